@@ -19,6 +19,7 @@ type ServerDescribeServer_Links struct {
 // ServerDescribeServer_Output is the output of a com.atproto.server.describeServer call.
 type ServerDescribeServer_Output struct {
 	AvailableUserDomains []string                    `json:"availableUserDomains" cborgen:"availableUserDomains"`
+	Did                  string                      `json:"did" cborgen:"did"`
 	InviteCodeRequired   *bool                       `json:"inviteCodeRequired,omitempty" cborgen:"inviteCodeRequired,omitempty"`
 	Links                *ServerDescribeServer_Links `json:"links,omitempty" cborgen:"links,omitempty"`
 }
@@ -8,6 +8,19 @@ import (
 	"github.com/bluesky-social/indigo/lex/util"
 )
 
+// SyncSubscribeRepos_Account is a "account" in the com.atproto.sync.subscribeRepos schema.
+//
+// Represents a change to an account's status on a host (eg, PDS or Relay). The semantics of this event are that the status is at the host which emitted the event, not necessarily that at the currently active PDS. Eg, a Relay takedown would emit a takedown with active=false, even if the PDS is still active.
+type SyncSubscribeRepos_Account struct {
+	// active: Indicates that the account has a repository which can be fetched from the host that emitted this event.
+	Active bool   `json:"active" cborgen:"active"`
+	Did    string `json:"did" cborgen:"did"`
+	Seq    int64  `json:"seq" cborgen:"seq"`
+	// status: If active=false, this optional field indicates a reason for why the account is not active.
+	Status *string `json:"status,omitempty" cborgen:"status,omitempty"`
+	Time   string  `json:"time" cborgen:"time"`
+}
+
 // SyncSubscribeRepos_Commit is a "commit" in the com.atproto.sync.subscribeRepos schema.
 type SyncSubscribeRepos_Commit struct {
 	Blobs []util.LexLink `json:"blobs" cborgen:"blobs"`
@@ -58,6 +71,22 @@ type SyncSubscribeRepos_RepoOp struct {
 	Path   string        `json:"path" cborgen:"path"`
 }
 
+// SyncSubscribeRepos_Sync is a "sync" in the com.atproto.sync.subscribeRepos schema.
+//
+// Updates the repo to a new state, without necessarily including that state on the firehose. Used to recover from broken commit streams, data loss incidents, or in situations where upstream host does not know recent state of the repository.
+type SyncSubscribeRepos_Sync struct {
+	// blocks: CAR file containing the commit, as a block. The CAR header must include the commit block CID as the first 'root'.
+	Blocks util.LexBytes `json:"blocks,omitempty" cborgen:"blocks"`
+	// did: The account this repo event corresponds to. Must match that in the commit object.
+	Did string `json:"did" cborgen:"did"`
+	// rev: The rev of the commit. This value must match that in the commit object.
+	Rev string `json:"rev" cborgen:"rev"`
+	// seq: The stream sequence number of this message.
+	Seq int64 `json:"seq" cborgen:"seq"`
+	// time: Timestamp of when this message was originally broadcast.
+	Time string `json:"time" cborgen:"time"`
+}
+
 // SyncSubscribeRepos_Tombstone is a "tombstone" in the com.atproto.sync.subscribeRepos schema.
 type SyncSubscribeRepos_Tombstone struct {
 	Did  string `json:"did" cborgen:"did"`
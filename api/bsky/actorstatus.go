@@ -0,0 +1,266 @@
+package bsky
+
+// schema: app.bsky.actor.status
+//
+// Written by hand after what lexgen produces for the schema: cbor-gen can't
+// encode optional integers, like durationMinutes, so the record's CBOR
+// methods are here rather than in cbor_gen.go.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/lex/util"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	util.RegisterType("app.bsky.actor.status", &ActorStatus{})
+} //
+// RECORDTYPE: ActorStatus
+type ActorStatus struct {
+	LexiconTypeID string `json:"$type,const=app.bsky.actor.status" cborgen:"$type,const=app.bsky.actor.status"`
+	CreatedAt     string `json:"createdAt" cborgen:"createdAt"`
+	// durationMinutes: The duration of the status in minutes. Applications can choose to impose minimum and maximum limits.
+	DurationMinutes *int64 `json:"durationMinutes,omitempty" cborgen:"durationMinutes,omitempty"`
+	// embed: An optional embed associated with the status.
+	Embed *ActorStatus_Embed `json:"embed,omitempty" cborgen:"embed,omitempty"`
+	// status: The status for the account.
+	Status string `json:"status" cborgen:"status"`
+}
+
+// An optional embed associated with the status.
+type ActorStatus_Embed struct {
+	EmbedExternal *EmbedExternal
+}
+
+func (t *ActorStatus_Embed) MarshalJSON() ([]byte, error) {
+	if t.EmbedExternal != nil {
+		t.EmbedExternal.LexiconTypeID = "app.bsky.embed.external"
+		return json.Marshal(t.EmbedExternal)
+	}
+	return nil, fmt.Errorf("cannot marshal empty enum")
+}
+func (t *ActorStatus_Embed) UnmarshalJSON(b []byte) error {
+	typ, err := util.TypeExtract(b)
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case "app.bsky.embed.external":
+		t.EmbedExternal = new(EmbedExternal)
+		return json.Unmarshal(b, t.EmbedExternal)
+
+	default:
+		return nil
+	}
+}
+
+func (t *ActorStatus_Embed) MarshalCBOR(w io.Writer) error {
+
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if t.EmbedExternal != nil {
+		return t.EmbedExternal.MarshalCBOR(w)
+	}
+	return fmt.Errorf("cannot cbor marshal empty enum")
+}
+func (t *ActorStatus_Embed) UnmarshalCBOR(r io.Reader) error {
+	typ, b, err := util.CborTypeExtractReader(r)
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case "app.bsky.embed.external":
+		t.EmbedExternal = new(EmbedExternal)
+		return t.EmbedExternal.UnmarshalCBOR(bytes.NewReader(b))
+
+	default:
+		return nil
+	}
+}
+
+func (t *ActorStatus) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+	fieldCount := 5
+
+	if t.Embed == nil {
+		fieldCount--
+	}
+
+	if t.DurationMinutes == nil {
+		fieldCount--
+	}
+
+	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
+		return err
+	}
+
+	// fields in DAG-CBOR key order: shortest first, then bytewise
+	if err := writeCborString(cw, "$type"); err != nil {
+		return err
+	}
+	if err := writeCborString(cw, "app.bsky.actor.status"); err != nil {
+		return err
+	}
+
+	if t.Embed != nil {
+		if err := writeCborString(cw, "embed"); err != nil {
+			return err
+		}
+		if err := t.Embed.MarshalCBOR(cw); err != nil {
+			return err
+		}
+	}
+
+	if err := writeCborString(cw, "status"); err != nil {
+		return err
+	}
+	if err := writeCborString(cw, t.Status); err != nil {
+		return err
+	}
+
+	if err := writeCborString(cw, "createdAt"); err != nil {
+		return err
+	}
+	if err := writeCborString(cw, t.CreatedAt); err != nil {
+		return err
+	}
+
+	if t.DurationMinutes != nil {
+		if err := writeCborString(cw, "durationMinutes"); err != nil {
+			return err
+		}
+
+		if v := *t.DurationMinutes; v >= 0 {
+			if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(v)); err != nil {
+				return err
+			}
+		} else {
+			if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-v-1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeCborString(cw *cbg.CborWriter, s string) error {
+	if len(s) > cbg.MaxLength {
+		return xerrors.Errorf("Value %q was too long", s)
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := cw.WriteString(s)
+	return err
+}
+
+func (t *ActorStatus) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = ActorStatus{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("ActorStatus: map struct too large (%d)", extra)
+	}
+
+	n := extra
+	for i := uint64(0); i < n; i++ {
+		name, err := cbg.ReadString(cr)
+		if err != nil {
+			return err
+		}
+
+		switch name {
+		case "$type":
+			if t.LexiconTypeID, err = cbg.ReadString(cr); err != nil {
+				return err
+			}
+		case "status":
+			if t.Status, err = cbg.ReadString(cr); err != nil {
+				return err
+			}
+		case "createdAt":
+			if t.CreatedAt, err = cbg.ReadString(cr); err != nil {
+				return err
+			}
+		case "embed":
+			b, err := cr.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b != cbg.CborNull[0] {
+				if err := cr.UnreadByte(); err != nil {
+					return err
+				}
+				t.Embed = new(ActorStatus_Embed)
+				if err := t.Embed.UnmarshalCBOR(cr); err != nil {
+					return xerrors.Errorf("unmarshaling t.Embed pointer: %w", err)
+				}
+			}
+		case "durationMinutes":
+			b, err := cr.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b == cbg.CborNull[0] {
+				continue
+			}
+			if err := cr.UnreadByte(); err != nil {
+				return err
+			}
+
+			maj, extra, err := cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+			v := int64(extra)
+			if v < 0 {
+				return fmt.Errorf("int64 overflow")
+			}
+			switch maj {
+			case cbg.MajUnsignedInt:
+			case cbg.MajNegativeInt:
+				v = -1 - v
+			default:
+				return fmt.Errorf("wrong type for int64 field: %d", maj)
+			}
+			t.DurationMinutes = &v
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package bsky
+
+import (
+	"bytes"
+	"testing"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestActorStatusCBOR(t *testing.T) {
+	duration := int64(90)
+	st := &ActorStatus{
+		LexiconTypeID:   "app.bsky.actor.status",
+		CreatedAt:       "2024-05-01T12:00:00.000Z",
+		Status:          "app.bsky.actor.status#live",
+		DurationMinutes: &duration,
+		Embed: &ActorStatus_Embed{EmbedExternal: &EmbedExternal{
+			LexiconTypeID: "app.bsky.embed.external",
+			External:      &EmbedExternal_External{Uri: "https://example.com/live", Title: "live", Description: "streaming now"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := st.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the record must already be in canonical DAG-CBOR form
+	nd, err := cbornode.Decode(buf.Bytes(), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nd.RawData(), buf.Bytes()) {
+		t.Fatal("expected canonical encoding")
+	}
+
+	var out ActorStatus
+	if err := out.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status != st.Status || out.CreatedAt != st.CreatedAt || out.DurationMinutes == nil || *out.DurationMinutes != duration {
+		t.Fatalf("unexpected round trip: %+v", out)
+	}
+	if out.Embed == nil || out.Embed.EmbedExternal == nil || out.Embed.EmbedExternal.External.Uri != "https://example.com/live" {
+		t.Fatalf("expected the embed to round trip, got %+v", out.Embed)
+	}
+
+	// and without the optional fields
+	buf.Reset()
+	if err := (&ActorStatus{CreatedAt: st.CreatedAt, Status: st.Status}).MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out = ActorStatus{}
+	if err := out.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if out.DurationMinutes != nil || out.Embed != nil {
+		t.Fatalf("expected no optional fields, got %+v", out)
+	}
+}
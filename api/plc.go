@@ -22,6 +22,17 @@ type PLCServer struct {
 	C    *http.Client
 }
 
+// PLCStatusError is returned by GetDocument when the PLC directory answers
+// with anything other than a 200.
+type PLCStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *PLCStatusError) Error() string {
+	return fmt.Sprintf("get did request failed (code %d): %s", e.StatusCode, e.Status)
+}
+
 func (s *PLCServer) GetDocument(ctx context.Context, didstr string) (*did.Document, error) {
 	ctx, span := otel.Tracer("gosky").Start(ctx, "plsResolveDid")
 	defer span.End()
@@ -43,7 +54,7 @@ func (s *PLCServer) GetDocument(ctx context.Context, didstr string) (*did.Docume
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("get did request failed (code %d): %s", resp.StatusCode, resp.Status)
+		return nil, &PLCStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	var doc did.Document
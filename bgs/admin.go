@@ -1,6 +1,7 @@
 package bgs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -151,9 +152,9 @@ func (bgs *BGS) handleListPDSs(e echo.Context) error {
 			MaxEventsPerSecond: p.CrawlRateLimit,
 		}
 
-		limiter = bgs.Index.GetLimiter(p.ID)
-		if limiter != nil {
-			crawlRate.TokenCount = limiter.Tokens()
+		crawlLimiter := bgs.Index.GetLimiter(p.ID)
+		if crawlLimiter != nil {
+			crawlRate.TokenCount = crawlLimiter.Tokens()
 		}
 
 		enrichedPDSs[i].CrawlRate = crawlRate
@@ -321,6 +322,84 @@ func (bgs *BGS) handleAdminUnbanDomain(c echo.Context) error {
 	})
 }
 
+type allowedDomains struct {
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+func (bgs *BGS) handleAdminListDomainAllows(c echo.Context) error {
+	var all []models.DomainAllow
+	if err := bgs.db.Find(&all).Error; err != nil {
+		return err
+	}
+
+	resp := allowedDomains{
+		AllowedDomains: []string{},
+	}
+	for _, a := range all {
+		resp.AllowedDomains = append(resp.AllowedDomains, a.Domain)
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (bgs *BGS) handleAdminAllowDomain(c echo.Context) error {
+	var body banDomainBody
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	var existing models.DomainAllow
+	if err := bgs.db.Where("domain = ?", body.Domain).First(&existing).Error; err == nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "domain is already allowed",
+		}
+	}
+
+	if err := bgs.db.Create(&models.DomainAllow{
+		Domain: body.Domain,
+	}).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminDisallowDomain(c echo.Context) error {
+	var body banDomainBody
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+
+	if err := bgs.db.Where("domain = ?", body.Domain).Delete(&models.DomainAllow{}).Error; err != nil {
+		return err
+	}
+
+	return c.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminSetAllowlistOnly(e echo.Context) error {
+	enabled, err := strconv.ParseBool(e.QueryParam("enabled"))
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+
+	return bgs.slurper.SetCrawlAllowlistOnly(enabled)
+}
+
+func (bgs *BGS) handleAdminGetAllowlistOnly(e echo.Context) error {
+	return e.JSON(200, map[string]bool{
+		"enabled": bgs.slurper.GetCrawlAllowlistOnly(),
+	})
+}
+
 func (bgs *BGS) handleAdminChangePDSRateLimit(e echo.Context) error {
 	host := strings.TrimSpace(e.QueryParam("host"))
 	if host == "" {
@@ -499,6 +578,106 @@ func (bgs *BGS) handleAdminGetResyncPDS(e echo.Context) error {
 	})
 }
 
+func (bgs *BGS) handleAdminPostRecrawlPDS(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return fmt.Errorf("must pass a host")
+	}
+
+	var pds models.PDS
+	if err := bgs.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	if bgs.Index.GetRecrawlProgress(pds.ID) != nil {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: "recrawl already in progress for given PDS",
+		}
+	}
+
+	go func() {
+		if err := bgs.Index.RecrawlPDS(context.Background(), pds.ID); err != nil {
+			log.Errorw("failed to recrawl PDS", "err", err, "pds", pds.Host)
+		}
+	}()
+
+	return e.JSON(200, map[string]any{
+		"message": "recrawl started...",
+	})
+}
+
+func (bgs *BGS) handleAdminGetRecrawlPDS(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return fmt.Errorf("must pass a host")
+	}
+
+	var pds models.PDS
+	if err := bgs.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	prog := bgs.Index.GetRecrawlProgress(pds.ID)
+	if prog == nil {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no recrawl found for given PDS",
+		}
+	}
+
+	return e.JSON(200, map[string]any{
+		"recrawl": prog,
+	})
+}
+
+func (bgs *BGS) handleAdminPostTakedownPDS(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return fmt.Errorf("must pass a host")
+	}
+
+	var pds models.PDS
+	if err := bgs.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	go func() {
+		ctx := context.Background()
+		if err := bgs.TakedownPDS(ctx, pds.ID); err != nil {
+			log.Errorw("failed to take down PDS", "err", err, "pds", pds.Host)
+		}
+	}()
+
+	return e.JSON(200, map[string]any{
+		"message": "takedown started...",
+	})
+}
+
+func (bgs *BGS) handleAdminGetTakedownPDS(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return fmt.Errorf("must pass a host")
+	}
+
+	var pds models.PDS
+	if err := bgs.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	takedown, found := bgs.GetPDSTakedown(pds.ID)
+	if !found {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no takedown found for given PDS",
+		}
+	}
+
+	return e.JSON(200, map[string]any{
+		"takedown": takedown,
+	})
+}
+
 func (bgs *BGS) handleAdminResetRepo(e echo.Context) error {
 	ctx := e.Request().Context()
 
@@ -524,3 +703,158 @@ func (bgs *BGS) handleAdminResetRepo(e echo.Context) error {
 		"success": true,
 	})
 }
+
+func (bgs *BGS) handleAdminRecrawlRepo(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	did := e.QueryParam("did")
+	if did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a did",
+		}
+	}
+
+	if bgs.Index.Crawler == nil {
+		return &echo.HTTPError{
+			Code:    http.StatusServiceUnavailable,
+			Message: "crawling is not enabled on this server",
+		}
+	}
+
+	ai, err := bgs.Index.LookupUserByDid(ctx, did)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// unknown users get created, which sends them off for an initial crawl
+		if _, err := bgs.Index.GetUserOrMissing(ctx, did); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		return e.JSON(http.StatusAccepted, map[string]any{
+			"success": true,
+		})
+	}
+
+	if err := bgs.Index.Crawler.CrawlFull(ctx, ai); err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusAccepted, map[string]any{
+		"success": true,
+	})
+}
+
+func (bgs *BGS) handleAdminGetRepoStatus(e echo.Context) error {
+	did := e.QueryParam("did")
+	if did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a did",
+		}
+	}
+
+	st, err := bgs.Index.GetIndexingStatus(e.Request().Context(), did)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(200, st)
+}
+
+const (
+	defaultExportLimit = 100_000
+	maxExportLimit     = 1_000_000
+)
+
+// handleAdminExportParquet serves one chunk of an indexer table as a Parquet
+// file. The cursor for the next chunk comes back in the X-Export-Cursor
+// header, which is missing once the table has been exported in full.
+func (bgs *BGS) handleAdminExportParquet(e echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(e.Request().Context(), "adminExportParquet")
+	defer span.End()
+
+	table := e.QueryParam("table")
+	if table == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a table",
+		}
+	}
+
+	var since time.Time
+	if s := e.QueryParam("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: fmt.Sprintf("invalid since: %s", err),
+			}
+		}
+		since = t
+	}
+
+	lim := defaultExportLimit
+	if limstr := e.QueryParam("limit"); limstr != "" {
+		v, err := strconv.Atoi(limstr)
+		if err != nil {
+			return err
+		}
+
+		lim = v
+	}
+	if lim <= 0 || lim > maxExportLimit {
+		lim = maxExportLimit
+	}
+
+	// the file is only complete once its footer is written, so build it
+	// before sending anything
+	var buf bytes.Buffer
+	next, err := bgs.Index.ExportParquet(ctx, table, since, e.QueryParam("cursor"), lim, &buf)
+	if err != nil {
+		return fmt.Errorf("exporting %s: %w", table, err)
+	}
+
+	if next != "" {
+		e.Response().Header().Set("X-Export-Cursor", next)
+	}
+	return e.Blob(200, "application/vnd.apache.parquet", buf.Bytes())
+}
+
+func (bgs *BGS) handleAdminPostRebuildHandleIndex(e echo.Context) error {
+	if bgs.Index.GetHandleRebuildProgress() != nil {
+		return &echo.HTTPError{
+			Code:    409,
+			Message: "handle index rebuild already in progress",
+		}
+	}
+
+	go func() {
+		ctx, span := otel.Tracer("bgs").Start(context.Background(), "adminRebuildHandleIndex")
+		defer span.End()
+
+		if _, err := bgs.Index.RebuildHandleIndex(ctx); err != nil {
+			log.Errorw("failed to rebuild handle index", "err", err)
+		}
+	}()
+
+	return e.JSON(200, map[string]any{
+		"message": "handle index rebuild started...",
+	})
+}
+
+func (bgs *BGS) handleAdminGetRebuildHandleIndex(e echo.Context) error {
+	prog := bgs.Index.GetHandleRebuildProgress()
+	if prog == nil {
+		return &echo.HTTPError{
+			Code:    404,
+			Message: "no handle index rebuild in progress",
+		}
+	}
+
+	return e.JSON(200, map[string]any{
+		"rebuild": prog,
+	})
+}
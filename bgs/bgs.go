@@ -32,6 +32,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/gorilla/websocket"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
@@ -83,6 +84,98 @@ type BGS struct {
 	// Management of Resyncs
 	pdsResyncsLk sync.RWMutex
 	pdsResyncs   map[uint]*PDSResync
+
+	// Management of PDS takedowns
+	pdsTakedownsLk sync.RWMutex
+	pdsTakedowns   map[uint]*PDSTakedown
+
+	// Limits concurrent getRepo exports; nil means unlimited
+	repoExportSem chan struct{}
+
+	// getRepo requests more than this many commits behind get the full repo
+	// instead of a diff; zero means no limit
+	maxGetRepoDiffCommits int64
+
+	// Fetch blobs missing from the blob store from the user's PDS
+	blobProxy        bool
+	blobProxyMaxSize int64
+
+	// Base URL of the labeler whose labels queryLabels serves; empty
+	// disables it
+	labelSource string
+
+	// Upper bound on the page size of listRepos
+	listReposMaxLimit int
+
+	// Reject crawl requests from hosts with incomplete describeServer responses
+	verifyPDSDescribe bool
+
+	// Block codecs subscribers may ask for with ?compress=, and the
+	// compressed blocks of recent events shared between them
+	firehoseCodecs   map[string]events.BlockCodec
+	compressedBlocks *lru.Cache[compressedBlocksKey, []byte]
+
+	// Record refs of recent events for subscribers asking with ?records=,
+	// nil unless enabled
+	recordRefs *lru.Cache[int64, []events.RecordRef]
+}
+
+const defaultListReposLimit = 500
+
+// SetListReposMaxLimit caps the number of repos returned by a single
+// listRepos call, regardless of the limit the client asks for.
+func (bgs *BGS) SetListReposMaxLimit(n int) {
+	if n <= 0 {
+		n = defaultListReposLimit
+	}
+	bgs.listReposMaxLimit = n
+}
+
+// SetVerifyPDSDescribe makes requestCrawl reject hosts whose describeServer
+// response lacks a valid DID or their list of user domains.
+func (bgs *BGS) SetVerifyPDSDescribe(v bool) {
+	bgs.verifyPDSDescribe = v
+}
+
+// SetMaxGetRepoDiffCommits makes getRepo return the full repo, flagged as a
+// reset, when the requested since rev is more than n commits behind rather
+// than building a huge diff. Zero disables the check.
+func (bgs *BGS) SetMaxGetRepoDiffCommits(n int64) {
+	bgs.maxGetRepoDiffCommits = n
+}
+
+// SetMaxConcurrentRepoExports caps how many getRepo requests are served at
+// once. Requests over the cap are rejected with a 503. Zero disables the cap.
+func (bgs *BGS) SetMaxConcurrentRepoExports(n int) {
+	if n <= 0 {
+		bgs.repoExportSem = nil
+		return
+	}
+	bgs.repoExportSem = make(chan struct{}, n)
+}
+
+// tryAcquireRepoExport reserves a repo export slot without blocking, returning
+// false if all slots are in use
+func (bgs *BGS) tryAcquireRepoExport() bool {
+	if bgs.repoExportSem == nil {
+		repoExportsInFlight.Inc()
+		return true
+	}
+	select {
+	case bgs.repoExportSem <- struct{}{}:
+		repoExportsInFlight.Inc()
+		return true
+	default:
+		repoExportsRejected.Inc()
+		return false
+	}
+}
+
+func (bgs *BGS) releaseRepoExport() {
+	repoExportsInFlight.Dec()
+	if bgs.repoExportSem != nil {
+		<-bgs.repoExportSem
+	}
 }
 
 type PDSResync struct {
@@ -107,6 +200,7 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 	db.AutoMigrate(AuthToken{})
 	db.AutoMigrate(models.PDS{})
 	db.AutoMigrate(models.DomainBan{})
+	db.AutoMigrate(models.DomainAllow{})
 
 	bgs := &BGS{
 		Index: ix,
@@ -122,10 +216,15 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 		consumersLk: sync.RWMutex{},
 		consumers:   make(map[uint64]*SocketConsumer),
 
-		pdsResyncs: make(map[uint]*PDSResync),
+		pdsResyncs:   make(map[uint]*PDSResync),
+		pdsTakedowns: make(map[uint]*PDSTakedown),
+
+		listReposMaxLimit: defaultListReposLimit,
 	}
 
 	ix.CreateExternalUser = bgs.createExternalUser
+	ix.SyncProfileBlobs = bgs.syncProfileBlobs
+	ix.UserTombstoned = bgs.userTombstoned
 	slOpts := DefaultSlurperOptions()
 	slOpts.SSL = ssl
 	s, err := NewSlurper(db, bgs.handleFedEvent, slOpts)
@@ -305,8 +404,10 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	e.GET("/xrpc/com.atproto.sync.requestCrawl", bgs.HandleComAtprotoSyncRequestCrawl)
 	e.POST("/xrpc/com.atproto.sync.requestCrawl", bgs.HandleComAtprotoSyncRequestCrawl)
 	e.GET("/xrpc/com.atproto.sync.listRepos", bgs.HandleComAtprotoSyncListRepos)
+	e.GET("/xrpc/com.atproto.sync.listRecords", bgs.HandleListRecords)
 	e.GET("/xrpc/com.atproto.sync.getLatestCommit", bgs.HandleComAtprotoSyncGetLatestCommit)
 	e.GET("/xrpc/com.atproto.sync.notifyOfUpdate", bgs.HandleComAtprotoSyncNotifyOfUpdate)
+	e.GET("/xrpc/com.atproto.label.queryLabels", bgs.HandleQueryLabels)
 	e.GET("/xrpc/_health", bgs.HandleHealthCheck)
 
 	promh := prometheusHandler()
@@ -327,6 +428,11 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	admin.GET("/subs/listDomainBans", bgs.handleAdminListDomainBans)
 	admin.POST("/subs/banDomain", bgs.handleAdminBanDomain)
 	admin.POST("/subs/unbanDomain", bgs.handleAdminUnbanDomain)
+	admin.GET("/subs/listDomainAllows", bgs.handleAdminListDomainAllows)
+	admin.POST("/subs/allowDomain", bgs.handleAdminAllowDomain)
+	admin.POST("/subs/disallowDomain", bgs.handleAdminDisallowDomain)
+	admin.GET("/subs/getAllowlistOnly", bgs.handleAdminGetAllowlistOnly)
+	admin.POST("/subs/setAllowlistOnly", bgs.handleAdminSetAllowlistOnly)
 
 	// Repo-related Admin API
 	admin.POST("/repo/takeDown", bgs.handleAdminTakeDownRepo)
@@ -334,11 +440,20 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	admin.POST("/repo/compact", bgs.handleAdminCompactRepo)
 	admin.POST("/repo/compactAll", bgs.handleAdminCompactAllRepos)
 	admin.POST("/repo/reset", bgs.handleAdminResetRepo)
+	admin.POST("/repo/recrawl", bgs.handleAdminRecrawlRepo)
+	admin.GET("/repo/status", bgs.handleAdminGetRepoStatus)
+	admin.GET("/repo/latestCommits", bgs.handleAdminGetLatestCommits)
+	admin.POST("/repo/rebuildHandleIndex", bgs.handleAdminPostRebuildHandleIndex)
+	admin.GET("/repo/rebuildHandleIndex", bgs.handleAdminGetRebuildHandleIndex)
 
 	// PDS-related Admin API
 	admin.GET("/pds/list", bgs.handleListPDSs)
 	admin.POST("/pds/resync", bgs.handleAdminPostResyncPDS)
 	admin.GET("/pds/resync", bgs.handleAdminGetResyncPDS)
+	admin.POST("/pds/recrawl", bgs.handleAdminPostRecrawlPDS)
+	admin.GET("/pds/recrawl", bgs.handleAdminGetRecrawlPDS)
+	admin.POST("/pds/takedown", bgs.handleAdminPostTakedownPDS)
+	admin.GET("/pds/takedown", bgs.handleAdminGetTakedownPDS)
 	admin.POST("/pds/changeIngestRateLimit", bgs.handleAdminChangePDSRateLimit)
 	admin.POST("/pds/changeCrawlRateLimit", bgs.handleAdminChangePDSCrawlLimit)
 	admin.POST("/pds/block", bgs.handleBlockPDS)
@@ -347,6 +462,9 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	// Consumer-related Admin API
 	admin.GET("/consumers/list", bgs.handleAdminListConsumers)
 
+	// Indexer-related Admin API
+	admin.GET("/export/parquet", bgs.handleAdminExportParquet)
+
 	// In order to support booting on random ports in tests, we need to tell the
 	// Echo instance it's already got a port, and then use its StartServer
 	// method to re-use that listener.
@@ -358,6 +476,11 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 func (bgs *BGS) Shutdown() []error {
 	errs := bgs.slurper.Shutdown()
 
+	// with the upstream connections gone, the crawl queue is no longer growing
+	if err := bgs.Index.SaveCrawlQueue(context.TODO()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save crawl queue: %w", err))
+	}
+
 	if err := bgs.events.Shutdown(context.TODO()); err != nil {
 		errs = append(errs, err)
 	}
@@ -447,8 +570,8 @@ type User struct {
 	DeletedAt   gorm.DeletedAt `gorm:"index"`
 	Handle      sql.NullString `gorm:"uniqueIndex"`
 	Did         string         `gorm:"uniqueIndex"`
-	PDS         uint
-	ValidHandle bool `gorm:"default:true"`
+	PDS         uint           `gorm:"index"`
+	ValidHandle bool           `gorm:"default:true"`
 
 	// TakenDown is set to true if the user in question has been taken down.
 	// A user in this state will have all future events related to it dropped
@@ -457,6 +580,15 @@ type User struct {
 	Tombstoned bool
 }
 
+func (bgs *BGS) userTombstoned(ctx context.Context, uid models.Uid) (bool, error) {
+	var u User
+	if err := bgs.db.Select("tombstoned").Limit(1).Find(&u, "id = ?", uid).Error; err != nil {
+		return false, err
+	}
+
+	return u.Tombstoned, nil
+}
+
 type addTargetBody struct {
 	Host string `json:"host"`
 }
@@ -503,6 +635,10 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 		since = &sval
 	}
 
+	// nil unless the subscriber asked for a codec we offer
+	codec := bgs.firehoseCodecs[c.QueryParam("compress")]
+	withRecords := bgs.recordRefs != nil && c.QueryParam("records") == "true"
+
 	ctx, cancel := context.WithCancel(c.Request().Context())
 	defer cancel()
 
@@ -604,6 +740,8 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 			}
 
 			var obj lexutil.CBOR
+			header.Codec = ""
+			header.Records = nil
 
 			switch {
 			case evt.Error != nil:
@@ -612,6 +750,33 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 			case evt.RepoCommit != nil:
 				header.MsgType = "#commit"
 				obj = evt.RepoCommit
+
+				if withRecords && len(evt.RepoCommit.Blocks) > 0 {
+					refs, err := bgs.commitRecordRefs(evt)
+					if err != nil {
+						log.Warnw("failed to find records in event blocks, sending without them", "err", err, "repo", evt.RepoCommit.Repo)
+					} else {
+						header.Records = refs
+					}
+				}
+
+				if codec != nil && len(evt.RepoCommit.Blocks) > 0 {
+					blks, err := bgs.compressBlocks(evt, codec)
+					if err != nil {
+						log.Warnw("failed to compress event blocks, sending uncompressed", "err", err, "codec", codec.Name())
+					} else {
+						cc := *evt.RepoCommit
+						cc.Blocks = blks
+						obj = &cc
+						header.Codec = codec.Name()
+					}
+				}
+			case evt.RepoSync != nil:
+				header.MsgType = "#sync"
+				obj = evt.RepoSync
+			case evt.RepoAccount != nil:
+				header.MsgType = "#account"
+				obj = evt.RepoAccount
 			case evt.RepoHandle != nil:
 				header.MsgType = "#handle"
 				obj = evt.RepoHandle
@@ -669,10 +834,9 @@ func prometheusHandler() http.Handler {
 	return exporter
 }
 
-// domainIsBanned checks if the given host is banned, starting with the host
-// itself, then checking every parent domain up to the tld
-func (s *BGS) domainIsBanned(ctx context.Context, host string) (bool, error) {
-	// ignore ports when checking for ban status
+// domainSuffixes returns the given host and each of its parent domains (down
+// to, but not including, the TLD), ignoring any port.
+func domainSuffixes(host string) []string {
 	hostport := strings.Split(host, ":")
 
 	segments := strings.Split(hostport[0], ".")
@@ -689,8 +853,17 @@ func (s *BGS) domainIsBanned(ctx context.Context, host string) (bool, error) {
 	}
 	segments = cleaned
 
+	var out []string
 	for i := 0; i < len(segments)-1; i++ {
-		dchk := strings.Join(segments[i:], ".")
+		out = append(out, strings.Join(segments[i:], "."))
+	}
+	return out
+}
+
+// domainIsBanned checks if the given host is banned, starting with the host
+// itself, then checking every parent domain up to the tld
+func (s *BGS) domainIsBanned(ctx context.Context, host string) (bool, error) {
+	for _, dchk := range domainSuffixes(host) {
 		found, err := s.findDomainBan(ctx, dchk)
 		if err != nil {
 			return false, err
@@ -703,6 +876,26 @@ func (s *BGS) domainIsBanned(ctx context.Context, host string) (bool, error) {
 	return false, nil
 }
 
+// domainIsAllowed checks the given host against the crawl allowlist. When
+// allowlist-only mode is off, every host is allowed.
+func (s *BGS) domainIsAllowed(ctx context.Context, host string) (bool, error) {
+	if !s.slurper.GetCrawlAllowlistOnly() {
+		return true, nil
+	}
+
+	for _, dchk := range domainSuffixes(host) {
+		var da models.DomainAllow
+		if err := s.db.Find(&da, "domain = ?", dchk).Error; err != nil {
+			return false, err
+		}
+
+		if da.ID != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (s *BGS) findDomainBan(ctx context.Context, host string) (bool, error) {
 	var db models.DomainBan
 	if err := s.db.Find(&db, "domain = ?", host).Error; err != nil {
@@ -744,6 +937,8 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 	ctx, span := otel.Tracer("bgs").Start(ctx, "handleFedEvent")
 	defer span.End()
 
+	ctx = indexer.WithPrimaryReads(ctx)
+
 	eventsReceivedCounter.WithLabelValues(host.Host).Add(1)
 
 	switch {
@@ -794,6 +989,9 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 			if err := bgs.db.Model(&User{}).Where("id = ?", u.ID).UpdateColumn("tombstoned", false).Error; err != nil {
 				return fmt.Errorf("failed to un-tombstone a user: %w", err)
 			}
+			if err := bgs.db.Model(&models.ActorInfo{}).Where("uid = ?", u.ID).UpdateColumn("tombstoned", false).Error; err != nil {
+				return fmt.Errorf("failed to un-tombstone a user: %w", err)
+			}
 
 			ai, err := bgs.Index.LookupUser(ctx, u.ID)
 			if err != nil {
@@ -823,9 +1021,14 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 			return bgs.Index.Crawler.AddToCatchupQueue(ctx, host, ai, evt)
 		}
 
-		if err := bgs.repoman.HandleExternalUserEvent(ctx, host.ID, u.ID, u.Did, evt.Since, evt.Rev, evt.Blocks, evt.Ops); err != nil {
+		if err := bgs.repoman.HandleExternalUserEvent(ctx, host.ID, u.ID, u.Did, evt.Since, evt.Rev, evt.Time, evt.Blocks, evt.Ops); err != nil {
 			log.Warnw("failed handling event", "err", err, "host", host.Host, "seq", evt.Seq, "repo", u.Did, "prev", stringLink(evt.Prev), "commit", evt.Commit.String())
 
+			if errors.Is(err, repomgr.ErrRevNotAdvanced) {
+				// a replayed or stale commit, we already hold something newer
+				return nil
+			}
+
 			if errors.Is(err, carstore.ErrRepoBaseMismatch) || ipld.IsNotFound(err) {
 				ai, lerr := bgs.Index.LookupUser(ctx, u.ID)
 				if lerr != nil {
@@ -895,6 +1098,8 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 		}
 
 		return nil
+	case env.RepoAccount != nil:
+		return bgs.handleRepoAccount(ctx, host, env.RepoAccount)
 	default:
 		return fmt.Errorf("invalid fed event")
 	}
@@ -918,20 +1123,90 @@ func (bgs *BGS) handleRepoTombstone(ctx context.Context, pds *models.PDS, evt *a
 	}
 
 	if err := bgs.db.Model(&models.ActorInfo{}).Where("uid = ?", u.ID).UpdateColumns(map[string]any{
-		"handle": nil,
+		"tombstoned": true,
+		"handle":     nil,
 	}).Error; err != nil {
 		return err
 	}
 
+	// don't bother finishing a crawl of a repo we're about to delete
+	if bgs.Index.Crawler != nil {
+		bgs.Index.Crawler.CancelCrawl(u.ID)
+	}
+
 	// delete data from carstore
 	if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
 		// don't let a failure here prevent us from propagating this event
 		log.Errorf("failed to delete user data from carstore: %s", err)
 	}
 
-	return bgs.events.AddEvent(ctx, &events.XRPCStreamEvent{
+	if err := bgs.events.AddEvent(ctx, &events.XRPCStreamEvent{
 		RepoTombstone: evt,
-	})
+	}); err != nil {
+		return err
+	}
+
+	return bgs.Index.SendAccountEvent(ctx, evt.Did, false, indexer.AccountStatusDeleted)
+}
+
+func (bgs *BGS) handleRepoAccount(ctx context.Context, pds *models.PDS, evt *atproto.SyncSubscribeRepos_Account) error {
+	u, err := bgs.lookupUserByDid(ctx, evt.Did)
+	if err != nil {
+		return err
+	}
+
+	if u.PDS != pds.ID {
+		return fmt.Errorf("unauthoritative account event from %s for %s", pds.Host, evt.Did)
+	}
+
+	// our own takedown wins over whatever the PDS thinks of the account
+	if u.TakenDown {
+		return nil
+	}
+
+	var status string
+	if evt.Status != nil {
+		status = *evt.Status
+	}
+
+	return bgs.Index.SendAccountEvent(ctx, evt.Did, evt.Active, status)
+}
+
+// syncProfileBlobs makes sure the avatar and banner blobs referenced by a
+// user's profile are in our blob store, fetching any we don't have yet.
+func (s *BGS) syncProfileBlobs(ctx context.Context, user models.Uid, blobs []string) error {
+	if s.blobs == nil {
+		return nil
+	}
+
+	did, err := s.Index.DidForUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, b := range blobs {
+		if _, err := s.blobs.GetBlob(ctx, b, did); err == nil {
+			continue
+		}
+		missing = append(missing, b)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	u, err := s.lookupUserByDid(ctx, did)
+	if err != nil {
+		return err
+	}
+
+	var pds models.PDS
+	if err := s.db.First(&pds, "id = ?", u.PDS).Error; err != nil {
+		return fmt.Errorf("finding pds for user: %w", err)
+	}
+
+	return s.syncUserBlobs(ctx, &pds, user, missing)
 }
 
 func (s *BGS) syncUserBlobs(ctx context.Context, pds *models.PDS, user models.Uid, blobs []string) error {
@@ -966,11 +1241,16 @@ func (s *BGS) createExternalUser(ctx context.Context, did string) (*models.Actor
 	ctx, span := otel.Tracer("bgs").Start(ctx, "createExternalUser")
 	defer span.End()
 
+	ctx = indexer.WithPrimaryReads(ctx)
+
 	externalUserCreationAttempts.Inc()
 
 	log.Infof("create external user: %s", did)
 	doc, err := s.didr.GetDocument(ctx, did)
 	if err != nil {
+		if indexer.IsResolverFailure(did, err) {
+			return nil, fmt.Errorf("could not locate DID document for followed user (%s): %w: %w", did, indexer.ErrDidResolution, err)
+		}
 		return nil, fmt.Errorf("could not locate DID document for followed user (%s): %w", did, err)
 	}
 
@@ -1005,7 +1285,16 @@ func (s *BGS) createExternalUser(ctx context.Context, did string) (*models.Actor
 	}
 
 	if ban {
-		return nil, fmt.Errorf("cannot create user on pds with banned domain")
+		return nil, fmt.Errorf("cannot create user on pds with banned domain (%s): %w", durl.Host, indexer.ErrBannedDomain)
+	}
+
+	allowed, err := s.domainIsAllowed(ctx, durl.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pds allowlist status: %w", err)
+	}
+
+	if !allowed {
+		return nil, fmt.Errorf("cannot create user on pds that is not on the crawl allowlist")
 	}
 
 	c := &xrpc.Client{Host: durl.String()}
@@ -1168,10 +1457,14 @@ func (bgs *BGS) TakeDownRepo(ctx context.Context, did string) error {
 		return err
 	}
 
-	if err := bgs.db.Model(User{}).Where("id = ?", u.ID).Update("taken_down", true).Error; err != nil {
-		return err
-	}
+	return bgs.takeDownUser(ctx, u)
+}
 
+// takeDownUser wipes the user's repo and events and announces the takedown.
+// The user is only flagged as taken down once all of that is done, so that
+// a takedown that fails partway is picked up again by TakedownPDS, which
+// skips flagged users.
+func (bgs *BGS) takeDownUser(ctx context.Context, u *User) error {
 	if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
 		return err
 	}
@@ -1180,7 +1473,15 @@ func (bgs *BGS) TakeDownRepo(ctx context.Context, did string) error {
 		return err
 	}
 
-	return nil
+	if err := bgs.Index.SetActorTakenDown(ctx, u.ID, true); err != nil {
+		return err
+	}
+
+	if err := bgs.Index.SendAccountEvent(ctx, u.Did, false, indexer.AccountStatusTakendown); err != nil {
+		return err
+	}
+
+	return bgs.db.Model(User{}).Where("id = ?", u.ID).Update("taken_down", true).Error
 }
 
 func (bgs *BGS) ReverseTakedown(ctx context.Context, did string) error {
@@ -1193,7 +1494,11 @@ func (bgs *BGS) ReverseTakedown(ctx context.Context, did string) error {
 		return err
 	}
 
-	return nil
+	if err := bgs.Index.SetActorTakenDown(ctx, u.ID, false); err != nil {
+		return err
+	}
+
+	return bgs.Index.SendAccountEvent(ctx, did, true, "")
 }
 
 type compactionStats struct {
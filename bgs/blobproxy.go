@@ -0,0 +1,177 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	mh "github.com/multiformats/go-multihash"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// blobProxyHeader is set on upstream getBlob requests made by the blob proxy.
+// Requests carrying it are never proxied again, so two relays pointed at each
+// other can't bounce a request back and forth.
+const blobProxyHeader = "X-Bgs-Blob-Proxy"
+
+var blobProxyClient = &http.Client{Timeout: time.Minute}
+
+// SetBlobProxy enables fetching blobs from the user's PDS when they aren't in
+// the local blob store (or there is no blob store). Blobs larger than maxSize
+// bytes are rejected. Proxied blobs are cached if a blob store is configured.
+func (bgs *BGS) SetBlobProxy(enabled bool, maxSize int64) {
+	bgs.blobProxy = enabled
+	bgs.blobProxyMaxSize = maxSize
+}
+
+// proxyBlob fetches a blob from the user's PDS, checking it against its cid.
+// The returned reader has to be closed.
+func (s *BGS) proxyBlob(ctx context.Context, cidStr string, did string) (io.ReadCloser, error) {
+	ctx, span := otel.Tracer("bgs").Start(ctx, "proxyBlob")
+	defer span.End()
+
+	bcid, err := cid.Decode(cidStr)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid cid")
+	}
+
+	hasher, err := mh.GetHasher(bcid.Prefix().MhType)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "unsupported blob hash")
+	}
+
+	u, err := s.lookupUserByDid(ctx, did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return nil, err
+	}
+
+	if u.Tombstoned || u.TakenDown {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "blob not found")
+	}
+
+	var pds models.PDS
+	if err := s.db.First(&pds, "id = ?", u.PDS).Error; err != nil {
+		return nil, fmt.Errorf("failed to find pds for user: %w", err)
+	}
+
+	if pds.Blocked {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "blob not found")
+	}
+
+	c := models.ClientForPds(&pds)
+	params := url.Values{}
+	params.Set("cid", cidStr)
+	params.Set("did", did)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.Host+"/xrpc/com.atproto.sync.getBlob?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(blobProxyHeader, "1")
+
+	resp, err := blobProxyClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching blob from pds: %w", err)
+	}
+
+	body := &verifiedBody{
+		body:      resp.Body,
+		remaining: s.blobProxyMaxSize,
+		hasher:    hasher,
+		cid:       bcid,
+	}
+
+	// without a blob store there is nothing to cache, so just stream it
+	// through and leave closing the body to the caller
+	streaming := false
+	defer func() {
+		if !streaming {
+			resp.Body.Close()
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "blob not found")
+		}
+		return nil, fmt.Errorf("pds returned status %d for blob", resp.StatusCode)
+	}
+
+	if resp.ContentLength > s.blobProxyMaxSize {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "blob too large")
+	}
+
+	if s.blobs == nil {
+		streaming = true
+		return body, nil
+	}
+
+	blob, err := io.ReadAll(body)
+	if err != nil {
+		if errors.Is(err, errBlobTooLarge) {
+			return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "blob too large")
+		}
+		if errors.Is(err, errBlobMismatch) {
+			return nil, echo.NewHTTPError(http.StatusBadGateway, "blob from pds did not match its cid")
+		}
+		return nil, fmt.Errorf("reading blob from pds: %w", err)
+	}
+
+	if err := s.blobs.PutBlob(ctx, cidStr, did, blob); err != nil {
+		log.Warnw("failed to cache proxied blob", "did", did, "cid", cidStr, "err", err)
+	}
+
+	return io.NopCloser(bytes.NewReader(blob)), nil
+}
+
+var (
+	errBlobTooLarge = errors.New("blob exceeded maximum proxy size")
+	errBlobMismatch = errors.New("blob does not match its cid")
+)
+
+// verifiedBody reads from an upstream response body, failing once more than
+// the allowed number of bytes have been read, or at the end if the bytes
+// don't hash to the blob's cid.
+type verifiedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	hasher    hash.Hash
+	cid       cid.Cid
+}
+
+func (vb *verifiedBody) Read(p []byte) (int, error) {
+	n, err := vb.body.Read(p)
+	vb.remaining -= int64(n)
+	if vb.remaining < 0 {
+		return n, errBlobTooLarge
+	}
+	vb.hasher.Write(p[:n])
+
+	if err == io.EOF {
+		sum, merr := mh.Encode(vb.hasher.Sum(nil), vb.cid.Prefix().MhType)
+		if merr != nil {
+			return n, merr
+		}
+		if !bytes.Equal(sum, vb.cid.Hash()) {
+			return n, errBlobMismatch
+		}
+	}
+	return n, err
+}
+
+func (vb *verifiedBody) Close() error {
+	return vb.body.Close()
+}
@@ -0,0 +1,202 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/ipfs/go-cid"
+	"github.com/labstack/echo/v4"
+	mh "github.com/multiformats/go-multihash"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type memBlobStore map[string][]byte
+
+func (m memBlobStore) PutBlob(ctx context.Context, cid string, did string, blob []byte) error {
+	m[did+"/"+cid] = blob
+	return nil
+}
+
+func (m memBlobStore) GetBlob(ctx context.Context, cid string, did string) ([]byte, error) {
+	b, ok := m[did+"/"+cid]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return b, nil
+}
+
+// testBlobProxy sets up a relay knowing did:plc:alice, whose PDS answers
+// every getBlob request with served.
+func testBlobProxy(t *testing.T, served []byte) (*BGS, *int) {
+	t.Helper()
+
+	requests := 0
+	pds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(served)
+	}))
+	t.Cleanup(pds.Close)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(User{}, models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(pds.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := models.PDS{Host: u.Host}
+	if err := db.Create(&host).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&User{ID: 1, Did: "did:plc:alice", PDS: host.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := &BGS{db: db}
+	s.SetBlobProxy(true, 1024)
+	return s, &requests
+}
+
+func blobCid(t *testing.T, blob []byte) string {
+	t.Helper()
+
+	c, err := cid.NewPrefixV1(cid.Raw, mh.SHA2_256).Sum(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.String()
+}
+
+func httpCode(err error) int {
+	var herr *echo.HTTPError
+	if errors.As(err, &herr) {
+		return herr.Code
+	}
+	return 0
+}
+
+func TestBlobProxyStreams(t *testing.T) {
+	ctx := context.Background()
+	blob := []byte("hello blob")
+
+	s, _ := testBlobProxy(t, blob)
+
+	r, err := s.handleComAtprotoSyncGetBlob(ctx, blobCid(t, blob), "did:plc:alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.(io.Closer).Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(blob) {
+		t.Fatalf("expected %q, got %q", blob, got)
+	}
+}
+
+func TestBlobProxyStreamVerifiesCid(t *testing.T) {
+	ctx := context.Background()
+
+	s, _ := testBlobProxy(t, []byte("not the blob"))
+
+	r, err := s.handleComAtprotoSyncGetBlob(ctx, blobCid(t, []byte("hello blob")), "did:plc:alice", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.(io.Closer).Close()
+
+	if _, err := io.ReadAll(r); !errors.Is(err, errBlobMismatch) {
+		t.Fatalf("expected the stream to fail on a cid mismatch, got %v", err)
+	}
+}
+
+func TestBlobProxyCaches(t *testing.T) {
+	ctx := context.Background()
+	blob := []byte("hello blob")
+	bcid := blobCid(t, blob)
+
+	s, requests := testBlobProxy(t, blob)
+	store := memBlobStore{}
+	s.blobs = store
+
+	for i := 0; i < 2; i++ {
+		r, err := s.handleComAtprotoSyncGetBlob(ctx, bcid, "did:plc:alice", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(blob) {
+			t.Fatalf("expected %q, got %q", blob, got)
+		}
+	}
+
+	if *requests != 1 {
+		t.Fatalf("expected the second fetch to come from the blob store, got %d pds requests", *requests)
+	}
+}
+
+func TestBlobProxyDoesNotCacheMismatch(t *testing.T) {
+	ctx := context.Background()
+	bcid := blobCid(t, []byte("hello blob"))
+
+	s, _ := testBlobProxy(t, []byte("not the blob"))
+	store := memBlobStore{}
+	s.blobs = store
+
+	_, err := s.handleComAtprotoSyncGetBlob(ctx, bcid, "did:plc:alice", true)
+	if httpCode(err) != http.StatusBadGateway {
+		t.Fatalf("expected a bad gateway error, got %v", err)
+	}
+	if len(store) != 0 {
+		t.Fatal("expected the mismatched blob not to be cached")
+	}
+}
+
+func TestBlobProxyMaxSize(t *testing.T) {
+	ctx := context.Background()
+	blob := make([]byte, 2048)
+
+	s, _ := testBlobProxy(t, blob)
+	s.blobs = memBlobStore{}
+
+	_, err := s.handleComAtprotoSyncGetBlob(ctx, blobCid(t, blob), "did:plc:alice", true)
+	if httpCode(err) != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the blob to be too large, got %v", err)
+	}
+}
+
+func TestBlobProxyNotReproxied(t *testing.T) {
+	blob := []byte("hello blob")
+
+	s, requests := testBlobProxy(t, blob)
+
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.sync.getBlob?did=did:plc:alice&cid="+blobCid(t, blob), nil)
+	req.Header.Set(blobProxyHeader, "1")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	if err := s.HandleComAtprotoSyncGetBlob(c); httpCode(err) != http.StatusNotFound {
+		t.Fatalf("expected a proxied request not to be proxied again, got %v", err)
+	}
+	if *requests != 0 {
+		t.Fatalf("expected no pds requests, got %d", *requests)
+	}
+}
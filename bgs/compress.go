@@ -0,0 +1,61 @@
+package bgs
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/events"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Number of recent events whose compressed blocks we keep around. Subscribers
+// are usually within a few events of each other, so this only needs to cover
+// the spread between the fastest and slowest of them.
+const compressedBlocksCacheSize = 4096
+
+// Keyed by seq rather than by event, as events played back from the
+// persister are new copies of the ones that were broadcast live.
+type compressedBlocksKey struct {
+	seq   int64
+	codec string
+}
+
+// SetFirehoseCompression sets which block codecs subscribers may request
+// when connecting to the firehose. Subscribers that don't ask for one, or ask
+// for one not listed here, get uncompressed frames.
+func (bgs *BGS) SetFirehoseCompression(codecs []string) error {
+	out := make(map[string]events.BlockCodec)
+	for _, name := range codecs {
+		codec, ok := events.GetBlockCodec(name)
+		if !ok {
+			return fmt.Errorf("unknown firehose block codec: %q", name)
+		}
+		out[name] = codec
+	}
+
+	cache, err := lru.New[compressedBlocksKey, []byte](compressedBlocksCacheSize)
+	if err != nil {
+		return err
+	}
+
+	bgs.firehoseCodecs = out
+	bgs.compressedBlocks = cache
+	return nil
+}
+
+// compressBlocks returns the commit's blocks compressed with the given codec,
+// so each event is only compressed once no matter how many subscribers asked
+// for it.
+func (bgs *BGS) compressBlocks(evt *events.XRPCStreamEvent, codec events.BlockCodec) ([]byte, error) {
+	k := compressedBlocksKey{seq: evt.RepoCommit.Seq, codec: codec.Name()}
+	if b, ok := bgs.compressedBlocks.Get(k); ok {
+		return b, nil
+	}
+
+	b, err := codec.Compress(evt.RepoCommit.Blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	bgs.compressedBlocks.Add(k, b)
+	return b, nil
+}
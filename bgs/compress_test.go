@@ -0,0 +1,48 @@
+package bgs
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+)
+
+type countingCodec struct {
+	compressed *int
+}
+
+func (c countingCodec) Name() string { return "counting" }
+
+func (c countingCodec) Compress(b []byte) ([]byte, error) {
+	*c.compressed++
+	return b, nil
+}
+
+func (c countingCodec) Decompress(b []byte, maxSize int) ([]byte, error) {
+	return b, nil
+}
+
+func TestCompressedBlocksCachedBySeq(t *testing.T) {
+	var compressed int
+	events.RegisterBlockCodec(countingCodec{&compressed})
+
+	s := &BGS{}
+	if err := s.SetFirehoseCompression([]string{"counting"}); err != nil {
+		t.Fatal(err)
+	}
+	codec := s.firehoseCodecs["counting"]
+
+	// the same event as broadcast live and as played back from the
+	// persister
+	live := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{Seq: 7, Blocks: []byte("blocks")}}
+	played := &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{Seq: 7, Blocks: []byte("blocks")}}
+
+	for _, evt := range []*events.XRPCStreamEvent{live, played} {
+		if _, err := s.compressBlocks(evt, codec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if compressed != 1 {
+		t.Fatalf("expected the event to be compressed once, got %d", compressed)
+	}
+}
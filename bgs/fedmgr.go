@@ -35,7 +35,8 @@ type Slurper struct {
 	DefaultLimit      rate.Limit
 	DefaultCrawlLimit rate.Limit
 
-	newSubsDisabled bool
+	newSubsDisabled    bool
+	crawlAllowlistOnly bool
 
 	shutdownChan   chan bool
 	shutdownResult chan []error
@@ -171,6 +172,7 @@ func (s *Slurper) loadConfig() error {
 	}
 
 	s.newSubsDisabled = sc.NewSubsDisabled
+	s.crawlAllowlistOnly = sc.CrawlAllowlistOnly
 
 	return nil
 }
@@ -178,7 +180,8 @@ func (s *Slurper) loadConfig() error {
 type SlurpConfig struct {
 	gorm.Model
 
-	NewSubsDisabled bool
+	NewSubsDisabled    bool
+	CrawlAllowlistOnly bool
 }
 
 func (s *Slurper) SetNewSubsDisabled(dis bool) error {
@@ -199,6 +202,24 @@ func (s *Slurper) GetNewSubsDisabledState() bool {
 	return s.newSubsDisabled
 }
 
+func (s *Slurper) SetCrawlAllowlistOnly(only bool) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.db.Model(SlurpConfig{}).Where("id = 1").Update("crawl_allowlist_only", only).Error; err != nil {
+		return err
+	}
+
+	s.crawlAllowlistOnly = only
+	return nil
+}
+
+func (s *Slurper) GetCrawlAllowlistOnly() bool {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.crawlAllowlistOnly
+}
+
 var ErrNewSubsDisabled = fmt.Errorf("new subscriptions temporarily disabled")
 
 func (s *Slurper) SubscribeToPds(ctx context.Context, host string, reg bool) error {
@@ -426,6 +447,21 @@ func (s *Slurper) handleConnection(ctx context.Context, host *models.PDS, con *w
 
 			return nil
 		},
+		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
+			log.Infow("got remote account event", "host", host.Host, "did", evt.Did, "active", evt.Active)
+			if err := s.cb(context.TODO(), host, &events.XRPCStreamEvent{
+				RepoAccount: evt,
+			}); err != nil {
+				log.Errorf("failed handling event from %q (%d): %s", host.Host, evt.Seq, err)
+			}
+			*lastCursor = evt.Seq
+
+			if err := s.updateCursor(sub, *lastCursor); err != nil {
+				return fmt.Errorf("updating cursor: %w", err)
+			}
+
+			return nil
+		},
 		RepoInfo: func(info *comatproto.SyncSubscribeRepos_Info) error {
 			log.Infow("info event", "name", info.Name, "message", info.Message, "host", host.Host)
 			return nil
@@ -6,18 +6,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	comatprototypes "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"gorm.io/gorm"
 
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/repomgr"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
 	"github.com/ipfs/go-cid"
 	"github.com/labstack/echo/v4"
+	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
 func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection string, commit string, did string, rkey string) (io.Reader, error) {
@@ -37,17 +45,31 @@ func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection stri
 		return nil, fmt.Errorf("account was taken down")
 	}
 
-	reqCid := cid.Undef
+	var record cbg.CBORMarshaler
 	if commit != "" {
-		reqCid, err = cid.Decode(commit)
+		reqCid, err := cid.Decode(commit)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode commit cid: %w", err)
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to decode commit cid: %s", err))
 		}
-	}
 
-	_, record, err := s.repoman.GetRecord(ctx, u.ID, collection, rkey, reqCid)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get record: %w", err)
+		_, record, err = s.repoman.GetRecordAtCommit(ctx, u.ID, collection, rkey, reqCid)
+		if err != nil {
+			if errors.Is(err, repomgr.ErrHistoricalReadUnsupported) {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, "historical reads not supported for the given commit")
+			}
+			if errors.Is(err, repomgr.ErrInvalidCommitCid) {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			if errors.Is(err, repomgr.ErrRecordNotFound) {
+				return nil, echo.NewHTTPError(http.StatusNotFound, "record not found")
+			}
+			return nil, fmt.Errorf("failed to get record: %w", err)
+		}
+	} else {
+		_, record, err = s.repoman.GetRecord(ctx, u.ID, collection, rkey, cid.Undef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get record: %w", err)
+		}
 	}
 
 	buf := new(bytes.Buffer)
@@ -59,30 +81,86 @@ func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection stri
 	return buf, nil
 }
 
-func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context, did string, since string) (io.Reader, error) {
+// handleComAtprotoSyncGetRepo exports the user's repo, or the diff since the
+// given rev. If we don't have history going back as far as since, or since is
+// more commits behind than the configured limit, the full repo is returned
+// instead and sinceIgnored is set.
+func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context, did string, since string) (out io.Reader, sinceIgnored bool, err error) {
 	u, err := s.lookupUserByDid(ctx, did)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, echo.NewHTTPError(http.StatusNotFound, "user not found")
+			return nil, false, echo.NewHTTPError(http.StatusNotFound, "user not found")
 		}
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to lookup user")
+		return nil, false, echo.NewHTTPError(http.StatusInternalServerError, "failed to lookup user")
 	}
 
 	if u.Tombstoned {
-		return nil, fmt.Errorf("account was deleted")
+		return nil, false, fmt.Errorf("account was deleted")
 	}
 
 	if u.TakenDown {
-		return nil, fmt.Errorf("account was taken down")
+		return nil, false, fmt.Errorf("account was taken down")
+	}
+
+	if since != "" {
+		if !repo.ValidTID(since) {
+			return nil, false, echo.NewHTTPError(http.StatusBadRequest, "invalid since rev")
+		}
+
+		ok, err := s.repoman.HasHistorySince(ctx, u.ID, since)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to check repo history: %w", err)
+		}
+		if !ok {
+			getRepoFullResets.WithLabelValues("history_unavailable").Inc()
+			since = ""
+			sinceIgnored = true
+		} else if s.maxGetRepoDiffCommits > 0 {
+			behind, err := s.repoman.CountCommitsSince(ctx, u.ID, since)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to count commits since rev: %w", err)
+			}
+			if behind > s.maxGetRepoDiffCommits {
+				getRepoFullResets.WithLabelValues("too_far_behind").Inc()
+				log.Infow("getRepo since is too far behind, returning full repo", "did", did, "since", since, "commits", behind)
+				since = ""
+				sinceIgnored = true
+			}
+		}
 	}
 
 	// TODO: stream the response
 	buf := new(bytes.Buffer)
 	if err := s.repoman.ReadRepo(ctx, u.ID, since, buf); err != nil {
-		return nil, fmt.Errorf("failed to read repo: %w", err)
+		if errors.Is(err, carstore.ErrRepoIncomplete) {
+			incompleteRepoReads.Inc()
+			log.Errorw("repo data is incomplete, requesting re-sync", "did", did, "uid", u.ID, "err", err)
+			s.requestRepoResync(ctx, did)
+
+			return nil, false, echo.NewHTTPError(http.StatusServiceUnavailable, "repo data is incomplete on this server, try again later")
+		}
+		return nil, false, fmt.Errorf("failed to read repo: %w", err)
 	}
 
-	return buf, nil
+	return buf, sinceIgnored, nil
+}
+
+// requestRepoResync schedules a full re-crawl of the given user's repo from
+// their PDS, used when our local copy turns out to be damaged.
+func (s *BGS) requestRepoResync(ctx context.Context, did string) {
+	if s.Index.Crawler == nil {
+		return
+	}
+
+	ai, err := s.Index.LookupUserByDid(ctx, did)
+	if err != nil {
+		log.Warnw("failed to look up user for re-sync", "did", did, "err", err)
+		return
+	}
+
+	if err := s.Index.Crawler.CrawlFull(ctx, ai); err != nil {
+		log.Warnw("failed to enqueue re-sync", "did", did, "err", err)
+	}
 }
 
 func (s *BGS) handleComAtprotoSyncGetBlocks(ctx context.Context, cids []string, did string) (io.Reader, error) {
@@ -115,6 +193,17 @@ func (s *BGS) handleComAtprotoSyncRequestCrawl(ctx context.Context, body *comatp
 		}
 	}
 
+	allowed, err := s.domainIsAllowed(ctx, host)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &echo.HTTPError{
+			Code:    403,
+			Message: "domain is not on the crawl allowlist",
+		}
+	}
+
 	log.Warnf("TODO: better host validation for crawl requests")
 
 	c := &xrpc.Client{
@@ -134,10 +223,50 @@ func (s *BGS) handleComAtprotoSyncRequestCrawl(ctx context.Context, body *comatp
 		}
 	}
 
-	// Maybe we could do something with this response later
-	_ = desc
+	if err := s.checkDescribeServer(norm, desc); err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("given host has an invalid describeServer response: %s", err),
+		}
+	}
+
+	if err := s.slurper.SubscribeToPds(ctx, norm, true); err != nil {
+		return err
+	}
+
+	return s.db.Model(&models.PDS{}).Where("host = ?", norm).Updates(map[string]any{
+		"did":          desc.Did,
+		"user_domains": strings.Join(desc.AvailableUserDomains, ","),
+	}).Error
+}
+
+// checkDescribeServer validates a PDS's describeServer response. Without
+// verifyPDSDescribe set, anything goes; otherwise the response must carry a
+// valid DID, its list of user domains, and a did:web must name the host
+// itself.
+func (s *BGS) checkDescribeServer(host string, desc *comatprototypes.ServerDescribeServer_Output) error {
+	if !s.verifyPDSDescribe {
+		return nil
+	}
+
+	if desc.Did == "" {
+		return fmt.Errorf("missing did")
+	}
+
+	did, err := syntax.ParseDID(desc.Did)
+	if err != nil {
+		return err
+	}
+
+	if did.Method() == "web" && !strings.EqualFold(strings.ReplaceAll(did.Identifier(), "%3A", ":"), host) {
+		return fmt.Errorf("did %s does not match host %s", desc.Did, host)
+	}
 
-	return s.slurper.SubscribeToPds(ctx, norm, true)
+	if desc.AvailableUserDomains == nil {
+		return fmt.Errorf("missing availableUserDomains")
+	}
+
+	return nil
 }
 
 func (s *BGS) handleComAtprotoSyncNotifyOfUpdate(ctx context.Context, body *comatprototypes.SyncNotifyOfUpdate_Input) error {
@@ -145,13 +274,21 @@ func (s *BGS) handleComAtprotoSyncNotifyOfUpdate(ctx context.Context, body *coma
 	return nil
 }
 
-func (s *BGS) handleComAtprotoSyncGetBlob(ctx context.Context, cid string, did string) (io.Reader, error) {
+func (s *BGS) handleComAtprotoSyncGetBlob(ctx context.Context, cid string, did string, allowProxy bool) (io.Reader, error) {
+	canProxy := s.blobProxy && allowProxy
+
 	if s.blobs == nil {
+		if canProxy {
+			return s.proxyBlob(ctx, cid, did)
+		}
 		return nil, echo.NewHTTPError(http.StatusNotFound, "blobs not enabled on this server")
 	}
 
 	b, err := s.blobs.GetBlob(ctx, cid, did)
 	if err != nil {
+		if canProxy && errors.Is(err, fs.ErrNotExist) {
+			return s.proxyBlob(ctx, cid, did)
+		}
 		return nil, err
 	}
 
@@ -162,7 +299,10 @@ func (s *BGS) handleComAtprotoSyncListBlobs(ctx context.Context, cursor string,
 	return nil, fmt.Errorf("NYI")
 }
 
-func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context, cursor string, limit int) (*comatprototypes.SyncListRepos_Output, error) {
+// handleComAtprotoSyncListRepos pages through the repos we host. If since is
+// given (as an RFC3339 timestamp), only repos with a commit stored after it
+// are returned, which may make for pages shorter than limit.
+func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context, cursor string, limit int, since string) (*comatprototypes.SyncListRepos_Output, error) {
 	// Use UIDs for the cursor
 	var err error
 	c := int64(0)
@@ -173,28 +313,73 @@ func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context, cursor string,
 		}
 	}
 
+	if limit <= 0 {
+		limit = defaultListReposLimit
+	}
+	if limit > s.listReposMaxLimit {
+		limit = s.listReposMaxLimit
+	}
+
+	q := s.db.Model(&User{}).Where("id > ? AND NOT tombstoned AND NOT taken_down", c)
+
+	// the carstore records when each commit was stored, the page is the
+	// next repos it has updated, minus any we won't serve
+	var next models.Uid
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid since: %s", err))
+		}
+
+		updated, err := s.repoman.ReposUpdatedSince(ctx, t, models.Uid(c), limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get updated repos: %w", err)
+		}
+
+		if len(updated) == 0 {
+			return &comatprototypes.SyncListRepos_Output{}, nil
+		}
+
+		q = q.Where("id IN ?", updated)
+		next = updated[len(updated)-1]
+	}
+
 	users := []User{}
-	if err := s.db.Model(&User{}).Where("id > ? AND NOT tombstoned AND NOT taken_down", c).Order("id").Limit(limit).Find(&users).Error; err != nil {
+	if err := q.Order("id").Limit(limit).Find(&users).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return &comatprototypes.SyncListRepos_Output{}, nil
 		}
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
 
-	if len(users) == 0 {
-		return &comatprototypes.SyncListRepos_Output{}, nil
+	if since == "" {
+		if len(users) == 0 {
+			return &comatprototypes.SyncListRepos_Output{}, nil
+		}
+		next = users[len(users)-1].ID
 	}
 
 	resp := &comatprototypes.SyncListRepos_Output{
 		Repos: []*comatprototypes.SyncListRepos_Repo{},
 	}
 
+	uids := make([]models.Uid, 0, len(users))
+	for _, user := range users {
+		uids = append(uids, user.ID)
+	}
+
+	roots, err := s.repoman.GetRepoRoots(ctx, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repo roots: %w", err)
+	}
+
 	for i := range users {
 		user := users[i]
 
-		root, err := s.repoman.GetRepoRoot(ctx, user.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get repo root for (%s): %w", user.Did, err)
+		root, ok := roots[user.ID]
+		if !ok {
+			// no repo data stored for this user (yet)
+			continue
 		}
 
 		resp.Repos = append(resp.Repos, &comatprototypes.SyncListRepos_Repo{
@@ -203,8 +388,7 @@ func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context, cursor string,
 		})
 	}
 
-	c += int64(len(users))
-	cursor = strconv.FormatInt(c, 10)
+	cursor = strconv.FormatInt(int64(next), 10)
 	resp.Cursor = &cursor
 
 	return resp, nil
@@ -227,18 +411,14 @@ func (s *BGS) handleComAtprotoSyncGetLatestCommit(ctx context.Context, did strin
 		return nil, fmt.Errorf("account was taken down")
 	}
 
-	root, err := s.repoman.GetRepoRoot(ctx, u.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get repo root: %w", err)
-	}
-
-	rev, err := s.repoman.GetRepoRev(ctx, u.ID)
+	commits, err := s.repoman.GetLatestCommits(ctx, []models.Uid{u.ID})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get repo rev: %w", err)
+		return nil, fmt.Errorf("failed to get latest commit: %w", err)
 	}
 
+	lc := commits[u.ID]
 	return &comatprototypes.SyncGetLatestCommit_Output{
-		Cid: root.String(),
-		Rev: rev,
+		Cid: lc.Root.String(),
+		Rev: lc.Rev,
 	}, nil
 }
@@ -0,0 +1,143 @@
+package bgs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	label "github.com/bluesky-social/indigo/api/label"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultQueryLabelsLimit = 50
+	maxQueryLabelsLimit     = 250
+)
+
+var labelSourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// SetLabelSource sets the labeler whose labels queryLabels serves, given as
+// its base URL. Mirrors pulling a repo can use it to fetch the labels applied
+// to the account and its records. An empty host disables the endpoint.
+func (bgs *BGS) SetLabelSource(host string) {
+	bgs.labelSource = strings.TrimSuffix(host, "/")
+}
+
+// HandleQueryLabels serves com.atproto.label.queryLabels from the configured
+// labeler, as a companion to getRepo: a mirror asks for the patterns did and
+// at://did/* to get the labels on a repo's account and all of its records.
+// Patterns for repos that getRepo wouldn't serve are left out of the query.
+func (bgs *BGS) HandleQueryLabels(c echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(c.Request().Context(), "HandleQueryLabels")
+	defer span.End()
+
+	if bgs.labelSource == "" {
+		return c.JSON(http.StatusNotImplemented, XRPCError{Message: "no label source configured on this server"})
+	}
+
+	patterns := c.QueryParams()["uriPatterns"]
+	if len(patterns) == 0 {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: "no uriPatterns given"})
+	}
+
+	limit := defaultQueryLabelsLimit
+	if p := c.QueryParam("limit"); p != "" {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid limit: %s", p)})
+		}
+		limit = v
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > maxQueryLabelsLimit {
+		limit = maxQueryLabelsLimit
+	}
+
+	hidden := make(map[string]bool)
+	var query []string
+	for _, p := range patterns {
+		did, ok := patternDid(p)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("uri pattern must name a repo: %s", p)})
+		}
+
+		h, seen := hidden[did]
+		if !seen {
+			u, err := bgs.lookupUserByDid(ctx, did)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				h = true
+			case err != nil:
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to lookup user")
+			default:
+				// same as getRepo, there is nothing to mirror for these
+				h = u.Tombstoned || u.TakenDown
+			}
+			hidden[did] = h
+		}
+
+		if !h {
+			query = append(query, p)
+		}
+	}
+
+	if len(query) == 0 {
+		return c.JSON(200, &label.QueryLabels_Output{Labels: []*label.Label{}})
+	}
+
+	// array parameters are repeated, which the xrpc client doesn't do
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(limit))
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	params["sources"] = c.QueryParams()["sources"]
+	params["uriPatterns"] = query
+
+	req, err := http.NewRequestWithContext(ctx, "GET", bgs.labelSource+"/xrpc/com.atproto.label.queryLabels?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := labelSourceClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("querying labels: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("label source returned status %d", resp.StatusCode)
+	}
+
+	var out label.QueryLabels_Output
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("decoding labels: %w", err)
+	}
+
+	return c.JSON(200, &out)
+}
+
+// patternDid returns the repo a label uri pattern is about: either the DID
+// itself or an at:// uri (or prefix ending in a wildcard) within the repo.
+func patternDid(p string) (string, bool) {
+	did := p
+	if rest, ok := strings.CutPrefix(p, "at://"); ok {
+		did, _, _ = strings.Cut(rest, "/")
+	}
+
+	if _, err := syntax.ParseDID(did); err != nil {
+		return "", false
+	}
+	return did, true
+}
@@ -0,0 +1,149 @@
+package bgs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	label "github.com/bluesky-social/indigo/api/label"
+	"github.com/labstack/echo/v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testLabelSource sets up a relay knowing did:plc:alice and the taken down
+// did:plc:bob, passing label queries through to a labeler whose received
+// queries are returned.
+func testLabelSource(t *testing.T) (*BGS, *[]url.Values) {
+	t.Helper()
+
+	var queries []url.Values
+	labeler := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		json.NewEncoder(w).Encode(&label.QueryLabels_Output{
+			Labels: []*label.Label{{Src: "did:plc:labeler", Uri: "did:plc:alice", Val: "spam"}},
+		})
+	}))
+	t.Cleanup(labeler.Close)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(User{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{
+		{ID: 1, Did: "did:plc:alice"},
+		{ID: 2, Did: "did:plc:bob", TakenDown: true},
+	} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &BGS{db: db}
+	s.SetLabelSource(labeler.URL + "/")
+	return s, &queries
+}
+
+func queryLabels(t *testing.T, s *BGS, query string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.label.queryLabels?"+query, nil)
+	rec := httptest.NewRecorder()
+	return rec, s.HandleQueryLabels(echo.New().NewContext(req, rec))
+}
+
+func TestQueryLabels(t *testing.T) {
+	s, queries := testLabelSource(t)
+
+	rec, err := queryLabels(t, s, "uriPatterns=did:plc:alice&uriPatterns=at://did:plc:alice/*&uriPatterns=at://did:plc:bob/*&limit=1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out label.QueryLabels_Output
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Labels) != 1 || out.Labels[0].Val != "spam" {
+		t.Fatalf("expected the labeler's labels, got %+v", out.Labels)
+	}
+
+	if len(*queries) != 1 {
+		t.Fatalf("expected one labeler query, got %d", len(*queries))
+	}
+	q := (*queries)[0]
+	if exp := []string{"did:plc:alice", "at://did:plc:alice/*"}; !reflect.DeepEqual(q["uriPatterns"], exp) {
+		t.Fatalf("expected the taken down repo to be left out, got patterns %v", q["uriPatterns"])
+	}
+	if q.Get("limit") != "250" {
+		t.Fatalf("expected the limit to be clamped to 250, got %s", q.Get("limit"))
+	}
+}
+
+func TestQueryLabelsLimitFloor(t *testing.T) {
+	s, queries := testLabelSource(t)
+
+	if _, err := queryLabels(t, s, "uriPatterns=did:plc:alice&limit=0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*queries)[0].Get("limit"); got != "1" {
+		t.Fatalf("expected the limit to be raised to 1, got %s", got)
+	}
+}
+
+func TestQueryLabelsHiddenRepo(t *testing.T) {
+	s, queries := testLabelSource(t)
+
+	for _, query := range []string{"uriPatterns=did:plc:bob", "uriPatterns=at://did:plc:carol/*"} {
+		rec, err := queryLabels(t, s, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out label.QueryLabels_Output
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Labels) != 0 {
+			t.Fatalf("%s: expected no labels, got %+v", query, out.Labels)
+		}
+	}
+
+	if len(*queries) != 0 {
+		t.Fatalf("expected the labeler not to be asked, got %d queries", len(*queries))
+	}
+}
+
+func TestQueryLabelsBadPattern(t *testing.T) {
+	s, _ := testLabelSource(t)
+
+	for _, query := range []string{"", "uriPatterns=*", "uriPatterns=https://example.com"} {
+		rec, err := queryLabels(t, s, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected a bad request, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestQueryLabelsDisabled(t *testing.T) {
+	s, _ := testLabelSource(t)
+	s.SetLabelSource("")
+
+	rec, err := queryLabels(t, s, "uriPatterns=did:plc:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotImplemented {
+		t.Fatalf("expected not implemented without a label source, got %d", rec.Code)
+	}
+}
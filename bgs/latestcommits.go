@@ -0,0 +1,101 @@
+package bgs
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxLatestCommitsDids caps how many repos one latestCommits call asks
+// about.
+const maxLatestCommitsDids = 100
+
+type LatestCommit struct {
+	Did string `json:"did"`
+
+	// one of active, takendown, deleted or notFound
+	Status string `json:"status"`
+
+	// only set for active repos we hold data for
+	Cid string `json:"cid,omitempty"`
+	Rev string `json:"rev,omitempty"`
+}
+
+type GetLatestCommitsOutput struct {
+	Commits []*LatestCommit `json:"commits"`
+}
+
+// handleAdminGetLatestCommits is getLatestCommit for many repos at once,
+// given as repeated did parameters, for monitoring tools polling lots of
+// them. It isn't part of any lexicon, so it lives with the admin API.
+// Instead of failing for repos it can't serve, it reports their status, and
+// results come back in the order the repos were asked for.
+func (bgs *BGS) handleAdminGetLatestCommits(c echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(c.Request().Context(), "handleAdminGetLatestCommits")
+	defer span.End()
+
+	dids := c.QueryParams()["did"]
+	if len(dids) == 0 {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: "no dids given"})
+	}
+	if len(dids) > maxLatestCommitsDids {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("at most %d dids may be given", maxLatestCommitsDids)})
+	}
+	for _, did := range dids {
+		if _, err := syntax.ParseDID(did); err != nil {
+			return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid did: %s", did)})
+		}
+	}
+	span.SetAttributes(attribute.Int("dids", len(dids)))
+
+	var users []User
+	if err := bgs.db.WithContext(ctx).Find(&users, "did IN ?", dids).Error; err != nil {
+		return fmt.Errorf("failed to lookup users: %w", err)
+	}
+
+	byDid := make(map[string]*User, len(users))
+	var active []models.Uid
+	for i := range users {
+		u := &users[i]
+		byDid[u.Did] = u
+		if !u.Tombstoned && !u.TakenDown {
+			active = append(active, u.ID)
+		}
+	}
+
+	commits, err := bgs.repoman.GetLatestCommits(ctx, active)
+	if err != nil {
+		return fmt.Errorf("failed to get latest commits: %w", err)
+	}
+
+	out := &GetLatestCommitsOutput{Commits: make([]*LatestCommit, 0, len(dids))}
+	for _, did := range dids {
+		lc := &LatestCommit{Did: did}
+
+		u, ok := byDid[did]
+		switch {
+		case !ok:
+			lc.Status = "notFound"
+		case u.TakenDown:
+			lc.Status = "takendown"
+		case u.Tombstoned:
+			lc.Status = "deleted"
+		default:
+			lc.Status = "active"
+			if commit, ok := commits[u.ID]; ok {
+				lc.Cid = commit.Root.String()
+				lc.Rev = commit.Rev
+			}
+		}
+
+		out.Commits = append(out.Commits, lc)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,94 @@
+package bgs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+const maxListRecordsLimit = 1000
+
+type ListRecordsRecord struct {
+	Rkey string `json:"rkey"`
+	Cid  string `json:"cid"`
+}
+
+type ListRecordsOutput struct {
+	Cursor  *string              `json:"cursor,omitempty"`
+	Records []*ListRecordsRecord `json:"records"`
+}
+
+// HandleListRecords pages through the rkeys and CIDs of one collection in a
+// repo, read from its MST, so mirrors can enumerate a collection without
+// downloading the whole repo. The cursor is the last rkey returned.
+func (bgs *BGS) HandleListRecords(c echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(c.Request().Context(), "HandleListRecords")
+	defer span.End()
+
+	did := c.QueryParam("did")
+	if _, err := syntax.ParseDID(did); err != nil {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid did: %s", did)})
+	}
+
+	collection := c.QueryParam("collection")
+	if _, err := syntax.ParseNSID(collection); err != nil {
+		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid collection: %s", collection)})
+	}
+
+	limit := 500
+	if p := c.QueryParam("limit"); p != "" {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid limit: %s", p)})
+		}
+		limit = v
+	}
+	if limit <= 0 || limit > maxListRecordsLimit {
+		limit = maxListRecordsLimit
+	}
+
+	u, err := bgs.lookupUserByDid(ctx, did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to lookup user")
+	}
+
+	if u.Tombstoned {
+		return fmt.Errorf("account was deleted")
+	}
+
+	if u.TakenDown {
+		return fmt.Errorf("account was taken down")
+	}
+
+	entries, err := bgs.repoman.ListRecords(ctx, u.ID, collection, c.QueryParam("cursor"), limit)
+	if err != nil {
+		return fmt.Errorf("failed to list records: %w", err)
+	}
+
+	out := &ListRecordsOutput{
+		Records: make([]*ListRecordsRecord, 0, len(entries)),
+	}
+	for _, e := range entries {
+		out.Records = append(out.Records, &ListRecordsRecord{
+			Rkey: e.Rkey,
+			Cid:  e.Cid.String(),
+		})
+	}
+
+	if len(entries) == limit {
+		next := entries[len(entries)-1].Rkey
+		out.Cursor = &next
+	}
+
+	return c.JSON(200, out)
+}
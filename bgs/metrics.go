@@ -41,6 +41,26 @@ var newUsersDiscovered = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "The total number of new users discovered directly from the firehose (not from refs)",
 })
 
+var repoExportsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "bgs_repo_exports_in_flight",
+	Help: "The number of getRepo exports currently being served",
+})
+
+var repoExportsRejected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_repo_exports_rejected",
+	Help: "The total number of getRepo requests rejected because too many exports were in flight",
+})
+
+var getRepoFullResets = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_get_repo_full_resets",
+	Help: "Number of getRepo requests with a since rev that were served the full repo instead of a diff",
+}, []string{"reason"})
+
+var incompleteRepoReads = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bgs_incomplete_repo_reads",
+	Help: "Number of getRepo requests that found the stored repo data incomplete",
+})
+
 var reqSz = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    "http_request_size_bytes",
 	Help:    "A histogram of request sizes for requests.",
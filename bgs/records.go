@@ -0,0 +1,45 @@
+package bgs
+
+import (
+	"github.com/bluesky-social/indigo/events"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Number of recent events whose record refs we keep around, see
+// compressedBlocksCacheSize.
+const recordRefsCacheSize = 4096
+
+// SetFirehoseRecordRefs lets firehose subscribers ask for the records of
+// #commit ops to be pointed out in the frame header with ?records=true, see
+// events.RecordRef. It costs a walk of each event's blocks, done once no
+// matter how many subscribers asked. Off by default.
+func (bgs *BGS) SetFirehoseRecordRefs(enabled bool) error {
+	bgs.recordRefs = nil
+	if !enabled {
+		return nil
+	}
+
+	// keyed by seq, like the compressed blocks
+	cache, err := lru.New[int64, []events.RecordRef](recordRefsCacheSize)
+	if err != nil {
+		return err
+	}
+
+	bgs.recordRefs = cache
+	return nil
+}
+
+// commitRecordRefs returns the record refs of the commit's ops.
+func (bgs *BGS) commitRecordRefs(evt *events.XRPCStreamEvent) ([]events.RecordRef, error) {
+	if refs, ok := bgs.recordRefs.Get(evt.RepoCommit.Seq); ok {
+		return refs, nil
+	}
+
+	refs, err := events.FindRecordRefs(evt.RepoCommit.Blocks, evt.RepoCommit.Ops)
+	if err != nil {
+		return nil, err
+	}
+
+	bgs.recordRefs.Add(evt.RepoCommit.Seq, refs)
+	return refs, nil
+}
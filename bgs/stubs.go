@@ -52,11 +52,17 @@ func (s *BGS) HandleComAtprotoSyncGetBlob(c echo.Context) error {
 
 	var out io.Reader
 	var handleErr error
-	// func (s *BGS) handleComAtprotoSyncGetBlob(ctx context.Context,cid string,did string) (io.Reader, error)
-	out, handleErr = s.handleComAtprotoSyncGetBlob(ctx, bCid, did)
+	// never re-proxy a request that came from another relay's blob proxy
+	allowProxy := c.Request().Header.Get(blobProxyHeader) == ""
+	// func (s *BGS) handleComAtprotoSyncGetBlob(ctx context.Context,cid string,did string,allowProxy bool) (io.Reader, error)
+	out, handleErr = s.handleComAtprotoSyncGetBlob(ctx, bCid, did, allowProxy)
 	if handleErr != nil {
 		return handleErr
 	}
+	// proxied blobs stream straight from the pds
+	if cl, ok := out.(io.Closer); ok {
+		defer cl.Close()
+	}
 	return c.Stream(200, "application/octet-stream", out)
 }
 
@@ -159,13 +165,24 @@ func (s *BGS) HandleComAtprotoSyncGetRepo(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, XRPCError{Message: fmt.Sprintf("invalid did: %s", did)})
 	}
 
+	if !s.tryAcquireRepoExport() {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.JSON(http.StatusServiceUnavailable, XRPCError{Message: "too many concurrent repo exports, try again later"})
+	}
+	defer s.releaseRepoExport()
+
 	var out io.Reader
+	var sinceIgnored bool
 	var handleErr error
-	// func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context,did string,since string) (io.Reader, error)
-	out, handleErr = s.handleComAtprotoSyncGetRepo(ctx, did, since)
+	// func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context,did string,since string) (io.Reader, bool, error)
+	out, sinceIgnored, handleErr = s.handleComAtprotoSyncGetRepo(ctx, did, since)
 	if handleErr != nil {
 		return handleErr
 	}
+	if sinceIgnored {
+		// tell the client they got the whole repo rather than a diff
+		c.Response().Header().Set("X-Repo-Since-Unavailable", "true")
+	}
 	return c.Stream(200, "application/vnd.ipld.car", out)
 }
 
@@ -217,10 +234,11 @@ func (s *BGS) HandleComAtprotoSyncListRepos(c echo.Context) error {
 	} else {
 		limit = 500
 	}
+	since := c.QueryParam("since")
 	var out *comatprototypes.SyncListRepos_Output
 	var handleErr error
-	// func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context,cursor string,limit int) (*comatprototypes.SyncListRepos_Output, error)
-	out, handleErr = s.handleComAtprotoSyncListRepos(ctx, cursor, limit)
+	// func (s *BGS) handleComAtprotoSyncListRepos(ctx context.Context,cursor string,limit int,since string) (*comatprototypes.SyncListRepos_Output, error)
+	out, handleErr = s.handleComAtprotoSyncListRepos(ctx, cursor, limit, since)
 	if handleErr != nil {
 		return handleErr
 	}
@@ -0,0 +1,134 @@
+package bgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+// how many users are taken down per batch during a PDS takedown
+const pdsTakedownBatchSize = 500
+
+type PDSTakedown struct {
+	PDS               models.PDS `json:"pds"`
+	NumRepos          int64      `json:"numRepos"`
+	NumReposTakenDown int64      `json:"numReposTakenDown"`
+	Status            string     `json:"status"`
+	StatusChangedAt   time.Time  `json:"statusChangedAt"`
+}
+
+func (bgs *BGS) GetPDSTakedown(pdsID uint) (PDSTakedown, bool) {
+	bgs.pdsTakedownsLk.RLock()
+	defer bgs.pdsTakedownsLk.RUnlock()
+
+	if t, ok := bgs.pdsTakedowns[pdsID]; ok {
+		return *t, true
+	}
+
+	return PDSTakedown{}, false
+}
+
+func (bgs *BGS) updatePDSTakedown(t PDSTakedown) {
+	bgs.pdsTakedownsLk.Lock()
+	defer bgs.pdsTakedownsLk.Unlock()
+
+	bgs.pdsTakedowns[t.PDS.ID] = &t
+}
+
+// TakedownPDS blocks the given PDS, drops our subscription to it, and takes
+// down every repo it hosts. Users already taken down are skipped, and a user
+// is only marked taken down once everything else about its takedown is done,
+// so if this is interrupted it can simply be run again to pick up where it
+// left off.
+// Progress can be checked with GetPDSTakedown.
+func (bgs *BGS) TakedownPDS(ctx context.Context, pdsID uint) error {
+	ctx, span := otel.Tracer("bgs").Start(ctx, "TakedownPDS")
+	defer span.End()
+
+	var pds models.PDS
+	if err := bgs.db.First(&pds, "id = ?", pdsID).Error; err != nil {
+		return err
+	}
+
+	log := log.With("pds", pds.Host, "source", "takedown_pds")
+
+	bgs.pdsTakedownsLk.Lock()
+	if t, ok := bgs.pdsTakedowns[pds.ID]; ok && t.Status != "complete" && t.Status != "failed" {
+		bgs.pdsTakedownsLk.Unlock()
+		return fmt.Errorf("takedown already in progress")
+	}
+	bgs.pdsTakedowns[pds.ID] = &PDSTakedown{
+		PDS:             pds,
+		Status:          "started",
+		StatusChangedAt: time.Now(),
+	}
+	bgs.pdsTakedownsLk.Unlock()
+
+	progress, _ := bgs.GetPDSTakedown(pds.ID)
+	setStatus := func(status string) {
+		progress.Status = status
+		progress.StatusChangedAt = time.Now()
+		bgs.updatePDSTakedown(progress)
+	}
+
+	// block first so no new users or events from this host come in while we
+	// work through the existing ones
+	if err := bgs.db.Model(models.PDS{}).Where("id = ?", pds.ID).UpdateColumn("blocked", true).Error; err != nil {
+		setStatus("failed")
+		return fmt.Errorf("failed to block pds: %w", err)
+	}
+
+	if err := bgs.slurper.KillUpstreamConnection(pds.Host, true); err != nil && !errors.Is(err, ErrNoActiveConnection) {
+		setStatus("failed")
+		return fmt.Errorf("failed to kill upstream connection: %w", err)
+	}
+
+	if err := bgs.db.Model(User{}).Where("pds = ?", pds.ID).Count(&progress.NumRepos).Error; err != nil {
+		setStatus("failed")
+		return err
+	}
+	if err := bgs.db.Model(User{}).Where("pds = ? AND taken_down", pds.ID).Count(&progress.NumReposTakenDown).Error; err != nil {
+		setStatus("failed")
+		return err
+	}
+
+	setStatus("taking down repos")
+	log.Warnw("starting PDS takedown", "num_repos", progress.NumRepos, "already_taken_down", progress.NumReposTakenDown)
+
+	var lastID models.Uid
+	for {
+		var users []User
+		if err := bgs.db.Where("pds = ? AND NOT taken_down AND id > ?", pds.ID, lastID).Order("id").Limit(pdsTakedownBatchSize).Find(&users).Error; err != nil {
+			setStatus("failed")
+			return err
+		}
+
+		if len(users) == 0 {
+			break
+		}
+
+		for i := range users {
+			u := &users[i]
+			if err := bgs.takeDownUser(ctx, u); err != nil {
+				setStatus("failed")
+				return fmt.Errorf("taking down %s: %w", u.Did, err)
+			}
+
+			progress.NumReposTakenDown++
+			lastID = u.ID
+		}
+
+		bgs.updatePDSTakedown(progress)
+		log.Warnw("PDS takedown progress", "taken_down", progress.NumReposTakenDown, "num_repos", progress.NumRepos)
+	}
+
+	setStatus("complete")
+	log.Warnw("completed PDS takedown", "num_repos", progress.NumRepos)
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -44,6 +45,11 @@ type CarStore struct {
 	lastShardCache map[models.Uid]*CarShard
 }
 
+// ErrRepoIncomplete is returned when a repo's stored data is missing pieces
+// that its metadata says should be there, e.g. a shard file that no longer
+// exists on disk.
+var ErrRepoIncomplete = errors.New("repo data is incomplete")
+
 func NewCarStore(meta *gorm.DB, root string) (*CarStore, error) {
 	if _, err := os.Stat(root); err != nil {
 		if !os.IsNotExist(err) {
@@ -60,6 +66,9 @@ func NewCarStore(meta *gorm.DB, root string) (*CarStore, error) {
 	if err := meta.AutoMigrate(&staleRef{}); err != nil {
 		return nil, err
 	}
+	if err := meta.AutoMigrate(&importMarker{}); err != nil {
+		return nil, err
+	}
 
 	return &CarStore{
 		meta:           meta,
@@ -74,8 +83,8 @@ type UserInfo struct {
 }
 
 type CarShard struct {
-	ID        uint `gorm:"primarykey"`
-	CreatedAt time.Time
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
 
 	Root      models.DbCID `gorm:"index"`
 	DataStart int64
@@ -367,6 +376,19 @@ func (cs *CarStore) ReadUserCar(ctx context.Context, user models.Uid, sinceRev s
 
 	var earlySeq int
 	if sinceRev != "" {
+		lastShard, err := cs.getLastShard(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		// nothing has happened since the given rev, so the diff is empty
+		if lastShard.ID != 0 && sinceRev >= lastShard.Rev {
+			return car.WriteHeader(&car.CarHeader{
+				Roots:   []cid.Cid{lastShard.Root.CID},
+				Version: 1,
+			}, w)
+		}
+
 		var untilShard CarShard
 		if err := cs.meta.Where("rev >= ? AND usr = ?", sinceRev, user).Order("rev").First(&untilShard).Error; err != nil {
 			return fmt.Errorf("finding early shard: %w", err)
@@ -411,10 +433,22 @@ func (cs *CarStore) writeShardBlocks(ctx context.Context, sh *CarShard, w io.Wri
 
 	fi, err := os.Open(sh.Path)
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: shard %d (seq %d) file is missing: %s", ErrRepoIncomplete, sh.ID, sh.Seq, err)
+		}
 		return err
 	}
 	defer fi.Close()
 
+	st, err := fi.Stat()
+	if err != nil {
+		return err
+	}
+
+	if st.Size() < sh.DataStart {
+		return fmt.Errorf("%w: shard %d (seq %d) file is truncated", ErrRepoIncomplete, sh.ID, sh.Seq)
+	}
+
 	_, err = fi.Seek(sh.DataStart, io.SeekStart)
 	if err != nil {
 		return err
@@ -854,36 +888,65 @@ func BlockDiff(ctx context.Context, bs blockstore.Blockstore, oldroot cid.Cid, n
 	return dropset, nil
 }
 
-func (cs *CarStore) ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
-	ctx, span := otel.Tracer("carstore").Start(ctx, "ImportSlice")
-	defer span.End()
+// DecodedSlice is a car slice that has been parsed but not yet applied to
+// any repo. Decoding needs no access to the store, so it can run ahead of
+// ImportDecodedSlice.
+type DecodedSlice struct {
+	Root   cid.Cid
+	Blocks []blockformat.Block
+}
 
+func DecodeSlice(carslice []byte) (*DecodedSlice, error) {
 	carr, err := car.NewCarReader(bytes.NewReader(carslice))
 	if err != nil {
-		return cid.Undef, nil, err
+		return nil, err
 	}
 
 	if len(carr.Header.Roots) != 1 {
-		return cid.Undef, nil, fmt.Errorf("invalid car file, header must have a single root (has %d)", len(carr.Header.Roots))
+		return nil, fmt.Errorf("invalid car file, header must have a single root (has %d)", len(carr.Header.Roots))
 	}
 
-	ds, err := cs.NewDeltaSession(ctx, uid, since)
-	if err != nil {
-		return cid.Undef, nil, fmt.Errorf("new delta session failed: %w", err)
-	}
-
-	var cids []cid.Cid
+	var blks []blockformat.Block
 	for {
 		blk, err := carr.Next()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return cid.Undef, nil, err
+			return nil, err
 		}
 
-		cids = append(cids, blk.Cid())
+		blks = append(blks, blk)
+	}
+
+	return &DecodedSlice{
+		Root:   carr.Header.Roots[0],
+		Blocks: blks,
+	}, nil
+}
 
+func (cs *CarStore) ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "ImportSlice")
+	defer span.End()
+
+	slice, err := DecodeSlice(carslice)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	return cs.ImportDecodedSlice(ctx, uid, since, slice)
+}
+
+func (cs *CarStore) ImportDecodedSlice(ctx context.Context, uid models.Uid, since *string, slice *DecodedSlice) (cid.Cid, *DeltaSession, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "ImportDecodedSlice")
+	defer span.End()
+
+	ds, err := cs.NewDeltaSession(ctx, uid, since)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("new delta session failed: %w", err)
+	}
+
+	for _, blk := range slice.Blocks {
 		if err := ds.Put(ctx, blk); err != nil {
 			return cid.Undef, nil, err
 		}
@@ -896,7 +959,7 @@ func (cs *CarStore) ImportSlice(ctx context.Context, uid models.Uid, since *stri
 
 	ds.rmcids = rmcids
 
-	return carr.Header.Roots[0], ds, nil
+	return slice.Root, ds, nil
 }
 
 func (ds *DeltaSession) CalcDiff(ctx context.Context, nroot cid.Cid) error {
@@ -921,6 +984,116 @@ func (cs *CarStore) GetUserRepoHead(ctx context.Context, user models.Uid) (cid.C
 	return lastShard.Root.CID, nil
 }
 
+// GetUserRepoHeads returns the current repo root for each of the given users,
+// using a single query for any users not already in the last shard cache.
+// Users without any shards are omitted from the result.
+func (cs *CarStore) GetUserRepoHeads(ctx context.Context, users []models.Uid) (map[models.Uid]cid.Cid, error) {
+	commits, err := cs.GetUserRepoCommits(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[models.Uid]cid.Cid, len(commits))
+	for u, c := range commits {
+		out[u] = c.Root
+	}
+
+	return out, nil
+}
+
+// RepoCommit identifies a repo's latest commit.
+type RepoCommit struct {
+	Root cid.Cid
+	Rev  string
+}
+
+// GetUserRepoCommits returns the latest commit of each of the given users,
+// same as GetUserRepoHeads.
+func (cs *CarStore) GetUserRepoCommits(ctx context.Context, users []models.Uid) (map[models.Uid]RepoCommit, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "GetUserRepoCommits")
+	defer span.End()
+
+	out := make(map[models.Uid]RepoCommit, len(users))
+	var missing []models.Uid
+	for _, u := range users {
+		if ls := cs.checkLastShardCache(u); ls != nil {
+			if ls.ID != 0 {
+				out[u] = RepoCommit{Root: ls.Root.CID, Rev: ls.Rev}
+			}
+			continue
+		}
+		missing = append(missing, u)
+	}
+
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	var shards []CarShard
+	if err := cs.meta.WithContext(ctx).Raw(`SELECT car_shards.* FROM car_shards
+		JOIN (SELECT usr, MAX(seq) AS seq FROM car_shards WHERE usr IN (?) GROUP BY usr) latest
+		ON car_shards.usr = latest.usr AND car_shards.seq = latest.seq`, missing).Scan(&shards).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range shards {
+		sh := shards[i]
+		cs.putLastShardCache(&sh)
+		out[sh.Usr] = RepoCommit{Root: sh.Root.CID, Rev: sh.Rev}
+	}
+
+	return out, nil
+}
+
+// ReposUpdatedSince returns, in order, up to limit of the users after the
+// given one that stored a commit after since.
+func (cs *CarStore) ReposUpdatedSince(ctx context.Context, since time.Time, after models.Uid, limit int) ([]models.Uid, error) {
+	var uids []models.Uid
+	if err := cs.meta.WithContext(ctx).Model(&CarShard{}).Where("created_at > ? AND usr > ?", since, after).Distinct("usr").Order("usr").Limit(limit).Pluck("usr", &uids).Error; err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// HasHistorySince reports whether we hold enough of the user's history to
+// produce a diff since the given rev, i.e. it is not older than the first
+// rev we stored for this user.
+func (cs *CarStore) HasHistorySince(ctx context.Context, user models.Uid, sinceRev string) (bool, error) {
+	var first CarShard
+	if err := cs.meta.WithContext(ctx).Where("usr = ?", user).Order("seq").Limit(1).Find(&first).Error; err != nil {
+		return false, err
+	}
+	if first.ID == 0 {
+		return false, nil
+	}
+
+	return sinceRev >= first.Rev, nil
+}
+
+// CountCommitsSince returns how many of the user's stored commits are newer
+// than sinceRev. Compaction folds older shards together, so commits from
+// before a compaction are undercounted.
+func (cs *CarStore) CountCommitsSince(ctx context.Context, user models.Uid, sinceRev string) (int64, error) {
+	var count int64
+	if err := cs.meta.WithContext(ctx).Model(CarShard{}).Where("usr = ? AND rev > ?", user, sinceRev).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// HasCommit reports whether the given commit is still the root of one of the
+// user's shards. Compaction folds older shards together and only keeps the
+// root of the newest one, so commits from before a compaction are not found.
+func (cs *CarStore) HasCommit(ctx context.Context, user models.Uid, root cid.Cid) (bool, error) {
+	var count int64
+	if err := cs.meta.WithContext(ctx).Model(CarShard{}).Where("usr = ? AND root = ?", user, models.DbCID{CID: root}).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 func (cs *CarStore) GetUserRepoRev(ctx context.Context, user models.Uid) (string, error) {
 	lastShard, err := cs.getLastShard(ctx, user)
 	if err != nil {
@@ -1470,6 +1643,8 @@ func (cs *CarStore) compactBucket(ctx context.Context, user models.Uid, b *compB
 		Path:      path,
 		Usr:       user,
 		Rev:       lastsh.Rev,
+		// keeps the repo from looking updated to ReposUpdatedSince
+		CreatedAt: lastsh.CreatedAt,
 	}
 
 	if err := cs.putShard(ctx, &shard, nbrefs, nil, true); err != nil {
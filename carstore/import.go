@@ -0,0 +1,77 @@
+package carstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"go.opentelemetry.io/otel"
+)
+
+// importMarker records that a repo import is in progress for a user, along
+// with the seq of the user's last shard before the import started. A marker
+// left behind after a crash means the shards written after BaseSeq may not
+// have been fully processed.
+type importMarker struct {
+	Usr       models.Uid `gorm:"primarykey"`
+	BaseSeq   int
+	CreatedAt time.Time
+}
+
+// BeginImport marks the start of a repo import for the given user. It must be
+// paired with a call to FinishImport once the import has been fully
+// processed.
+func (cs *CarStore) BeginImport(ctx context.Context, user models.Uid) error {
+	lastShard, err := cs.getLastShard(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return cs.meta.WithContext(ctx).Save(&importMarker{
+		Usr:     user,
+		BaseSeq: lastShard.Seq,
+	}).Error
+}
+
+// FinishImport clears the import marker set by BeginImport.
+func (cs *CarStore) FinishImport(ctx context.Context, user models.Uid) error {
+	return cs.meta.WithContext(ctx).Delete(&importMarker{}, "usr = ?", user).Error
+}
+
+// RollbackInterruptedImport checks for an import marker left behind by an
+// import that never finished, and if one exists deletes every shard written
+// since the import began, returning the repo to its pre-import state. It
+// reports whether anything was rolled back.
+func (cs *CarStore) RollbackInterruptedImport(ctx context.Context, user models.Uid) (bool, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "RollbackInterruptedImport")
+	defer span.End()
+
+	var marker importMarker
+	if err := cs.meta.WithContext(ctx).Limit(1).Find(&marker, "usr = ?", user).Error; err != nil {
+		return false, err
+	}
+
+	if marker.Usr == 0 {
+		return false, nil
+	}
+
+	var shards []*CarShard
+	if err := cs.meta.WithContext(ctx).Find(&shards, "usr = ? AND seq > ?", user, marker.BaseSeq).Error; err != nil {
+		return false, err
+	}
+
+	cs.removeLastShardCache(user)
+
+	if len(shards) > 0 {
+		if err := cs.deleteShards(ctx, shards); err != nil {
+			return false, fmt.Errorf("deleting shards from interrupted import: %w", err)
+		}
+	}
+
+	if err := cs.FinishImport(ctx, user); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
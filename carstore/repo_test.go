@@ -12,6 +12,7 @@ import (
 	"time"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/util"
 	sqlbs "github.com/ipfs/go-bs-sqlite3"
@@ -19,6 +20,7 @@ import (
 	flatfs "github.com/ipfs/go-ds-flatfs"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	ipld "github.com/ipfs/go-ipld-format"
+	car "github.com/ipld/go-car"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -153,6 +155,312 @@ func TestBasicOperation(t *testing.T) {
 	checkRepo(t, cs, buf, recs)
 }
 
+func TestGetUserRepoHeads(t *testing.T) {
+	ctx := context.TODO()
+
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	heads := make(map[models.Uid]cid.Cid)
+	revs := make(map[models.Uid]string)
+	for _, u := range []models.Uid{1, 2} {
+		ds, err := cs.NewDeltaSession(ctx, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ncid, rev, err := setupRepo(ctx, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ds.CloseWithRoot(ctx, ncid, rev); err != nil {
+			t.Fatal(err)
+		}
+		heads[u] = ncid
+		revs[u] = rev
+	}
+
+	// warm the cache for one user only, then force a lookup from the db
+	if _, err := cs.GetUserRepoHead(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	cs.removeLastShardCache(2)
+
+	out, err := cs.GetUserRepoHeads(ctx, []models.Uid{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("expected 2 heads, got %d", len(out))
+	}
+	for u, h := range heads {
+		if out[u] != h {
+			t.Fatalf("mismatched head for user %d: %s != %s", u, out[u], h)
+		}
+	}
+	cs.removeLastShardCache(1)
+	commits, err := cs.GetUserRepoCommits(ctx, []models.Uid{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+	for u, h := range heads {
+		if commits[u].Root != h || commits[u].Rev != revs[u] {
+			t.Fatalf("mismatched commit for user %d: %+v", u, commits[u])
+		}
+	}
+}
+
+func TestReposUpdatedSince(t *testing.T) {
+	ctx := context.TODO()
+
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	for _, u := range []models.Uid{1, 2, 3} {
+		ds, err := cs.NewDeltaSession(ctx, u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ncid, rev, err := setupRepo(ctx, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ds.CloseWithRoot(ctx, ncid, rev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-24 * time.Hour)
+	if err := cs.meta.Model(&CarShard{}).Where("usr IN ?", []models.Uid{1, 3}).Update("created_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		since time.Time
+		after models.Uid
+		limit int
+		exp   []models.Uid
+	}{
+		{since: time.Now().Add(-time.Hour), limit: 10, exp: []models.Uid{2}},
+		{since: old.Add(-time.Hour), limit: 10, exp: []models.Uid{1, 2, 3}},
+		{since: old.Add(-time.Hour), after: 1, limit: 1, exp: []models.Uid{2}},
+		{since: time.Now().Add(time.Hour), limit: 10, exp: nil},
+	} {
+		uids, err := cs.ReposUpdatedSince(ctx, tc.since, tc.after, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(uids) != fmt.Sprint(tc.exp) {
+			t.Fatalf("since %s after %d: expected %v, got %v", tc.since, tc.after, tc.exp, uids)
+		}
+	}
+}
+
+func TestReadUserCarMissingShard(t *testing.T) {
+	ctx := context.TODO()
+
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ncid, rev, err := setupRepo(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.CloseWithRoot(ctx, ncid, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	var shards []CarShard
+	if err := cs.meta.Find(&shards, "usr = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, sh := range shards {
+		if err := os.Remove(sh.Path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cs.ReadUserCar(ctx, 1, "", true, io.Discard)
+	if !errors.Is(err, ErrRepoIncomplete) {
+		t.Fatalf("expected ErrRepoIncomplete, got %v", err)
+	}
+}
+
+func TestReadUserCarSinceHead(t *testing.T) {
+	ctx := context.TODO()
+
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ncid, rev, err := setupRepo(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.CloseWithRoot(ctx, ncid, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cs.ReadUserCar(ctx, 1, rev, true, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	carr, err := car.NewCarReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carr.Header.Roots[0] != ncid {
+		t.Fatalf("expected root %s, got %s", ncid, carr.Header.Roots[0])
+	}
+	if _, err := carr.Next(); err != io.EOF {
+		t.Fatalf("expected an empty diff, got err %v", err)
+	}
+
+	ok, err := cs.HasHistorySince(ctx, 1, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected history since the current rev")
+	}
+
+	ok, err = cs.HasHistorySince(ctx, 1, "2222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected no history from before the first stored rev")
+	}
+
+	n, err := cs.CountCommitsSince(ctx, 1, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no commits since the current rev, got %d", n)
+	}
+
+	n, err = cs.CountCommitsSince(ctx, 1, "2222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one commit since an older rev, got %d", n)
+	}
+}
+
+func TestRollbackInterruptedImport(t *testing.T) {
+	ctx := context.TODO()
+
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, rev, err := setupRepo(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	// an import that writes a new shard and then never finishes
+	if err := cs.BeginImport(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err = cs.NewDeltaSession(ctx, 1, &rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := repo.OpenRepo(ctx, ds, head, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := rr.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{
+		Text: "this import gets interrupted",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	kmgr := &util.FakeKeyManager{}
+	nroot, nrev, err := rr.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.CloseWithRoot(ctx, nroot, nrev); err != nil {
+		t.Fatal(err)
+	}
+
+	rolledBack, err := cs.RollbackInterruptedImport(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rolledBack {
+		t.Fatal("expected interrupted import to be rolled back")
+	}
+
+	cur, err := cs.GetUserRepoHead(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != head {
+		t.Fatalf("expected head to be reset to %s, got %s", head, cur)
+	}
+
+	// nothing left to roll back once the marker is cleared
+	rolledBack, err = cs.RollbackInterruptedImport(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack {
+		t.Fatal("expected no rollback without an import marker")
+	}
+}
+
 func TestRepeatedCompactions(t *testing.T) {
 	ctx := context.TODO()
 
@@ -40,6 +40,8 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
 	"gorm.io/plugin/opentelemetry/tracing"
 )
 
@@ -71,6 +73,11 @@ func run(args []string) {
 			Value:   "sqlite://./data/bigsky/bgs.sqlite",
 			EnvVars: []string{"DATABASE_URL"},
 		},
+		&cli.StringFlag{
+			Name:    "read-replica-db-url",
+			Usage:   "database connection string for a read replica of the BGS database, used for lookups that tolerate stale reads",
+			EnvVars: []string{"READ_REPLICA_DATABASE_URL"},
+		},
 		&cli.StringFlag{
 			Name:    "carstore-db-url",
 			Usage:   "database connection string for carstore database",
@@ -115,6 +122,11 @@ func run(args []string) {
 			Name:  "disk-persister-dir",
 			Usage: "set directory for disk persister (implicitly enables disk persister)",
 		},
+		&cli.BoolFlag{
+			Name:    "db-event-store",
+			Usage:   "keep the event log in an event store table of the main database, instead of the db persister",
+			EnvVars: []string{"BGS_DB_EVENT_STORE"},
+		},
 		&cli.StringFlag{
 			Name:    "admin-key",
 			EnvVars: []string{"BGS_ADMIN_KEY"},
@@ -133,6 +145,277 @@ func run(args []string) {
 			EnvVars: []string{"MAX_METADB_CONNECTIONS"},
 			Value:   40,
 		},
+		&cli.BoolFlag{
+			Name:    "blob-proxy",
+			Usage:   "fetch blobs missing from the local blob store from the user's PDS",
+			EnvVars: []string{"BGS_BLOB_PROXY"},
+		},
+		&cli.Int64Flag{
+			Name:    "blob-proxy-max-size",
+			Usage:   "maximum size in bytes of blobs fetched by the blob proxy",
+			EnvVars: []string{"BGS_BLOB_PROXY_MAX_SIZE"},
+			Value:   5_000_000,
+		},
+		&cli.StringFlag{
+			Name:    "label-source",
+			Usage:   "base URL of a labeler whose labels on the repos we serve are passed through by queryLabels",
+			EnvVars: []string{"BGS_LABEL_SOURCE"},
+		},
+		&cli.IntFlag{
+			Name:    "max-concurrent-repo-exports",
+			Usage:   "maximum number of getRepo requests served at once (0 for unlimited)",
+			EnvVars: []string{"BGS_MAX_CONCURRENT_REPO_EXPORTS"},
+			Value:   0,
+		},
+		&cli.Int64Flag{
+			Name:    "max-get-repo-diff-commits",
+			Usage:   "serve the full repo to getRepo requests whose since rev is more than this many commits behind (0 for no limit)",
+			EnvVars: []string{"BGS_MAX_GET_REPO_DIFF_COMMITS"},
+			Value:   0,
+		},
+		&cli.StringSliceFlag{
+			Name:    "firehose-compression",
+			Usage:   "block codecs (eg, gzip) firehose subscribers may request with ?compress=",
+			EnvVars: []string{"BGS_FIREHOSE_COMPRESSION"},
+		},
+		&cli.BoolFlag{
+			Name:    "firehose-record-refs",
+			Usage:   "let firehose subscribers ask with ?records=true for the location of each op's record in the commit blocks",
+			EnvVars: []string{"BGS_FIREHOSE_RECORD_REFS"},
+		},
+		&cli.BoolFlag{
+			Name:    "verify-pds-describe",
+			Usage:   "reject crawl requests from hosts whose describeServer response lacks a valid did or user domains",
+			EnvVars: []string{"BGS_VERIFY_PDS_DESCRIBE"},
+		},
+		&cli.IntFlag{
+			Name:    "list-repos-max-limit",
+			Usage:   "maximum number of repos returned by a single listRepos call",
+			EnvVars: []string{"BGS_LIST_REPOS_MAX_LIMIT"},
+			Value:   500,
+		},
+		&cli.StringFlag{
+			Name:    "reference-crawl",
+			Usage:   "how to crawl users referenced by indexed records: sync, batched or off",
+			EnvVars: []string{"BGS_REFERENCE_CRAWL"},
+			Value:   "sync",
+		},
+		&cli.StringFlag{
+			Name:    "unknown-op-kinds",
+			Usage:   "how to handle repo ops of an unrecognized kind: error or ignore",
+			EnvVars: []string{"BGS_UNKNOWN_OP_KINDS"},
+			Value:   "error",
+		},
+		&cli.StringFlag{
+			Name:    "event-order",
+			Usage:   "whether repo events are emitted after aggregating their records or before, aggregating them in the background: aggregate-first or emit-first",
+			EnvVars: []string{"BGS_EVENT_ORDER"},
+			Value:   "aggregate-first",
+		},
+		&cli.StringFlag{
+			Name:    "self-follow-records",
+			Usage:   "how to handle follow records whose subject is their author: store or reject",
+			EnvVars: []string{"BGS_SELF_FOLLOW_RECORDS"},
+			Value:   "store",
+		},
+		&cli.DurationFlag{
+			Name:    "reference-crawl-window",
+			Usage:   "how often batched reference crawls are flushed",
+			EnvVars: []string{"BGS_REFERENCE_CRAWL_WINDOW"},
+			Value:   time.Second * 5,
+		},
+		&cli.IntFlag{
+			Name:    "crawl-fanout-limit",
+			Usage:   "max number of new users a single repo crawl may create inline before deferring the rest (0 for no limit)",
+			EnvVars: []string{"BGS_CRAWL_FANOUT_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    "record-log-sample-rate",
+			Usage:   "only log 1 in this many record create, update and delete events (errors are always logged)",
+			EnvVars: []string{"BGS_RECORD_LOG_SAMPLE_RATE"},
+			Value:   1,
+		},
+		&cli.IntFlag{
+			Name:    "notification-queue-size",
+			Usage:   "max number of notifications buffered for a background writer before indexing waits on it (0 to write them inline)",
+			EnvVars: []string{"BGS_NOTIFICATION_QUEUE_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:    "initial-scrape-notifications",
+			Usage:   "whether records found in a user's initial scrape create notifications: notify or suppress",
+			EnvVars: []string{"BGS_INITIAL_SCRAPE_NOTIFICATIONS"},
+			Value:   "notify",
+		},
+		&cli.DurationFlag{
+			Name:    "new-user-crawl-delay",
+			Usage:   "how long to wait before crawling a newly referenced user, coalescing repeat references in the meantime",
+			EnvVars: []string{"BGS_NEW_USER_CRAWL_DELAY"},
+			Value:   0,
+		},
+		&cli.BoolFlag{
+			Name:    "dedup-new-users",
+			Usage:   "fold concurrent attempts to create the same newly referenced user into one",
+			EnvVars: []string{"BGS_DEDUP_NEW_USERS"},
+			Value:   true,
+		},
+		&cli.BoolFlag{
+			Name:    "toobig-sync-events",
+			Usage:   "emit #sync events instead of tooBig commits for commits over the event size limits",
+			EnvVars: []string{"BGS_TOOBIG_SYNC_EVENTS"},
+		},
+		&cli.BoolFlag{
+			Name:    "strict-reference-uris",
+			Usage:   "fail records referencing malformed at-uris instead of skipping the malformed references",
+			EnvVars: []string{"BGS_STRICT_REFERENCE_URIS"},
+		},
+		&cli.Float64Flag{
+			Name:    "placeholder-rate-limit",
+			Usage:   "placeholder posts per second a single repo's records may create for unknown posts (0 for no limit)",
+			EnvVars: []string{"BGS_PLACEHOLDER_RATE_LIMIT"},
+			Value:   0,
+		},
+		&cli.Int64Flag{
+			Name:    "max-placeholder-posts",
+			Usage:   "maximum number of placeholder posts waiting to be filled in (0 for no limit)",
+			EnvVars: []string{"BGS_MAX_PLACEHOLDER_POSTS"},
+			Value:   0,
+		},
+		&cli.DurationFlag{
+			Name:    "placeholder-max-age",
+			Usage:   "delete placeholder posts not filled in within this long (0 to keep them)",
+			EnvVars: []string{"BGS_PLACEHOLDER_MAX_AGE"},
+			Value:   0,
+		},
+		&cli.IntFlag{
+			Name:    "defer-missing-posts",
+			Usage:   "instead of creating placeholder posts, hold back up to this many records referencing unknown posts until the post is indexed (0 to create placeholders)",
+			EnvVars: []string{"BGS_DEFER_MISSING_POSTS"},
+			Value:   0,
+		},
+		&cli.DurationFlag{
+			Name:    "defer-missing-posts-ttl",
+			Usage:   "how long a record is held back waiting on an unknown post before it is dropped (0 to hold it until the post is indexed)",
+			EnvVars: []string{"BGS_DEFER_MISSING_POSTS_TTL"},
+			Value:   10 * time.Minute,
+		},
+		&cli.IntFlag{
+			Name:    "block-cache-size",
+			Usage:   "number of viewers whose blocks are cached for feed filtering (0 to not cache them)",
+			EnvVars: []string{"BGS_BLOCK_CACHE_SIZE"},
+			Value:   10000,
+		},
+		&cli.DurationFlag{
+			Name:    "block-cache-ttl",
+			Usage:   "how long a viewer's cached blocks are used for",
+			EnvVars: []string{"BGS_BLOCK_CACHE_TTL"},
+			Value:   time.Minute,
+		},
+		&cli.IntFlag{
+			Name:    "bulk-delete-threshold",
+			Usage:   "batch the deletes of commits deleting at least this many posts, reposts and follows (0 to handle each on its own)",
+			EnvVars: []string{"BGS_BULK_DELETE_THRESHOLD"},
+			Value:   50,
+		},
+		&cli.DurationFlag{
+			Name:    "pds-info-max-age",
+			Usage:   "refresh the software and version recorded for a PDS when crawling finds it older than this (0 to not track them)",
+			EnvVars: []string{"BGS_PDS_INFO_MAX_AGE"},
+			Value:   24 * time.Hour,
+		},
+		&cli.BoolFlag{
+			Name:    "ordered-repo-events",
+			Usage:   "serialize event handling per repo so each repo's events are emitted in rev order",
+			EnvVars: []string{"BGS_ORDERED_REPO_EVENTS"},
+		},
+		&cli.BoolFlag{
+			Name:    "shared-crawl-limits",
+			Usage:   "enforce per-pds crawl rate limits through the database, across all indexers using it",
+			EnvVars: []string{"BGS_SHARED_CRAWL_LIMITS"},
+		},
+		&cli.DurationFlag{
+			Name:    "db-query-timeout",
+			Usage:   "fail indexer database queries that run longer than this (0 to disable)",
+			EnvVars: []string{"BGS_DB_QUERY_TIMEOUT"},
+			Value:   0,
+		},
+		&cli.Int64Flag{
+			Name:    "crawl-snapshot-max-buffer",
+			Usage:   "max total bytes of buffered catch-up events saved with the crawl queue on shutdown",
+			EnvVars: []string{"BGS_CRAWL_SNAPSHOT_MAX_BUFFER"},
+			Value:   256 << 20,
+		},
+		&cli.IntFlag{
+			Name:    "catchup-lookahead",
+			Usage:   "number of buffered catch-up events to decode ahead of the one being applied",
+			EnvVars: []string{"BGS_CATCHUP_LOOKAHEAD"},
+			Value:   8,
+		},
+		&cli.DurationFlag{
+			Name:    "catchup-max-age",
+			Usage:   "fetch the repo instead of replaying buffered catch-up events older than this (0 to keep them indefinitely)",
+			EnvVars: []string{"BGS_CATCHUP_MAX_AGE"},
+			Value:   0,
+		},
+		&cli.IntFlag{
+			Name:    "max-catchup-events",
+			Usage:   "number of events to buffer per repo while it is being crawled before falling back to a full resync (0 for no limit)",
+			EnvVars: []string{"BGS_MAX_CATCHUP_EVENTS"},
+			Value:   2000,
+		},
+		&cli.BoolFlag{
+			Name:    "validate-records",
+			Usage:   "check indexed records against their lexicon schemas before aggregating them",
+			EnvVars: []string{"BGS_VALIDATE_RECORDS"},
+		},
+		&cli.BoolFlag{
+			Name:    "verify-record-cids",
+			Usage:   "check that indexed records hash to the cid their op claims before aggregating them",
+			EnvVars: []string{"BGS_VERIFY_RECORD_CIDS"},
+			Value:   true,
+		},
+		&cli.Int64Flag{
+			Name:    "aggregation-lag-alert-threshold",
+			Usage:   "warn when more than this many received repo events are waiting to be aggregated, 0 to disable",
+			EnvVars: []string{"BGS_AGGREGATION_LAG_ALERT_THRESHOLD"},
+		},
+		&cli.DurationFlag{
+			Name:    "aggregation-lag-alert-after",
+			Usage:   "how long the aggregation lag must stay above its threshold before warning",
+			EnvVars: []string{"BGS_AGGREGATION_LAG_ALERT_AFTER"},
+			Value:   time.Minute,
+		},
+		&cli.IntFlag{
+			Name:    "resolver-outage-failures",
+			Usage:   "pause creating users after this many DID resolution failures in a row, 0 to disable",
+			EnvVars: []string{"BGS_RESOLVER_OUTAGE_FAILURES"},
+			Value:   0,
+		},
+		&cli.DurationFlag{
+			Name:    "resolver-outage-probe-interval",
+			Usage:   "how often to try resolving a DID again while user creation is paused",
+			EnvVars: []string{"BGS_RESOLVER_OUTAGE_PROBE_INTERVAL"},
+			Value:   30 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    "allow-rev-regressions",
+			Usage:   "accept commits from PDSs whose rev does not advance the stored repo rev, for intentional re-imports",
+			EnvVars: []string{"BGS_ALLOW_REV_REGRESSIONS"},
+		},
+		&cli.DurationFlag{
+			Name:    "aggregation-timeout",
+			Usage:   "abandon aggregating a repo op after this long, 0 for no limit",
+			EnvVars: []string{"BGS_AGGREGATION_TIMEOUT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "collection-aggregation-timeouts",
+			Usage:   "per collection aggregation timeouts overriding aggregation-timeout, as collection=duration (eg, app.bsky.feed.post=5s)",
+			EnvVars: []string{"BGS_COLLECTION_AGGREGATION_TIMEOUTS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "collection-retention",
+			Usage:   "prune records of a collection indexed longer ago than this, as collection=duration (eg, app.bsky.feed.like=2160h); only likes and reposts can be pruned",
+			EnvVars: []string{"BGS_COLLECTION_RETENTION"},
+		},
 	}
 
 	app.Action = Bigsky
@@ -217,6 +500,15 @@ func Bigsky(cctx *cli.Context) error {
 		return err
 	}
 
+	var readdb *gorm.DB
+	if rurl := cctx.String("read-replica-db-url"); rurl != "" {
+		log.Infow("setting up read replica database")
+		readdb, err = cliutil.SetupDatabase(rurl, cctx.Int("max-metadb-connections"))
+		if err != nil {
+			return err
+		}
+	}
+
 	log.Infow("setting up carstore database")
 	csdburl := cctx.String("carstore-db-url")
 	csdb, err := cliutil.SetupDatabase(csdburl, cctx.Int("max-carstore-connections"))
@@ -231,6 +523,11 @@ func Bigsky(cctx *cli.Context) error {
 		if err := csdb.Use(tracing.NewPlugin()); err != nil {
 			return err
 		}
+		if readdb != nil {
+			if err := readdb.Use(tracing.NewPlugin()); err != nil {
+				return err
+			}
+		}
 	}
 
 	os.MkdirAll(filepath.Dir(csdir), os.ModePerm)
@@ -255,6 +552,7 @@ func Bigsky(cctx *cli.Context) error {
 	kmgr := indexer.NewKeyManager(cachedidr, nil)
 
 	repoman := repomgr.NewRepoManager(cstore, kmgr)
+	repoman.SetAllowRevRegressions(cctx.Bool("allow-rev-regressions"))
 
 	var persister events.EventPersistence
 
@@ -265,6 +563,17 @@ func Bigsky(cctx *cli.Context) error {
 			return fmt.Errorf("setting up disk persister: %w", err)
 		}
 		persister = dp
+	} else if cctx.Bool("db-event-store") {
+		log.Infow("setting up db event store")
+		store, err := events.NewDBEventStore(db)
+		if err != nil {
+			return fmt.Errorf("setting up db event store: %w", err)
+		}
+		sp, err := events.NewStorePersister(context.Background(), store)
+		if err != nil {
+			return fmt.Errorf("setting up event store persister: %w", err)
+		}
+		persister = sp
 	} else {
 		dbp, err := events.NewDbPersistence(db, cstore, nil)
 		if err != nil {
@@ -282,6 +591,117 @@ func Bigsky(cctx *cli.Context) error {
 		return err
 	}
 
+	switch cctx.String("reference-crawl") {
+	case "sync":
+	case "batched":
+		ix.SetReferenceCrawlMode(context.Background(), indexer.RefCrawlBatched, cctx.Duration("reference-crawl-window"))
+	case "off":
+		ix.SetReferenceCrawlMode(context.Background(), indexer.RefCrawlDisabled, 0)
+	default:
+		return fmt.Errorf("invalid reference-crawl mode: %q", cctx.String("reference-crawl"))
+	}
+
+	switch cctx.String("unknown-op-kinds") {
+	case "error":
+	case "ignore":
+		ix.SetUnknownOpPolicy(indexer.UnknownOpIgnore)
+	default:
+		return fmt.Errorf("invalid unknown-op-kinds policy: %q", cctx.String("unknown-op-kinds"))
+	}
+
+	switch cctx.String("event-order") {
+	case "aggregate-first":
+	case "emit-first":
+		ix.SetEventOrder(context.Background(), indexer.EmitThenAggregate)
+	default:
+		return fmt.Errorf("invalid event-order: %q", cctx.String("event-order"))
+	}
+
+	switch cctx.String("self-follow-records") {
+	case "store":
+	case "reject":
+		ix.SetSelfFollowPolicy(indexer.SelfFollowReject)
+	default:
+		return fmt.Errorf("invalid self-follow-records policy: %q", cctx.String("self-follow-records"))
+	}
+
+	switch cctx.String("initial-scrape-notifications") {
+	case "notify":
+	case "suppress":
+		ix.SetInitialScrapeNotifications(indexer.InitialScrapeSuppress)
+	default:
+		return fmt.Errorf("invalid initial-scrape-notifications setting: %q", cctx.String("initial-scrape-notifications"))
+	}
+
+	ix.SetNotificationQueueSize(context.Background(), cctx.Int("notification-queue-size"))
+	ix.SetRecordLogSampleRate(cctx.Int("record-log-sample-rate"))
+	ix.SetNewUserCrawlDelay(cctx.Duration("new-user-crawl-delay"))
+	ix.SetDedupMissingUsers(cctx.Bool("dedup-new-users"))
+	ix.SetCrawlFanoutLimit(context.Background(), cctx.Int("crawl-fanout-limit"))
+	if readdb != nil {
+		if err := ix.SetReadReplica(readdb); err != nil {
+			return fmt.Errorf("setting read replica: %w", err)
+		}
+	}
+	ix.SetRecordValidation(cctx.Bool("validate-records"))
+	ix.SetRecordCidVerification(cctx.Bool("verify-record-cids"))
+	ix.SetAggregationTimeout(cctx.Duration("aggregation-timeout"))
+	ix.SetAggregationLagAlert(context.Background(), cctx.Int64("aggregation-lag-alert-threshold"), cctx.Duration("aggregation-lag-alert-after"))
+	ix.SetResolverOutageDetection(cctx.Int("resolver-outage-failures"), cctx.Duration("resolver-outage-probe-interval"))
+	for _, ct := range cctx.StringSlice("collection-aggregation-timeouts") {
+		collection, timeout, ok := strings.Cut(ct, "=")
+		if !ok {
+			return fmt.Errorf("invalid collection aggregation timeout %q, expected collection=duration", ct)
+		}
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid collection aggregation timeout %q: %w", ct, err)
+		}
+		ix.SetCollectionAggregationTimeout(collection, d)
+	}
+	retention := make(map[string]time.Duration)
+	for _, cr := range cctx.StringSlice("collection-retention") {
+		collection, maxAge, ok := strings.Cut(cr, "=")
+		if !ok {
+			return fmt.Errorf("invalid collection retention %q, expected collection=duration", cr)
+		}
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return fmt.Errorf("invalid collection retention %q: %w", cr, err)
+		}
+		retention[collection] = d
+	}
+	if err := ix.SetRetention(context.Background(), retention); err != nil {
+		return fmt.Errorf("setting retention: %w", err)
+	}
+	ix.SetCatchupLookahead(cctx.Int("catchup-lookahead"))
+	ix.SetCatchupMaxAge(cctx.Duration("catchup-max-age"))
+	ix.Crawler.SetMaxCatchupEvents(cctx.Int("max-catchup-events"))
+	ix.SetTooBigSyncEvents(cctx.Bool("toobig-sync-events"))
+	ix.SetStrictReferenceUris(cctx.Bool("strict-reference-uris"))
+	ix.SetCrawlSnapshotMaxBuffer(cctx.Int64("crawl-snapshot-max-buffer"))
+	ix.SetOrderedRepoEvents(cctx.Bool("ordered-repo-events"))
+	if err := ix.SetPlaceholderLimits(rate.Limit(cctx.Float64("placeholder-rate-limit")), cctx.Int64("max-placeholder-posts")); err != nil {
+		return fmt.Errorf("setting placeholder limits: %w", err)
+	}
+	ix.SetPlaceholderGC(context.Background(), cctx.Duration("placeholder-max-age"))
+	ix.SetDeferMissingPosts(cctx.Int("defer-missing-posts"), cctx.Duration("defer-missing-posts-ttl"))
+	ix.SetPDSInfoMaxAge(cctx.Duration("pds-info-max-age"))
+	ix.SetBulkDeleteThreshold(cctx.Int("bulk-delete-threshold"))
+	if err := ix.SetBlockCache(cctx.Int("block-cache-size"), cctx.Duration("block-cache-ttl")); err != nil {
+		return fmt.Errorf("setting up block cache: %w", err)
+	}
+	if cctx.Bool("shared-crawl-limits") {
+		ls, err := indexer.NewDBLimitStore(db)
+		if err != nil {
+			return fmt.Errorf("setting up shared crawl limits: %w", err)
+		}
+		ix.SetSharedLimitStore(ls)
+	}
+	if err := ix.SetQueryTimeout(cctx.Duration("db-query-timeout")); err != nil {
+		return fmt.Errorf("setting db query timeout: %w", err)
+	}
+
 	rlskip := os.Getenv("BSKY_SOCIAL_RATE_LIMIT_SKIP")
 	ix.ApplyPDSClientSettings = func(c *xrpc.Client) {
 		if c.Host == "https://bsky.social" {
@@ -334,6 +754,24 @@ func Bigsky(cctx *cli.Context) error {
 		return err
 	}
 
+	bgs.SetMaxConcurrentRepoExports(cctx.Int("max-concurrent-repo-exports"))
+	bgs.SetMaxGetRepoDiffCommits(cctx.Int64("max-get-repo-diff-commits"))
+	bgs.SetBlobProxy(cctx.Bool("blob-proxy"), cctx.Int64("blob-proxy-max-size"))
+	bgs.SetLabelSource(cctx.String("label-source"))
+	bgs.SetListReposMaxLimit(cctx.Int("list-repos-max-limit"))
+	bgs.SetVerifyPDSDescribe(cctx.Bool("verify-pds-describe"))
+	if err := bgs.SetFirehoseCompression(cctx.StringSlice("firehose-compression")); err != nil {
+		return err
+	}
+	if err := bgs.SetFirehoseRecordRefs(cctx.Bool("firehose-record-refs")); err != nil {
+		return err
+	}
+
+	// pick up crawls that were still pending when we last shut down
+	if err := ix.RestoreCrawlQueue(context.Background()); err != nil {
+		return fmt.Errorf("failed to restore crawl queue: %w", err)
+	}
+
 	if tok := cctx.String("admin-key"); tok != "" {
 		if err := bgs.CreateAdminToken(tok); err != nil {
 			return fmt.Errorf("failed to set up admin token: %w", err)
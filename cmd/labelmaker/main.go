@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -141,6 +142,16 @@ func run(args []string) error {
 			Usage:   "SQRL API endpoint (full URL)",
 			EnvVars: []string{"LABELMAKER_SQRL_URL"},
 		},
+		&cli.StringFlag{
+			Name:    "report-webhook-url",
+			Usage:   "URL to POST newly created moderation reports to",
+			EnvVars: []string{"LABELMAKER_REPORT_WEBHOOK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "report-webhook-secret",
+			Usage:   "secret used to HMAC-sign report webhook payloads",
+			EnvVars: []string{"LABELMAKER_REPORT_WEBHOOK_SECRET"},
+		},
 		&cli.IntFlag{
 			Name:    "max-carstore-connections",
 			EnvVars: []string{"MAX_CARSTORE_CONNECTIONS"},
@@ -216,6 +227,8 @@ func run(args []string) error {
 		microNSFWImgURL := cctx.String("micro-nsfw-img-url")
 		hiveAIToken := cctx.String("hiveai-api-token")
 		sqrlURL := cctx.String("sqrl-url")
+		reportWebhookURL := cctx.String("report-webhook-url")
+		reportWebhookSecret := cctx.String("report-webhook-secret")
 
 		if repoPassword == "admin" {
 			log.Warn("using insecure default admin password (ok for dev, not for deployment)")
@@ -263,6 +276,13 @@ func run(args []string) error {
 			srv.AddSQRLLabeler(sqrlURL)
 		}
 
+		if reportWebhookURL != "" {
+			if reportWebhookSecret == "" {
+				return fmt.Errorf("report webhook requires a signing secret")
+			}
+			srv.AddReportWebhook(reportWebhookURL, reportWebhookSecret)
+		}
+
 		srv.SubscribeBGS(context.TODO(), bgsURL, useWss)
 		return srv.RunAPI(bind)
 	}
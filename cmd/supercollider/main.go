@@ -704,6 +704,7 @@ func (s *Server) HandleWellKnownDid(c echo.Context) error {
 func (s *Server) DescribeServerHandler(c echo.Context) error {
 	invcode := false
 	resp := &atproto.ServerDescribeServer_Output{
+		Did:                  "did:web:" + c.Request().Host,
 		InviteCodeRequired:   &invcode,
 		AvailableUserDomains: []string{},
 		Links:                &atproto.ServerDescribeServer_Links{},
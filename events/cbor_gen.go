@@ -25,8 +25,17 @@ func (t *EventHeader) MarshalCBOR(w io.Writer) error {
 	}
 
 	cw := cbg.NewCborWriter(w)
+	fieldCount := 4
 
-	if _, err := cw.Write([]byte{162}); err != nil {
+	if t.Codec == "" {
+		fieldCount--
+	}
+
+	if t.Records == nil {
+		fieldCount--
+	}
+
+	if _, err := cw.Write(cbg.CborEncodeMajorType(cbg.MajMap, uint64(fieldCount))); err != nil {
 		return err
 	}
 
@@ -74,6 +83,60 @@ func (t *EventHeader) MarshalCBOR(w io.Writer) error {
 			return err
 		}
 	}
+
+	// t.Codec (string) (string)
+	if t.Codec != "" {
+
+		if len("codec") > cbg.MaxLength {
+			return xerrors.Errorf("Value in field \"codec\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("codec"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("codec")); err != nil {
+			return err
+		}
+
+		if len(t.Codec) > cbg.MaxLength {
+			return xerrors.Errorf("Value in field t.Codec was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len(t.Codec))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string(t.Codec)); err != nil {
+			return err
+		}
+	}
+
+	// t.Records ([]events.RecordRef) (slice)
+	if t.Records != nil {
+
+		if len("records") > cbg.MaxLength {
+			return xerrors.Errorf("Value in field \"records\" was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("records"))); err != nil {
+			return err
+		}
+		if _, err := cw.WriteString(string("records")); err != nil {
+			return err
+		}
+
+		if len(t.Records) > cbg.MaxLength {
+			return xerrors.Errorf("Slice value in field t.Records was too long")
+		}
+
+		if err := cw.WriteMajorTypeHeader(cbg.MajArray, uint64(len(t.Records))); err != nil {
+			return err
+		}
+		for _, v := range t.Records {
+			if err := v.MarshalCBOR(cw); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -152,6 +215,46 @@ func (t *EventHeader) UnmarshalCBOR(r io.Reader) (err error) {
 
 				t.Op = int64(extraI)
 			}
+			// t.Codec (string) (string)
+		case "codec":
+
+			{
+				sval, err := cbg.ReadString(cr)
+				if err != nil {
+					return err
+				}
+
+				t.Codec = string(sval)
+			}
+			// t.Records ([]events.RecordRef) (slice)
+		case "records":
+
+			maj, extra, err = cr.ReadHeader()
+			if err != nil {
+				return err
+			}
+
+			if extra > cbg.MaxLength {
+				return fmt.Errorf("t.Records: array too large (%d)", extra)
+			}
+
+			if maj != cbg.MajArray {
+				return fmt.Errorf("expected cbor array")
+			}
+
+			if extra > 0 {
+				t.Records = make([]RecordRef, extra)
+			}
+
+			for i := 0; i < int(extra); i++ {
+
+				var v RecordRef
+				if err := v.UnmarshalCBOR(cr); err != nil {
+					return err
+				}
+
+				t.Records[i] = v
+			}
 
 		default:
 			// Field doesn't exist on this type, so ignore it
@@ -290,3 +393,160 @@ func (t *ErrorFrame) UnmarshalCBOR(r io.Reader) (err error) {
 
 	return nil
 }
+func (t *RecordRef) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+
+	cw := cbg.NewCborWriter(w)
+
+	if _, err := cw.Write([]byte{162}); err != nil {
+		return err
+	}
+
+	// t.Length (int64) (int64)
+	if len("length") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"length\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("length"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("length")); err != nil {
+		return err
+	}
+
+	if t.Length >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Length)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.Length-1)); err != nil {
+			return err
+		}
+	}
+
+	// t.Offset (int64) (int64)
+	if len("offset") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"offset\" was too long")
+	}
+
+	if err := cw.WriteMajorTypeHeader(cbg.MajTextString, uint64(len("offset"))); err != nil {
+		return err
+	}
+	if _, err := cw.WriteString(string("offset")); err != nil {
+		return err
+	}
+
+	if t.Offset >= 0 {
+		if err := cw.WriteMajorTypeHeader(cbg.MajUnsignedInt, uint64(t.Offset)); err != nil {
+			return err
+		}
+	} else {
+		if err := cw.WriteMajorTypeHeader(cbg.MajNegativeInt, uint64(-t.Offset-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *RecordRef) UnmarshalCBOR(r io.Reader) (err error) {
+	*t = RecordRef{}
+
+	cr := cbg.NewCborReader(r)
+
+	maj, extra, err := cr.ReadHeader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("RecordRef: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadString(cr)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Length (int64) (int64)
+		case "length":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Length = int64(extraI)
+			}
+			// t.Offset (int64) (int64)
+		case "offset":
+			{
+				maj, extra, err := cr.ReadHeader()
+				var extraI int64
+				if err != nil {
+					return err
+				}
+				switch maj {
+				case cbg.MajUnsignedInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 positive overflow")
+					}
+				case cbg.MajNegativeInt:
+					extraI = int64(extra)
+					if extraI < 0 {
+						return fmt.Errorf("int64 negative overflow")
+					}
+					extraI = -1 - extraI
+				default:
+					return fmt.Errorf("wrong type for int64 field: %d", maj)
+				}
+
+				t.Offset = int64(extraI)
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// BlockCodec compresses the CAR slice carried in #commit events. Subscribers
+// opt in to a codec when connecting; the codec used is named in the frame
+// header so consumers that didn't ask for compression never see it.
+// Decompress must fail rather than produce more than maxSize bytes, so a
+// small frame can't expand into an unbounded amount of memory.
+type BlockCodec interface {
+	Name() string
+	Compress([]byte) ([]byte, error)
+	Decompress(b []byte, maxSize int) ([]byte, error)
+}
+
+var (
+	blockCodecsLk sync.RWMutex
+	blockCodecs   = map[string]BlockCodec{
+		"gzip": gzipCodec{},
+	}
+)
+
+// RegisterBlockCodec makes a codec available for negotiation by name,
+// replacing any existing codec with the same name.
+func RegisterBlockCodec(c BlockCodec) {
+	blockCodecsLk.Lock()
+	defer blockCodecsLk.Unlock()
+
+	blockCodecs[c.Name()] = c
+}
+
+func GetBlockCodec(name string) (BlockCodec, bool) {
+	blockCodecsLk.RLock()
+	defer blockCodecsLk.RUnlock()
+
+	c, ok := blockCodecs[name]
+	return c, ok
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) Compress(b []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(b []byte, maxSize int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxSize {
+		return nil, fmt.Errorf("decompressed blocks exceed %d bytes", maxSize)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package events_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bluesky-social/indigo/events"
+)
+
+func TestGzipBlockCodec(t *testing.T) {
+	codec, ok := events.GetBlockCodec("gzip")
+	if !ok {
+		t.Fatal("gzip codec not registered")
+	}
+
+	blocks := bytes.Repeat([]byte("some car slice bytes "), 100)
+
+	comp, err := codec.Compress(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comp) >= len(blocks) {
+		t.Fatalf("expected compressed blocks to be smaller: %d >= %d", len(comp), len(blocks))
+	}
+
+	out, err := codec.Decompress(comp, len(blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, blocks) {
+		t.Fatal("round tripped blocks do not match")
+	}
+
+	if _, err := codec.Decompress(comp, len(blocks)-1); err == nil {
+		t.Fatal("expected blocks larger than the max size to be rejected")
+	}
+}
+
+func TestEventHeaderCodecOptional(t *testing.T) {
+	buf := new(bytes.Buffer)
+	hdr := events.EventHeader{Op: events.EvtKindMessage, MsgType: "#commit"}
+	if err := hdr.MarshalCBOR(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var out events.EventHeader
+	if err := out.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, hdr) {
+		t.Fatalf("header mismatch: %+v != %+v", out, hdr)
+	}
+
+	buf.Reset()
+	hdr.Codec = "gzip"
+	if err := hdr.MarshalCBOR(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.UnmarshalCBOR(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if out.Codec != "gzip" {
+		t.Fatalf("expected codec to round trip, got %q", out.Codec)
+	}
+}
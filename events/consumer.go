@@ -13,10 +13,13 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/gorilla/websocket"
+	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
 type RepoStreamCallbacks struct {
 	RepoCommit    func(evt *comatproto.SyncSubscribeRepos_Commit) error
+	RepoSync      func(evt *comatproto.SyncSubscribeRepos_Sync) error
+	RepoAccount   func(evt *comatproto.SyncSubscribeRepos_Account) error
 	RepoHandle    func(evt *comatproto.SyncSubscribeRepos_Handle) error
 	RepoInfo      func(evt *comatproto.SyncSubscribeRepos_Info) error
 	RepoMigrate   func(evt *comatproto.SyncSubscribeRepos_Migrate) error
@@ -30,6 +33,10 @@ func (rsc *RepoStreamCallbacks) EventHandler(ctx context.Context, xev *XRPCStrea
 	switch {
 	case xev.RepoCommit != nil && rsc.RepoCommit != nil:
 		return rsc.RepoCommit(xev.RepoCommit)
+	case xev.RepoSync != nil && rsc.RepoSync != nil:
+		return rsc.RepoSync(xev.RepoSync)
+	case xev.RepoAccount != nil && rsc.RepoAccount != nil:
+		return rsc.RepoAccount(xev.RepoAccount)
 	case xev.RepoHandle != nil && rsc.RepoHandle != nil:
 		return rsc.RepoHandle(xev.RepoHandle)
 	case xev.RepoInfo != nil && rsc.RepoInfo != nil:
@@ -153,6 +160,20 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler)
 					return fmt.Errorf("reading repoCommit event: %w", err)
 				}
 
+				if header.Codec != "" {
+					codec, ok := GetBlockCodec(header.Codec)
+					if !ok {
+						return fmt.Errorf("unknown block codec in commit event: %q", header.Codec)
+					}
+
+					// held to the same limit as uncompressed blocks
+					blks, err := codec.Decompress(evt.Blocks, cbg.ByteArrayMaxLen)
+					if err != nil {
+						return fmt.Errorf("decompressing repoCommit blocks: %w", err)
+					}
+					evt.Blocks = blks
+				}
+
 				if evt.Seq < lastSeq {
 					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
 				}
@@ -160,7 +181,8 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler)
 				lastSeq = evt.Seq
 
 				if err := sched.AddWork(ctx, evt.Repo, &XRPCStreamEvent{
-					RepoCommit: &evt,
+					RepoCommit:     &evt,
+					PrivRecordRefs: header.Records,
 				}); err != nil {
 					return err
 				}
@@ -192,6 +214,38 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler)
 				}); err != nil {
 					return err
 				}
+			case "#sync":
+				var evt comatproto.SyncSubscribeRepos_Sync
+				if err := evt.UnmarshalCBOR(r); err != nil {
+					return fmt.Errorf("reading repoSync event: %w", err)
+				}
+
+				if evt.Seq < lastSeq {
+					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
+				}
+				lastSeq = evt.Seq
+
+				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
+					RepoSync: &evt,
+				}); err != nil {
+					return err
+				}
+			case "#account":
+				var evt comatproto.SyncSubscribeRepos_Account
+				if err := evt.UnmarshalCBOR(r); err != nil {
+					return fmt.Errorf("reading repoAccount event: %w", err)
+				}
+
+				if evt.Seq < lastSeq {
+					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
+				}
+				lastSeq = evt.Seq
+
+				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
+					RepoAccount: &evt,
+				}); err != nil {
+					return err
+				}
 			case "#migrate":
 				var evt comatproto.SyncSubscribeRepos_Migrate
 				if err := evt.UnmarshalCBOR(r); err != nil {
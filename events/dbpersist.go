@@ -73,6 +73,13 @@ type RepoEventRecord struct {
 	Prev      *models.DbCID
 	NewHandle *string // NewHandle is only set if this is a handle change event
 
+	// Blocks is only set for sync events, which carry their commit block
+	// instead of referring to the carstore
+	Blocks []byte
+	// Active and Status are only set for account events
+	Active *bool
+	Status *string
+
 	Time   time.Time
 	Blobs  []byte
 	Repo   models.Uid
@@ -165,6 +172,10 @@ func (p *DbPersistence) flushBatchLocked(ctx context.Context) error {
 			e.RepoCommit.Seq = int64(item.Seq)
 		case e.RepoHandle != nil:
 			e.RepoHandle.Seq = int64(item.Seq)
+		case e.RepoSync != nil:
+			e.RepoSync.Seq = int64(item.Seq)
+		case e.RepoAccount != nil:
+			e.RepoAccount.Seq = int64(item.Seq)
 		default:
 			return fmt.Errorf("unknown event type")
 		}
@@ -209,6 +220,16 @@ func (p *DbPersistence) Persist(ctx context.Context, e *XRPCStreamEvent) error {
 		if err != nil {
 			return err
 		}
+	case e.RepoSync != nil:
+		rer, err = p.RecordFromRepoSync(ctx, e.RepoSync)
+		if err != nil {
+			return err
+		}
+	case e.RepoAccount != nil:
+		rer, err = p.RecordFromAccount(ctx, e.RepoAccount)
+		if err != nil {
+			return err
+		}
 	default:
 		return nil
 	}
@@ -239,6 +260,47 @@ func (p *DbPersistence) RecordFromHandleChange(ctx context.Context, evt *comatpr
 	}, nil
 }
 
+func (p *DbPersistence) RecordFromRepoSync(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Sync) (*RepoEventRecord, error) {
+	t, err := time.Parse(util.ISO8601, evt.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := p.uidForDid(ctx, evt.Did)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RepoEventRecord{
+		Repo:   uid,
+		Type:   "repo_sync",
+		Time:   t,
+		Rev:    evt.Rev,
+		Blocks: evt.Blocks,
+	}, nil
+}
+
+func (p *DbPersistence) RecordFromAccount(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Account) (*RepoEventRecord, error) {
+	t, err := time.Parse(util.ISO8601, evt.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := p.uidForDid(ctx, evt.Did)
+	if err != nil {
+		return nil, err
+	}
+
+	active := evt.Active
+	return &RepoEventRecord{
+		Repo:   uid,
+		Type:   "repo_account",
+		Time:   t,
+		Active: &active,
+		Status: evt.Status,
+	}, nil
+}
+
 func (p *DbPersistence) RecordFromRepoCommit(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Commit) (*RepoEventRecord, error) {
 	// TODO: hack hack hack
 	if len(evt.Ops) > 8192 {
@@ -371,6 +433,10 @@ func (p *DbPersistence) hydrateBatch(ctx context.Context, batch []*RepoEventReco
 				streamEvent, err = p.hydrateCommit(ctx, record)
 			case record.NewHandle != nil:
 				streamEvent, err = p.hydrateHandleChange(ctx, record)
+			case record.Type == "repo_sync":
+				streamEvent, err = p.hydrateRepoSync(ctx, record)
+			case record.Type == "repo_account":
+				streamEvent, err = p.hydrateAccount(ctx, record)
 			default:
 				err = fmt.Errorf("unknown event type: %s", record.Type)
 			}
@@ -452,6 +518,44 @@ func (p *DbPersistence) hydrateHandleChange(ctx context.Context, rer *RepoEventR
 	}, nil
 }
 
+func (p *DbPersistence) hydrateRepoSync(ctx context.Context, rer *RepoEventRecord) (*XRPCStreamEvent, error) {
+	did, err := p.didForUid(ctx, rer.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &XRPCStreamEvent{
+		RepoSync: &comatproto.SyncSubscribeRepos_Sync{
+			Seq:    int64(rer.Seq),
+			Did:    did,
+			Rev:    rer.Rev,
+			Blocks: rer.Blocks,
+			Time:   rer.Time.Format(util.ISO8601),
+		},
+	}, nil
+}
+
+func (p *DbPersistence) hydrateAccount(ctx context.Context, rer *RepoEventRecord) (*XRPCStreamEvent, error) {
+	if rer.Active == nil {
+		return nil, fmt.Errorf("Active is nil")
+	}
+
+	did, err := p.didForUid(ctx, rer.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &XRPCStreamEvent{
+		RepoAccount: &comatproto.SyncSubscribeRepos_Account{
+			Seq:    int64(rer.Seq),
+			Did:    did,
+			Active: *rer.Active,
+			Status: rer.Status,
+			Time:   rer.Time.Format(util.ISO8601),
+		},
+	}, nil
+}
+
 func (p *DbPersistence) hydrateCommit(ctx context.Context, rer *RepoEventRecord) (*XRPCStreamEvent, error) {
 	if rer.Commit == nil {
 		return nil, fmt.Errorf("commit is nil")
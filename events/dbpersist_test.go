@@ -268,6 +268,76 @@ func BenchmarkPlayback(b *testing.B) {
 	}
 }
 
+func TestDBPersistSyncAndAccountEvents(t *testing.T) {
+	ctx := context.Background()
+
+	db, _, cs, tempPath, err := setupDBs(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempPath)
+
+	db.AutoMigrate(&models.ActorInfo{})
+	db.Create(&models.ActorInfo{
+		Uid: 1,
+		Did: "did:example:123",
+	})
+
+	dbp, err := events.NewDbPersistence(db, cs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events.NewEventManager(dbp)
+
+	now := time.Now().Format(util.ISO8601)
+	status := "takendown"
+	if err := dbp.Persist(ctx, &events.XRPCStreamEvent{
+		RepoSync: &atproto.SyncSubscribeRepos_Sync{
+			Did:    "did:example:123",
+			Rev:    "3ksqxrdr7ul2l",
+			Blocks: []byte("commit block"),
+			Time:   now,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbp.Persist(ctx, &events.XRPCStreamEvent{
+		RepoAccount: &atproto.SyncSubscribeRepos_Account{
+			Did:    "did:example:123",
+			Active: false,
+			Status: &status,
+			Time:   now,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbp.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []*events.XRPCStreamEvent
+	if err := dbp.Playback(ctx, 0, func(evt *events.XRPCStreamEvent) error {
+		out = append(out, evt)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(out))
+	}
+
+	se := out[0].RepoSync
+	if se == nil || se.Seq != 1 || se.Did != "did:example:123" || se.Rev != "3ksqxrdr7ul2l" || string(se.Blocks) != "commit block" {
+		t.Fatalf("unexpected sync event: %+v", out[0])
+	}
+
+	acct := out[1].RepoAccount
+	if acct == nil || acct.Seq != 2 || acct.Did != "did:example:123" || acct.Active || acct.Status == nil || *acct.Status != status {
+		t.Fatalf("unexpected account event: %+v", out[1])
+	}
+}
+
 func setupDBs(t testing.TB) (*gorm.DB, *gorm.DB, *carstore.CarStore, string, error) {
 	dir, err := os.MkdirTemp("", "integtest")
 	if err != nil {
@@ -0,0 +1,169 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBEventStore is an EventStore keeping the event log in a SQL table, keyed
+// by sequence number.
+type DBEventStore struct {
+	db *gorm.DB
+
+	readBatchSize int
+}
+
+type StoreEvent struct {
+	Seq  int64      `gorm:"primaryKey;autoIncrement:false"`
+	Uid  models.Uid `gorm:"index"`
+	Kind uint32
+	Data []byte
+}
+
+type StoreTakedown struct {
+	Uid models.Uid `gorm:"primaryKey;autoIncrement:false"`
+}
+
+func NewDBEventStore(db *gorm.DB) (*DBEventStore, error) {
+	if err := db.AutoMigrate(&StoreEvent{}, &StoreTakedown{}); err != nil {
+		return nil, err
+	}
+
+	return &DBEventStore{
+		db:            db,
+		readBatchSize: 1000,
+	}, nil
+}
+
+func (s *DBEventStore) Append(ctx context.Context, e *XRPCStreamEvent) error {
+	var buf bytes.Buffer
+
+	var kind uint32
+	switch {
+	case e.RepoCommit != nil:
+		kind = evtKindCommit
+		if err := e.RepoCommit.MarshalCBOR(&buf); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	case e.RepoHandle != nil:
+		kind = evtKindHandle
+		if err := e.RepoHandle.MarshalCBOR(&buf); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	case e.RepoSync != nil:
+		kind = evtKindSync
+		if err := e.RepoSync.MarshalCBOR(&buf); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	case e.RepoAccount != nil:
+		kind = evtKindAccount
+		if err := e.RepoAccount.MarshalCBOR(&buf); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	default:
+		// same four kinds as the disk persister
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Create(&StoreEvent{
+		Seq:  e.sequence(),
+		Uid:  e.PrivUid,
+		Kind: kind,
+		Data: buf.Bytes(),
+	}).Error
+}
+
+func (s *DBEventStore) ReadSince(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error) error {
+	for {
+		var batch []StoreEvent
+		if err := s.db.WithContext(ctx).Where("seq > ?", since).Order("seq asc").Limit(s.readBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+
+		for _, se := range batch {
+			evt, err := se.hydrate()
+			if err != nil {
+				return fmt.Errorf("failed to read event %d: %w", se.Seq, err)
+			}
+
+			if err := cb(evt); err != nil {
+				return err
+			}
+			since = se.Seq
+		}
+
+		if len(batch) < s.readBatchSize {
+			return nil
+		}
+	}
+}
+
+func (se *StoreEvent) hydrate() (*XRPCStreamEvent, error) {
+	r := bytes.NewReader(se.Data)
+
+	out := &XRPCStreamEvent{PrivUid: se.Uid}
+	switch se.Kind {
+	case evtKindCommit:
+		var evt atproto.SyncSubscribeRepos_Commit
+		if err := evt.UnmarshalCBOR(r); err != nil {
+			return nil, err
+		}
+		evt.Seq = se.Seq
+		out.RepoCommit = &evt
+	case evtKindHandle:
+		var evt atproto.SyncSubscribeRepos_Handle
+		if err := evt.UnmarshalCBOR(r); err != nil {
+			return nil, err
+		}
+		evt.Seq = se.Seq
+		out.RepoHandle = &evt
+	case evtKindSync:
+		var evt atproto.SyncSubscribeRepos_Sync
+		if err := evt.UnmarshalCBOR(r); err != nil {
+			return nil, err
+		}
+		evt.Seq = se.Seq
+		out.RepoSync = &evt
+	case evtKindAccount:
+		var evt atproto.SyncSubscribeRepos_Account
+		if err := evt.UnmarshalCBOR(r); err != nil {
+			return nil, err
+		}
+		evt.Seq = se.Seq
+		out.RepoAccount = &evt
+	default:
+		return nil, fmt.Errorf("unrecognized event kind %d", se.Kind)
+	}
+
+	return out, nil
+}
+
+func (s *DBEventStore) LastSeq(ctx context.Context) (int64, error) {
+	var last int64
+	if err := s.db.WithContext(ctx).Model(&StoreEvent{}).Select("coalesce(max(seq), 0)").Scan(&last).Error; err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+func (s *DBEventStore) Truncate(ctx context.Context, before int64) error {
+	return s.db.WithContext(ctx).Where("seq < ?", before).Delete(&StoreEvent{}).Error
+}
+
+func (s *DBEventStore) TakeDown(ctx context.Context, uid models.Uid) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&StoreTakedown{Uid: uid}).Error
+}
+
+func (s *DBEventStore) TakenDown(ctx context.Context) ([]models.Uid, error) {
+	var uids []models.Uid
+	if err := s.db.WithContext(ctx).Model(&StoreTakedown{}).Pluck("uid", &uids).Error; err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
@@ -273,8 +273,10 @@ func scanForLastSeq(fi *os.File, end int64) (int64, error) {
 }
 
 const (
-	evtKindCommit = 1
-	evtKindHandle = 2
+	evtKindCommit  = 1
+	evtKindHandle  = 2
+	evtKindSync    = 3
+	evtKindAccount = 4
 )
 
 var emptyHeader = make([]byte, headerSize)
@@ -450,8 +452,12 @@ func (dp *DiskPersistence) doPersist(ctx context.Context, j persistJob) error {
 		e.RepoCommit.Seq = seq
 	case e.RepoHandle != nil:
 		e.RepoHandle.Seq = seq
+	case e.RepoSync != nil:
+		e.RepoSync.Seq = seq
+	case e.RepoAccount != nil:
+		e.RepoAccount.Seq = seq
 	default:
-		// only those two get peristed right now
+		// only those four get peristed right now
 		// we shouldnt actually ever get here...
 		return nil
 	}
@@ -502,9 +508,21 @@ func (dp *DiskPersistence) Persist(ctx context.Context, e *XRPCStreamEvent) erro
 		if err := e.RepoHandle.MarshalCBOR(cw); err != nil {
 			return fmt.Errorf("failed to marshal: %w", err)
 		}
+	case e.RepoSync != nil:
+		evtKind = evtKindSync
+		did = e.RepoSync.Did
+		if err := e.RepoSync.MarshalCBOR(cw); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+	case e.RepoAccount != nil:
+		evtKind = evtKindAccount
+		did = e.RepoAccount.Did
+		if err := e.RepoAccount.MarshalCBOR(cw); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
 	default:
 		return nil
-		// only those two get peristed right now
+		// only those four get peristed right now
 	}
 
 	usr, err := dp.uidForDid(ctx, did)
@@ -691,6 +709,24 @@ func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn s
 			if err := cb(&XRPCStreamEvent{RepoHandle: &evt}); err != nil {
 				return err
 			}
+		case evtKindSync:
+			var evt atproto.SyncSubscribeRepos_Sync
+			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+				return err
+			}
+			evt.Seq = h.Seq
+			if err := cb(&XRPCStreamEvent{RepoSync: &evt}); err != nil {
+				return err
+			}
+		case evtKindAccount:
+			var evt atproto.SyncSubscribeRepos_Account
+			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+				return err
+			}
+			evt.Seq = h.Seq
+			if err := cb(&XRPCStreamEvent{RepoAccount: &evt}); err != nil {
+				return err
+			}
 		default:
 			log.Warnw("unrecognized event kind coming from log file", "seq", h.Seq, "kind", h.Kind)
 			return fmt.Errorf("halting on unrecognized event kind")
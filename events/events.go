@@ -24,6 +24,7 @@ type Scheduler interface {
 
 type EventManager struct {
 	subs   []*Subscriber
+	sinks  []*registeredSink
 	subsLk sync.Mutex
 
 	bufferSize int
@@ -82,15 +83,22 @@ func (em *EventManager) broadcastEvent(evt *XRPCStreamEvent) {
 			s.broadcastCounter.Inc()
 		}
 	}
+
+	em.sendToSinks(evt)
 }
 
-func (em *EventManager) persistAndSendEvent(ctx context.Context, evt *XRPCStreamEvent) {
+func (em *EventManager) persistAndSendEvent(ctx context.Context, evt *XRPCStreamEvent) error {
 	// TODO: can cut 5-10% off of disk persister benchmarks by making this function
 	// accept a uid. The lookup inside the persister is notably expensive (despite
 	// being an lru cache?)
 	if err := em.persister.Persist(ctx, evt); err != nil {
 		log.Errorf("failed to persist outbound event: %s", err)
+		eventEmitFailures.WithLabelValues("persist").Inc()
+		return fmt.Errorf("failed to persist outbound event: %w", err)
 	}
+
+	eventsEmitted.WithLabelValues(evt.eventType()).Inc()
+	return nil
 }
 
 type Subscriber struct {
@@ -113,11 +121,21 @@ const (
 type EventHeader struct {
 	Op      int64  `cborgen:"op"`
 	MsgType string `cborgen:"t"`
+
+	// Codec names the BlockCodec used on the blocks of a #commit body. It is
+	// only set for subscribers that negotiated compression.
+	Codec string `cborgen:"codec,omitempty"`
+
+	// Records points at the record of each op of a #commit body, see
+	// RecordRef. It is only set for subscribers that asked for them.
+	Records []RecordRef `cborgen:"records,omitempty"`
 }
 
 type XRPCStreamEvent struct {
 	Error         *ErrorFrame
 	RepoCommit    *comatproto.SyncSubscribeRepos_Commit
+	RepoSync      *comatproto.SyncSubscribeRepos_Sync
+	RepoAccount   *comatproto.SyncSubscribeRepos_Account
 	RepoHandle    *comatproto.SyncSubscribeRepos_Handle
 	RepoInfo      *comatproto.SyncSubscribeRepos_Info
 	RepoMigrate   *comatproto.SyncSubscribeRepos_Migrate
@@ -129,6 +147,10 @@ type XRPCStreamEvent struct {
 	PrivUid         models.Uid `json:"-" cborgen:"-"`
 	PrivPdsId       uint       `json:"-" cborgen:"-"`
 	PrivRelevantPds []uint     `json:"-" cborgen:"-"`
+
+	// PrivRecordRefs are the record refs the frame header of a #commit
+	// carried, when the consumer asked for them
+	PrivRecordRefs []RecordRef `json:"-" cborgen:"-"`
 }
 
 type ErrorFrame struct {
@@ -140,8 +162,36 @@ func (em *EventManager) AddEvent(ctx context.Context, ev *XRPCStreamEvent) error
 	ctx, span := otel.Tracer("events").Start(ctx, "AddEvent")
 	defer span.End()
 
-	em.persistAndSendEvent(ctx, ev)
-	return nil
+	return em.persistAndSendEvent(ctx, ev)
+}
+
+// eventType returns a short name for the kind of message carried by the
+// event, for use in metrics.
+func (evt *XRPCStreamEvent) eventType() string {
+	switch {
+	case evt.Error != nil:
+		return "error"
+	case evt.RepoCommit != nil:
+		return "commit"
+	case evt.RepoSync != nil:
+		return "sync"
+	case evt.RepoAccount != nil:
+		return "account"
+	case evt.RepoHandle != nil:
+		return "identity"
+	case evt.RepoInfo != nil:
+		return "info"
+	case evt.RepoMigrate != nil:
+		return "migrate"
+	case evt.RepoTombstone != nil:
+		return "tombstone"
+	case evt.LabelLabels != nil:
+		return "labels"
+	case evt.LabelInfo != nil:
+		return "label_info"
+	default:
+		return "unknown"
+	}
 }
 
 var ErrPlaybackShutdown = fmt.Errorf("playback shutting down")
@@ -24,3 +24,23 @@ var eventsBroadcast = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "indigo_events_broadcast_total",
 	Help: "Total number of events broadcast to subscribers",
 }, []string{"pool"})
+
+var eventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_events_emitted_total",
+	Help: "Total number of events successfully persisted and emitted to the firehose",
+}, []string{"type"})
+
+var eventEmitFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_event_emit_failures_total",
+	Help: "Total number of events that failed to be emitted to the firehose",
+}, []string{"reason"})
+
+var sinkEventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_event_sink_dropped_total",
+	Help: "Total number of events dropped because an event sink's queue was full",
+}, []string{"sink"})
+
+var sinkEventFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_event_sink_failures_total",
+	Help: "Total number of events an event sink failed to handle",
+}, []string{"sink"})
@@ -42,6 +42,10 @@ func (mp *MemPersister) Persist(ctx context.Context, e *XRPCStreamEvent) error {
 	switch {
 	case e.RepoCommit != nil:
 		e.RepoCommit.Seq = mp.seq
+	case e.RepoSync != nil:
+		e.RepoSync.Seq = mp.seq
+	case e.RepoAccount != nil:
+		e.RepoAccount.Seq = mp.seq
 	case e.RepoHandle != nil:
 		e.RepoHandle.Seq = mp.seq
 	case e.RepoMigrate != nil:
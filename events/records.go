@@ -0,0 +1,73 @@
+package events
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	"github.com/ipfs/go-cid"
+)
+
+// RecordRef points at the CBOR of an op's record within the (uncompressed)
+// blocks of its #commit event. Subscribers opt in to them when connecting;
+// they are then listed in the frame header, one per op, so consumers can
+// pick records out of the CAR slice without parsing it. Ops without a
+// record, like deletes, get a zero RecordRef.
+type RecordRef struct {
+	Offset int64 `cborgen:"offset"`
+	Length int64 `cborgen:"length"`
+}
+
+// Record returns the record bytes the ref points at in blocks.
+func (r RecordRef) Record(blocks []byte) ([]byte, error) {
+	if r.Length == 0 {
+		return nil, nil
+	}
+	if r.Offset < 0 || r.Length < 0 || r.Offset+r.Length > int64(len(blocks)) {
+		return nil, fmt.Errorf("record ref %d+%d out of range of %d bytes of blocks", r.Offset, r.Length, len(blocks))
+	}
+	return blocks[r.Offset : r.Offset+r.Length], nil
+}
+
+// FindRecordRefs locates the records of the ops in the CAR slice of their
+// commit.
+func FindRecordRefs(blocks []byte, ops []*comatproto.SyncSubscribeRepos_RepoOp) ([]RecordRef, error) {
+	hlen, n := binary.Uvarint(blocks)
+	if n <= 0 || uint64(len(blocks)-n) < hlen {
+		return nil, fmt.Errorf("invalid car header")
+	}
+	pos := n + int(hlen)
+
+	sections := make(map[cid.Cid]RecordRef)
+	for pos < len(blocks) {
+		slen, n := binary.Uvarint(blocks[pos:])
+		if n <= 0 || uint64(len(blocks)-pos-n) < slen {
+			return nil, fmt.Errorf("invalid car section at offset %d", pos)
+		}
+		pos += n
+
+		clen, c, err := cid.CidFromBytes(blocks[pos : pos+int(slen)])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cid in car section at offset %d: %w", pos, err)
+		}
+
+		sections[c] = RecordRef{Offset: int64(pos + clen), Length: int64(int(slen) - clen)}
+		pos += int(slen)
+	}
+
+	refs := make([]RecordRef, len(ops))
+	for i, op := range ops {
+		if op.Cid == nil {
+			continue
+		}
+
+		ref, ok := sections[cid.Cid(*op.Cid)]
+		if !ok {
+			return nil, fmt.Errorf("record of %s (%s) not in commit blocks", op.Path, cid.Cid(*op.Cid))
+		}
+		refs[i] = ref
+	}
+
+	return refs, nil
+}
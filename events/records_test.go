@@ -0,0 +1,90 @@
+package events_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestFindRecordRefs(t *testing.T) {
+	var recs []blocks.Block
+	for _, data := range [][]byte{[]byte("commit block"), []byte("first record"), []byte("second record")} {
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blk, err := blocks.NewBlockWithCid(data, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, blk)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{recs[0].Cid()}, Version: 1}, buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, blk := range recs {
+		if err := carutil.LdWrite(buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slice := buf.Bytes()
+
+	link := func(c cid.Cid) *lexutil.LexLink {
+		l := lexutil.LexLink(c)
+		return &l
+	}
+	ops := []*comatproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/b", Cid: link(recs[2].Cid())},
+		{Action: "delete", Path: "app.bsky.feed.post/c"},
+		{Action: "update", Path: "app.bsky.actor.profile/self", Cid: link(recs[1].Cid())},
+	}
+
+	refs, err := events.FindRecordRefs(slice, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != len(ops) {
+		t.Fatalf("expected a ref per op, got %d", len(refs))
+	}
+
+	for i, expected := range [][]byte{[]byte("second record"), nil, []byte("first record")} {
+		rec, err := refs[i].Record(slice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rec, expected) {
+			t.Fatalf("op %d: expected record %q, got %q", i, expected, rec)
+		}
+	}
+
+	// the refs survive the trip through the frame header
+	hbuf := new(bytes.Buffer)
+	hdr := events.EventHeader{Op: events.EvtKindMessage, MsgType: "#commit", Records: refs}
+	if err := hdr.MarshalCBOR(hbuf); err != nil {
+		t.Fatal(err)
+	}
+	var out events.EventHeader
+	if err := out.UnmarshalCBOR(bytes.NewReader(hbuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, hdr) {
+		t.Fatalf("header mismatch: %+v != %+v", out, hdr)
+	}
+
+	missing := []*comatproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/d", Cid: link(recs[0].Cid())}}
+	if _, err := events.FindRecordRefs(slice[:len(slice)-4], missing); err == nil {
+		t.Fatal("expected a truncated slice to be rejected")
+	}
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"context"
+	"fmt"
+)
+
+// EventSink receives every event the EventManager broadcasts, in order, after
+// it has been persisted and assigned a sequence number. It lets in-process
+// consumers such as an archival pipeline tap the firehose without a
+// subscriber connection of their own.
+type EventSink interface {
+	HandleEvent(ctx context.Context, evt *XRPCStreamEvent) error
+}
+
+// EventSinkFunc adapts a plain function to the EventSink interface.
+type EventSinkFunc func(ctx context.Context, evt *XRPCStreamEvent) error
+
+func (f EventSinkFunc) HandleEvent(ctx context.Context, evt *XRPCStreamEvent) error {
+	return f(ctx, evt)
+}
+
+type registeredSink struct {
+	name     string
+	sink     EventSink
+	incoming chan *XRPCStreamEvent
+	done     chan struct{}
+}
+
+// AddSink registers a sink under the given name and returns a function that
+// removes it again. Each sink is fed from its own buffered queue by its own
+// goroutine, so a sink that fails or falls behind never holds up the
+// firehose or the other sinks. Errors are logged and counted, and events are
+// dropped for a sink whose queue is full.
+func (em *EventManager) AddSink(name string, sink EventSink) (func(), error) {
+	em.subsLk.Lock()
+	defer em.subsLk.Unlock()
+
+	for _, s := range em.sinks {
+		if s.name == name {
+			return nil, fmt.Errorf("event sink %q already registered", name)
+		}
+	}
+
+	rs := &registeredSink{
+		name:     name,
+		sink:     sink,
+		incoming: make(chan *XRPCStreamEvent, em.bufferSize),
+		done:     make(chan struct{}),
+	}
+	em.sinks = append(em.sinks, rs)
+
+	go rs.run()
+
+	return func() { em.rmSink(rs) }, nil
+}
+
+func (em *EventManager) rmSink(rs *registeredSink) {
+	em.subsLk.Lock()
+	defer em.subsLk.Unlock()
+
+	for i, s := range em.sinks {
+		if s == rs {
+			em.sinks = append(em.sinks[:i], em.sinks[i+1:]...)
+			close(rs.done)
+			break
+		}
+	}
+}
+
+// sendToSinks queues the event for every registered sink. The caller must
+// hold subsLk.
+func (em *EventManager) sendToSinks(evt *XRPCStreamEvent) {
+	for _, s := range em.sinks {
+		select {
+		case s.incoming <- evt:
+		default:
+			log.Warnw("event sink overflow, dropping event", "sink", s.name, "queued", len(s.incoming))
+			sinkEventsDropped.WithLabelValues(s.name).Inc()
+		}
+	}
+}
+
+func (rs *registeredSink) run() {
+	ctx := context.Background()
+	for {
+		select {
+		case <-rs.done:
+			return
+		case evt := <-rs.incoming:
+			if err := rs.sink.HandleEvent(ctx, evt); err != nil {
+				log.Errorw("event sink failed to handle event", "sink", rs.name, "type", evt.eventType(), "err", err)
+				sinkEventFailures.WithLabelValues(rs.name).Inc()
+			}
+		}
+	}
+}
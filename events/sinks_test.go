@@ -0,0 +1,79 @@
+package events_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+)
+
+func TestEventSinks(t *testing.T) {
+	ctx := context.Background()
+	em := events.NewEventManager(events.NewMemPersister())
+
+	failing := make(chan int64, 10)
+	archive := make(chan int64, 10)
+
+	rmFailing, err := em.AddSink("failing", events.EventSinkFunc(func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		failing <- evt.RepoCommit.Seq
+		return fmt.Errorf("sink broken")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rmFailing()
+
+	rmArchive, err := em.AddSink("archive", events.EventSinkFunc(func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		archive <- evt.RepoCommit.Seq
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := em.AddSink("archive", events.EventSinkFunc(nil)); err == nil {
+		t.Fatal("expected registering a duplicate sink name to fail")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := em.AddEvent(ctx, &events.XRPCStreamEvent{
+			RepoCommit: &atproto.SyncSubscribeRepos_Commit{Repo: "did:plc:alice"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, ch := range map[string]chan int64{"failing": failing, "archive": archive} {
+		for i := int64(1); i <= 3; i++ {
+			select {
+			case seq := <-ch:
+				if seq != i {
+					t.Fatalf("sink %s: expected seq %d, got %d", name, i, seq)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("sink %s: timed out waiting for event %d", name, i)
+			}
+		}
+	}
+
+	rmArchive()
+	if err := em.AddEvent(ctx, &events.XRPCStreamEvent{
+		RepoCommit: &atproto.SyncSubscribeRepos_Commit{Repo: "did:plc:alice"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-failing:
+	case <-time.After(time.Second):
+		t.Fatal("remaining sink did not get event")
+	}
+	select {
+	case seq := <-archive:
+		t.Fatalf("removed sink got event %d", seq)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+// EventStore is the minimal storage backend for the event log. It only has
+// to durably keep events keyed by their sequence number and hand them back in
+// order, which makes it easy to back with local files, object storage or a
+// SQL table (see DBEventStore). Use NewStorePersister to turn an EventStore
+// into an EventPersistence that can be handed to an EventManager.
+type EventStore interface {
+	// Append stores an event. Its sequence number has already been assigned
+	// and is greater than that of any event appended before it. Stores should
+	// keep the event's PrivUid alongside it so takedowns apply on playback.
+	Append(ctx context.Context, e *XRPCStreamEvent) error
+
+	// ReadSince calls cb, in sequence order, for every stored event with a
+	// sequence number greater than since.
+	ReadSince(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error) error
+
+	// LastSeq returns the highest sequence number stored, or zero if the
+	// store is empty. It is looked up on startup, so it shouldn't require
+	// reading through the log.
+	LastSeq(ctx context.Context) (int64, error)
+
+	// TakeDown durably records that the user's events must no longer be
+	// played back, and TakenDown lists every user recorded so.
+	TakeDown(ctx context.Context, uid models.Uid) error
+	TakenDown(ctx context.Context) ([]models.Uid, error)
+
+	// Truncate drops all stored events with a sequence number lower than
+	// before, for stores that enforce their own retention.
+	Truncate(ctx context.Context, before int64) error
+}
+
+// StorePersister implements EventPersistence on top of an EventStore,
+// handling sequencing, takedowns and broadcast so stores don't have to.
+type StorePersister struct {
+	store EventStore
+
+	lk        sync.Mutex
+	seq       int64
+	takenDown map[models.Uid]bool
+
+	broadcast func(*XRPCStreamEvent)
+}
+
+// NewStorePersister creates a persister writing through to the given store,
+// continuing from the last sequence number it holds.
+func NewStorePersister(ctx context.Context, store EventStore) (*StorePersister, error) {
+	last, err := store.LastSeq(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last sequence number in event store: %w", err)
+	}
+
+	uids, err := store.TakenDown(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load takedowns from event store: %w", err)
+	}
+
+	takenDown := make(map[models.Uid]bool, len(uids))
+	for _, uid := range uids {
+		takenDown[uid] = true
+	}
+
+	return &StorePersister{
+		store:     store,
+		seq:       last,
+		takenDown: takenDown,
+	}, nil
+}
+
+func (evt *XRPCStreamEvent) sequence() int64 {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Seq
+	case evt.RepoSync != nil:
+		return evt.RepoSync.Seq
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Seq
+	case evt.RepoHandle != nil:
+		return evt.RepoHandle.Seq
+	case evt.RepoMigrate != nil:
+		return evt.RepoMigrate.Seq
+	case evt.RepoTombstone != nil:
+		return evt.RepoTombstone.Seq
+	case evt.LabelLabels != nil:
+		return evt.LabelLabels.Seq
+	default:
+		return 0
+	}
+}
+
+func (sp *StorePersister) Persist(ctx context.Context, e *XRPCStreamEvent) error {
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+
+	seq := sp.seq + 1
+	switch {
+	case e.RepoCommit != nil:
+		e.RepoCommit.Seq = seq
+	case e.RepoSync != nil:
+		e.RepoSync.Seq = seq
+	case e.RepoAccount != nil:
+		e.RepoAccount.Seq = seq
+	case e.RepoHandle != nil:
+		e.RepoHandle.Seq = seq
+	case e.RepoMigrate != nil:
+		e.RepoMigrate.Seq = seq
+	case e.RepoTombstone != nil:
+		e.RepoTombstone.Seq = seq
+	case e.LabelLabels != nil:
+		e.LabelLabels.Seq = seq
+	default:
+		return fmt.Errorf("unknown event type")
+	}
+
+	if err := sp.store.Append(ctx, e); err != nil {
+		return err
+	}
+	sp.seq = seq
+
+	sp.broadcast(e)
+
+	return nil
+}
+
+func (sp *StorePersister) Playback(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error) error {
+	return sp.store.ReadSince(ctx, since, func(e *XRPCStreamEvent) error {
+		if e.PrivUid != 0 && sp.isTakenDown(e.PrivUid) {
+			return nil
+		}
+
+		return cb(e)
+	})
+}
+
+func (sp *StorePersister) isTakenDown(uid models.Uid) bool {
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+
+	return sp.takenDown[uid]
+}
+
+// TakeDownRepo hides the user's events from playback. Stores are append
+// only, so the takedown is recorded in the store and applied as events are
+// read back.
+func (sp *StorePersister) TakeDownRepo(ctx context.Context, uid models.Uid) error {
+	if err := sp.store.TakeDown(ctx, uid); err != nil {
+		return fmt.Errorf("failed to record takedown: %w", err)
+	}
+
+	sp.lk.Lock()
+	defer sp.lk.Unlock()
+
+	sp.takenDown[uid] = true
+	return nil
+}
+
+func (sp *StorePersister) RebaseRepoEvents(ctx context.Context, usr models.Uid) error {
+	return fmt.Errorf("repo rebases not supported by store persister")
+}
+
+// Truncate drops events older than the given sequence number from the
+// underlying store.
+func (sp *StorePersister) Truncate(ctx context.Context, before int64) error {
+	return sp.store.Truncate(ctx, before)
+}
+
+func (sp *StorePersister) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (sp *StorePersister) SetEventBroadcaster(brc func(*XRPCStreamEvent)) {
+	sp.broadcast = brc
+}
+
+func (sp *StorePersister) Shutdown(context.Context) error {
+	return nil
+}
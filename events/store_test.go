@@ -0,0 +1,193 @@
+package events_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/ipfs/go-cid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type memEventStore struct {
+	lk        sync.Mutex
+	evts      []*events.XRPCStreamEvent
+	takenDown []models.Uid
+}
+
+func (s *memEventStore) Append(ctx context.Context, e *events.XRPCStreamEvent) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.evts = append(s.evts, e)
+	return nil
+}
+
+func (s *memEventStore) ReadSince(ctx context.Context, since int64, cb func(*events.XRPCStreamEvent) error) error {
+	s.lk.Lock()
+	evts := append([]*events.XRPCStreamEvent{}, s.evts...)
+	s.lk.Unlock()
+
+	for _, e := range evts {
+		if e.RepoCommit.Seq <= since {
+			continue
+		}
+		if err := cb(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *memEventStore) Truncate(ctx context.Context, before int64) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	var keep []*events.XRPCStreamEvent
+	for _, e := range s.evts {
+		if e.RepoCommit.Seq >= before {
+			keep = append(keep, e)
+		}
+	}
+	s.evts = keep
+	return nil
+}
+
+func (s *memEventStore) LastSeq(ctx context.Context) (int64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if len(s.evts) == 0 {
+		return 0, nil
+	}
+	return s.evts[len(s.evts)-1].RepoCommit.Seq, nil
+}
+
+func (s *memEventStore) TakeDown(ctx context.Context, uid models.Uid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	s.takenDown = append(s.takenDown, uid)
+	return nil
+}
+
+func (s *memEventStore) TakenDown(ctx context.Context) ([]models.Uid, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	return append([]models.Uid{}, s.takenDown...), nil
+}
+
+func TestStorePersister(t *testing.T) {
+	testStorePersister(t, &memEventStore{}, func(store events.EventStore) int {
+		return len(store.(*memEventStore).evts)
+	})
+}
+
+func TestDBEventStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "events.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := events.NewDBEventStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorePersister(t, store, func(events.EventStore) int {
+		var n int64
+		if err := db.Model(&events.StoreEvent{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return int(n)
+	})
+}
+
+func testCommit(t *testing.T, did string) *atproto.SyncSubscribeRepos_Commit {
+	t.Helper()
+
+	c, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &atproto.SyncSubscribeRepos_Commit{
+		Repo:   did,
+		Commit: lexutil.LexLink(c),
+		Ops:    []*atproto.SyncSubscribeRepos_RepoOp{},
+		Blobs:  []lexutil.LexLink{},
+	}
+}
+
+func testStorePersister(t *testing.T, store events.EventStore, stored func(events.EventStore) int) {
+	ctx := context.Background()
+
+	sp, err := events.NewStorePersister(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+
+	for i := 1; i <= 3; i++ {
+		if err := sp.Persist(ctx, &events.XRPCStreamEvent{
+			RepoCommit: testCommit(t, "did:plc:alice"),
+			PrivUid:    1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a fresh persister over the same store should continue the sequence
+	sp, err = events.NewStorePersister(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+
+	evt := &events.XRPCStreamEvent{
+		RepoCommit: testCommit(t, "did:plc:bob"),
+		PrivUid:    2,
+	}
+	if err := sp.Persist(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+	if evt.RepoCommit.Seq != 4 {
+		t.Fatalf("expected seq 4, got %d", evt.RepoCommit.Seq)
+	}
+
+	if err := sp.TakeDownRepo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// takedowns outlive the persister too
+	sp, err = events.NewStorePersister(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []int64
+	if err := sp.Playback(ctx, 0, func(e *events.XRPCStreamEvent) error {
+		seen = append(seen, e.RepoCommit.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || seen[0] != 4 {
+		t.Fatalf("expected only the event from the remaining repo, got %v", seen)
+	}
+
+	if err := sp.Truncate(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := stored(store); n != 1 {
+		t.Fatalf("expected 1 event left after truncate, got %d", n)
+	}
+}
@@ -27,6 +27,10 @@ func (yp *YoloPersister) Persist(ctx context.Context, e *XRPCStreamEvent) error
 	switch {
 	case e.RepoCommit != nil:
 		e.RepoCommit.Seq = yp.seq
+	case e.RepoSync != nil:
+		e.RepoSync.Seq = yp.seq
+	case e.RepoAccount != nil:
+		e.RepoAccount.Seq = yp.seq
 	case e.RepoHandle != nil:
 		e.RepoHandle.Seq = yp.seq
 	case e.RepoMigrate != nil:
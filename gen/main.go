@@ -45,6 +45,8 @@ func main() {
 		bsky.GraphList{},
 		bsky.GraphListitem{},
 		bsky.FeedGenerator{},
+		bsky.FeedPostgate{},
+		bsky.FeedPostgate_DisableRule{},
 		/*bsky.EmbedImages_View{},
 		bsky.EmbedRecord_View{}, bsky.EmbedRecordWithMedia_View{},
 		bsky.EmbedExternal_View{}, bsky.EmbedImages_ViewImage{},
@@ -64,6 +66,8 @@ func main() {
 		atproto.SyncSubscribeRepos_Migrate{},
 		atproto.SyncSubscribeRepos_RepoOp{},
 		atproto.SyncSubscribeRepos_Tombstone{},
+		atproto.SyncSubscribeRepos_Sync{},
+		atproto.SyncSubscribeRepos_Account{},
 		atproto.LabelDefs_SelfLabels{},
 		atproto.LabelDefs_SelfLabel{},
 	); err != nil {
@@ -78,7 +82,7 @@ func main() {
 		panic(err)
 	}
 
-	if err := cbg.WriteMapEncodersToFile("events/cbor_gen.go", "events", events.EventHeader{}, events.ErrorFrame{}); err != nil {
+	if err := cbg.WriteMapEncodersToFile("events/cbor_gen.go", "events", events.EventHeader{}, events.ErrorFrame{}, events.RecordRef{}); err != nil {
 		panic(err)
 	}
 }
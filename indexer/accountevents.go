@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"context"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/util"
+)
+
+// Statuses carried by #account events for accounts that are not active.
+const (
+	AccountStatusTakendown   = "takendown"
+	AccountStatusDeleted     = "deleted"
+	AccountStatusDeactivated = "deactivated"
+)
+
+// SendAccountEvent emits an #account event announcing that the given account
+// became active or inactive. status should be empty for active accounts and
+// one of the AccountStatus constants otherwise.
+//
+// The BGS emits these when:
+//   - an account is taken down (inactive, "takendown")
+//   - a takedown is reversed (active)
+//   - the account's PDS tombstones the repo (inactive, "deleted")
+//   - the account's PDS reports a change in status, such as a deactivation,
+//     which is passed through unless we have the account taken down
+func (ix *Indexer) SendAccountEvent(ctx context.Context, did string, active bool, status string) error {
+	evt := &comatproto.SyncSubscribeRepos_Account{
+		Did:    did,
+		Active: active,
+		Time:   ix.Now().UTC().Format(util.ISO8601),
+	}
+	if status != "" {
+		evt.Status = &status
+	}
+
+	return ix.events.AddEvent(ctx, &events.XRPCStreamEvent{
+		RepoAccount: evt,
+	})
+}
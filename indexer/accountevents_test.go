@@ -0,0 +1,61 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSendAccountEvent(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.Now = func() time.Time {
+		return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	if err := ix.SendAccountEvent(ctx, "did:plc:alice", false, AccountStatusTakendown); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.SendAccountEvent(ctx, "did:plc:alice", true, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	since := int64(0)
+	evts, cancel, err := ix.events.Subscribe(ctx, "test", nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	for i, exp := range []struct {
+		active bool
+		status string
+	}{
+		{false, AccountStatusTakendown},
+		{true, ""},
+	} {
+		select {
+		case evt := <-evts:
+			acct := evt.RepoAccount
+			if acct == nil {
+				t.Fatalf("event %d: expected an account event", i)
+			}
+			if acct.Did != "did:plc:alice" || acct.Active != exp.active || acct.Time != "2024-05-01T12:00:00.000Z" {
+				t.Fatalf("event %d: unexpected account event: %+v", i, acct)
+			}
+
+			var status string
+			if acct.Status != nil {
+				status = *acct.Status
+			}
+			if status != exp.status {
+				t.Fatalf("event %d: expected status %q, got %q", i, exp.status, status)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm/clause"
+)
+
+type ActorWithInfo struct {
+	*models.ActorInfo
+
+	// Muted and BlockedBy report whether the viewer muted the actor and
+	// whether the actor blocks the viewer. Blocking is the at:// uri of the
+	// viewer's block of the actor, if any.
+	Muted     bool
+	BlockedBy bool
+	Blocking  string
+}
+
+// HydrateActors looks up the actor info of the given users in one query,
+// returning it keyed by uid. If viewer is non-zero, the mute and block state
+// between the viewer and each actor is filled in as well, with one query for
+// each relation. Users we don't know of are absent from the returned map.
+func (ix *Indexer) HydrateActors(ctx context.Context, viewer models.Uid, uids []models.Uid) (map[models.Uid]*ActorWithInfo, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "HydrateActors")
+	defer span.End()
+
+	out := make(map[models.Uid]*ActorWithInfo, len(uids))
+	if len(uids) == 0 {
+		return out, nil
+	}
+
+	db := ix.reader(ctx).WithContext(ctx)
+
+	var actors []*models.ActorInfo
+	if err := db.Find(&actors, "uid IN ?", uids).Error; err != nil {
+		return nil, err
+	}
+	for _, ai := range actors {
+		out[ai.Uid] = &ActorWithInfo{ActorInfo: ai}
+	}
+
+	if viewer == 0 || len(out) == 0 {
+		return out, nil
+	}
+
+	viewerActor, err := ix.LookupUser(ctx, viewer)
+	if err != nil {
+		return nil, fmt.Errorf("looking up viewer: %w", err)
+	}
+
+	var mutes []models.ActorMute
+	if err := db.Find(&mutes, "muter = ? AND subject IN ?", viewer, uids).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range mutes {
+		if a, ok := out[m.Subject]; ok {
+			a.Muted = true
+		}
+	}
+
+	var blocking []models.BlockRecord
+	if err := db.Find(&blocking, "blocker = ? AND target IN ?", viewer, uids).Error; err != nil {
+		return nil, err
+	}
+	for _, br := range blocking {
+		if a, ok := out[br.Target]; ok {
+			a.Blocking = util.BuildAtUri(viewerActor.Did, "app.bsky.graph.block", br.Rkey)
+		}
+	}
+
+	var blockedBy []models.BlockRecord
+	if err := db.Find(&blockedBy, "target = ? AND blocker IN ?", viewer, uids).Error; err != nil {
+		return nil, err
+	}
+	for _, br := range blockedBy {
+		if a, ok := out[br.Blocker]; ok {
+			a.BlockedBy = true
+		}
+	}
+
+	return out, nil
+}
+
+// MuteActor records that muter muted subject. Muting an already muted actor
+// is a no-op.
+func (ix *Indexer) MuteActor(ctx context.Context, muter, subject models.Uid) error {
+	return ix.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ActorMute{
+		Muter:   muter,
+		Subject: subject,
+	}).Error
+}
+
+// UnmuteActor removes muter's mute of subject, if there is one.
+func (ix *Indexer) UnmuteActor(ctx context.Context, muter, subject models.Uid) error {
+	return ix.db.WithContext(ctx).Where("muter = ? AND subject = ?", muter, subject).Delete(&models.ActorMute{}).Error
+}
@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/gorm"
+)
+
+func TestHydrateActors(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for i := 1; i <= 4; i++ {
+		if err := ix.db.Create(&models.ActorInfo{
+			Uid:         models.Uid(i),
+			Did:         fmt.Sprintf("did:plc:user%d", i),
+			Handle:      sql.NullString{String: fmt.Sprintf("user%d.test", i), Valid: true},
+			DisplayName: fmt.Sprintf("User %d", i),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 1 is the viewer; they mute 2 and block 3, and 4 blocks them
+	if err := ix.MuteActor(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.MuteActor(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.BlockRecord{Blocker: 1, Target: 3, Rkey: "b3"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.BlockRecord{Blocker: 4, Target: 1, Rkey: "b1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	actors, err := ix.HydrateActors(ctx, 1, []models.Uid{2, 3, 4, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actors) != 3 {
+		t.Fatalf("expected three actors, got %d", len(actors))
+	}
+
+	if a := actors[2]; a.Handle.String != "user2.test" || a.DisplayName != "User 2" || !a.Muted || a.BlockedBy || a.Blocking != "" {
+		t.Fatalf("unexpected actor 2: %+v", a)
+	}
+	if a := actors[3]; a.Muted || a.BlockedBy || a.Blocking != "at://did:plc:user1/app.bsky.graph.block/b3" {
+		t.Fatalf("unexpected actor 3: %+v", a)
+	}
+	if a := actors[4]; a.Muted || !a.BlockedBy || a.Blocking != "" {
+		t.Fatalf("unexpected actor 4: %+v", a)
+	}
+
+	if err := ix.UnmuteActor(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a viewer only the actor info is filled in
+	actors, err = ix.HydrateActors(ctx, 0, []models.Uid{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actors) != 2 || actors[2].Muted || actors[3].Blocking != "" {
+		t.Fatalf("unexpected actors without viewer: %+v", actors)
+	}
+}
+
+func TestLookupActor(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{
+		Uid:    1,
+		Did:    "did:plc:alice",
+		Handle: sql.NullString{String: "alice.test", Valid: true},
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"did:plc:alice", "alice.test", "Alice.Test"} {
+		ai, err := ix.LookupActor(ctx, id, false)
+		if err != nil {
+			t.Fatalf("%s: %s", id, err)
+		}
+		if ai.Uid != 1 {
+			t.Fatalf("%s: got wrong user %d", id, ai.Uid)
+		}
+	}
+
+	for _, id := range []string{"did:plc:bob", "bob.test"} {
+		if _, err := ix.LookupActor(ctx, id, false); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("%s: expected not found, got %v", id, err)
+		}
+	}
+
+	if _, err := ix.LookupActor(ctx, "not a handle", false); err == nil || errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected invalid identifier error, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+// SetAggregationTimeout bounds how long aggregating a single repo op may
+// take, so one pathological record (say, a post mentioning thousands of
+// actors) can't hold up the ops after it. Ops that run over are abandoned
+// and handed to AggregationFailed. Zero, the default, means no limit.
+func (ix *Indexer) SetAggregationTimeout(d time.Duration) {
+	ix.aggTimeoutsLk.Lock()
+	defer ix.aggTimeoutsLk.Unlock()
+
+	ix.aggTimeout = d
+}
+
+// SetCollectionAggregationTimeout overrides the aggregation timeout for ops
+// on records of the given collection. Zero means no limit.
+func (ix *Indexer) SetCollectionAggregationTimeout(collection string, d time.Duration) {
+	ix.aggTimeoutsLk.Lock()
+	defer ix.aggTimeoutsLk.Unlock()
+
+	if ix.aggTimeouts == nil {
+		ix.aggTimeouts = make(map[string]time.Duration)
+	}
+	ix.aggTimeouts[collection] = d
+}
+
+func (ix *Indexer) aggregationTimeout(collection string) time.Duration {
+	ix.aggTimeoutsLk.Lock()
+	defer ix.aggTimeoutsLk.Unlock()
+
+	if d, ok := ix.aggTimeouts[collection]; ok {
+		return d
+	}
+	return ix.aggTimeout
+}
+
+// handleRepoOpTimed runs handleRepoOp under the aggregation timeout of the
+// op's collection. It reports whether the op was abandoned for running over,
+// as opposed to the whole event being cancelled.
+func (ix *Indexer) handleRepoOpTimed(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) (bool, error) {
+	d := ix.aggregationTimeout(op.Collection)
+	if d <= 0 {
+		return false, ix.handleRepoOp(ctx, evt, op)
+	}
+
+	opctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	err := ix.handleRepoOp(opctx, evt, op)
+	if err == nil {
+		return false, nil
+	}
+
+	timedOut := errors.Is(opctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	return timedOut, err
+}
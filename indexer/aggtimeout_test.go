@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestAggregationTimeout(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetAggregationTimeout(time.Minute)
+	ix.SetCollectionAggregationTimeout("com.example.slow", 10*time.Millisecond)
+
+	ix.RegisterCollectionHandler("com.example.slow", func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var fast int
+	ix.RegisterCollectionHandler("com.example.fast", func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+		fast++
+		return nil
+	})
+
+	var abandoned []string
+	ix.AggregationFailed = func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline error, got %v", err)
+		}
+		abandoned = append(abandoned, op.Rkey)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1, Ops: []repomgr.RepoOp{
+		{Kind: repomgr.EvtKindDeleteRecord, Collection: "com.example.slow", Rkey: "a"},
+		{Kind: repomgr.EvtKindDeleteRecord, Collection: "com.example.fast", Rkey: "b"},
+	}}
+	ix.aggregateEvent(ctx, evt, func(op *repomgr.RepoOp, err error) {
+		t.Fatalf("unexpected failure of %s: %s", op.Rkey, err)
+	})
+
+	if len(abandoned) != 1 || abandoned[0] != "a" {
+		t.Fatalf("expected only the slow op to be abandoned, got %v", abandoned)
+	}
+	if fast != 1 {
+		t.Fatalf("expected the op after the slow one to be aggregated, got %d", fast)
+	}
+}
+
+func TestAggregationTimeoutCancelsQueries(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an op whose time is already up shouldn't get any more database work done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "hello"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the post create to be cancelled, got %v", err)
+	}
+
+	var n int64
+	if err := ix.db.Model(&models.FeedPost{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no post to be written, got %d", n)
+	}
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+// how many posts are checked per query when auditing counts
+const auditChunkSize = 500
+
+// CountDiscrepancy describes a post whose cached aggregate counts don't match
+// the number of rows in the corresponding record tables
+type CountDiscrepancy struct {
+	Post uint
+
+	CachedUpCount int64
+	ActualUpCount int64
+
+	CachedRepostCount int64
+	ActualRepostCount int64
+}
+
+// AuditCounts compares the cached like and repost counts on (up to) the
+// limit most recent posts against the vote and repost record tables. Posts
+// are checked in small chunks so no single query holds locks on large parts
+// of the table. If fix is set, mismatched counts are overwritten with the
+// live values.
+func (ix *Indexer) AuditCounts(ctx context.Context, limit int, fix bool) ([]CountDiscrepancy, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "AuditCounts")
+	defer span.End()
+
+	var out []CountDiscrepancy
+	var lastID uint
+	for checked := 0; checked < limit; {
+		chunk := auditChunkSize
+		if limit-checked < chunk {
+			chunk = limit - checked
+		}
+
+		q := ix.db.WithContext(ctx).Model(models.FeedPost{}).Select("id", "up_count", "repost_count").Order("id desc").Limit(chunk)
+		if lastID != 0 {
+			q = q.Where("id < ?", lastID)
+		}
+
+		var posts []models.FeedPost
+		if err := q.Find(&posts).Error; err != nil {
+			return nil, err
+		}
+
+		if len(posts) == 0 {
+			break
+		}
+
+		ids := make([]uint, 0, len(posts))
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+
+		votes, err := ix.countByPost(ctx, models.VoteRecord{}, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		reposts, err := ix.countByPost(ctx, models.RepostRecord{}, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range posts {
+			if p.UpCount == votes[p.ID] && p.RepostCount == reposts[p.ID] {
+				continue
+			}
+
+			d := CountDiscrepancy{
+				Post:              p.ID,
+				CachedUpCount:     p.UpCount,
+				ActualUpCount:     votes[p.ID],
+				CachedRepostCount: p.RepostCount,
+				ActualRepostCount: reposts[p.ID],
+			}
+			out = append(out, d)
+			countMismatchesFound.Inc()
+
+			if fix {
+				if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", p.ID).Updates(map[string]any{
+					"up_count":     d.ActualUpCount,
+					"repost_count": d.ActualRepostCount,
+				}).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		checked += len(posts)
+		lastID = posts[len(posts)-1].ID
+	}
+
+	return out, nil
+}
+
+// countByPost counts rows of the given record model for each of the posts
+func (ix *Indexer) countByPost(ctx context.Context, model any, posts []uint) (map[uint]int64, error) {
+	var rows []struct {
+		Post  uint
+		Count int64
+	}
+	if err := ix.db.WithContext(ctx).Model(model).Select("post, count(*) as count").Where("post IN ?", posts).Group("post").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	out := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		out[r.Post] = r.Count
+	}
+	return out, nil
+}
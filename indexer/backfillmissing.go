@@ -0,0 +1,202 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// orphanedPlaceholderGrace is how long placeholders of authors that are
+// gone are kept around, in case the account comes back.
+const orphanedPlaceholderGrace = 7 * 24 * time.Hour
+
+// backfillPollInterval is how often BackfillMissingPosts checks on the
+// crawls it is waiting for, and backfillCrawlTimeout how long it waits for
+// them at most.
+var (
+	backfillPollInterval = time.Second
+	backfillCrawlTimeout = 10 * time.Minute
+)
+
+// MissingPostBackfill reports what a BackfillMissingPosts run did with the
+// placeholders it looked at.
+type MissingPostBackfill struct {
+	Checked int `json:"checked"`
+	Filled  int `json:"filled"`
+	Removed int `json:"removed"`
+
+	// Crawled is the number of authors crawled to fill placeholders in, and
+	// Failed the number of them whose crawls didn't finish in time
+	Crawled int `json:"crawled"`
+	Failed  int `json:"failed"`
+}
+
+// BackfillMissingPosts looks at up to limit placeholder posts, oldest
+// first, and tries to fill them in. Their authors' repos are fully crawled,
+// as a placeholder may point at a post older than the last crawl, and it
+// blocks until those crawls are done, for up to backfillCrawlTimeout (or
+// until ctx is cancelled). Authors whose crawls don't finish in that time
+// are counted as failed. Placeholders of authors that are unknown, taken
+// down or tombstoned are deleted once they are older than a grace period,
+// unless records still point at them.
+func (ix *Indexer) BackfillMissingPosts(ctx context.Context, limit int) (*MissingPostBackfill, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "BackfillMissingPosts")
+	defer span.End()
+
+	if ix.Crawler == nil {
+		return nil, fmt.Errorf("crawling is disabled")
+	}
+
+	var placeholders []models.FeedPost
+	if err := ix.db.WithContext(ctx).Where("missing AND NOT deleted").Order("id").Limit(limit).Find(&placeholders).Error; err != nil {
+		return nil, fmt.Errorf("listing placeholder posts: %w", err)
+	}
+
+	report := &MissingPostBackfill{Checked: len(placeholders)}
+	if len(placeholders) == 0 {
+		return report, nil
+	}
+
+	byAuthor := make(map[models.Uid][]models.FeedPost)
+	for _, fp := range placeholders {
+		byAuthor[fp.Author] = append(byAuthor[fp.Author], fp)
+	}
+
+	cutoff := ix.Now().Add(-orphanedPlaceholderGrace)
+	start := time.Now()
+
+	var waiting []uint
+	crawling := make(map[models.Uid]bool)
+	for author, fps := range byAuthor {
+		gone, ai, err := ix.placeholderAuthorGone(ctx, author)
+		if err != nil {
+			return nil, err
+		}
+
+		if gone {
+			var expired []uint
+			for _, fp := range fps {
+				if fp.CreatedAt.Before(cutoff) {
+					expired = append(expired, fp.ID)
+				}
+			}
+			if len(expired) == 0 {
+				continue
+			}
+
+			n, err := ix.deletePlaceholders(ctx, expired)
+			if err != nil {
+				return nil, fmt.Errorf("deleting orphaned placeholders of %d: %w", author, err)
+			}
+			report.Removed += int(n)
+			continue
+		}
+
+		if ai.PDS == 0 {
+			// nowhere to crawl them from (yet)
+			continue
+		}
+
+		if ix.Crawler.CrawlState(author) == "" {
+			if err := ix.Crawler.CrawlFull(ctx, ai); err != nil {
+				return nil, fmt.Errorf("enqueueing crawl of %s: %w", ai.Did, err)
+			}
+			report.Crawled++
+		}
+		crawling[author] = true
+
+		for _, fp := range fps {
+			waiting = append(waiting, fp.ID)
+		}
+	}
+
+	failed, err := ix.waitForCrawls(ctx, crawling, start)
+	if err != nil {
+		return report, err
+	}
+	for _, uid := range failed {
+		report.Failed++
+		log.Warnw("crawl to fill in placeholder posts didn't finish in time", "uid", uid)
+	}
+
+	if len(waiting) > 0 {
+		var filled int64
+		if err := ix.db.WithContext(ctx).Model(&models.FeedPost{}).Where("id IN ? AND NOT missing", waiting).Count(&filled).Error; err != nil {
+			return report, fmt.Errorf("counting filled placeholders: %w", err)
+		}
+		report.Filled = int(filled)
+	}
+
+	missingPostsBackfilled.WithLabelValues("filled").Add(float64(report.Filled))
+	missingPostsBackfilled.WithLabelValues("removed").Add(float64(report.Removed))
+	span.SetAttributes(attribute.Int("checked", report.Checked), attribute.Int("filled", report.Filled), attribute.Int("removed", report.Removed))
+	log.Infow("backfilled placeholder posts", "checked", report.Checked, "filled", report.Filled, "removed", report.Removed, "crawled", report.Crawled)
+
+	return report, nil
+}
+
+// placeholderAuthorGone reports whether the author of placeholders won't
+// be filling them in, returning the author otherwise.
+func (ix *Indexer) placeholderAuthorGone(ctx context.Context, author models.Uid) (bool, *models.ActorInfo, error) {
+	var ai models.ActorInfo
+	if err := ix.db.WithContext(ctx).Limit(1).Find(&ai, "uid = ?", author).Error; err != nil {
+		return false, nil, fmt.Errorf("looking up placeholder author %d: %w", author, err)
+	}
+	if ai.ID == 0 || ai.TakenDown {
+		return true, nil, nil
+	}
+
+	tombstoned, err := ix.UserTombstoned(ctx, author)
+	if err != nil {
+		return false, nil, fmt.Errorf("checking tombstone status of %s: %w", ai.Did, err)
+	}
+	if tombstoned {
+		return true, nil, nil
+	}
+
+	return false, &ai, nil
+}
+
+// waitForCrawls blocks until the crawls of the given users that were
+// enqueued after start have finished, or backfillCrawlTimeout has passed.
+// It returns the users whose crawls didn't finish in time.
+func (ix *Indexer) waitForCrawls(ctx context.Context, uids map[models.Uid]bool, start time.Time) ([]models.Uid, error) {
+	t := time.NewTicker(backfillPollInterval)
+	defer t.Stop()
+
+	deadline := time.NewTimer(backfillCrawlTimeout)
+	defer deadline.Stop()
+
+	for len(uids) > 0 {
+		for uid := range uids {
+			if ix.Crawler.CrawlState(uid) != "" {
+				continue
+			}
+			if outcome := ix.Crawler.LastCrawl(uid); outcome != nil && !outcome.FinishedAt.Before(start) {
+				delete(uids, uid)
+			}
+		}
+		if len(uids) == 0 {
+			break
+		}
+
+		select {
+		case <-t.C:
+		case <-deadline.C:
+			var out []models.Uid
+			for uid := range uids {
+				out = append(out, uid)
+			}
+			return out, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, nil
+}
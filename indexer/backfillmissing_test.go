@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+func TestBackfillMissingPosts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	backfillPollInterval = 10 * time.Millisecond
+	backfillCrawlTimeout = 200 * time.Millisecond
+	defer func() {
+		backfillPollInterval = time.Second
+		backfillCrawlTimeout = 10 * time.Minute
+	}()
+
+	// dave's crawl never finishes
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrawlDispatcher(func(ctx context.Context, job *crawlWork) error {
+		if job.act.Uid == 3 {
+			<-stuck
+			return nil
+		}
+		if job.act.Uid != 1 || !job.forceFull {
+			t.Errorf("unexpected crawl of %d (full: %t)", job.act.Uid, job.forceFull)
+			return nil
+		}
+		// alice's repo has one of the two posts
+		return ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "found it"})
+	}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run()
+	ix.Crawler = c
+
+	// normally migrated by the bgs
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.PDS{Model: gorm.Model{ID: 1}, Host: "pds.one"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice", PDS: 1},
+		{Uid: 2, Did: "did:plc:gone", PDS: 1},
+		{Uid: 3, Did: "did:plc:dave", PDS: 1},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	ix.UserTombstoned = func(ctx context.Context, uid models.Uid) (bool, error) {
+		return uid == 2, nil
+	}
+
+	for _, fp := range []*models.FeedPost{
+		{Author: 1, Rkey: "aaaa", Missing: true},
+		{Author: 1, Rkey: "bbbb", Missing: true},
+		{Author: 2, Rkey: "cccc", Missing: true},
+		{Author: 2, Rkey: "dddd", Missing: true},
+		{Author: 2, Rkey: "eeee", Missing: true},
+		{Author: 3, Rkey: "ffff", Missing: true},
+	} {
+		if err := ix.db.Create(fp).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-orphanedPlaceholderGrace - time.Hour)
+	if err := ix.db.Model(&models.FeedPost{}).Where("rkey IN ?", []string{"cccc", "eeee"}).Update("created_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// somebody liked eeee, so it stays around
+	var liked models.FeedPost
+	if err := ix.db.First(&liked, "rkey = ?", "eeee").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.VoteRecord{Voter: 1, Post: liked.ID, Rkey: "l1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ix.BackfillMissingPosts(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := MissingPostBackfill{Checked: 6, Filled: 1, Removed: 1, Crawled: 2, Failed: 1}
+	if *report != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *report)
+	}
+
+	var left []string
+	if err := ix.db.Model(&models.FeedPost{}).Where("missing").Order("rkey").Pluck("rkey", &left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 4 || left[0] != "bbbb" || left[1] != "dddd" || left[2] != "eeee" || left[3] != "ffff" {
+		t.Fatalf("unexpected placeholders left: %v", left)
+	}
+}
@@ -0,0 +1,155 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type blockCacheKey struct {
+	viewer    models.Uid
+	blockedBy bool
+}
+
+type cachedBlocks struct {
+	cachedAt time.Time
+	uids     []models.Uid
+	dids     map[string]struct{}
+}
+
+// SetBlockCache caches the results of GetBlockedDids for up to size viewers,
+// each for at most ttl. Entries are dropped early when a block record that
+// affects them is created or deleted. Zero size turns the cache off, which
+// is the default.
+func (ix *Indexer) SetBlockCache(size int, ttl time.Duration) error {
+	ix.blockCacheLk.Lock()
+	defer ix.blockCacheLk.Unlock()
+
+	ix.blockCache = nil
+	ix.blockCacheTTL = ttl
+	if size > 0 {
+		c, err := lru.New[blockCacheKey, *cachedBlocks](size)
+		if err != nil {
+			return err
+		}
+		ix.blockCache = c
+	}
+
+	return nil
+}
+
+// GetBlockedDids returns the DIDs of the actors the viewer blocks, or with
+// blockedBy set, of the actors blocking the viewer. The returned set may be
+// shared with other callers and must not be modified.
+func (ix *Indexer) GetBlockedDids(ctx context.Context, viewer models.Uid, blockedBy bool) (map[string]struct{}, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetBlockedDids")
+	defer span.End()
+
+	cb, err := ix.getBlocks(ctx, blockCacheKey{viewer: viewer, blockedBy: blockedBy})
+	if err != nil {
+		return nil, err
+	}
+
+	return cb.dids, nil
+}
+
+// getBlocks returns the uids and DIDs for the block cache entry of key,
+// loading it if it isn't cached.
+func (ix *Indexer) getBlocks(ctx context.Context, key blockCacheKey) (*cachedBlocks, error) {
+	span := trace.SpanFromContext(ctx)
+
+	cb, gen, ok := ix.cachedBlocks(key)
+	if ok {
+		span.SetAttributes(attribute.Bool("cache", true))
+		blockCacheHits.Inc()
+		return cb, nil
+	}
+	span.SetAttributes(attribute.Bool("cache", false))
+	blockCacheMisses.Inc()
+
+	db := ix.reader(ctx).WithContext(ctx)
+
+	q := db.Model(&models.BlockRecord{}).Where("blocker = ?", key.viewer).Select("target")
+	if key.blockedBy {
+		q = db.Model(&models.BlockRecord{}).Where("target = ?", key.viewer).Select("blocker")
+	}
+
+	var rows []struct {
+		Uid models.Uid
+		Did string
+	}
+	if err := db.Model(&models.ActorInfo{}).Where("uid IN (?)", q).Select("uid", "did").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	cb = &cachedBlocks{
+		cachedAt: ix.Now(),
+		uids:     make([]models.Uid, 0, len(rows)),
+		dids:     make(map[string]struct{}, len(rows)),
+	}
+	for _, r := range rows {
+		cb.uids = append(cb.uids, r.Uid)
+		cb.dids[r.Did] = struct{}{}
+	}
+
+	ix.blockCacheLk.Lock()
+	// a block created or deleted while we were reading may not be in what
+	// we read, so only cache it if nothing was invalidated in the meantime
+	if ix.blockCache != nil && ix.blockCacheGen == gen {
+		ix.blockCache.Add(key, cb)
+	}
+	ix.blockCacheLk.Unlock()
+
+	return cb, nil
+}
+
+// cachedBlocks returns the cached entry for key if there is a fresh one, and
+// otherwise the cache generation to load a new entry against.
+func (ix *Indexer) cachedBlocks(key blockCacheKey) (*cachedBlocks, uint64, bool) {
+	ix.blockCacheLk.Lock()
+	defer ix.blockCacheLk.Unlock()
+
+	if ix.blockCache == nil {
+		return nil, ix.blockCacheGen, false
+	}
+
+	cb, ok := ix.blockCache.Get(key)
+	if !ok {
+		return nil, ix.blockCacheGen, false
+	}
+
+	if ix.Now().Sub(cb.cachedAt) > ix.blockCacheTTL {
+		ix.blockCache.Remove(key)
+		return nil, ix.blockCacheGen, false
+	}
+
+	return cb, ix.blockCacheGen, true
+}
+
+func (ix *Indexer) blockCacheEnabled() bool {
+	ix.blockCacheLk.Lock()
+	defer ix.blockCacheLk.Unlock()
+
+	return ix.blockCache != nil
+}
+
+// invalidateBlocks drops the cached entries a block between the two actors
+// shows up in.
+func (ix *Indexer) invalidateBlocks(blocker, target models.Uid) {
+	ix.blockCacheLk.Lock()
+	defer ix.blockCacheLk.Unlock()
+
+	ix.blockCacheGen++
+	if ix.blockCache == nil {
+		return
+	}
+
+	ix.blockCache.Remove(blockCacheKey{viewer: blocker})
+	ix.blockCache.Remove(blockCacheKey{viewer: target, blockedBy: true})
+}
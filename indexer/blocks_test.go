@@ -0,0 +1,188 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+func TestGetBlockedDids(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.SetBlockCache(10, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+		{Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := func(viewer models.Uid, blockedBy bool) map[string]struct{} {
+		t.Helper()
+		dids, err := ix.GetBlockedDids(ctx, viewer, blockedBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dids
+	}
+
+	// warm the cache before any blocks exist
+	if len(blocked(1, false)) != 0 || len(blocked(2, true)) != 0 {
+		t.Fatal("expected no blocks yet")
+	}
+
+	evt := &repomgr.RepoEvent{User: 1}
+	op := &repomgr.RepoOp{Rkey: "kkkk", RecCid: &cc}
+	if err := ix.handleRecordCreateGraphBlock(ctx, &bsky.GraphBlock{Subject: "did:plc:bob"}, evt, op); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := blocked(1, false)["did:plc:bob"]; !ok {
+		t.Fatal("expected alice's blocks to include bob once the block was created")
+	}
+	if _, ok := blocked(2, true)["did:plc:alice"]; !ok {
+		t.Fatal("expected bob to be blocked by alice once the block was created")
+	}
+	if len(blocked(3, false)) != 0 || len(blocked(3, true)) != 0 {
+		t.Fatal("expected carol to be unaffected")
+	}
+
+	if err := ix.handleRecordDeleteGraphBlock(ctx, evt, op); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocked(1, false)) != 0 || len(blocked(2, true)) != 0 {
+		t.Fatal("expected deleted block to be dropped from the cache")
+	}
+}
+
+func TestReplayedBlockIsIdempotent(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1}
+	op := &repomgr.RepoOp{Rkey: "kkkk", RecCid: &cc}
+	for i := 0; i < 2; i++ {
+		if err := ix.handleRecordCreateGraphBlock(ctx, &bsky.GraphBlock{Subject: "did:plc:bob"}, evt, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var blocks int64
+	if err := ix.db.Model(&models.BlockRecord{}).Where("blocker = ? AND rkey = ?", 1, "kkkk").Count(&blocks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if blocks != 1 {
+		t.Fatalf("expected a single block record, got %d", blocks)
+	}
+
+	// a deleted block frees its rkey up again
+	if err := ix.handleRecordDeleteGraphBlock(ctx, evt, op); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordCreateGraphBlock(ctx, &bsky.GraphBlock{Subject: "did:plc:bob"}, evt, op); err != nil {
+		t.Fatal(err)
+	}
+
+	dids, err := ix.GetBlockedDids(ctx, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dids["did:plc:bob"]; !ok || len(dids) != 1 {
+		t.Fatalf("expected alice to block only bob after reblocking, got %v", dids)
+	}
+}
+
+func TestBlockCacheStaleLoadNotCached(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ix.Now = func() time.Time { return now }
+	if err := ix.SetBlockCache(10, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := blockCacheKey{viewer: 1}
+
+	// a block lands while the load is reading: what was read may predate
+	// it, so it mustn't be cached
+	landed := false
+	if err := ix.db.Callback().Query().After("gorm:query").Register("test:block_lands", func(db *gorm.DB) {
+		if !landed {
+			landed = true
+			ix.invalidateBlocks(1, 2)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.getBlocks(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := ix.cachedBlocks(key); ok {
+		t.Fatal("expected a load raced by an invalidation not to be cached")
+	}
+
+	if _, err := ix.getBlocks(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := ix.cachedBlocks(key); !ok {
+		t.Fatal("expected a load with no invalidation in between to be cached")
+	}
+
+	// entries expire by the indexer's clock
+	now = now.Add(2 * time.Hour)
+	if _, _, ok := ix.cachedBlocks(key); ok {
+		t.Fatal("expected the entry to have expired")
+	}
+}
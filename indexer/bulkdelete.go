@@ -0,0 +1,239 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// bulkDeleteChunk caps how many records a single batched statement touches.
+const bulkDeleteChunk = 500
+
+// SetBulkDeleteThreshold makes commits deleting at least n posts, likes,
+// reposts and follows (together) handle those deletes with a few batched
+// queries instead of a handful of queries each, as happens when a repo gets
+// compacted or wiped. Other ops in the commit are handled as usual, and the
+// deletes gathered so far are applied before any create or update, so ops
+// still take effect in commit order. Zero handles every delete on its own.
+func (ix *Indexer) SetBulkDeleteThreshold(n int) {
+	ix.bulkDeleteThreshold = n
+}
+
+func bulkDeletable(op *repomgr.RepoOp) bool {
+	if op.Kind != repomgr.EvtKindDeleteRecord {
+		return false
+	}
+
+	switch op.Collection {
+	case "app.bsky.feed.post", "app.bsky.feed.like", "app.bsky.feed.repost", "app.bsky.graph.follow":
+		return true
+	default:
+		return false
+	}
+}
+
+// batchingDeletes reports whether the event has enough deletes to batch.
+func (ix *Indexer) batchingDeletes(evt *repomgr.RepoEvent) bool {
+	if !ix.doAggregations || ix.bulkDeleteThreshold <= 0 {
+		return false
+	}
+
+	var n int
+	for i := range evt.Ops {
+		if bulkDeletable(&evt.Ops[i]) {
+			n++
+		}
+	}
+	return n >= ix.bulkDeleteThreshold
+}
+
+// handleBulkDeletes applies the deletes gathered while aggregating an event
+// it was batchingDeletes for, with the same effect as handling each through
+// handleRecordDelete.
+func (ix *Indexer) handleBulkDeletes(ctx context.Context, evt *repomgr.RepoEvent, ops []*repomgr.RepoOp) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "handleBulkDeletes")
+	defer span.End()
+
+	byCollection := make(map[string][]string)
+	for _, op := range ops {
+		byCollection[op.Collection] = append(byCollection[op.Collection], op.Rkey)
+	}
+
+	log.Infow("bulk deleting records", "uid", evt.User, "posts", len(byCollection["app.bsky.feed.post"]), "likes", len(byCollection["app.bsky.feed.like"]), "reposts", len(byCollection["app.bsky.feed.repost"]), "follows", len(byCollection["app.bsky.graph.follow"]))
+
+	for collection, rkeys := range byCollection {
+		span.SetAttributes(attribute.Int(collection, len(rkeys)))
+
+		for len(rkeys) > 0 {
+			chunk := rkeys[:min(len(rkeys), bulkDeleteChunk)]
+			rkeys = rkeys[len(chunk):]
+
+			var err error
+			switch collection {
+			case "app.bsky.feed.post":
+				err = ix.bulkDeletePosts(ctx, evt.User, chunk)
+			case "app.bsky.feed.like":
+				err = ix.bulkDeleteLikes(ctx, evt.User, chunk)
+			case "app.bsky.feed.repost":
+				err = ix.db.WithContext(ctx).Where("reposter = ? AND rkey IN ?", evt.User, chunk).Delete(&models.RepostRecord{}).Error
+			case "app.bsky.graph.follow":
+				err = ix.bulkDeleteFollows(ctx, evt.User, chunk)
+			}
+			if err != nil {
+				return fmt.Errorf("bulk deleting %s records: %w", collection, err)
+			}
+
+			bulkDeletedRecords.WithLabelValues(collection).Add(float64(len(chunk)))
+		}
+	}
+
+	return nil
+}
+
+func (ix *Indexer) bulkDeletePosts(ctx context.Context, author models.Uid, rkeys []string) error {
+	var posts []models.FeedPost
+	if err := ix.db.WithContext(ctx).Find(&posts, "author = ? AND rkey IN ?", author, rkeys).Error; err != nil {
+		return err
+	}
+
+	if len(posts) < len(rkeys) {
+		log.Warnw("deleting posts weve never seen before. Weird.", "user", author, "count", len(rkeys)-len(posts))
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(posts))
+	quotes := make(map[uint]int)
+	for _, fp := range posts {
+		ids = append(ids, fp.ID)
+
+		if fp.QuoteOf == 0 || fp.Deleted {
+			continue
+		}
+
+		// quotes that a postgate kept out of the count were never added
+		allowed, err := ix.embedAllowed(ctx, fp.QuoteOf, fp.ID)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			quotes[fp.QuoteOf]++
+		}
+	}
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(models.FeedPost{}).Where("id IN ?", ids).UpdateColumn("deleted", true).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("post IN ?", ids).Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+
+		for n, quoted := range byCount(quotes) {
+			if err := tx.Model(models.FeedPost{}).Where("id IN ?", quoted).Update("quote_count", gorm.Expr("quote_count - ?", n)).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (ix *Indexer) bulkDeleteLikes(ctx context.Context, voter models.Uid, rkeys []string) error {
+	var vrs []models.VoteRecord
+	if err := ix.db.WithContext(ctx).Find(&vrs, "voter = ? AND rkey IN ?", voter, rkeys).Error; err != nil {
+		return err
+	}
+	if len(vrs) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(vrs))
+	posts := make(map[uint]int)
+	for _, vr := range vrs {
+		ids = append(ids, vr.ID)
+		posts[vr.Post]++
+	}
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id IN ?", ids).Delete(&models.VoteRecord{}).Error; err != nil {
+			return err
+		}
+
+		for n, pids := range byCount(posts) {
+			if err := tx.Model(models.FeedPost{}).Where("id IN ?", pids).Update("up_count", gorm.Expr("up_count - ?", n)).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (ix *Indexer) bulkDeleteFollows(ctx context.Context, follower models.Uid, rkeys []string) error {
+	var frs []models.FollowRecord
+	if err := ix.db.WithContext(ctx).Find(&frs, "follower = ? AND rkey IN ?", follower, rkeys).Error; err != nil {
+		return err
+	}
+
+	if len(frs) < len(rkeys) {
+		log.Warnw("attempted to delete follows we didnt have a record for", "user", follower, "count", len(rkeys)-len(frs))
+	}
+	if len(frs) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(frs))
+	targets := make(map[models.Uid]int)
+	for _, fr := range frs {
+		ids = append(ids, fr.ID)
+
+		// self-follows aren't counted, see updateFollowCounts
+		if fr.Follower != fr.Target {
+			targets[fr.Target]++
+		}
+	}
+
+	var following int
+	for _, n := range targets {
+		following += n
+	}
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.FollowRecord{}).Error; err != nil {
+			return err
+		}
+
+		if following > 0 {
+			if err := tx.Model(models.ActorInfo{}).Where("uid = ?", follower).Update("following", gorm.Expr("following - ?", following)).Error; err != nil {
+				return err
+			}
+		}
+
+		for n, uids := range byCount(targets) {
+			if err := tx.Model(models.ActorInfo{}).Where("uid IN ?", uids).Update("followers", gorm.Expr("followers - ?", n)).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// byCount groups the keys of m by their value, so that keys needing the same
+// adjustment can be updated with one statement. That's usually all of them.
+func byCount[K comparable](m map[K]int) map[int][]K {
+	out := make(map[int][]K)
+	for k, n := range m {
+		out[n] = append(out[n], k)
+	}
+	return out
+}
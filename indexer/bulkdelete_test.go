@@ -0,0 +1,143 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestBulkDeletes(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetBulkDeleteThreshold(2)
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+		{Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "bbbb", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := &bsky.FeedPost{
+		Text: "look at this",
+		Embed: &bsky.FeedPost_Embed{
+			EmbedRecord: &bsky.EmbedRecord{
+				Record: &comatproto.RepoStrongRef{Uri: "at://did:plc:bob/app.bsky.feed.post/bbbb", Cid: cc.String()},
+			},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "q111", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "p222", cc, &bsky.FeedPost{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for rkey, subject := range map[string]string{"f111": "did:plc:bob", "f222": "did:plc:carol"} {
+		follow := &bsky.GraphFollow{Subject: subject}
+		if err := ix.handleRecordCreateGraphFollow(ctx, follow, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{Rkey: rkey, RecCid: &cc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	like := &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "at://did:plc:bob/app.bsky.feed.post/bbbb", Cid: cc.String()}}
+	if err := ix.handleRecordCreateFeedLike(ctx, like, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{Rkey: "l111", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []repomgr.RepoOp
+	for _, del := range []struct{ collection, rkey string }{
+		{"app.bsky.feed.post", "q111"},
+		{"app.bsky.feed.post", "p222"},
+		{"app.bsky.graph.follow", "f111"},
+		{"app.bsky.graph.follow", "f222"},
+		{"app.bsky.feed.like", "l111"},
+	} {
+		ops = append(ops, repomgr.RepoOp{Kind: repomgr.EvtKindDeleteRecord, Collection: del.collection, Rkey: del.rkey})
+	}
+
+	if ix.batchingDeletes(&repomgr.RepoEvent{User: 1, Ops: ops[:1]}) {
+		t.Fatal("expected a single delete not to be batched")
+	}
+
+	// p222 gets written again after being deleted, which has to stick
+	ops = append(ops, repomgr.RepoOp{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.feed.post",
+		Rkey:       "p222",
+		RecCid:     &cc,
+		Record:     &bsky.FeedPost{Text: "hello again"},
+	})
+
+	if err := ix.HandleRepoEvent(ctx, &repomgr.RepoEvent{User: 1, NewRoot: cc, Rev: "rev1", Ops: ops}); err != nil {
+		t.Fatal(err)
+	}
+
+	var live int64
+	if err := ix.db.Model(&models.FeedPost{}).Where("author = 1 AND NOT deleted").Count(&live).Error; err != nil {
+		t.Fatal(err)
+	}
+	if live != 1 {
+		t.Fatalf("expected only alice's rewritten post to be left, got %d", live)
+	}
+	if _, err := ix.GetPost(ctx, "at://did:plc:alice/app.bsky.feed.post/p222"); err != nil {
+		t.Fatalf("expected the rewritten post to be live: %s", err)
+	}
+
+	var follows int64
+	if err := ix.db.Model(&models.FollowRecord{}).Where("follower = 1").Count(&follows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if follows != 0 {
+		t.Fatalf("expected alice's follows to be deleted, %d left", follows)
+	}
+
+	op, err := ix.GetPost(ctx, "at://did:plc:bob/app.bsky.feed.post/bbbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.QuoteCount != 0 {
+		t.Fatalf("expected quote count to go back to 0, got %d", op.QuoteCount)
+	}
+	if op.UpCount != 0 {
+		t.Fatalf("expected like count to go back to 0, got %d", op.UpCount)
+	}
+
+	var likes int64
+	if err := ix.db.Model(&models.VoteRecord{}).Where("voter = 1").Count(&likes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if likes != 0 {
+		t.Fatalf("expected alice's likes to be deleted, %d left", likes)
+	}
+
+	for _, uid := range []models.Uid{1, 2, 3} {
+		ai, err := ix.LookupUser(ctx, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ai.Followers != 0 || ai.Following != 0 {
+			t.Fatalf("unexpected follow counts for %d: %d followers, %d following", uid, ai.Followers, ai.Following)
+		}
+	}
+}
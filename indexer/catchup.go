@@ -0,0 +1,142 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/models"
+)
+
+const defaultCatchupLookahead = 8
+
+// SetCatchupLookahead configures how many buffered catch-up events may wait
+// decoded while another is being applied during a crawl. It defaults to
+// defaultCatchupLookahead. Events are still applied strictly in order. Zero,
+// or anything below it, leaves no decoded events waiting, but the next event
+// is still decoded while the current one is applied.
+func (ix *Indexer) SetCatchupLookahead(n int) {
+	if n < 0 {
+		n = 0
+	}
+	ix.catchupLookahead = n
+}
+
+// SetCatchupMaxAge sets how long buffered catch-up events stay usable. When
+// a crawl finds a buffered event older than this, the upstream firehose has
+// likely moved on past it, so the buffer is dropped and the repo is fetched
+// instead. Zero keeps buffered events indefinitely.
+func (ix *Indexer) SetCatchupMaxAge(d time.Duration) {
+	ix.catchupMaxAge = d
+}
+
+// catchupExpired reports whether any of the buffered events is older than
+// the configured max age.
+func (ix *Indexer) catchupExpired(jobs []*catchupJob, now time.Time) bool {
+	if ix.catchupMaxAge <= 0 {
+		return false
+	}
+
+	for _, j := range jobs {
+		if !j.buffered.IsZero() && now.Sub(j.buffered) > ix.catchupMaxAge {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dropStaleCatchup returns the buffered events whose rev is newer than the
+// given repo rev. Older or equal revs are replays of commits we already hold,
+// and skipping them keeps reprocessing a firehose segment harmless. Events
+// without a rev can't be ordered against it, so they are always kept.
+func dropStaleCatchup(rev string, jobs []*catchupJob) []*catchupJob {
+	if rev == "" {
+		return jobs
+	}
+
+	out := make([]*catchupJob, 0, len(jobs))
+	for _, j := range jobs {
+		if j.evt.Rev != "" && j.evt.Rev <= rev {
+			catchupStaleEventsSkipped.Inc()
+			continue
+		}
+		out = append(out, j)
+	}
+
+	return out
+}
+
+// catchupGap describes a break in the rev chain of buffered events: the
+// event at index claims to follow since, but the rev before it was expected.
+type catchupGap struct {
+	index    int
+	expected string
+	since    string
+	seq      int64
+}
+
+// findCatchupGap checks that the buffered events chain on from the given
+// repo rev, each event's since matching the rev of the one before it. A
+// mismatch means commits were lost somewhere upstream, and replaying the
+// events would leave the repo missing them. Events without a since carry no
+// chain information and are accepted as they are.
+func findCatchupGap(rev string, jobs []*catchupJob) *catchupGap {
+	for i, j := range jobs {
+		if j.evt.Since != nil && *j.evt.Since != rev {
+			return &catchupGap{
+				index:    i,
+				expected: rev,
+				since:    *j.evt.Since,
+				seq:      j.evt.Seq,
+			}
+		}
+		rev = j.evt.Rev
+	}
+
+	return nil
+}
+
+type decodedCatchup struct {
+	job   *catchupJob
+	slice *carstore.DecodedSlice
+	err   error
+}
+
+// replayCatchup applies the buffered events for a repo in order, decoding
+// upcoming events concurrently. It returns false if any event failed and the
+// repo needs a full sync instead.
+func (ix *Indexer) replayCatchup(ctx context.Context, pds *models.PDS, ai *models.ActorInfo, jobs []*catchupJob) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	decoded := make(chan decodedCatchup, ix.catchupLookahead)
+	go func() {
+		defer close(decoded)
+		for _, j := range jobs {
+			slice, err := carstore.DecodeSlice(j.evt.Blocks)
+			select {
+			case decoded <- decodedCatchup{job: j, slice: slice, err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	i := 0
+	for d := range decoded {
+		catchupEventsProcessed.Inc()
+
+		err := d.err
+		if err == nil {
+			err = ix.repomgr.HandleDecodedExternalUserEvent(ctx, pds.ID, ai.Uid, ai.Did, d.job.evt.Since, d.job.evt.Rev, d.job.evt.Time, d.slice, d.job.evt.Ops)
+		}
+		if err != nil {
+			log.Errorw("buffered event catchup failed", "error", err, "did", ai.Did, "i", i, "jobCount", len(jobs), "seq", d.job.evt.Seq)
+			return false
+		}
+		i++
+	}
+
+	return true
+}
@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+)
+
+func TestFindCatchupGap(t *testing.T) {
+	str := func(s string) *string { return &s }
+	evt := func(seq int64, since *string, rev string) *catchupJob {
+		return &catchupJob{evt: &comatproto.SyncSubscribeRepos_Commit{Seq: seq, Since: since, Rev: rev}}
+	}
+
+	cases := []struct {
+		name string
+		rev  string
+		jobs []*catchupJob
+		gap  int
+	}{
+		{"chained", "r1", []*catchupJob{evt(1, str("r1"), "r2"), evt(2, str("r2"), "r3")}, -1},
+		{"no since", "r1", []*catchupJob{evt(1, nil, "r2"), evt(2, str("r2"), "r3")}, -1},
+		{"first does not follow repo", "r1", []*catchupJob{evt(1, str("r0"), "r2")}, 0},
+		{"missing commit in between", "r1", []*catchupJob{evt(1, str("r1"), "r2"), evt(2, str("r3"), "r4")}, 1},
+	}
+
+	for _, c := range cases {
+		gap := findCatchupGap(c.rev, c.jobs)
+		switch {
+		case c.gap < 0 && gap != nil:
+			t.Errorf("%s: unexpected gap %+v", c.name, gap)
+		case c.gap >= 0 && gap == nil:
+			t.Errorf("%s: expected gap at %d", c.name, c.gap)
+		case c.gap >= 0 && gap.index != c.gap:
+			t.Errorf("%s: expected gap at %d, got %+v", c.name, c.gap, gap)
+		}
+	}
+}
+
+func TestDropStaleCatchup(t *testing.T) {
+	str := func(s string) *string { return &s }
+	jobs := []*catchupJob{
+		{evt: &comatproto.SyncSubscribeRepos_Commit{Seq: 1, Since: str("r1"), Rev: "r2"}},
+		{evt: &comatproto.SyncSubscribeRepos_Commit{Seq: 2, Since: str("r2"), Rev: "r3"}},
+		{evt: &comatproto.SyncSubscribeRepos_Commit{Seq: 3, Since: str("r3"), Rev: "r4"}},
+	}
+
+	if out := dropStaleCatchup("", jobs); len(out) != 3 {
+		t.Fatalf("expected nothing dropped without a local rev, got %d events", len(out))
+	}
+
+	out := dropStaleCatchup("r3", jobs)
+	if len(out) != 1 || out[0].evt.Seq != 3 {
+		t.Fatalf("expected only the event after r3 to remain, got %d events", len(out))
+	}
+	if gap := findCatchupGap("r3", out); gap != nil {
+		t.Fatalf("unexpected gap after dropping stale events: %+v", gap)
+	}
+
+	if out := dropStaleCatchup("r4", jobs); len(out) != 0 {
+		t.Fatalf("expected all events to be stale, got %d", len(out))
+	}
+
+	// an event without a rev would otherwise sort before every rev
+	norev := []*catchupJob{{evt: &comatproto.SyncSubscribeRepos_Commit{Seq: 4}}}
+	if out := dropStaleCatchup("r4", norev); len(out) != 1 {
+		t.Fatal("expected an event without a rev to be kept")
+	}
+}
+
+func TestCatchupExpired(t *testing.T) {
+	now := time.Now()
+	jobs := []*catchupJob{
+		{buffered: now.Add(-time.Hour)},
+		{buffered: now.Add(-time.Minute)},
+	}
+
+	ix := &Indexer{}
+	if ix.catchupExpired(jobs, now) {
+		t.Fatal("buffered events should not expire without a max age")
+	}
+
+	ix.SetCatchupMaxAge(2 * time.Hour)
+	if ix.catchupExpired(jobs, now) {
+		t.Fatal("expected buffered events to still be usable")
+	}
+
+	ix.SetCatchupMaxAge(30 * time.Minute)
+	if !ix.catchupExpired(jobs, now) {
+		t.Fatal("expected the hour old event to be expired")
+	}
+
+	// events restored without a buffer time never expire
+	if ix.catchupExpired([]*catchupJob{{}}, now) {
+		t.Fatal("event without a buffer time should not expire")
+	}
+}
@@ -0,0 +1,34 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+// CollectionHandler indexes records of a collection the indexer doesn't
+// handle itself. It is called for creates, updates and deletes alike (see
+// op.Kind). op.Record holds the decoded record if its type is registered with
+// lexutil, otherwise only op.RecordBytes holds the raw CBOR. Deletes carry
+// neither.
+type CollectionHandler func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error
+
+// RegisterCollectionHandler sets the handler for records in the given
+// collection, replacing any previously registered one. Collections the
+// indexer aggregates itself can't be overridden.
+func (ix *Indexer) RegisterCollectionHandler(nsid string, h CollectionHandler) {
+	ix.collectionHandlersLk.Lock()
+	defer ix.collectionHandlersLk.Unlock()
+
+	if ix.collectionHandlers == nil {
+		ix.collectionHandlers = make(map[string]CollectionHandler)
+	}
+	ix.collectionHandlers[nsid] = h
+}
+
+func (ix *Indexer) collectionHandler(nsid string) CollectionHandler {
+	ix.collectionHandlersLk.RLock()
+	defer ix.collectionHandlersLk.RUnlock()
+
+	return ix.collectionHandlers[nsid]
+}
@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestCollectionHandlerDispatch(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	var seen []repomgr.EventKind
+	ix.RegisterCollectionHandler("com.example.thing", func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+		if op.Kind != repomgr.EvtKindDeleteRecord && len(op.RecordBytes) == 0 {
+			t.Fatal("expected raw record bytes for unregistered record type")
+		}
+		seen = append(seen, op.Kind)
+		return nil
+	})
+
+	evt := &repomgr.RepoEvent{User: 1}
+	raw := []byte{0xa0}
+	for _, op := range []repomgr.RepoOp{
+		{Kind: repomgr.EvtKindCreateRecord, Collection: "com.example.thing", Rkey: "a", RecordBytes: raw},
+		{Kind: repomgr.EvtKindUpdateRecord, Collection: "com.example.thing", Rkey: "a", RecordBytes: raw},
+		{Kind: repomgr.EvtKindDeleteRecord, Collection: "com.example.thing", Rkey: "a"},
+	} {
+		op := op
+		if err := ix.handleRepoOp(ctx, evt, &op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(seen) != 3 || seen[0] != repomgr.EvtKindCreateRecord || seen[1] != repomgr.EvtKindUpdateRecord || seen[2] != repomgr.EvtKindDeleteRecord {
+		t.Fatalf("expected create, update and delete to be dispatched, got %v", seen)
+	}
+
+	// collections without a handler still fail
+	if err := ix.handleRepoOp(ctx, evt, &repomgr.RepoOp{Kind: repomgr.EvtKindDeleteRecord, Collection: "com.example.other", Rkey: "a"}); err == nil {
+		t.Fatal("expected an error for a collection with no handler")
+	}
+}
@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+// SetNewUserCrawlDelay configures how long a newly discovered user waits
+// before being sent to the crawler. References to the user that arrive
+// during the delay are coalesced into the single pending crawl. A delay of
+// zero (the default) crawls new users immediately.
+func (ix *Indexer) SetNewUserCrawlDelay(d time.Duration) {
+	ix.pendingCrawlsLk.Lock()
+	defer ix.pendingCrawlsLk.Unlock()
+
+	ix.newUserCrawlDelay = d
+}
+
+// enqueueNewUserCrawl sends a freshly created user to the crawler, either
+// right away or after the configured delay.
+func (ix *Indexer) enqueueNewUserCrawl(ctx context.Context, ai *models.ActorInfo) error {
+	ix.pendingCrawlsLk.Lock()
+	delay := ix.newUserCrawlDelay
+	if delay <= 0 {
+		ix.pendingCrawlsLk.Unlock()
+
+		if err := ix.addUserToCrawler(ctx, ai); err != nil {
+			return fmt.Errorf("failed to add unknown user to crawler: %w", err)
+		}
+		return nil
+	}
+	defer ix.pendingCrawlsLk.Unlock()
+
+	if _, ok := ix.pendingCrawls[ai.Did]; ok {
+		newUserCrawlsCoalesced.Inc()
+		return nil
+	}
+
+	ix.pendingCrawls[ai.Did] = ai
+	time.AfterFunc(delay, func() {
+		ix.flushPendingCrawl(ai.Did)
+	})
+
+	return nil
+}
+
+// notePendingCrawlRef records a reference to a user whose initial crawl is
+// still waiting out its delay.
+func (ix *Indexer) notePendingCrawlRef(did string) {
+	ix.pendingCrawlsLk.Lock()
+	defer ix.pendingCrawlsLk.Unlock()
+
+	if _, ok := ix.pendingCrawls[did]; ok {
+		newUserCrawlsCoalesced.Inc()
+	}
+}
+
+func (ix *Indexer) flushPendingCrawl(did string) {
+	ix.pendingCrawlsLk.Lock()
+	ai, ok := ix.pendingCrawls[did]
+	delete(ix.pendingCrawls, did)
+	ix.pendingCrawlsLk.Unlock()
+
+	if !ok {
+		return
+	}
+
+	// the request that discovered this user is long gone by now
+	if err := ix.addUserToCrawler(context.Background(), ai); err != nil {
+		log.Warnw("failed to add delayed user to crawler", "did", did, "err", err)
+	}
+}
@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestNewUserCrawlDelayCoalesces(t *testing.T) {
+	ix := &Indexer{pendingCrawls: make(map[string]*models.ActorInfo)}
+	ix.SetNewUserCrawlDelay(50 * time.Millisecond)
+
+	ctx := context.Background()
+	ai := &models.ActorInfo{Did: "did:plc:alice"}
+	for i := 0; i < 3; i++ {
+		if err := ix.enqueueNewUserCrawl(ctx, ai); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ix.pendingCrawlsLk.Lock()
+	n := len(ix.pendingCrawls)
+	ix.pendingCrawlsLk.Unlock()
+	if n != 1 {
+		t.Fatalf("expected 1 pending crawl, got %d", n)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	ix.pendingCrawlsLk.Lock()
+	n = len(ix.pendingCrawls)
+	ix.pendingCrawlsLk.Unlock()
+	if n != 0 {
+		t.Fatalf("expected pending crawl to be flushed, got %d", n)
+	}
+}
@@ -4,15 +4,27 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/models"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	"go.opentelemetry.io/otel"
 )
 
+// crawlOutcomes is how many repos the outcome of their last crawl is kept for.
+const crawlOutcomes = 100000
+
+// CrawlOutcome records how the last crawl of a repo went.
+type CrawlOutcome struct {
+	FinishedAt time.Time `json:"finishedAt"`
+	Cancelled  bool      `json:"cancelled,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
 type CrawlDispatcher struct {
-	ingest chan *models.ActorInfo
+	ingest chan *crawlRequest
 
 	repoSync chan *crawlWork
 
@@ -27,6 +39,14 @@ type CrawlDispatcher struct {
 	doRepoCrawl func(context.Context, *crawlWork) error
 
 	concurrency int
+
+	// maxCatchup caps the events buffered per repo, zero for no limit
+	maxCatchup int
+
+	lastCrawls *lru.Cache[models.Uid, *CrawlOutcome]
+
+	// now stamps buffered events and crawl outcomes
+	now func() time.Time
 }
 
 func NewCrawlDispatcher(repoFn func(context.Context, *crawlWork) error, concurrency int) (*CrawlDispatcher, error) {
@@ -34,8 +54,13 @@ func NewCrawlDispatcher(repoFn func(context.Context, *crawlWork) error, concurre
 		return nil, fmt.Errorf("must specify a non-zero positive integer for crawl dispatcher concurrency")
 	}
 
+	lastCrawls, err := lru.New[models.Uid, *CrawlOutcome](crawlOutcomes)
+	if err != nil {
+		return nil, err
+	}
+
 	return &CrawlDispatcher{
-		ingest:      make(chan *models.ActorInfo),
+		ingest:      make(chan *crawlRequest),
 		repoSync:    make(chan *crawlWork),
 		complete:    make(chan models.Uid),
 		catchup:     make(chan *crawlWork),
@@ -43,6 +68,8 @@ func NewCrawlDispatcher(repoFn func(context.Context, *crawlWork) error, concurre
 		concurrency: concurrency,
 		todo:        make(map[models.Uid]*crawlWork),
 		inProgress:  make(map[models.Uid]*crawlWork),
+		lastCrawls:  lastCrawls,
+		now:         time.Now,
 	}, nil
 }
 
@@ -58,12 +85,23 @@ type catchupJob struct {
 	evt  *comatproto.SyncSubscribeRepos_Commit
 	host *models.PDS
 	user *models.ActorInfo
+
+	// when the event was buffered, zero if unknown
+	buffered time.Time
+}
+
+type crawlRequest struct {
+	act       *models.ActorInfo
+	forceFull bool
 }
 
 type crawlWork struct {
 	act        *models.ActorInfo
 	initScrape bool
 
+	// ignore any local repo state and buffered events, and re-fetch the entire repo
+	forceFull bool
+
 	// for events that come in while this actor's crawl is enqueued
 	// catchup items are processed during the crawl
 	catchup []*catchupJob
@@ -71,6 +109,15 @@ type crawlWork struct {
 	// for events that come in while this actor is being processed
 	// next items are processed after the crawl
 	next []*catchupJob
+
+	// set by CancelCrawl; a cancelled job is skipped when dispatched, and
+	// aborted through cancel if it is already running
+	cancelled bool
+	cancel    context.CancelFunc
+
+	// set when next overflowed the catch-up buffer limit; the job is
+	// queued again for a full resync once the current crawl completes
+	nextOverflowed bool
 }
 
 func (c *CrawlDispatcher) mainLoop() {
@@ -82,9 +129,9 @@ func (c *CrawlDispatcher) mainLoop() {
 
 	for {
 		select {
-		case actorToCrawl := <-c.ingest:
+		case req := <-c.ingest:
 			// TODO: max buffer size
-			crawlJob := c.enqueueJobForActor(actorToCrawl)
+			crawlJob := c.enqueueJobForActor(req)
 			if crawlJob == nil {
 				break
 			}
@@ -125,9 +172,11 @@ func (c *CrawlDispatcher) mainLoop() {
 
 			// If there are any subsequent jobs for this UID, add it back to the todo list or buffer.
 			// We're basically pumping the `next` queue into the `catchup` queue and will do this over and over until the `next` queue is empty.
-			if len(job.next) > 0 {
+			if (len(job.next) > 0 || job.nextOverflowed) && !job.cancelled {
 				c.todo[uid] = job
 				job.initScrape = false
+				job.forceFull = job.nextOverflowed
+				job.nextOverflowed = false
 				job.catchup = job.next
 				job.next = nil
 				if nextDispatchedJob == nil {
@@ -143,22 +192,32 @@ func (c *CrawlDispatcher) mainLoop() {
 }
 
 // enqueueJobForActor adds a new crawl job to the todo list if there isn't already a job in progress for this actor
-func (c *CrawlDispatcher) enqueueJobForActor(ai *models.ActorInfo) *crawlWork {
+func (c *CrawlDispatcher) enqueueJobForActor(req *crawlRequest) *crawlWork {
+	ai := req.act
+
 	c.maplk.Lock()
 	defer c.maplk.Unlock()
 	_, ok := c.inProgress[ai.Uid]
 	if ok {
+		if req.forceFull {
+			log.Warnw("full crawl requested while a crawl is in progress, ignoring", "did", ai.Did)
+		}
 		return nil
 	}
 
-	_, has := c.todo[ai.Uid]
+	job, has := c.todo[ai.Uid]
 	if has {
+		// upgrade the already queued job rather than queueing a second one
+		if req.forceFull {
+			job.forceFull = true
+		}
 		return nil
 	}
 
 	crawlJob := &crawlWork{
 		act:        ai,
 		initScrape: true,
+		forceFull:  req.forceFull,
 	}
 	c.todo[ai.Uid] = crawlJob
 	return crawlJob
@@ -178,8 +237,20 @@ func (c *CrawlDispatcher) addToCatchupQueue(catchup *catchupJob) *crawlWork {
 	defer c.maplk.Unlock()
 
 	// If the actor crawl is enqueued, we can append to the catchup queue which gets emptied during the crawl
+	// A job already set for a full resync will pick the event up from the
+	// fetched repo, so there is no need to buffer it.
 	job, ok := c.todo[catchup.user.Uid]
 	if ok {
+		if job.cancelled || job.forceFull {
+			return nil
+		}
+		if c.maxCatchup > 0 && len(job.catchup) >= c.maxCatchup {
+			log.Warnw("catch-up buffer full, falling back to a full resync", "did", catchup.user.Did, "buffered", len(job.catchup))
+			catchupBufferOverflows.Inc()
+			job.catchup = nil
+			job.forceFull = true
+			return nil
+		}
 		job.catchup = append(job.catchup, catchup)
 		return nil
 	}
@@ -187,6 +258,16 @@ func (c *CrawlDispatcher) addToCatchupQueue(catchup *catchupJob) *crawlWork {
 	// If the actor crawl is in progress, we can append to the nextr queue which gets emptied after the crawl
 	job, ok = c.inProgress[catchup.user.Uid]
 	if ok {
+		if job.cancelled || job.nextOverflowed {
+			return nil
+		}
+		if c.maxCatchup > 0 && len(job.next) >= c.maxCatchup {
+			log.Warnw("catch-up buffer full, falling back to a full resync", "did", catchup.user.Did, "buffered", len(job.next))
+			catchupBufferOverflows.Inc()
+			job.next = nil
+			job.nextOverflowed = true
+			return nil
+		}
 		job.next = append(job.next, catchup)
 		return nil
 	}
@@ -200,13 +281,42 @@ func (c *CrawlDispatcher) addToCatchupQueue(catchup *catchupJob) *crawlWork {
 	return cw
 }
 
+// SetMaxCatchupEvents caps how many events are buffered for a repo while it
+// waits on or undergoes a crawl. Past the cap the buffered events are dropped
+// and the repo is resynced in full instead. Zero (the default) means no cap.
+func (c *CrawlDispatcher) SetMaxCatchupEvents(n int) {
+	c.maplk.Lock()
+	defer c.maplk.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	c.maxCatchup = n
+}
+
 func (c *CrawlDispatcher) fetchWorker() {
 	for {
 		select {
 		case job := <-c.repoSync:
-			if err := c.doRepoCrawl(context.TODO(), job); err != nil {
+			ctx, cancel := context.WithCancel(context.TODO())
+
+			c.maplk.Lock()
+			skip := job.cancelled
+			job.cancel = cancel
+			c.maplk.Unlock()
+
+			outcome := &CrawlOutcome{Cancelled: skip}
+			if skip {
+				crawlsCancelled.Inc()
+			} else if err := c.doRepoCrawl(ctx, job); err != nil {
 				log.Errorf("failed to perform repo crawl of %q: %s", job.act.Did, err)
+				outcome.Error = err.Error()
+				outcome.Cancelled = ctx.Err() != nil
 			}
+			cancel()
+
+			outcome.FinishedAt = c.now()
+			c.lastCrawls.Add(job.act.Uid, outcome)
 
 			// TODO: do we still just do this if it errors?
 			c.complete <- job.act.Uid
@@ -219,13 +329,27 @@ func (c *CrawlDispatcher) Crawl(ctx context.Context, ai *models.ActorInfo) error
 		panic("must have pds for user in queue")
 	}
 
+	return c.enqueue(ctx, &crawlRequest{act: ai})
+}
+
+// CrawlFull enqueues a crawl of the actor's entire repo, disregarding any
+// repo data we already have for them
+func (c *CrawlDispatcher) CrawlFull(ctx context.Context, ai *models.ActorInfo) error {
+	if ai.PDS == 0 {
+		panic("must have pds for user in queue")
+	}
+
+	return c.enqueue(ctx, &crawlRequest{act: ai, forceFull: true})
+}
+
+func (c *CrawlDispatcher) enqueue(ctx context.Context, req *crawlRequest) error {
 	userCrawlsEnqueued.Inc()
 
 	ctx, span := otel.Tracer("crawler").Start(ctx, "addToCrawler")
 	defer span.End()
 
 	select {
-	case c.ingest <- ai:
+	case c.ingest <- req:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -238,9 +362,10 @@ func (c *CrawlDispatcher) AddToCatchupQueue(ctx context.Context, host *models.PD
 	}
 
 	catchup := &catchupJob{
-		evt:  evt,
-		host: host,
-		user: u,
+		evt:      evt,
+		host:     host,
+		user:     u,
+		buffered: c.now(),
 	}
 
 	cw := c.addToCatchupQueue(catchup)
@@ -256,6 +381,110 @@ func (c *CrawlDispatcher) AddToCatchupQueue(ctx context.Context, host *models.PD
 	}
 }
 
+// pendingWork returns a copy of every job that is queued or in progress. The
+// events buffered for after an in-progress crawl are folded into its catch-up
+// list, as the crawl itself will have to be redone.
+func (c *CrawlDispatcher) pendingWork() []*crawlWork {
+	c.maplk.Lock()
+	defer c.maplk.Unlock()
+
+	out := make([]*crawlWork, 0, len(c.todo)+len(c.inProgress))
+	for _, jobs := range []map[models.Uid]*crawlWork{c.todo, c.inProgress} {
+		for _, job := range jobs {
+			if job.cancelled {
+				continue
+			}
+
+			cp := &crawlWork{
+				act:        job.act,
+				initScrape: job.initScrape,
+				forceFull:  job.forceFull || job.nextOverflowed,
+			}
+			cp.catchup = append(cp.catchup, job.catchup...)
+			cp.catchup = append(cp.catchup, job.next...)
+			out = append(out, cp)
+		}
+	}
+
+	return out
+}
+
+// restoreWork queues a job loaded from a saved crawl queue, merging it into
+// any job already queued for the same user.
+func (c *CrawlDispatcher) restoreWork(ctx context.Context, cw *crawlWork) error {
+	uid := cw.act.Uid
+
+	c.maplk.Lock()
+	if job, ok := c.todo[uid]; ok {
+		job.catchup = append(cw.catchup, job.catchup...)
+		job.forceFull = job.forceFull || cw.forceFull
+		c.maplk.Unlock()
+		return nil
+	}
+	if job, ok := c.inProgress[uid]; ok {
+		job.next = append(job.next, cw.catchup...)
+		c.maplk.Unlock()
+		return nil
+	}
+	c.todo[uid] = cw
+	c.maplk.Unlock()
+
+	select {
+	case c.catchup <- cw:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CancelCrawl drops any queued crawl of the given user along with its
+// buffered events, and aborts the crawl if it is already running. It reports
+// whether there was a crawl to cancel.
+func (c *CrawlDispatcher) CancelCrawl(uid models.Uid) bool {
+	c.maplk.Lock()
+	defer c.maplk.Unlock()
+
+	if job, ok := c.todo[uid]; ok {
+		job.cancelled = true
+		job.catchup = nil
+		return true
+	}
+
+	if job, ok := c.inProgress[uid]; ok {
+		job.cancelled = true
+		job.next = nil
+		if job.cancel != nil {
+			job.cancel()
+		}
+		return true
+	}
+
+	return false
+}
+
+// CrawlState reports whether a crawl of the given user is "queued" or
+// "inProgress", or the empty string if neither.
+func (c *CrawlDispatcher) CrawlState(uid models.Uid) string {
+	c.maplk.Lock()
+	defer c.maplk.Unlock()
+
+	if job, ok := c.todo[uid]; ok && !job.cancelled {
+		return "queued"
+	}
+	if job, ok := c.inProgress[uid]; ok && !job.cancelled {
+		return "inProgress"
+	}
+
+	return ""
+}
+
+// LastCrawl returns the outcome of the last crawl of the given user, or nil
+// if it hasn't been crawled recently.
+func (c *CrawlDispatcher) LastCrawl(uid models.Uid) *CrawlOutcome {
+	outcome, _ := c.lastCrawls.Get(uid)
+	return outcome
+}
+
 func (c *CrawlDispatcher) RepoInSlowPath(ctx context.Context, host *models.PDS, uid models.Uid) bool {
 	c.maplk.Lock()
 	defer c.maplk.Unlock()
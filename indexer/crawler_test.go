@@ -0,0 +1,185 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestCancelCrawl(t *testing.T) {
+	started := make(chan models.Uid, 2)
+	aborted := make(chan models.Uid, 2)
+
+	var lk sync.Mutex
+	crawled := make(map[models.Uid]bool)
+
+	c, err := NewCrawlDispatcher(func(ctx context.Context, job *crawlWork) error {
+		lk.Lock()
+		crawled[job.act.Uid] = true
+		lk.Unlock()
+
+		started <- job.act.Uid
+		<-ctx.Done()
+		aborted <- job.act.Uid
+		return ctx.Err()
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run()
+
+	ctx := context.Background()
+	running := &models.ActorInfo{Uid: 1, Did: "did:plc:running", PDS: 1}
+	queued := &models.ActorInfo{Uid: 2, Did: "did:plc:queued", PDS: 1}
+
+	if err := c.Crawl(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := c.Crawl(ctx, queued); err != nil {
+		t.Fatal(err)
+	}
+
+	// the dispatcher queues the job asynchronously
+	for i := 0; !c.RepoInSlowPath(ctx, nil, queued.Uid); i++ {
+		if i > 100 {
+			t.Fatal("crawl was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if !c.CancelCrawl(queued.Uid) {
+		t.Fatal("expected queued crawl to be cancelled")
+	}
+	if !c.CancelCrawl(running.Uid) {
+		t.Fatal("expected running crawl to be cancelled")
+	}
+
+	select {
+	case uid := <-aborted:
+		if uid != running.Uid {
+			t.Fatalf("unexpected crawl aborted: %d", uid)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("running crawl was not aborted")
+	}
+
+	// give the dispatcher the chance to (wrongly) run the queued job
+	time.Sleep(50 * time.Millisecond)
+
+	lk.Lock()
+	defer lk.Unlock()
+	if crawled[queued.Uid] {
+		t.Fatal("cancelled queued crawl still ran")
+	}
+
+	if c.CancelCrawl(3) {
+		t.Fatal("expected nothing to cancel for unknown user")
+	}
+}
+
+func TestCatchupBufferOverflow(t *testing.T) {
+	type crawl struct {
+		uid       models.Uid
+		forceFull bool
+		catchup   int
+	}
+
+	release := make(chan struct{})
+	crawls := make(chan crawl, 4)
+
+	c, err := NewCrawlDispatcher(func(ctx context.Context, job *crawlWork) error {
+		crawls <- crawl{job.act.Uid, job.forceFull, len(job.catchup)}
+		<-release
+		return nil
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxCatchupEvents(2)
+	c.Run()
+
+	ctx := context.Background()
+	running := &models.ActorInfo{Uid: 1, Did: "did:plc:running", PDS: 1}
+	queued := &models.ActorInfo{Uid: 2, Did: "did:plc:queued", PDS: 1}
+
+	if err := c.Crawl(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+	if cr := <-crawls; cr.uid != running.Uid {
+		t.Fatalf("unexpected first crawl: %+v", cr)
+	}
+	if err := c.Crawl(ctx, queued); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; !c.RepoInSlowPath(ctx, nil, queued.Uid); i++ {
+		if i > 100 {
+			t.Fatal("crawl was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, ai := range []*models.ActorInfo{running, queued} {
+		for i := 0; i < 3; i++ {
+			if err := c.AddToCatchupQueue(ctx, nil, ai, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got := make(map[models.Uid]crawl)
+	for i := 0; i < 2; i++ {
+		release <- struct{}{}
+		select {
+		case cr := <-crawls:
+			got[cr.uid] = cr
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for crawl")
+		}
+	}
+	close(release)
+
+	for _, uid := range []models.Uid{running.Uid, queued.Uid} {
+		cr, ok := got[uid]
+		if !ok {
+			t.Fatalf("user %d was not crawled again", uid)
+		}
+		if !cr.forceFull || cr.catchup != 0 {
+			t.Fatalf("expected a full resync with no buffered events for user %d, got %+v", uid, cr)
+		}
+	}
+}
+
+func TestCrawlDispatcherClock(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ix.Now = func() time.Time { return now }
+
+	c, err := NewCrawlDispatcher(func(ctx context.Context, job *crawlWork) error { return nil }, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = func() time.Time { return ix.Now() }
+	c.Run()
+
+	ai := &models.ActorInfo{Uid: 1, Did: "did:plc:alice", PDS: 1}
+	if err := c.Crawl(context.Background(), ai); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; c.LastCrawl(ai.Uid) == nil; i++ {
+		if i > 1000 {
+			t.Fatal("crawl never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := c.LastCrawl(ai.Uid).FinishedAt; !got.Equal(now) {
+		t.Fatalf("expected the outcome to be stamped by the indexer's clock, got %s", got)
+	}
+}
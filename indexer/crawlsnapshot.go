@@ -0,0 +1,219 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const defaultCrawlSnapshotMaxBuffer = 256 << 20
+
+// SetCrawlSnapshotMaxBuffer caps the total size of the buffered catch-up
+// events SaveCrawlQueue writes out. Jobs keep their place in the queue when
+// their buffers are evicted; they just fetch the repo instead of replaying.
+func (ix *Indexer) SetCrawlSnapshotMaxBuffer(n int64) {
+	ix.crawlSnapshotMaxBuffer = n
+}
+
+// SaveCrawlQueue writes the crawl dispatcher's pending jobs to the database so
+// RestoreCrawlQueue can pick them up after a restart. It replaces any queue
+// saved previously.
+func (ix *Indexer) SaveCrawlQueue(ctx context.Context) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "SaveCrawlQueue")
+	defer span.End()
+
+	if ix.Crawler == nil {
+		return nil
+	}
+
+	jobs := ix.Crawler.pendingWork()
+	evicted := evictCrawlBuffers(jobs, ix.crawlSnapshotMaxBuffer)
+	crawlSnapshotBuffersEvicted.Add(float64(evicted))
+
+	span.SetAttributes(attribute.Int("jobs", len(jobs)), attribute.Int("evicted", evicted))
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.CrawlQueueEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&models.CrawlQueueEvent{}).Error; err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if err := tx.Create(&models.CrawlQueueEntry{
+				Uid:        job.act.Uid,
+				InitScrape: job.initScrape,
+				ForceFull:  job.forceFull,
+			}).Error; err != nil {
+				return err
+			}
+
+			for _, cj := range job.catchup {
+				buf := new(bytes.Buffer)
+				if err := cj.evt.MarshalCBOR(buf); err != nil {
+					return fmt.Errorf("failed to marshal buffered event: %w", err)
+				}
+
+				pdsID := job.act.PDS
+				if cj.host != nil {
+					pdsID = cj.host.ID
+				}
+
+				if err := tx.Create(&models.CrawlQueueEvent{
+					Uid:        job.act.Uid,
+					PDS:        pdsID,
+					Event:      buf.Bytes(),
+					BufferedAt: cj.buffered,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// evictCrawlBuffers drops the buffered events of the jobs with the largest
+// buffers until the total fits in max, returning how many jobs lost theirs.
+// Large buffers go first as those repos are the cheapest to re-sync with a
+// fetch relative to what they'd cost to keep.
+func evictCrawlBuffers(jobs []*crawlWork, max int64) int {
+	sizes := make(map[*crawlWork]int64, len(jobs))
+	var total int64
+	for _, job := range jobs {
+		for _, cj := range job.catchup {
+			sizes[job] += int64(len(cj.evt.Blocks))
+		}
+		total += sizes[job]
+	}
+
+	if total <= max {
+		return 0
+	}
+
+	bysize := make([]*crawlWork, len(jobs))
+	copy(bysize, jobs)
+	sort.Slice(bysize, func(i, j int) bool {
+		return sizes[bysize[i]] > sizes[bysize[j]]
+	})
+
+	evicted := 0
+	for _, job := range bysize {
+		if total <= max {
+			break
+		}
+		if len(job.catchup) == 0 {
+			continue
+		}
+
+		total -= sizes[job]
+		job.catchup = nil
+		evicted++
+	}
+
+	return evicted
+}
+
+// RestoreCrawlQueue re-queues the crawl jobs saved by SaveCrawlQueue, then
+// clears the saved queue. It must be called after the crawler is running.
+// Jobs whose buffered events can't be restored are queued for a full fetch
+// of the repo instead.
+func (ix *Indexer) RestoreCrawlQueue(ctx context.Context) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "RestoreCrawlQueue")
+	defer span.End()
+
+	if ix.Crawler == nil {
+		return nil
+	}
+
+	var entries []models.CrawlQueueEntry
+	if err := ix.db.WithContext(ctx).Order("id").Find(&entries).Error; err != nil {
+		return err
+	}
+
+	pdsCache := make(map[uint]*models.PDS)
+	restored := 0
+	for _, ent := range entries {
+		ai, err := ix.LookupUser(ctx, ent.Uid)
+		if err != nil {
+			log.Warnw("skipping saved crawl for unknown user", "uid", ent.Uid, "err", err)
+			continue
+		}
+
+		cw := &crawlWork{
+			act:        ai,
+			initScrape: ent.InitScrape,
+			forceFull:  ent.ForceFull,
+		}
+
+		var evts []models.CrawlQueueEvent
+		if err := ix.db.WithContext(ctx).Order("id").Find(&evts, "uid = ?", ent.Uid).Error; err != nil {
+			return err
+		}
+
+		catchup, err := ix.restoreCatchup(ctx, ai, evts, pdsCache)
+		if err != nil {
+			// the repo is still crawled, just from a fetch instead
+			log.Warnw("dropping unusable saved crawl events", "uid", ent.Uid, "events", len(evts), "err", err)
+			cw.forceFull = true
+		} else {
+			cw.catchup = catchup
+		}
+
+		if err := ix.Crawler.restoreWork(ctx, cw); err != nil {
+			return err
+		}
+		restored++
+	}
+
+	log.Infow("restored saved crawl queue", "jobs", restored)
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.CrawlQueueEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("1 = 1").Delete(&models.CrawlQueueEvent{}).Error
+	})
+}
+
+// restoreCatchup decodes a job's saved buffered events. Any event that can't
+// be restored, because it is corrupt or its PDS is gone, fails the lot, as
+// replaying around a gap would leave the repo incomplete.
+func (ix *Indexer) restoreCatchup(ctx context.Context, ai *models.ActorInfo, evts []models.CrawlQueueEvent, pdsCache map[uint]*models.PDS) ([]*catchupJob, error) {
+	var out []*catchupJob
+	for _, e := range evts {
+		host, ok := pdsCache[e.PDS]
+		if !ok {
+			var pds models.PDS
+			if err := ix.db.WithContext(ctx).First(&pds, "id = ?", e.PDS).Error; err != nil {
+				return nil, fmt.Errorf("failed to find pds of saved crawl event: %w", err)
+			}
+			host = &pds
+			pdsCache[e.PDS] = host
+		}
+
+		var evt comatproto.SyncSubscribeRepos_Commit
+		if err := evt.UnmarshalCBOR(bytes.NewReader(e.Event)); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal saved crawl event: %w", err)
+		}
+
+		out = append(out, &catchupJob{
+			evt:      &evt,
+			host:     host,
+			user:     ai,
+			buffered: e.BufferedAt,
+		})
+	}
+
+	return out, nil
+}
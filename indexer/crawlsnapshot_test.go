@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/ipfs/go-cid"
+)
+
+func TestCrawlQueueSnapshotRoundTrip(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+	pds := &models.PDS{Host: "pds.example.com"}
+	if err := ix.db.Create(pds).Error; err != nil {
+		t.Fatal(err)
+	}
+	ai := &models.ActorInfo{Uid: 1, Did: "did:plc:alice", PDS: pds.ID}
+	if err := ix.db.Create(ai).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := lexutil.LexLink(cc)
+
+	noop := func(context.Context, *crawlWork) error { return nil }
+
+	// dispatchers aren't run here, so nothing gets crawled
+	before, err := NewCrawlDispatcher(noop, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffered := time.Now().Add(-time.Minute)
+	before.todo[ai.Uid] = &crawlWork{
+		act: ai,
+		catchup: []*catchupJob{
+			{evt: &comatproto.SyncSubscribeRepos_Commit{Repo: ai.Did, Commit: commit, Seq: 10, Blocks: []byte("one")}, host: pds, user: ai, buffered: buffered},
+			{evt: &comatproto.SyncSubscribeRepos_Commit{Repo: ai.Did, Commit: commit, Seq: 11, Blocks: []byte("two")}, host: pds, user: ai},
+		},
+	}
+	ix.Crawler = before
+
+	if err := ix.SaveCrawlQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewCrawlDispatcher(noop, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.Crawler = after
+	go func() {
+		for range after.catchup {
+		}
+	}()
+
+	if err := ix.RestoreCrawlQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(after.catchup)
+
+	job, ok := after.todo[ai.Uid]
+	if !ok {
+		t.Fatal("expected saved job to be restored")
+	}
+	if len(job.catchup) != 2 || job.catchup[0].evt.Seq != 10 || job.catchup[1].evt.Seq != 11 {
+		t.Fatalf("expected both buffered events, in order, got %d", len(job.catchup))
+	}
+	if job.catchup[0].host.ID != pds.ID {
+		t.Fatalf("expected restored event host to be %d, got %d", pds.ID, job.catchup[0].host.ID)
+	}
+	if !job.catchup[0].buffered.Equal(buffered) {
+		t.Fatalf("expected restored event to keep its buffer time, got %s", job.catchup[0].buffered)
+	}
+
+	var n int64
+	if err := ix.db.Model(&models.CrawlQueueEntry{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected saved queue to be cleared after restore, found %d entries", n)
+	}
+}
+
+func TestEvictCrawlBuffersLargestFirst(t *testing.T) {
+	mk := func(sizes ...int) *crawlWork {
+		cw := &crawlWork{}
+		for _, s := range sizes {
+			cw.catchup = append(cw.catchup, &catchupJob{evt: &comatproto.SyncSubscribeRepos_Commit{Blocks: make([]byte, s)}})
+		}
+		return cw
+	}
+
+	small, medium, large := mk(10), mk(20, 20), mk(100)
+	jobs := []*crawlWork{small, medium, large}
+
+	if n := evictCrawlBuffers(jobs, 60); n != 1 {
+		t.Fatalf("expected one buffer to be evicted, got %d", n)
+	}
+	if large.catchup != nil {
+		t.Fatal("expected the largest buffer to be evicted")
+	}
+	if len(small.catchup) != 1 || len(medium.catchup) != 2 {
+		t.Fatal("expected the smaller buffers to be kept")
+	}
+}
+
+func TestRestoreCrawlQueueUnusableEvents(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+	pds := &models.PDS{Host: "pds.example.com"}
+	if err := ix.db.Create(pds).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	evt := &comatproto.SyncSubscribeRepos_Commit{Repo: "did:plc:alice", Commit: lexutil.LexLink(cc), Seq: 10, Blocks: []byte("one")}
+	if err := evt.MarshalCBOR(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// alice's events are fine, bob's PDS has since been deleted and carol's
+	// event is corrupt
+	for _, row := range []struct {
+		ai  *models.ActorInfo
+		evt models.CrawlQueueEvent
+	}{
+		{&models.ActorInfo{Uid: 1, Did: "did:plc:alice", PDS: pds.ID}, models.CrawlQueueEvent{PDS: pds.ID, Event: buf.Bytes()}},
+		{&models.ActorInfo{Uid: 2, Did: "did:plc:bob", PDS: pds.ID}, models.CrawlQueueEvent{PDS: pds.ID + 1, Event: buf.Bytes()}},
+		{&models.ActorInfo{Uid: 3, Did: "did:plc:carol", PDS: pds.ID}, models.CrawlQueueEvent{PDS: pds.ID, Event: []byte("not cbor")}},
+	} {
+		if err := ix.db.Create(row.ai).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.db.Create(&models.CrawlQueueEntry{Uid: row.ai.Uid}).Error; err != nil {
+			t.Fatal(err)
+		}
+		row.evt.Uid = row.ai.Uid
+		if err := ix.db.Create(&row.evt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	noop := func(context.Context, *crawlWork) error { return nil }
+	c, err := NewCrawlDispatcher(noop, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.Crawler = c
+	go func() {
+		for range c.catchup {
+		}
+	}()
+
+	if err := ix.RestoreCrawlQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(c.catchup)
+
+	if job := c.todo[1]; job == nil || len(job.catchup) != 1 || job.forceFull {
+		t.Fatalf("expected alice's job to keep its buffered event, got %+v", job)
+	}
+	for _, uid := range []models.Uid{2, 3} {
+		job := c.todo[uid]
+		if job == nil {
+			t.Fatalf("expected job for %d to be restored", uid)
+		}
+		if len(job.catchup) != 0 || !job.forceFull {
+			t.Fatalf("expected job for %d to fall back to a full fetch, got %d events, forceFull %t", uid, len(job.catchup), job.forceFull)
+		}
+	}
+}
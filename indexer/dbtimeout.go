@@ -0,0 +1,136 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrQueryTimeout is returned (wrapped) by queries that ran past the timeout
+// set with SetQueryTimeout.
+var ErrQueryTimeout = errors.New("database query timed out")
+
+const (
+	queryTimeoutKey = "indexer:query_timeout"
+	queryParentKey  = "indexer:query_parent_ctx"
+	queryCancelKey  = "indexer:query_cancel"
+)
+
+// SetQueryTimeout bounds how long any single query the indexer makes may
+// run, so a degraded database fails queries fast instead of stalling event
+// processing. Zero means no timeout beyond that of the caller's context. The
+// timeout applies to the read replica too, whichever of the two is set first.
+func (ix *Indexer) SetQueryTimeout(d time.Duration) error {
+	db, err := withQueryTimeout(ix.db, d)
+	if err != nil {
+		return err
+	}
+
+	if ix.readReplica != nil {
+		replica, err := withQueryTimeout(ix.readReplica, d)
+		if err != nil {
+			return fmt.Errorf("read replica: %w", err)
+		}
+		ix.readReplica = replica
+	}
+
+	ix.db = db
+	return nil
+}
+
+// withQueryTimeout returns a session of db whose queries are bounded by d.
+func withQueryTimeout(db *gorm.DB, d time.Duration) (*gorm.DB, error) {
+	if d <= 0 {
+		if _, ok := db.Get(queryTimeoutKey); !ok {
+			return db, nil
+		}
+	} else if err := registerQueryTimeoutCallbacks(db); err != nil {
+		return nil, err
+	}
+
+	// Set hands back a bare statement that later queries would keep adding
+	// conditions to; a new session makes each query start from a copy
+	return db.Set(queryTimeoutKey, max(d, 0)).Session(&gorm.Session{}), nil
+}
+
+// registerQueryTimeoutCallbacks hooks the timeout into every kind of
+// statement. The callbacks only act on sessions carrying queryTimeoutKey, so
+// other users of the same database are unaffected.
+func registerQueryTimeoutCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	if cb.Query().Get("indexer:timeout_before") != nil {
+		return nil
+	}
+
+	if err := cb.Create().Before("*").Register("indexer:timeout_before", startQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Create().After("*").Register("indexer:timeout_after", endQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register("indexer:timeout_before", startQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Query().After("*").Register("indexer:timeout_after", endQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register("indexer:timeout_before", startQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Update().After("*").Register("indexer:timeout_after", endQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register("indexer:timeout_before", startQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("*").Register("indexer:timeout_after", endQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("*").Register("indexer:timeout_before", startQueryTimeout); err != nil {
+		return err
+	}
+	return cb.Raw().After("*").Register("indexer:timeout_after", endQueryTimeout)
+}
+
+func startQueryTimeout(db *gorm.DB) {
+	v, ok := db.Get(queryTimeoutKey)
+	if !ok {
+		return
+	}
+
+	d, _ := v.(time.Duration)
+	if d <= 0 {
+		return
+	}
+
+	parent := db.Statement.Context
+	ctx, cancel := context.WithTimeout(parent, d)
+	db.Statement.Context = ctx
+	db.InstanceSet(queryParentKey, parent)
+	db.InstanceSet(queryCancelKey, cancel)
+}
+
+func endQueryTimeout(db *gorm.DB) {
+	v, ok := db.InstanceGet(queryCancelKey)
+	if !ok {
+		return
+	}
+	cancel := v.(context.CancelFunc)
+
+	timedOut := errors.Is(db.Statement.Context.Err(), context.DeadlineExceeded)
+	cancel()
+
+	// statements can be reused by chained sessions, so put the caller's
+	// context back for the next query
+	if parent, ok := db.InstanceGet(queryParentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+
+	if timedOut && db.Error != nil {
+		queryTimeouts.Inc()
+		db.Error = fmt.Errorf("%w: %w", ErrQueryTimeout, db.Error)
+	}
+}
@@ -0,0 +1,133 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	if err := tt.ix.SetQueryTimeout(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := tt.ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// conditions of one query don't leak into the next
+	for i := 0; i < 3; i++ {
+		for _, did := range []string{"did:plc:alice", "did:plc:bob"} {
+			ai, err := tt.ix.LookupUserByDid(ctx, did)
+			if err != nil {
+				t.Fatalf("lookup %d of %s: %s", i, did, err)
+			}
+			if ai.Did != did {
+				t.Fatalf("expected %s, got %s", did, ai.Did)
+			}
+		}
+	}
+
+	// quick queries are unaffected, including repeated use of one session
+	q := tt.ix.db.WithContext(ctx).Model(&models.ActorInfo{}).Where("uid > ?", 0)
+	for i := 0; i < 2; i++ {
+		var n int64
+		if err := q.Count(&n).Error; err != nil {
+			t.Fatalf("count %d: %s", i, err)
+		}
+	}
+
+	var out []struct{ N int64 }
+	err := tt.ix.db.WithContext(ctx).Raw("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 1000000000) SELECT count(*) AS n FROM c").Find(&out).Error
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Fatalf("expected query timeout, got %v", err)
+	}
+
+	if err := tt.ix.SetQueryTimeout(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int64
+	if err := tt.ix.db.WithContext(ctx).Model(&models.ActorInfo{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 users, got %d", n)
+	}
+	if _, err := tt.ix.LookupUserByDid(ctx, "did:plc:bob"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryTimeoutDisabled(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	db := tt.ix.db
+	if err := tt.ix.SetQueryTimeout(0); err != nil {
+		t.Fatal(err)
+	}
+	if tt.ix.db != db {
+		t.Fatal("expected a zero timeout to leave the database alone")
+	}
+}
+
+func TestQueryTimeoutReadReplica(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	slow := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 1000000000) SELECT count(*) AS n FROM c"
+
+	// the timeout reaches the replica whichever is configured first
+	for i, replicaFirst := range []bool{true, false} {
+		replica, err := gorm.Open(sqlite.Open(filepath.Join(tt.dir, fmt.Sprintf("replica%d.sqlite", i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tt.ix.SetQueryTimeout(0); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.ix.SetReadReplica(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if replicaFirst {
+			if err := tt.ix.SetReadReplica(replica); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tt.ix.SetQueryTimeout(50 * time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if !replicaFirst {
+			if err := tt.ix.SetReadReplica(replica); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var out []struct{ N int64 }
+		err = tt.ix.reader(ctx).WithContext(ctx).Raw(slow).Find(&out).Error
+		if !errors.Is(err, ErrQueryTimeout) {
+			t.Fatalf("replica set first=%v: expected query timeout, got %v", replicaFirst, err)
+		}
+	}
+}
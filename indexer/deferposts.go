@@ -0,0 +1,288 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/util"
+)
+
+// SetDeferMissingPosts stops placeholder posts from being created for
+// references to posts we haven't seen. Instead, the referencing record (a
+// like, repost, reply, ...) is held back until the post is indexed and then
+// aggregated, and a crawl of the post's author is enqueued to get it there.
+// At most max records are held at once, further ones are dropped, as are
+// records held for longer than ttl (zero holds them until the post shows
+// up) and records deleted while held. Records held back are only kept in
+// memory. Zero max creates placeholders, which is the default.
+func (ix *Indexer) SetDeferMissingPosts(max int, ttl time.Duration) {
+	ix.deferredLk.Lock()
+	defer ix.deferredLk.Unlock()
+
+	ix.deferredMax = max
+	ix.deferredTTL = ttl
+}
+
+// how often held back records are checked for having expired
+const deferredSweepInterval = time.Minute
+
+type postRef struct {
+	author models.Uid
+	rkey   string
+}
+
+// heldRecord identifies a record that has ops held back
+type heldRecord struct {
+	user       models.Uid
+	collection string
+	rkey       string
+}
+
+type deferredOp struct {
+	evt    *repomgr.RepoEvent
+	op     repomgr.RepoOp
+	heldAt time.Time
+}
+
+func (d *deferredOp) record() heldRecord {
+	return heldRecord{user: d.evt.User, collection: d.op.Collection, rkey: d.op.Rkey}
+}
+
+// postDeferredError is returned in place of a placeholder post when
+// deferring is enabled, so the op being handled can be held back.
+type postDeferredError struct {
+	ref postRef
+	uri string
+}
+
+func (e *postDeferredError) Error() string {
+	return fmt.Sprintf("referenced post %s not indexed yet", e.uri)
+}
+
+func (ix *Indexer) deferringMissingPosts() bool {
+	ix.deferredLk.Lock()
+	defer ix.deferredLk.Unlock()
+
+	return ix.deferredMax > 0
+}
+
+// deferMissingPost makes sure the author of a post we don't have gets
+// crawled, and returns the error that holds back the referencing record.
+func (ix *Indexer) deferMissingPost(ctx context.Context, puri *util.ParsedUri) error {
+	ai, err := ix.LookupUserByDid(ctx, puri.Did)
+	switch {
+	case err == nil:
+		ref := postRef{author: ai.Uid, rkey: puri.Rkey}
+		if !ix.hasDeferredOps(ref) && ai.PDS != 0 {
+			// only the first record waiting on the post needs to trigger
+			// a crawl
+			if err := ix.addUserToCrawler(ctx, ai); err != nil {
+				return err
+			}
+		}
+	case isNotFound(err):
+		if ai, err = ix.createMissingUserRecord(ctx, puri.Did); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return &postDeferredError{
+		ref: postRef{author: ai.Uid, rkey: puri.Rkey},
+		uri: util.BuildAtUri(puri.Did, puri.Collection, puri.Rkey),
+	}
+}
+
+func (ix *Indexer) hasDeferredOps(ref postRef) bool {
+	ix.deferredLk.Lock()
+	defer ix.deferredLk.Unlock()
+
+	return len(ix.deferredOps[ref]) > 0
+}
+
+// holdIfDeferred buffers the op if handling it failed because it references
+// a post that isn't indexed yet, returning any other error unchanged.
+func (ix *Indexer) holdIfDeferred(err error, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	var de *postDeferredError
+	if !errors.As(err, &de) {
+		return err
+	}
+
+	ix.deferredLk.Lock()
+	defer ix.deferredLk.Unlock()
+
+	now := ix.Now()
+	if ix.deferredCount >= ix.deferredMax || now.Sub(ix.deferredSwept) >= deferredSweepInterval {
+		ix.expireDeferredOpsLocked(now)
+	}
+
+	if ix.deferredCount >= ix.deferredMax {
+		deferredOpsDropped.Inc()
+		log.Warnw("too many records waiting on unknown posts, dropping", "uid", evt.User, "collection", op.Collection, "rkey", op.Rkey, "post", de.uri)
+		return nil
+	}
+
+	if ix.deferredOps == nil {
+		ix.deferredOps = make(map[postRef][]*deferredOp)
+		ix.deferredBy = make(map[heldRecord][]postRef)
+	}
+
+	// record handlers only look at the user, so don't hang on to the rest of
+	// the event (namely its blocks)
+	d := &deferredOp{
+		evt:    &repomgr.RepoEvent{User: evt.User},
+		op:     *op,
+		heldAt: now,
+	}
+	ix.deferredOps[de.ref] = append(ix.deferredOps[de.ref], d)
+	ix.deferredBy[d.record()] = append(ix.deferredBy[d.record()], de.ref)
+	ix.deferredCount++
+	deferredOpsBuffered.Set(float64(ix.deferredCount))
+
+	return nil
+}
+
+// removeDeferredOpsLocked drops the ops held on ref that match, keeping
+// deferredBy and the count in step.
+func (ix *Indexer) removeDeferredOpsLocked(ref postRef, match func(*deferredOp) bool) int {
+	ops := ix.deferredOps[ref]
+	kept := ops[:0]
+	removed := 0
+	for _, d := range ops {
+		if !match(d) {
+			kept = append(kept, d)
+			continue
+		}
+
+		removed++
+		rec := d.record()
+		refs := ix.deferredBy[rec]
+		for i, r := range refs {
+			if r == ref {
+				refs = append(refs[:i], refs[i+1:]...)
+				break
+			}
+		}
+		if len(refs) == 0 {
+			delete(ix.deferredBy, rec)
+		} else {
+			ix.deferredBy[rec] = refs
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(ix.deferredOps, ref)
+	} else {
+		ix.deferredOps[ref] = kept
+	}
+	ix.deferredCount -= removed
+	deferredOpsBuffered.Set(float64(ix.deferredCount))
+
+	return removed
+}
+
+// expireDeferredOpsLocked drops ops that have been held for longer than the
+// ttl.
+func (ix *Indexer) expireDeferredOpsLocked(now time.Time) {
+	ix.deferredSwept = now
+	if ix.deferredTTL <= 0 {
+		return
+	}
+
+	for ref := range ix.deferredOps {
+		n := ix.removeDeferredOpsLocked(ref, func(d *deferredOp) bool {
+			return now.Sub(d.heldAt) > ix.deferredTTL
+		})
+		deferredOpsExpired.Add(float64(n))
+	}
+}
+
+// dropDeferredOps forgets the held back ops of a record that got deleted, so
+// they don't bring it back once the post they wait on shows up.
+func (ix *Indexer) dropDeferredOps(user models.Uid, op *repomgr.RepoOp) {
+	ix.deferredLk.Lock()
+	defer ix.deferredLk.Unlock()
+
+	rec := heldRecord{user: user, collection: op.Collection, rkey: op.Rkey}
+	refs := append([]postRef(nil), ix.deferredBy[rec]...)
+	for _, ref := range refs {
+		ix.removeDeferredOpsLocked(ref, func(d *deferredOp) bool {
+			return d.record() == rec
+		})
+	}
+}
+
+// replayDeferredOps hands the records that were waiting on the given post
+// back for aggregation, now that it has been indexed. Each goes through the
+// worker or gate of the repo it belongs to, so it stays ordered with that
+// repo's other events.
+func (ix *Indexer) replayDeferredOps(ctx context.Context, author models.Uid, rkey string) {
+	ref := postRef{author: author, rkey: rkey}
+
+	ix.deferredLk.Lock()
+	ops := append([]*deferredOp(nil), ix.deferredOps[ref]...)
+	ix.removeDeferredOpsLocked(ref, func(*deferredOp) bool { return true })
+	ttl := ix.deferredTTL
+	ix.deferredLk.Unlock()
+
+	now := ix.Now()
+	for _, d := range ops {
+		if ttl > 0 && now.Sub(d.heldAt) > ttl {
+			deferredOpsExpired.Inc()
+			continue
+		}
+
+		ix.dispatchDeferredOp(ctx, d)
+	}
+}
+
+func (ix *Indexer) dispatchDeferredOp(ctx context.Context, d *deferredOp) {
+	// the post's author may be handled by the very worker or gate the op
+	// has to go through, so hand it off instead of waiting on it here
+	if a := ix.aggregator; a != nil {
+		go a.pushReplay(ctx, d)
+		return
+	}
+
+	ix.repoGatesLk.Lock()
+	ordered := ix.orderedRepoEvents
+	ix.repoGatesLk.Unlock()
+
+	if ordered {
+		ctx = context.WithoutCancel(ctx)
+		go func() {
+			gate := ix.acquireRepoGate(d.evt.User)
+			defer ix.releaseRepoGate(d.evt.User, gate)
+
+			ix.replayDeferredOp(ctx, d)
+		}()
+		return
+	}
+
+	ix.replayDeferredOp(ctx, d)
+}
+
+func (ix *Indexer) replayDeferredOp(ctx context.Context, d *deferredOp) {
+	octx := withPlaceholderSource(ctx, d.evt.User)
+
+	var err error
+	switch d.op.Kind {
+	case repomgr.EvtKindCreateRecord:
+		_, err = ix.handleRecordCreate(octx, d.evt, &d.op, true)
+	case repomgr.EvtKindUpdateRecord:
+		err = ix.handleRecordUpdate(octx, d.evt, &d.op, true)
+	}
+
+	// a reply may still be waiting on its root, for example
+	if err := ix.holdIfDeferred(err, d.evt, &d.op); err != nil {
+		log.Warnw("failed to replay record held back for missing post", "uid", d.evt.User, "collection", d.op.Collection, "rkey", d.op.Rkey, "err", err)
+		return
+	}
+
+	deferredOpsReplayed.Inc()
+}
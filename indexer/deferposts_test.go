@@ -0,0 +1,209 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestDeferMissingPosts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetDeferMissingPosts(10, time.Minute)
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opUri := "at://did:plc:alice/app.bsky.feed.post/aaaa"
+	like := &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.feed.like",
+		Rkey:       "bbbb",
+		RecCid:     &cc,
+		Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()}},
+	}
+	if err := ix.handleRepoOp(ctx, &repomgr.RepoEvent{User: 2}, like); err != nil {
+		t.Fatal(err)
+	}
+
+	var posts int64
+	if err := ix.db.Model(&models.FeedPost{}).Count(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if posts != 0 {
+		t.Fatalf("expected no placeholder post, got %d posts", posts)
+	}
+	if ix.deferredCount != 1 {
+		t.Fatalf("expected the like to be held back, got %d", ix.deferredCount)
+	}
+
+	// the post showing up aggregates the like
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := ix.GetPost(ctx, opUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.UpCount != 1 {
+		t.Fatalf("expected like to be counted once the post was indexed, got %d", op.UpCount)
+	}
+	if ix.deferredCount != 0 {
+		t.Fatalf("expected nothing left held back, got %d", ix.deferredCount)
+	}
+}
+
+// deferredLikeSetup creates alice and bob and holds back a like of bob's on
+// alice's post aaaa, which isn't indexed yet.
+func deferredLikeSetup(t *testing.T, ix *Indexer) cid.Cid {
+	t.Helper()
+
+	ctx := context.Background()
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	like := &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.feed.like",
+		Rkey:       "bbbb",
+		RecCid:     &cc,
+		Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "at://did:plc:alice/app.bsky.feed.post/aaaa", Cid: cc.String()}},
+	}
+	if err := ix.handleRepoOp(ctx, &repomgr.RepoEvent{User: 2}, like); err != nil {
+		t.Fatal(err)
+	}
+	if ix.deferredCount != 1 {
+		t.Fatalf("expected the like to be held back, got %d", ix.deferredCount)
+	}
+
+	return cc
+}
+
+func upCount(t *testing.T, ix *Indexer) int64 {
+	t.Helper()
+
+	op, err := ix.GetPost(context.Background(), "at://did:plc:alice/app.bsky.feed.post/aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op.UpCount
+}
+
+func TestDeferredOpsDroppedOnDelete(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetDeferMissingPosts(10, time.Minute)
+
+	cc := deferredLikeSetup(t, ix)
+
+	ix.aggregateEvent(ctx, &repomgr.RepoEvent{User: 2, Ops: []repomgr.RepoOp{{
+		Kind:       repomgr.EvtKindDeleteRecord,
+		Collection: "app.bsky.feed.like",
+		Rkey:       "bbbb",
+	}}}, func(*repomgr.RepoOp, error) {})
+	if ix.deferredCount != 0 {
+		t.Fatalf("expected the deleted like to be dropped, got %d held", ix.deferredCount)
+	}
+
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := upCount(t, ix); n != 0 {
+		t.Fatalf("expected the deleted like not to be counted, got %d", n)
+	}
+}
+
+func TestDeferredOpsExpire(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetDeferMissingPosts(10, time.Minute)
+
+	now := time.Now()
+	ix.Now = func() time.Time { return now }
+
+	cc := deferredLikeSetup(t, ix)
+
+	now = now.Add(2 * time.Minute)
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := upCount(t, ix); n != 0 {
+		t.Fatalf("expected the expired like not to be counted, got %d", n)
+	}
+	if ix.deferredCount != 0 {
+		t.Fatalf("expected nothing left held back, got %d", ix.deferredCount)
+	}
+}
+
+func TestDeferredOpsReplayThroughOwnerGate(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetDeferMissingPosts(10, time.Minute)
+	ix.SetOrderedRepoEvents(true)
+
+	cc := deferredLikeSetup(t, ix)
+
+	// an event of bob's is being handled, so the like has to wait for it
+	gate := ix.acquireRepoGate(2)
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := upCount(t, ix); n != 0 {
+		t.Fatalf("expected the like to wait on bob's gate, got %d", n)
+	}
+	ix.releaseRepoGate(2, gate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for upCount(t, ix) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("like was never replayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// SetActorTakenDown marks whether the given user's account is taken down.
+// Taken down actors are left out of actor listings such as GetPostLikers.
+func (ix *Indexer) SetActorTakenDown(ctx context.Context, uid models.Uid, takenDown bool) error {
+	return ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", uid).Update("taken_down", takenDown).Error
+}
+
+// GetPostLikers returns up to limit actors who liked the given post, in the
+// order the likes were indexed. The returned cursor can be passed back in to
+// fetch the next page, and is empty once there are no more likes.
+func (ix *Indexer) GetPostLikers(ctx context.Context, postID uint, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetPostLikers")
+	defer span.End()
+
+	q := ix.reader(ctx).WithContext(ctx).Table("vote_records").
+		Joins("JOIN actor_infos ON actor_infos.uid = vote_records.voter").
+		Where("vote_records.post = ? AND vote_records.dir = ? AND vote_records.deleted_at IS NULL", postID, models.VoteDirUp)
+
+	return ix.listRecordActors(ctx, q, "vote_records", "voter", cursor, limit)
+}
+
+// GetPostReposters returns up to limit actors who reposted the given post, in
+// the order the reposts were indexed, paginated like GetPostLikers.
+func (ix *Indexer) GetPostReposters(ctx context.Context, postID uint, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetPostReposters")
+	defer span.End()
+
+	q := ix.reader(ctx).WithContext(ctx).Table("repost_records").
+		Joins("JOIN actor_infos ON actor_infos.uid = repost_records.reposter").
+		Where("repost_records.post = ?", postID)
+
+	return ix.listRecordActors(ctx, q, "repost_records", "reposter", cursor, limit)
+}
+
+// listRecordActors pages through the records matched by q, whose table is
+// joined against actor_infos on actorCol, and returns their actors.
+func (ix *Indexer) listRecordActors(ctx context.Context, q *gorm.DB, table, actorCol string, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	if cursor != "" {
+		after, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where(table+".id > ?", after)
+	}
+
+	var recs []struct {
+		ID  uint
+		Uid models.Uid
+	}
+	if err := q.Where("NOT actor_infos.taken_down AND actor_infos.deleted_at IS NULL").
+		Select(table + ".id, " + table + "." + actorCol + " AS uid").
+		Order(table + ".id").Limit(limit).Scan(&recs).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(recs) == 0 {
+		return nil, "", nil
+	}
+
+	uids := make([]models.Uid, 0, len(recs))
+	for _, r := range recs {
+		uids = append(uids, r.Uid)
+	}
+
+	var actors []*models.ActorInfo
+	if err := ix.reader(ctx).WithContext(ctx).Find(&actors, "uid IN ?", uids).Error; err != nil {
+		return nil, "", err
+	}
+
+	byUid := make(map[models.Uid]*models.ActorInfo, len(actors))
+	for _, ai := range actors {
+		byUid[ai.Uid] = ai
+	}
+
+	out := make([]*models.ActorInfo, 0, len(recs))
+	for _, r := range recs {
+		if ai, ok := byUid[r.Uid]; ok {
+			out = append(out, ai)
+		}
+	}
+
+	var next string
+	if len(recs) == limit && limit > 0 {
+		next = strconv.FormatUint(uint64(recs[len(recs)-1].ID), 10)
+	}
+
+	return out, next, nil
+}
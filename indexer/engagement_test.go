@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestGetPostLikersAndReposters(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for i := 1; i <= 4; i++ {
+		if err := ix.db.Create(&models.ActorInfo{Uid: models.Uid(i), Did: fmt.Sprintf("did:plc:user%d", i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// likes are indexed in the order 3, 1, 4, 2
+	for _, uid := range []models.Uid{3, 1, 4, 2} {
+		if err := ix.db.Create(&models.VoteRecord{Dir: models.VoteDirUp, Voter: uid, Post: 7, Rkey: "like"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.db.Create(&models.RepostRecord{Reposter: uid, Post: 7, Rkey: "repost"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// likes of other posts are not included
+	if err := ix.db.Create(&models.VoteRecord{Dir: models.VoteDirUp, Voter: 1, Post: 8, Rkey: "other"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.SetActorTakenDown(ctx, 4, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, list := range map[string]func(context.Context, uint, string, int) ([]*models.ActorInfo, string, error){
+		"likers":    ix.GetPostLikers,
+		"reposters": ix.GetPostReposters,
+	} {
+		page, cursor, err := list(ctx, 7, "", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || page[0].Uid != 3 || page[1].Uid != 1 {
+			t.Fatalf("%s: unexpected first page: %v", name, page)
+		}
+		if cursor == "" {
+			t.Fatalf("%s: expected a cursor for the next page", name)
+		}
+
+		page, cursor, err = list(ctx, 7, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 1 || page[0].Uid != 2 {
+			t.Fatalf("%s: expected only actor 2 on the second page, got %v", name, page)
+		}
+		if cursor != "" {
+			t.Fatalf("%s: expected no cursor after the last page, got %q", name, cursor)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package indexer
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+type EventOrder int
+
+const (
+	// AggregateThenEmit aggregates the ops of a repo event before emitting
+	// it on the firehose, so consumers only see events whose records have
+	// been indexed. This is the default.
+	AggregateThenEmit EventOrder = iota
+
+	// EmitThenAggregate emits repo events right away and hands their ops to
+	// background workers for aggregation, so a slow database doesn't hold up
+	// the firehose. Ops that fail to aggregate, or are dropped before they
+	// get to a worker, go to AggregationFailed, and their repo is queued for
+	// a full re-crawl whose import aggregates them again.
+	EmitThenAggregate
+)
+
+const (
+	aggregationWorkers   = 8
+	aggregationQueueSize = 1000
+
+	// bounds queueing the re-crawl of a repo with lost ops, in case the
+	// crawler is shutting down too
+	aggregationRecrawlTimeout = 10 * time.Second
+)
+
+// SetEventOrder configures whether repo events are emitted before or after
+// their ops are aggregated. Events of the same repo are always aggregated
+// in order. Switching back to AggregateThenEmit waits for queued events to
+// be aggregated.
+func (ix *Indexer) SetEventOrder(ctx context.Context, o EventOrder) {
+	if ix.aggregator != nil {
+		ix.aggregator.stop()
+		ix.aggregator = nil
+	}
+
+	if o == EmitThenAggregate {
+		ix.aggregator = newAggregator(ix, aggregationWorkers, aggregationQueueSize)
+		ix.aggregator.run(ctx)
+	}
+}
+
+// logAggregationFailure is the default AggregationFailed.
+func logAggregationFailure(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+	aggregationFailures.WithLabelValues(op.Collection).Inc()
+	log.Errorw("failed to aggregate repo op", "uid", evt.User, "collection", op.Collection, "rkey", op.Rkey, "kind", op.Kind, "err", err)
+}
+
+type repoFetchKey struct{}
+
+// withRepoFetch marks ctx as importing a repo fetched from its PDS. Ops that
+// fail to aggregate under it don't queue another re-crawl, so a record that
+// can never be indexed doesn't have its repo fetched over and over.
+func withRepoFetch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, repoFetchKey{}, true)
+}
+
+// recrawlUnaggregated queues a full re-crawl of the repo of an event whose
+// ops weren't all aggregated. The crawl queue is saved on shutdown, so the
+// re-crawl isn't lost with the process.
+func (ix *Indexer) recrawlUnaggregated(ctx context.Context, evt *repomgr.RepoEvent) {
+	if ix.Crawler == nil {
+		return
+	}
+	if v, _ := ctx.Value(repoFetchKey{}).(bool); v {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, aggregationRecrawlTimeout)
+	defer cancel()
+
+	ai, err := ix.LookupUser(ctx, evt.User)
+	if err != nil {
+		log.Errorw("failed to look up user to re-crawl after failed aggregation", "uid", evt.User, "err", err)
+		return
+	}
+	if ai.PDS == 0 {
+		log.Errorw("cannot re-crawl user with no pds after failed aggregation", "uid", evt.User)
+		return
+	}
+
+	if err := ix.Crawler.CrawlFull(ctx, ai); err != nil {
+		log.Errorw("failed to queue re-crawl after failed aggregation", "uid", evt.User, "err", err)
+		return
+	}
+	aggregationRecrawls.Inc()
+}
+
+// dropAggregation reports every op of an event that won't be aggregated as
+// failed, the same as if aggregating them had.
+func (ix *Indexer) dropAggregation(ctx context.Context, evt *repomgr.RepoEvent, err error) {
+	for i := range evt.Ops {
+		ix.aggregationFailed(ctx, evt, &evt.Ops[i], err)
+	}
+	ix.recrawlUnaggregated(ctx, evt)
+	ix.noteEventAggregated()
+}
+
+type aggregationJob struct {
+	ctx   context.Context
+	evt   *repomgr.RepoEvent
+	start time.Time
+
+	// set for held back ops replayed once their post is indexed, which
+	// weren't counted as received events
+	replay *deferredOp
+}
+
+type aggregator struct {
+	ix     *Indexer
+	queues []chan *aggregationJob
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newAggregator(ix *Indexer, workers, depth int) *aggregator {
+	a := &aggregator{
+		ix:     ix,
+		queues: make([]chan *aggregationJob, workers),
+		quit:   make(chan struct{}),
+	}
+	for i := range a.queues {
+		a.queues[i] = make(chan *aggregationJob, depth)
+	}
+	return a
+}
+
+func (a *aggregator) run(ctx context.Context) {
+	for _, q := range a.queues {
+		a.wg.Add(1)
+		go a.work(ctx, q)
+	}
+}
+
+func (a *aggregator) queueFor(uid models.Uid) chan *aggregationJob {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatUint(uint64(uid), 10)))
+
+	return a.queues[h.Sum32()%uint32(len(a.queues))]
+}
+
+// pushReplay queues a held back op on the worker of the repo it belongs to,
+// so it is aggregated in order with the rest of that repo's events.
+func (a *aggregator) pushReplay(ctx context.Context, d *deferredOp) {
+	job := &aggregationJob{ctx: context.WithoutCancel(ctx), evt: d.evt, replay: d}
+
+	select {
+	case a.queueFor(d.evt.User) <- job:
+		aggregationQueueDepth.Inc()
+	case <-a.quit:
+		a.aggregate(job)
+	}
+}
+
+// push queues the event on the worker of its repo, blocking while that
+// worker is backed up.
+func (a *aggregator) push(ctx context.Context, evt *repomgr.RepoEvent, start time.Time) {
+	// the event outlives the handling of it, but its markers (crawl, initial
+	// scrape) still apply
+	job := &aggregationJob{ctx: context.WithoutCancel(ctx), evt: evt, start: start}
+
+	select {
+	case a.queueFor(evt.User) <- job:
+		aggregationQueueDepth.Inc()
+	case <-a.quit:
+		// the aggregator is going away, so do it ourselves
+		a.aggregate(job)
+	case <-ctx.Done():
+		a.ix.dropAggregation(job.ctx, evt, ctx.Err())
+	}
+}
+
+func (a *aggregator) work(ctx context.Context, q chan *aggregationJob) {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case job := <-q:
+			aggregationQueueDepth.Dec()
+			a.aggregate(job)
+		case <-a.quit:
+			// finish whatever was already queued before exiting
+			for {
+				select {
+				case job := <-q:
+					aggregationQueueDepth.Dec()
+					a.aggregate(job)
+				default:
+					return
+				}
+			}
+		case <-ctx.Done():
+			// the queued events won't be aggregated
+			for {
+				select {
+				case job := <-q:
+					aggregationQueueDepth.Dec()
+					if job.replay == nil {
+						a.ix.dropAggregation(job.ctx, job.evt, ctx.Err())
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *aggregator) aggregate(job *aggregationJob) {
+	if job.replay != nil {
+		a.ix.replayDeferredOp(job.ctx, job.replay)
+		return
+	}
+
+	failed := false
+	a.ix.aggregateEvent(job.ctx, job.evt, func(op *repomgr.RepoOp, err error) {
+		failed = true
+		a.ix.aggregationFailed(job.ctx, job.evt, op, err)
+	})
+	if failed {
+		a.ix.recrawlUnaggregated(job.ctx, job.evt)
+	}
+	a.ix.noteEventAggregated()
+	observeIndexLatency(job.ctx, job.evt, job.start)
+}
+
+func (a *aggregator) stop() {
+	close(a.quit)
+	a.wg.Wait()
+}
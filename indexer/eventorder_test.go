@@ -0,0 +1,252 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestEmitThenAggregate(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed []string
+	ix.AggregationFailed = func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+		failed = append(failed, op.Rkey)
+	}
+
+	// workers are started after the event is handled, so nothing touches
+	// the database concurrently with the test
+	ix.aggregator = newAggregator(ix, 1, 10)
+
+	evt := &repomgr.RepoEvent{User: 1, NewRoot: cc, Rev: "rev1", Ops: []repomgr.RepoOp{
+		{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.graph.follow",
+			Rkey:       "ffff",
+			RecCid:     &cc,
+			Record:     &bsky.GraphFollow{Subject: "did:plc:bob"},
+		},
+		{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.feed.like",
+			Rkey:       "llll",
+			RecCid:     &cc,
+			Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "not a uri", Cid: cc.String()}},
+		},
+	}}
+	if err := ix.HandleRepoEvent(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+
+	since := int64(0)
+	evts, cancel, err := ix.events.Subscribe(ctx, "test", nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	select {
+	case <-evts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event to be emitted before aggregation")
+	}
+
+	bob, err := ix.LookupUser(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Followers != 0 {
+		t.Fatal("expected the follow not to be aggregated yet")
+	}
+
+	ix.aggregator.run(ctx)
+	// switching back waits for the queued event to be aggregated
+	ix.SetEventOrder(ctx, AggregateThenEmit)
+
+	bob, err = ix.LookupUser(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Followers != 1 {
+		t.Fatalf("expected the follow to be aggregated, got %d followers", bob.Followers)
+	}
+
+	if len(failed) != 1 || failed[0] != "llll" {
+		t.Fatalf("expected the bad like to go to AggregationFailed, got %v", failed)
+	}
+}
+
+func TestAggregateThenEmitReportsFailures(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the op below carries a made up cid
+	ix.SetRecordCidVerification(false)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed []string
+	ix.AggregationFailed = func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+		failed = append(failed, op.Rkey)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1, NewRoot: cc, Rev: "rev1", Ops: []repomgr.RepoOp{{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.feed.like",
+		Rkey:       "llll",
+		RecCid:     &cc,
+		Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "not a uri", Cid: cc.String()}},
+	}}}
+	if err := ix.HandleRepoEvent(ctx, evt); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0] != "llll" {
+		t.Fatalf("expected the bad like to go to AggregationFailed, got %v", failed)
+	}
+
+	status, err := ix.GetIndexingStatus(ctx, "did:plc:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.FailedOps != 1 {
+		t.Fatalf("expected the failure to show in the indexing status, got %d", status.FailedOps)
+	}
+}
+
+func TestAggregatorShutdownSettlesLag(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	a := newAggregator(ix, 1, 4)
+	q := a.queues[0]
+
+	for i := 0; i < 2; i++ {
+		ix.noteEventReceived()
+		q <- &aggregationJob{ctx: context.Background(), evt: &repomgr.RepoEvent{User: 1}}
+	}
+	// replays were never counted as received
+	replay := &deferredOp{evt: &repomgr.RepoEvent{User: 1}, op: repomgr.RepoOp{Kind: repomgr.EvtKindDeleteRecord}}
+	q <- &aggregationJob{ctx: context.Background(), evt: replay.evt, replay: replay}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a.wg.Add(1)
+	a.work(ctx, q)
+
+	if len(q) != 0 {
+		t.Fatalf("expected the queue to be drained, %d jobs left", len(q))
+	}
+	if lag := ix.AggregationLag(); lag != 0 {
+		t.Fatalf("expected no lag once the aggregator stopped, got %d", lag)
+	}
+}
+
+func TestEmitThenAggregateRecrawlsLostOps(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the op below carries a made up cid
+	ix.SetRecordCidVerification(false)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice", PDS: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dispatcher isn't run, requests are read off its ingest directly
+	c, err := NewCrawlDispatcher(func(context.Context, *crawlWork) error { return nil }, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.Crawler = c
+	recrawled := func() bool {
+		select {
+		case req := <-c.ingest:
+			return req.act.Uid == 1 && req.forceFull
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	var failed []string
+	ix.AggregationFailed = func(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+		failed = append(failed, op.Rkey)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1, NewRoot: cc, Ops: []repomgr.RepoOp{{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.feed.like",
+		Rkey:       "llll",
+		RecCid:     &cc,
+		Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "not a uri", Cid: cc.String()}},
+	}}}
+
+	a := newAggregator(ix, 1, 0)
+
+	go a.aggregate(&aggregationJob{ctx: ctx, evt: evt})
+	if !recrawled() {
+		t.Fatal("expected a failed op to queue a re-crawl of its repo")
+	}
+
+	// the re-crawl's own import doesn't queue another
+	a.aggregate(&aggregationJob{ctx: withRepoFetch(ctx), evt: evt})
+	if recrawled() {
+		t.Fatal("expected no re-crawl for ops failing during a repo import")
+	}
+
+	// nothing is reading the queue, so the push is dropped once cancelled
+	failed = nil
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	go a.push(cctx, evt, time.Now())
+	if !recrawled() {
+		t.Fatal("expected a dropped event to queue a re-crawl of its repo")
+	}
+	if len(failed) != 1 || failed[0] != "llll" {
+		t.Fatalf("expected the dropped op to go to AggregationFailed, got %v", failed)
+	}
+}
@@ -0,0 +1,183 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/parquet-go/parquet-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// exportPageSize is how many rows ExportParquet loads, and writes out as a
+// row group, at a time.
+const exportPageSize = 10000
+
+// The tables ExportParquet can export.
+const (
+	ExportPosts   = "posts"
+	ExportFollows = "follows"
+	ExportLikes   = "likes"
+)
+
+type exportRow interface {
+	rowID() uint64
+}
+
+type postExportRow struct {
+	ID          uint64    `parquet:"id"`
+	CreatedAt   time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Author      uint64    `parquet:"author"`
+	Rkey        string    `parquet:"rkey"`
+	Cid         string    `parquet:"cid"`
+	ReplyTo     uint64    `parquet:"reply_to"`
+	QuoteOf     uint64    `parquet:"quote_of"`
+	UpCount     int64     `parquet:"up_count"`
+	ReplyCount  int64     `parquet:"reply_count"`
+	RepostCount int64     `parquet:"repost_count"`
+	QuoteCount  int64     `parquet:"quote_count"`
+	Deleted     bool      `parquet:"deleted"`
+}
+
+type followExportRow struct {
+	ID        uint64    `parquet:"id"`
+	CreatedAt time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Follower  uint64    `parquet:"follower"`
+	Target    uint64    `parquet:"target"`
+	Rkey      string    `parquet:"rkey"`
+}
+
+type likeExportRow struct {
+	ID        uint64    `parquet:"id"`
+	CreatedAt time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Voter     uint64    `parquet:"voter"`
+	Post      uint64    `parquet:"post"`
+	Rkey      string    `parquet:"rkey"`
+}
+
+func (r postExportRow) rowID() uint64   { return r.ID }
+func (r followExportRow) rowID() uint64 { return r.ID }
+func (r likeExportRow) rowID() uint64   { return r.ID }
+
+// ExportParquet writes the rows of the given table (ExportPosts,
+// ExportFollows or ExportLikes) created at or after since to w as a Parquet
+// file, for offline analysis. Rows are read and written a page at a time in
+// id order, so tables of any size can be exported. Exporting starts after
+// cursor (empty for the start of the table) and stops after limit rows (zero
+// for no limit). The returned cursor resumes the export where it stopped,
+// and is empty once the table has been exported in full.
+func (ix *Indexer) ExportParquet(ctx context.Context, table string, since time.Time, cursor string, limit int, w io.Writer) (string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "ExportParquet")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("table", table))
+
+	var after uint64
+	if cursor != "" {
+		c, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		after = c
+	}
+
+	q := ix.reader(ctx).WithContext(ctx)
+	if !since.IsZero() {
+		q = q.Where("created_at >= ?", since)
+	}
+
+	switch table {
+	case ExportPosts:
+		// placeholders for posts we haven't seen carry nothing worth analyzing
+		return exportTable(q.Where("NOT missing"), after, limit, w, func(fp *models.FeedPost) postExportRow {
+			return postExportRow{
+				ID:          uint64(fp.ID),
+				CreatedAt:   fp.CreatedAt,
+				Author:      uint64(fp.Author),
+				Rkey:        fp.Rkey,
+				Cid:         fp.Cid,
+				ReplyTo:     uint64(fp.ReplyTo),
+				QuoteOf:     uint64(fp.QuoteOf),
+				UpCount:     fp.UpCount,
+				ReplyCount:  fp.ReplyCount,
+				RepostCount: fp.RepostCount,
+				QuoteCount:  fp.QuoteCount,
+				Deleted:     fp.Deleted,
+			}
+		})
+	case ExportFollows:
+		return exportTable(q, after, limit, w, func(fr *models.FollowRecord) followExportRow {
+			return followExportRow{
+				ID:        uint64(fr.ID),
+				CreatedAt: fr.CreatedAt,
+				Follower:  uint64(fr.Follower),
+				Target:    uint64(fr.Target),
+				Rkey:      fr.Rkey,
+			}
+		})
+	case ExportLikes:
+		return exportTable(q, after, limit, w, func(vr *models.VoteRecord) likeExportRow {
+			return likeExportRow{
+				ID:        uint64(vr.ID),
+				CreatedAt: vr.CreatedAt,
+				Voter:     uint64(vr.Voter),
+				Post:      uint64(vr.Post),
+				Rkey:      vr.Rkey,
+			}
+		})
+	default:
+		return "", fmt.Errorf("unknown export table: %q", table)
+	}
+}
+
+// exportTable pages through the rows of model M matching q with ids after
+// the given one, writing each page to w as a row group of R.
+func exportTable[M any, R exportRow](q *gorm.DB, after uint64, limit int, w io.Writer, convert func(*M) R) (string, error) {
+	pw := parquet.NewGenericWriter[R](w)
+
+	var written int
+	for {
+		n := exportPageSize
+		if limit > 0 && limit-written < n {
+			n = limit - written
+		}
+
+		var page []*M
+		if err := q.Session(&gorm.Session{}).Where("id > ?", after).Order("id asc").Limit(n).Find(&page).Error; err != nil {
+			return "", err
+		}
+
+		rows := make([]R, 0, len(page))
+		for _, m := range page {
+			rows = append(rows, convert(m))
+		}
+		if _, err := pw.Write(rows); err != nil {
+			return "", fmt.Errorf("writing rows: %w", err)
+		}
+		if err := pw.Flush(); err != nil {
+			return "", fmt.Errorf("writing row group: %w", err)
+		}
+
+		written += len(page)
+		if len(rows) > 0 {
+			after = rows[len(rows)-1].rowID()
+		}
+
+		if len(page) < n {
+			// nothing more to export
+			return "", pw.Close()
+		}
+		if limit > 0 && written >= limit {
+			if err := pw.Close(); err != nil {
+				return "", err
+			}
+			return strconv.FormatUint(after, 10), nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExportParquet(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 5; i++ {
+		fp := models.FeedPost{Author: 1, Rkey: fmt.Sprintf("post%d", i), UpCount: int64(i)}
+		if i == 0 {
+			fp.CreatedAt = old
+		}
+		if err := ix.db.Create(&fp).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.db.Create(&models.FeedPost{Author: 2, Rkey: "placeholder", Missing: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	export := func(since time.Time, cursor string, limit int) ([]postExportRow, string) {
+		buf := new(bytes.Buffer)
+		next, err := ix.ExportParquet(ctx, ExportPosts, since, cursor, limit, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := parquet.Read[postExportRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows, next
+	}
+
+	rows, next := export(time.Time{}, "", 0)
+	if len(rows) != 5 || next != "" {
+		t.Fatalf("expected all 5 posts and no cursor, got %d rows and %q", len(rows), next)
+	}
+	if rows[3].Rkey != "post3" || rows[3].UpCount != 3 || rows[3].Author != 1 {
+		t.Fatalf("unexpected row: %+v", rows[3])
+	}
+
+	var rkeys []string
+	var cursor string
+	for {
+		rows, next := export(time.Now().Add(-time.Hour), cursor, 2)
+		for _, r := range rows {
+			rkeys = append(rkeys, r.Rkey)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if fmt.Sprint(rkeys) != "[post1 post2 post3 post4]" {
+		t.Fatalf("unexpected rows from resumed export: %v", rkeys)
+	}
+
+	for _, fr := range []models.FollowRecord{{Follower: 1, Target: 2, Rkey: "a"}, {Follower: 2, Target: 1, Rkey: "b"}} {
+		if err := ix.db.Create(&fr).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := ix.ExportParquet(ctx, ExportFollows, time.Time{}, "", 0, buf); err != nil {
+		t.Fatal(err)
+	}
+	follows, err := parquet.Read[followExportRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(follows) != 2 || follows[1].Follower != 2 || follows[1].Target != 1 {
+		t.Fatalf("unexpected follows: %+v", follows)
+	}
+
+	if _, err := ix.ExportParquet(ctx, "blocks", time.Time{}, "", 0, new(bytes.Buffer)); err == nil {
+		t.Fatal("expected an error for an unknown table")
+	}
+}
@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"strings"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+)
+
+// postMentionDids returns the DIDs mentioned by a post, from both rich text
+// facets and the legacy entities field, without duplicates. Facet byte ranges
+// are not used to slice the post text, so malformed ranges are harmless.
+func postMentionDids(rec *bsky.FeedPost) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(did string) {
+		if did == "" || seen[did] {
+			return
+		}
+		seen[did] = true
+		out = append(out, did)
+	}
+
+	for _, f := range rec.Facets {
+		if f == nil {
+			continue
+		}
+		for _, feat := range f.Features {
+			if feat != nil && feat.RichtextFacet_Mention != nil {
+				add(feat.RichtextFacet_Mention.Did)
+			}
+		}
+	}
+
+	// legacy records
+	for _, e := range rec.Entities {
+		if e != nil && e.Type == "mention" {
+			add(e.Value)
+		}
+	}
+
+	return out
+}
+
+// postLinkUris returns the URIs linked from a post's rich text facets
+func postLinkUris(rec *bsky.FeedPost) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, f := range rec.Facets {
+		if f == nil {
+			continue
+		}
+		for _, feat := range f.Features {
+			if feat == nil || feat.RichtextFacet_Link == nil {
+				continue
+			}
+			uri := feat.RichtextFacet_Link.Uri
+			if uri == "" || seen[uri] {
+				continue
+			}
+			seen[uri] = true
+			out = append(out, uri)
+		}
+	}
+	return out
+}
+
+// maxTagLength is the longest tag, in bytes, the lexicon allows
+const maxTagLength = 640
+
+// postTags returns the hashtags of a post, from both its tag facets and its
+// tags field, lowercased and without duplicates.
+func postTags(rec *bsky.FeedPost) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(tag string) {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || len(tag) > maxTagLength || seen[tag] {
+			return
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+
+	for _, f := range rec.Facets {
+		if f == nil {
+			continue
+		}
+		for _, feat := range f.Features {
+			if feat != nil && feat.RichtextFacet_Tag != nil {
+				add(feat.RichtextFacet_Tag.Tag)
+			}
+		}
+	}
+
+	for _, t := range rec.Tags {
+		add(t)
+	}
+
+	return out
+}
+
+func isAtUri(uri string) bool {
+	return strings.HasPrefix(uri, "at://")
+}
@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+)
+
+func TestPostFacetRefs(t *testing.T) {
+	rec := &bsky.FeedPost{
+		Text: "hey @alice check https://example.com",
+		Facets: []*bsky.RichtextFacet{
+			{
+				// bogus byte range shouldn't matter
+				Index: &bsky.RichtextFacet_ByteSlice{ByteStart: 500, ByteEnd: 2},
+				Features: []*bsky.RichtextFacet_Features_Elem{
+					{RichtextFacet_Mention: &bsky.RichtextFacet_Mention{Did: "did:plc:alice"}},
+				},
+			},
+			{
+				Features: []*bsky.RichtextFacet_Features_Elem{
+					{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: "https://example.com"}},
+					{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: "at://did:plc:bob/app.bsky.feed.post/abc"}},
+					nil,
+				},
+			},
+			nil,
+		},
+		Entities: []*bsky.FeedPost_Entity{
+			{Type: "mention", Value: "did:plc:alice"},
+			{Type: "mention", Value: "did:plc:carol"},
+			{Type: "link", Value: "https://example.com"},
+		},
+	}
+
+	mentions := postMentionDids(rec)
+	if !reflect.DeepEqual(mentions, []string{"did:plc:alice", "did:plc:carol"}) {
+		t.Fatalf("unexpected mentions: %v", mentions)
+	}
+
+	links := postLinkUris(rec)
+	if !reflect.DeepEqual(links, []string{"https://example.com", "at://did:plc:bob/app.bsky.feed.post/abc"}) {
+		t.Fatalf("unexpected links: %v", links)
+	}
+}
+
+func TestPostTags(t *testing.T) {
+	rec := &bsky.FeedPost{
+		Text: "#Go and #golang",
+		Facets: []*bsky.RichtextFacet{
+			{
+				Features: []*bsky.RichtextFacet_Features_Elem{
+					{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: "Go"}},
+					{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: "#golang"}},
+					{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: " "}},
+					nil,
+				},
+			},
+		},
+		Tags: []string{"GOLANG", "indigo"},
+	}
+
+	tags := postTags(rec)
+	if !reflect.DeepEqual(tags, []string{"go", "golang", "indigo"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// SetCrawlFanoutLimit caps how many previously unknown users a single crawl
+// job may create while indexing the fetched repo. References past the cap are
+// handed to a background batcher instead of being resolved on the crawl
+// worker. Zero means no limit.
+func (ix *Indexer) SetCrawlFanoutLimit(ctx context.Context, limit int) {
+	if ix.fanoutBatcher != nil {
+		ix.fanoutBatcher.stop()
+		ix.fanoutBatcher = nil
+	}
+
+	ix.crawlFanoutLimit = limit
+
+	if limit > 0 {
+		ix.fanoutBatcher = newRefCrawlBatcher(ix, time.Second, defaultRefCrawlMaxPending)
+		go ix.fanoutBatcher.run(ctx)
+	}
+}
+
+type fanoutBudgetKey struct{}
+
+type fanoutBudget struct {
+	remaining atomic.Int64
+}
+
+func withFanoutBudget(ctx context.Context, n int) context.Context {
+	b := &fanoutBudget{}
+	b.remaining.Store(int64(n))
+	return context.WithValue(ctx, fanoutBudgetKey{}, b)
+}
+
+func fanoutBudgetFrom(ctx context.Context) *fanoutBudget {
+	b, _ := ctx.Value(fanoutBudgetKey{}).(*fanoutBudget)
+	return b
+}
+
+func (b *fanoutBudget) take() bool {
+	return b.remaining.Add(-1) >= 0
+}
+
+// crawlDidRefBudgeted is crawlDidRef for references seen during a crawl job,
+// where creating a new user counts against the job's fan-out budget.
+func (ix *Indexer) crawlDidRefBudgeted(ctx context.Context, b *fanoutBudget, did string) error {
+	_, err := ix.LookupUserByDid(ctx, did)
+	if err == nil {
+		ix.notePendingCrawlRef(did)
+		return nil
+	}
+
+	if !isNotFound(err) {
+		return err
+	}
+
+	if !b.take() {
+		crawlFanoutDeferred.Inc()
+		ix.fanoutBatcher.add(did)
+		return nil
+	}
+
+	_, err = ix.createMissingUserRecord(ctx, did)
+	return err
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestCrawlFanoutLimitDefers(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	ix.crawlFanoutLimit = 2
+	ix.fanoutBatcher = newRefCrawlBatcher(ix, time.Hour, 10)
+
+	created := 0
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		created++
+		ai := &models.ActorInfo{Uid: models.Uid(created), Did: did}
+		return ai, ix.db.Create(ai).Error
+	}
+
+	ctx := withFanoutBudget(context.Background(), ix.crawlFanoutLimit)
+	for i := 0; i < 4; i++ {
+		if err := ix.crawlDidRef(ctx, fmt.Sprintf("did:plc:user%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// already known users don't count against the budget
+	if err := ix.crawlDidRef(ctx, "did:plc:user0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if created != 2 {
+		t.Fatalf("expected 2 users to be created inline, got %d", created)
+	}
+
+	deferred := ix.fanoutBatcher.take()
+	if len(deferred) != 2 {
+		t.Fatalf("expected 2 deferred references, got %d", len(deferred))
+	}
+	for _, did := range []string{"did:plc:user2", "did:plc:user3"} {
+		if _, ok := deferred[did]; !ok {
+			t.Fatalf("expected %s to be deferred", did)
+		}
+	}
+}
+
+func TestCrawlFanoutLimitDefersFollows(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	ix.SetRecordCidVerification(false)
+	ix.crawlFanoutLimit = 1
+	ix.fanoutBatcher = newRefCrawlBatcher(ix, time.Hour, 10)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	created := 0
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		created++
+		ai := &models.ActorInfo{Uid: models.Uid(created + 1), Did: did}
+		return ai, ix.db.Create(ai).Error
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := withFanoutBudget(context.Background(), ix.crawlFanoutLimit)
+	for i, subject := range []string{"did:plc:bob", "did:plc:carol"} {
+		op := &repomgr.RepoOp{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.graph.follow",
+			Rkey:       fmt.Sprintf("f%d", i),
+			RecCid:     &cc,
+			Record:     &bsky.GraphFollow{Subject: subject},
+		}
+		if err := ix.handleRecordCreateGraphFollow(ctx, op.Record.(*bsky.GraphFollow), &repomgr.RepoEvent{User: 1}, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if created != 1 {
+		t.Fatalf("expected 1 user to be created inline, got %d", created)
+	}
+
+	follows := func() int64 {
+		var n int64
+		if err := ix.db.Model(&models.FollowRecord{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := follows(); n != 1 {
+		t.Fatalf("expected the follow past the limit to wait on its subject, got %d follows", n)
+	}
+
+	ix.fanoutBatcher.flush(context.Background())
+
+	if created != 2 {
+		t.Fatalf("expected the batcher to create the deferred subject, got %d users", created)
+	}
+	if n := follows(); n != 2 {
+		t.Fatalf("expected the deferred follow to be indexed after its subject was created, got %d follows", n)
+	}
+}
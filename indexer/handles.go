@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+const handleRebuildBatchSize = 500
+
+type handleRebuildResult int
+
+const (
+	handleUnchanged handleRebuildResult = iota
+	handleCorrected
+	handleConflict
+)
+
+// HandleRebuildStats reports how far along a RebuildHandleIndex run is.
+type HandleRebuildStats struct {
+	Scanned   int       `json:"scanned"`
+	Corrected int       `json:"corrected"`
+	Conflicts int       `json:"conflicts"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RebuildHandleIndex re-normalizes the stored handle of every actor, so that
+// lookups by handle find actors stored under a non-normalized form. Actors are
+// walked in batches by id and each fix is its own small update, so ingestion
+// carries on while it runs. A handle whose normalized form is already held by
+// another actor is left alone and counted as a conflict. Only one rebuild can
+// run at a time; it blocks until every actor has been scanned.
+func (ix *Indexer) RebuildHandleIndex(ctx context.Context) (*HandleRebuildStats, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "RebuildHandleIndex")
+	defer span.End()
+
+	now := ix.Now()
+	stats := &HandleRebuildStats{StartedAt: now, UpdatedAt: now}
+
+	ix.handleRebuildLk.Lock()
+	if ix.handleRebuild != nil {
+		ix.handleRebuildLk.Unlock()
+		return nil, fmt.Errorf("handle index rebuild already in progress")
+	}
+	ix.handleRebuild = stats
+	ix.handleRebuildLk.Unlock()
+
+	defer func() {
+		ix.handleRebuildLk.Lock()
+		ix.handleRebuild = nil
+		ix.handleRebuildLk.Unlock()
+	}()
+
+	db := ix.db.WithContext(ctx)
+
+	var last uint
+	for {
+		var batch []models.ActorInfo
+		if err := db.Select("id", "uid", "handle").Where("id > ? AND handle IS NOT NULL", last).Order("id").Limit(handleRebuildBatchSize).Find(&batch).Error; err != nil {
+			return ix.GetHandleRebuildProgress(), err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		last = batch[len(batch)-1].ID
+
+		for _, ai := range batch {
+			res, err := ix.rebuildActorHandle(ctx, &ai)
+			if err != nil {
+				return ix.GetHandleRebuildProgress(), err
+			}
+			ix.noteHandleRebuild(stats, res)
+		}
+	}
+
+	p := ix.GetHandleRebuildProgress()
+	log.Infow("rebuilt handle index", "scanned", p.Scanned, "corrected", p.Corrected, "conflicts", p.Conflicts, "took", ix.Now().Sub(p.StartedAt))
+
+	return p, nil
+}
+
+// rebuildActorHandle normalizes the actor's stored handle, unless another
+// actor already holds the normalized form.
+func (ix *Indexer) rebuildActorHandle(ctx context.Context, ai *models.ActorInfo) (handleRebuildResult, error) {
+	db := ix.db.WithContext(ctx)
+
+	norm := syntax.Handle(ai.Handle.String).Normalize().String()
+	if norm == ai.Handle.String {
+		return handleUnchanged, nil
+	}
+
+	taken := func() (bool, error) {
+		var n int64
+		if err := db.Model(&models.ActorInfo{}).Where("handle = ? AND id != ?", norm, ai.ID).Count(&n).Error; err != nil {
+			return false, err
+		}
+		return n > 0, nil
+	}
+
+	conflict, err := taken()
+	if err != nil {
+		return 0, err
+	}
+
+	if !conflict {
+		// only touch the row if the handle hasn't changed under us
+		res := db.Model(&models.ActorInfo{}).Where("id = ? AND handle = ?", ai.ID, ai.Handle.String).Update("handle", norm)
+		if res.Error == nil {
+			if res.RowsAffected == 0 {
+				return handleUnchanged, nil
+			}
+			return handleCorrected, nil
+		}
+
+		// another actor may have taken the handle since we checked, which
+		// the unique index turns away
+		if conflict, err = taken(); err != nil || !conflict {
+			return 0, res.Error
+		}
+	}
+
+	log.Warnw("normalized handle already taken by another actor", "uid", ai.Uid, "handle", ai.Handle.String, "normalized", norm)
+	return handleConflict, nil
+}
+
+func (ix *Indexer) noteHandleRebuild(stats *HandleRebuildStats, res handleRebuildResult) {
+	ix.handleRebuildLk.Lock()
+	defer ix.handleRebuildLk.Unlock()
+
+	stats.Scanned++
+	switch res {
+	case handleCorrected:
+		stats.Corrected++
+	case handleConflict:
+		stats.Conflicts++
+	}
+	stats.UpdatedAt = ix.Now()
+}
+
+// GetHandleRebuildProgress returns the progress of the running
+// RebuildHandleIndex, or nil if there is none.
+func (ix *Indexer) GetHandleRebuildProgress() *HandleRebuildStats {
+	ix.handleRebuildLk.Lock()
+	defer ix.handleRebuildLk.Unlock()
+
+	if ix.handleRebuild == nil {
+		return nil
+	}
+
+	cp := *ix.handleRebuild
+	return &cp
+}
@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/gorm"
+)
+
+func TestRebuildHandleIndex(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice", Handle: sql.NullString{String: "Alice.Example.com", Valid: true}},
+		{Uid: 2, Did: "did:plc:bob", Handle: sql.NullString{String: "bob.example.com", Valid: true}},
+		{Uid: 3, Did: "did:plc:bob2", Handle: sql.NullString{String: "BOB.example.com", Valid: true}},
+		{Uid: 4, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := ix.RebuildHandleIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Scanned != 3 || stats.Corrected != 1 || stats.Conflicts != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	ai, err := ix.LookupUserByHandle(ctx, "alice.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.Uid != 1 {
+		t.Fatalf("expected uid 1, got %d", ai.Uid)
+	}
+
+	// the conflicting handle is left as it was
+	if _, err := ix.LookupUserByHandle(ctx, "BOB.example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRebuildHandleIndexRacedConflict(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice", Handle: sql.NullString{String: "Alice.Example.com", Valid: true}},
+		{Uid: 2, Did: "did:plc:bob", Handle: sql.NullString{String: "Bob.Example.com", Valid: true}},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// someone else takes the normalized handle between the check and the
+	// update of the first actor
+	raced := false
+	if err := ix.db.Callback().Update().Before("gorm:update").Register("test:handle_race", func(db *gorm.DB) {
+		if raced {
+			return
+		}
+		raced = true
+		if err := ix.db.Create(&models.ActorInfo{Uid: 3, Did: "did:plc:alice2", Handle: sql.NullString{String: "alice.example.com", Valid: true}}).Error; err != nil {
+			t.Error(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := ix.RebuildHandleIndex(ctx)
+	if err != nil {
+		t.Fatalf("expected the conflict to be skipped, got %v", err)
+	}
+	if stats.Corrected != 1 || stats.Conflicts != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if ix.GetHandleRebuildProgress() != nil {
+		t.Fatal("expected progress to be cleared once the rebuild finished")
+	}
+
+	if _, err := ix.LookupUserByHandle(ctx, "bob.example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/did"
 	"github.com/bluesky-social/indigo/events"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
@@ -19,8 +22,10 @@ import (
 	"github.com/bluesky-social/indigo/repomgr"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/bluesky-social/indigo/xrpc"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/ipfs/go-cid"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
@@ -36,7 +41,8 @@ const MaxEventSliceLength = 1000000
 const MaxOpsSliceLength = 200
 
 type Indexer struct {
-	db *gorm.DB
+	db          *gorm.DB
+	readReplica *gorm.DB
 
 	notifman notifs.NotificationManager
 	events   *events.EventManager
@@ -47,22 +53,132 @@ type Indexer struct {
 
 	Crawler *CrawlDispatcher
 
-	Limiters map[uint]*rate.Limiter
+	Limiters map[uint]CrawlLimiter
 	LimitMux sync.RWMutex
 
-	doAggregations bool
+	// When set, crawl rate limits are enforced across all indexers sharing it
+	sharedLimits SharedLimitStore
+
+	doAggregations   bool
+	validateRecords  bool
+	verifyRecordCids bool
+	tooBigSyncEvents bool
+	strictRefUris    bool
+
+	bulkDeleteThreshold int
+
+	aggTimeoutsLk sync.Mutex
+	aggTimeout    time.Duration
+	aggTimeouts   map[string]time.Duration
+
+	eventsReceived   atomic.Int64
+	eventsAggregated atomic.Int64
+	lagMonitor       lagMonitor
+
+	resolverHealth resolverHealth
+
+	failedOpsLk sync.Mutex
+	failedOps   *lru.Cache[models.Uid, *failedOps]
+
+	catchupLookahead       int
+	catchupMaxAge          time.Duration
+	crawlSnapshotMaxBuffer int64
+
+	refCrawlMode ReferenceCrawlMode
+	refBatcher   *refCrawlBatcher
+
+	unknownOpPolicy  UnknownOpPolicy
+	aggregator       *aggregator
+	selfFollowPolicy SelfFollowPolicy
+
+	recordLogSampleRate int
+
+	notifQueue       *notifQueue
+	initScrapeNotifs InitialScrapeNotifications
+
+	actorSearcher ActorSearcher
+
+	crawlFanoutLimit int
+	fanoutBatcher    *refCrawlBatcher
+
+	collectionHandlersLk sync.RWMutex
+	collectionHandlers   map[string]CollectionHandler
+
+	placeholderLk       sync.Mutex
+	placeholderRate     rate.Limit
+	placeholderLimiters *lru.Cache[models.Uid, *rate.Limiter]
+	placeholderMax      int64
+	placeholderCount    int64
+
+	deferredLk    sync.Mutex
+	deferredOps   map[postRef][]*deferredOp
+	deferredBy    map[heldRecord][]postRef
+	deferredCount int
+	deferredMax   int
+	deferredTTL   time.Duration
+	deferredSwept time.Time
+
+	pdsInfoLk         sync.Mutex
+	pdsInfoMaxAge     time.Duration
+	pdsInfoRefreshing map[uint]bool
+
+	blockCacheLk  sync.Mutex
+	blockCache    *lru.Cache[blockCacheKey, *cachedBlocks]
+	blockCacheTTL time.Duration
+	blockCacheGen uint64
+
+	recrawlsLk sync.Mutex
+	recrawls   map[uint]*RecrawlProgress
+
+	handleRebuildLk sync.Mutex
+	handleRebuild   *HandleRebuildStats
+
+	repoGatesLk       sync.Mutex
+	repoGates         map[models.Uid]*repoGate
+	orderedRepoEvents bool
+
+	creatingUsersLk   sync.Mutex
+	creatingUsers     singleflight.Group
+	dedupMissingUsers bool
+
+	pendingCrawlsLk   sync.Mutex
+	pendingCrawls     map[string]*models.ActorInfo
+	newUserCrawlDelay time.Duration
 
 	SendRemoteFollow       func(context.Context, string, uint) error
 	CreateExternalUser     func(context.Context, string) (*models.ActorInfo, error)
 	ApplyPDSClientSettings func(*xrpc.Client)
+	SyncProfileBlobs       func(context.Context, models.Uid, []string) error
+	UserTombstoned         func(context.Context, models.Uid) (bool, error)
+
+	// AggregationFailed is handed the ops that failed to aggregate when
+	// events are emitted before aggregation, and those that ran past their
+	// aggregation timeout. By default they are logged.
+	AggregationFailed func(context.Context, *repomgr.RepoEvent, *repomgr.RepoOp, error)
+
+	// AggregationLagging is called when the aggregation lag alert fires,
+	// with the lag and how long it has been above the threshold
+	AggregationLagging func(context.Context, int64, time.Duration)
+
+	// Now is the clock used for any timestamps the indexer generates,
+	// overridable for tests
+	Now func() time.Time
 }
 
 func NewIndexer(db *gorm.DB, notifman notifs.NotificationManager, evtman *events.EventManager, didr did.Resolver, repoman *repomgr.RepoManager, crawl, aggregate bool) (*Indexer, error) {
 	db.AutoMigrate(&models.FeedPost{})
 	db.AutoMigrate(&models.ActorInfo{})
 	db.AutoMigrate(&models.FollowRecord{})
+	db.AutoMigrate(&models.BlockRecord{})
+	db.AutoMigrate(&models.ActorMute{})
 	db.AutoMigrate(&models.VoteRecord{})
 	db.AutoMigrate(&models.RepostRecord{})
+	db.AutoMigrate(&models.PostGate{})
+	db.AutoMigrate(&models.PostGateDetached{})
+	db.AutoMigrate(&models.PostLang{})
+	db.AutoMigrate(&models.PostTag{})
+	db.AutoMigrate(&models.CrawlQueueEntry{})
+	db.AutoMigrate(&models.CrawlQueueEvent{})
 
 	ix := &Indexer{
 		db:             db,
@@ -70,13 +186,35 @@ func NewIndexer(db *gorm.DB, notifman notifs.NotificationManager, evtman *events
 		events:         evtman,
 		repomgr:        repoman,
 		didr:           didr,
-		Limiters:       make(map[uint]*rate.Limiter),
+		Limiters:       make(map[uint]CrawlLimiter),
 		doAggregations: aggregate,
+		pendingCrawls:  make(map[string]*models.ActorInfo),
+		recrawls:       make(map[uint]*RecrawlProgress),
+
+		dedupMissingUsers:      true,
+		verifyRecordCids:       true,
+		catchupLookahead:       defaultCatchupLookahead,
+		crawlSnapshotMaxBuffer: defaultCrawlSnapshotMaxBuffer,
 		SendRemoteFollow: func(context.Context, string, uint) error {
 			return nil
 		},
 		ApplyPDSClientSettings: func(*xrpc.Client) {},
+		SyncProfileBlobs: func(context.Context, models.Uid, []string) error {
+			return nil
+		},
+		UserTombstoned: func(context.Context, models.Uid) (bool, error) {
+			return false, nil
+		},
+		AggregationFailed:  logAggregationFailure,
+		AggregationLagging: func(context.Context, int64, time.Duration) {},
+		Now:                time.Now,
+	}
+
+	fo, err := lru.New[models.Uid, *failedOps](failedOpUsers)
+	if err != nil {
+		return nil, err
 	}
+	ix.failedOps = fo
 
 	if crawl {
 		c, err := NewCrawlDispatcher(ix.FetchAndIndexRepo, 10)
@@ -84,6 +222,9 @@ func NewIndexer(db *gorm.DB, notifman notifs.NotificationManager, evtman *events
 			return nil, err
 		}
 
+		// follow the indexer's clock even if it's swapped out later
+		c.now = func() time.Time { return ix.Now() }
+
 		ix.Crawler = c
 		ix.Crawler.Run()
 	}
@@ -91,27 +232,30 @@ func NewIndexer(db *gorm.DB, notifman notifs.NotificationManager, evtman *events
 	return ix, nil
 }
 
-func (ix *Indexer) GetLimiter(pdsID uint) *rate.Limiter {
+func (ix *Indexer) GetLimiter(pdsID uint) CrawlLimiter {
 	ix.LimitMux.RLock()
 	defer ix.LimitMux.RUnlock()
 
 	return ix.Limiters[pdsID]
 }
 
-func (ix *Indexer) GetOrCreateLimiter(pdsID uint, pdsrate float64) *rate.Limiter {
-	ix.LimitMux.RLock()
-	defer ix.LimitMux.RUnlock()
+func (ix *Indexer) GetOrCreateLimiter(pdsID uint, pdsrate float64) CrawlLimiter {
+	ix.LimitMux.Lock()
+	defer ix.LimitMux.Unlock()
 
 	lim, ok := ix.Limiters[pdsID]
 	if !ok {
 		lim = rate.NewLimiter(rate.Limit(pdsrate), 1)
+		if ix.sharedLimits != nil {
+			lim = newSharedLimiter(ix.sharedLimits, pdsID, rate.Limit(pdsrate))
+		}
 		ix.Limiters[pdsID] = lim
 	}
 
 	return lim
 }
 
-func (ix *Indexer) SetLimiter(pdsID uint, lim *rate.Limiter) {
+func (ix *Indexer) SetLimiter(pdsID uint, lim CrawlLimiter) {
 	ix.LimitMux.Lock()
 	defer ix.LimitMux.Unlock()
 
@@ -122,8 +266,25 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 	ctx, span := otel.Tracer("indexer").Start(ctx, "HandleRepoEvent")
 	defer span.End()
 
+	ctx = WithPrimaryReads(ctx)
+
 	log.Debugw("Handling Repo Event!", "uid", evt.User)
 
+	start := time.Now()
+	ix.noteEventReceived()
+
+	gate := ix.acquireRepoGate(evt.User)
+	defer ix.releaseRepoGate(evt.User, gate)
+
+	// an older event must neither be emitted nor aggregated over the records
+	// of a later one
+	if gate.stale(evt.Rev) {
+		outOfOrderEvents.Inc()
+		ix.noteEventAggregated()
+		log.Warnw("dropping event older than one already emitted for the repo", "uid", evt.User, "rev", evt.Rev)
+		return nil
+	}
+
 	var outops []*comatproto.SyncSubscribeRepos_RepoOp
 	for _, op := range evt.Ops {
 		link := (*lexutil.LexLink)(op.RecCid)
@@ -132,14 +293,21 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 			Action: string(op.Kind),
 			Cid:    link,
 		})
+	}
 
-		if err := ix.handleRepoOp(ctx, evt, &op); err != nil {
-			log.Errorw("failed to handle repo op", "err", err)
-		}
+	if ix.aggregator != nil {
+		ix.aggregator.push(ctx, evt, start)
+	} else {
+		ix.aggregateEvent(ctx, evt, func(op *repomgr.RepoOp, err error) {
+			ix.aggregationFailed(ctx, evt, op, err)
+		})
+		ix.noteEventAggregated()
+		observeIndexLatency(ctx, evt, start)
 	}
 
 	did, err := ix.DidForUser(ctx, evt.User)
 	if err != nil {
+		eventDidLookupFailures.Inc()
 		return err
 	}
 
@@ -151,6 +319,20 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 		toobig = true
 	}
 
+	now := ix.Now()
+
+	if toobig && ix.tooBigSyncEvents {
+		blks, err := commitOnlySlice(evt.RepoSlice, evt.NewRoot)
+		if err == nil {
+			if err := ix.sendSyncEvent(ctx, evt, did, blks, now); err != nil {
+				return err
+			}
+			gate.emitted(evt.Rev)
+			return nil
+		}
+		log.Warnw("failed to build sync event, falling back to tooBig commit", "did", did, "err", err)
+	}
+
 	log.Debugw("Sending event", "did", did)
 	if err := ix.events.AddEvent(ctx, &events.XRPCStreamEvent{
 		RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
@@ -160,7 +342,7 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 			Rev:    evt.Rev,
 			Since:  evt.Since,
 			Commit: lexutil.LexLink(evt.NewRoot),
-			Time:   time.Now().Format(util.ISO8601),
+			Time:   now.Format(util.ISO8601),
 			Ops:    outops,
 			TooBig: toobig,
 		},
@@ -168,21 +350,92 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 	}); err != nil {
 		return fmt.Errorf("failed to push event: %s", err)
 	}
+	gate.emitted(evt.Rev)
+
+	return nil
+}
+
+// sendSyncEvent emits a #sync event pointing consumers at the repo's new
+// root, in place of a commit too big to send.
+func (ix *Indexer) sendSyncEvent(ctx context.Context, evt *repomgr.RepoEvent, did string, blks []byte, now time.Time) error {
+	log.Debugw("Sending sync event", "did", did)
+	if err := ix.events.AddEvent(ctx, &events.XRPCStreamEvent{
+		RepoSync: &comatproto.SyncSubscribeRepos_Sync{
+			Did:    did,
+			Blocks: blks,
+			Rev:    evt.Rev,
+			Time:   now.Format(util.ISO8601),
+		},
+		PrivUid: evt.User,
+	}); err != nil {
+		return fmt.Errorf("failed to push event: %s", err)
+	}
 
 	return nil
 }
 
+// aggregateEvent indexes the records of each op in the event, passing any
+// that fail to onErr.
+func (ix *Indexer) aggregateEvent(ctx context.Context, evt *repomgr.RepoEvent, onErr func(*repomgr.RepoOp, error)) {
+	batching := ix.batchingDeletes(evt)
+
+	var pending []*repomgr.RepoOp
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := ix.handleBulkDeletes(ctx, evt, pending); err != nil {
+			for _, op := range pending {
+				onErr(op, err)
+			}
+		}
+		pending = nil
+	}
+
+	for i := range evt.Ops {
+		op := &evt.Ops[i]
+		if op.Kind == repomgr.EvtKindDeleteRecord {
+			ix.dropDeferredOps(evt.User, op)
+		}
+		if batching && bulkDeletable(op) {
+			pending = append(pending, op)
+			continue
+		}
+		if op.Kind != repomgr.EvtKindDeleteRecord {
+			// e.g. a record deleted and created again under the same rkey
+			flush()
+		}
+
+		timedOut, err := ix.handleRepoOpTimed(ctx, evt, op)
+		if timedOut {
+			aggregationTimeouts.WithLabelValues(op.Collection).Inc()
+			log.Warnw("abandoned repo op that ran past its aggregation timeout", "uid", evt.User, "collection", op.Collection, "rkey", op.Rkey, "kind", op.Kind)
+			ix.aggregationFailed(ctx, evt, op, err)
+			continue
+		}
+		if err != nil {
+			onErr(op, err)
+		}
+	}
+
+	flush()
+}
+
 func (ix *Indexer) handleRepoOp(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	ctx = withPlaceholderSource(WithPrimaryReads(ctx), evt.User)
+
 	switch op.Kind {
 	case repomgr.EvtKindCreateRecord:
 		if ix.doAggregations {
 			_, err := ix.handleRecordCreate(ctx, evt, op, true)
-			if err != nil {
+			if err = ix.holdIfDeferred(err, evt, op); err != nil {
 				return fmt.Errorf("handle recordCreate: %w", err)
 			}
 		}
-		if err := ix.crawlRecordReferences(ctx, op); err != nil {
-			return err
+		if ix.refCrawlMode != RefCrawlDisabled {
+			if err := ix.crawlRecordReferences(ctx, op); err != nil {
+				return err
+			}
 		}
 
 	case repomgr.EvtKindDeleteRecord:
@@ -193,88 +446,69 @@ func (ix *Indexer) handleRepoOp(ctx context.Context, evt *repomgr.RepoEvent, op
 		}
 	case repomgr.EvtKindUpdateRecord:
 		if ix.doAggregations {
-			if err := ix.handleRecordUpdate(ctx, evt, op, true); err != nil {
+			err := ix.handleRecordUpdate(ctx, evt, op, true)
+			if err = ix.holdIfDeferred(err, evt, op); err != nil {
 				return fmt.Errorf("handle recordCreate: %w", err)
 			}
 		}
 	default:
-		return fmt.Errorf("unrecognized repo event type: %q", op.Kind)
+		return ix.handleUnknownOp(evt, op)
 	}
 
 	return nil
 }
 
-func (ix *Indexer) crawlAtUriRef(ctx context.Context, uri string) error {
-	puri, err := util.ParseAtUri(uri)
-	if err != nil {
-		return err
-	}
-
-	referencesCrawled.Inc()
-
-	_, err = ix.GetUserOrMissing(ctx, puri.Did)
-	if err != nil {
-		return err
-	}
-	return nil
-}
 func (ix *Indexer) crawlRecordReferences(ctx context.Context, op *repomgr.RepoOp) error {
 	ctx, span := otel.Tracer("indexer").Start(ctx, "crawlRecordReferences")
 	defer span.End()
 
 	switch rec := op.Record.(type) {
 	case *bsky.FeedPost:
-		for _, e := range rec.Entities {
-			if e.Type == "mention" {
-				_, err := ix.GetUserOrMissing(ctx, e.Value)
-				if err != nil {
-					log.Infow("failed to parse user mention", "ref", e.Value, "err", err)
-				}
-			}
-		}
-
-		if rec.Reply != nil {
-			if rec.Reply.Parent != nil {
-				if err := ix.crawlAtUriRef(ctx, rec.Reply.Parent.Uri); err != nil {
-					log.Infow("failed to crawl reply parent", "cid", op.RecCid, "replyuri", rec.Reply.Parent.Uri, "err", err)
-				}
-			}
-
-			if rec.Reply.Root != nil {
-				if err := ix.crawlAtUriRef(ctx, rec.Reply.Root.Uri); err != nil {
-					log.Infow("failed to crawl reply root", "cid", op.RecCid, "rooturi", rec.Reply.Root.Uri, "err", err)
-				}
-			}
-		}
-
-		return nil
+		return ix.crawlPostReferences(ctx, op, rec)
 	case *bsky.FeedRepost:
 		if rec.Subject != nil {
-			if err := ix.crawlAtUriRef(ctx, rec.Subject.Uri); err != nil {
+			if err := ix.crawlAtUriRef(ctx, "repost subject", rec.Subject.Uri); errors.Is(err, ErrMalformedAtUri) {
+				return err
+			} else if err != nil {
 				log.Infow("failed to crawl repost subject", "cid", op.RecCid, "subjecturi", rec.Subject.Uri, "err", err)
 			}
 		}
 		return nil
 	case *bsky.FeedLike:
 		if rec.Subject != nil {
-			if err := ix.crawlAtUriRef(ctx, rec.Subject.Uri); err != nil {
+			if err := ix.crawlAtUriRef(ctx, "like subject", rec.Subject.Uri); errors.Is(err, ErrMalformedAtUri) {
+				return err
+			} else if err != nil {
 				log.Infow("failed to crawl vote subject", "cid", op.RecCid, "subjecturi", rec.Subject.Uri, "err", err)
 			}
 		}
 		return nil
 	case *bsky.GraphFollow:
-		_, err := ix.GetUserOrMissing(ctx, rec.Subject)
-		if err != nil {
+		if err := ix.crawlDidRef(ctx, rec.Subject); err != nil {
 			log.Infow("failed to crawl follow subject", "cid", op.RecCid, "subjectdid", rec.Subject, "err", err)
 		}
 		return nil
 	case *bsky.GraphBlock:
-		_, err := ix.GetUserOrMissing(ctx, rec.Subject)
-		if err != nil {
+		if err := ix.crawlDidRef(ctx, rec.Subject); err != nil {
 			log.Infow("failed to crawl follow subject", "cid", op.RecCid, "subjectdid", rec.Subject, "err", err)
 		}
 		return nil
-	case *bsky.ActorProfile:
+	case *bsky.FeedPostgate:
+		if err := ix.crawlAtUriRef(ctx, "postgate post", rec.Post); errors.Is(err, ErrMalformedAtUri) {
+			return err
+		} else if err != nil {
+			log.Infow("failed to crawl postgate post", "cid", op.RecCid, "uri", rec.Post, "err", err)
+		}
+
+		for _, uri := range rec.DetachedEmbeddingUris {
+			if err := ix.crawlAtUriRef(ctx, "detached embedding", uri); errors.Is(err, ErrMalformedAtUri) {
+				return err
+			} else if err != nil {
+				log.Infow("failed to crawl detached embedding", "cid", op.RecCid, "uri", uri, "err", err)
+			}
+		}
+		return nil
+	case *bsky.ActorProfile, *bsky.ActorStatus:
 		return nil
 	default:
 		log.Warnf("unrecognized record type: %T", op.Record)
@@ -286,8 +520,12 @@ func (ix *Indexer) GetUserOrMissing(ctx context.Context, did string) (*models.Ac
 	ctx, span := otel.Tracer("indexer").Start(ctx, "getUserOrMissing")
 	defer span.End()
 
+	// a stale miss here would create the user a second time
+	ctx = WithPrimaryReads(ctx)
+
 	ai, err := ix.LookupUserByDid(ctx, did)
 	if err == nil {
+		ix.notePendingCrawlRef(did)
 		return ai, nil
 	}
 
@@ -303,18 +541,26 @@ func (ix *Indexer) createMissingUserRecord(ctx context.Context, did string) (*mo
 	ctx, span := otel.Tracer("indexer").Start(ctx, "createMissingUserRecord")
 	defer span.End()
 
-	externalUserCreationAttempts.Inc()
+	return ix.dedupUserCreation(ctx, did, func() (*models.ActorInfo, error) {
+		if !ix.resolverAvailable() {
+			resolverOutageSkippedUsers.Inc()
+			return nil, ErrResolverOutage
+		}
 
-	ai, err := ix.CreateExternalUser(ctx, did)
-	if err != nil {
-		return nil, err
-	}
+		externalUserCreationAttempts.Inc()
 
-	if err := ix.addUserToCrawler(ctx, ai); err != nil {
-		return nil, fmt.Errorf("failed to add unknown user to crawler: %w", err)
-	}
+		ai, err := ix.CreateExternalUser(ctx, did)
+		ix.noteResolution(err)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ix.enqueueNewUserCrawl(ctx, ai); err != nil {
+			return nil, err
+		}
 
-	return ai, nil
+		return ai, nil
+	})
 }
 
 func (ix *Indexer) addUserToCrawler(ctx context.Context, ai *models.ActorInfo) error {
@@ -328,7 +574,7 @@ func (ix *Indexer) addUserToCrawler(ctx context.Context, ai *models.ActorInfo) e
 
 func (ix *Indexer) DidForUser(ctx context.Context, uid models.Uid) (string, error) {
 	var ai models.ActorInfo
-	if err := ix.db.First(&ai, "uid = ?", uid).Error; err != nil {
+	if err := ix.reader(ctx).First(&ai, "uid = ?", uid).Error; err != nil {
 		return "", err
 	}
 
@@ -337,7 +583,7 @@ func (ix *Indexer) DidForUser(ctx context.Context, uid models.Uid) (string, erro
 
 func (ix *Indexer) LookupUser(ctx context.Context, id models.Uid) (*models.ActorInfo, error) {
 	var ai models.ActorInfo
-	if err := ix.db.First(&ai, "uid = ?", id).Error; err != nil {
+	if err := ix.reader(ctx).First(&ai, "uid = ?", id).Error; err != nil {
 		return nil, err
 	}
 
@@ -346,7 +592,7 @@ func (ix *Indexer) LookupUser(ctx context.Context, id models.Uid) (*models.Actor
 
 func (ix *Indexer) LookupUserByDid(ctx context.Context, did string) (*models.ActorInfo, error) {
 	var ai models.ActorInfo
-	if err := ix.db.Find(&ai, "did = ?", did).Error; err != nil {
+	if err := ix.reader(ctx).Find(&ai, "did = ?", did).Error; err != nil {
 		return nil, err
 	}
 
@@ -359,7 +605,7 @@ func (ix *Indexer) LookupUserByDid(ctx context.Context, did string) (*models.Act
 
 func (ix *Indexer) LookupUserByHandle(ctx context.Context, handle string) (*models.ActorInfo, error) {
 	var ai models.ActorInfo
-	if err := ix.db.Find(&ai, "handle = ?", handle).Error; err != nil {
+	if err := ix.reader(ctx).Find(&ai, "handle = ?", handle).Error; err != nil {
 		return nil, err
 	}
 
@@ -370,12 +616,70 @@ func (ix *Indexer) LookupUserByHandle(ctx context.Context, handle string) (*mode
 	return &ai, nil
 }
 
+// LookupActor looks up a user by an identifier that may be either a DID or a
+// handle, as accepted by the actor parameters of client endpoints. Handles are
+// looked up as given, then in lower case. If resolve is set, a DID we don't know of yet is
+// resolved and its user created and crawled; unknown handles are never
+// resolved. Unknown users are reported as gorm.ErrRecordNotFound.
+func (ix *Indexer) LookupActor(ctx context.Context, identifier string, resolve bool) (*models.ActorInfo, error) {
+	atid, err := syntax.ParseAtIdentifier(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("invalid actor %q: %w", identifier, err)
+	}
+
+	if atid.IsDID() {
+		did, _ := atid.AsDID()
+		if resolve {
+			return ix.GetUserOrMissing(ctx, did.String())
+		}
+		return ix.LookupUserByDid(ctx, did.String())
+	}
+
+	handle, _ := atid.AsHandle()
+	ai, err := ix.LookupUserByHandle(ctx, handle.String())
+	if errors.Is(err, gorm.ErrRecordNotFound) && handle.Normalize() != handle {
+		return ix.LookupUserByHandle(ctx, handle.Normalize().String())
+	}
+	return ai, err
+}
+
+// ListReposByPDS returns up to limit users hosted on the given PDS, ordered by
+// id. The returned cursor can be passed back in to fetch the next page, and is
+// empty once there are no more users.
+func (ix *Indexer) ListReposByPDS(ctx context.Context, pdsID uint, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "ListReposByPDS")
+	defer span.End()
+
+	q := ix.reader(ctx).WithContext(ctx).Where("pds = ?", pdsID)
+	if cursor != "" {
+		after, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where("id > ?", after)
+	}
+
+	var out []*models.ActorInfo
+	if err := q.Order("id").Limit(limit).Find(&out).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(out) == limit && limit > 0 {
+		next = strconv.FormatUint(uint64(out[len(out)-1].ID), 10)
+	}
+
+	return out, next, nil
+}
+
 func (ix *Indexer) handleInitActor(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
 	ai := op.ActorInfo
 
-	if err := ix.db.Clauses(clause.OnConflict{
+	// the follow counts are maintained incrementally, so re-initializing an
+	// existing actor must not reset them
+	if err := ix.db.WithContext(ctx).Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "uid"}},
-		UpdateAll: true,
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "handle", "did", "display_name", "type", "pds"}),
 	}).Create(&models.ActorInfo{
 		Uid:         evt.User,
 		Handle:      sql.NullString{String: ai.Handle, Valid: true},
@@ -387,7 +691,7 @@ func (ix *Indexer) handleInitActor(ctx context.Context, evt *repomgr.RepoEvent,
 		return fmt.Errorf("initializing new actor info: %w", err)
 	}
 
-	if err := ix.db.Create(&models.FollowRecord{
+	if err := ix.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.FollowRecord{
 		Follower: evt.User,
 		Target:   evt.User,
 	}).Error; err != nil {
@@ -431,44 +735,72 @@ func (ix *Indexer) FetchAndIndexRepo(ctx context.Context, job *crawlWork) error
 	ctx, span := otel.Tracer("indexer").Start(ctx, "FetchAndIndexRepo")
 	defer span.End()
 
+	ctx = WithPrimaryReads(ctx)
+
 	span.SetAttributes(attribute.Int("catchup", len(job.catchup)))
 
+	if ix.crawlFanoutLimit > 0 {
+		ctx = withFanoutBudget(ctx, ix.crawlFanoutLimit)
+	}
+
+	if job.initScrape {
+		ctx = withInitScrape(ctx)
+	}
+
+	ctx = withCrawl(ctx)
+
 	ai := job.act
 
 	var pds models.PDS
-	if err := ix.db.First(&pds, "id = ?", ai.PDS).Error; err != nil {
+	if err := ix.db.WithContext(ctx).First(&pds, "id = ?", ai.PDS).Error; err != nil {
 		return fmt.Errorf("expected to find pds record (%d) in db for crawling one of their users: %w", ai.PDS, err)
 	}
 
+	ix.maybeRefreshPDSInfo(&pds)
+
+	// a previous import that died partway through gets undone first, so the
+	// rev we fetch from reflects data that was actually fully processed
+	if err := ix.repomgr.RecoverInterruptedImport(ctx, ai.Uid); err != nil {
+		return err
+	}
+
 	rev, err := ix.repomgr.GetRepoRev(ctx, ai.Uid)
 	if err != nil && !isNotFound(err) {
 		return fmt.Errorf("failed to get repo root: %w", err)
 	}
 
+	if job.forceFull {
+		rev = ""
+	}
+
 	// attempt to process buffered events
-	if !job.initScrape && len(job.catchup) > 0 {
-		first := job.catchup[0]
-		var resync bool
-		if first.evt.Since == nil || rev == *first.evt.Since {
-			for i, j := range job.catchup {
-				catchupEventsProcessed.Inc()
-				if err := ix.repomgr.HandleExternalUserEvent(ctx, pds.ID, ai.Uid, ai.Did, j.evt.Since, j.evt.Rev, j.evt.Blocks, j.evt.Ops); err != nil {
-					log.Errorw("buffered event catchup failed", "error", err, "did", ai.Did, "i", i, "jobCount", len(job.catchup), "seq", j.evt.Seq)
-					resync = true // fall back to a repo sync
-					break
-				}
-			}
+	if !job.initScrape && !job.forceFull && len(job.catchup) > 0 {
+		pending := dropStaleCatchup(rev, job.catchup)
+		if len(pending) == 0 {
+			// everything buffered is already in our copy of the repo
+			return nil
+		}
 
-			if !resync {
-				return nil
-			}
+		if ix.catchupExpired(pending, ix.Now()) {
+			catchupExpiredFullFetches.Inc()
+			span.SetAttributes(attribute.Bool("catchup_expired", true))
+			log.Infow("buffered events expired, fetching repo", "did", ai.Did, "pds", pds.Host, "count", len(pending))
+		} else if gap := findCatchupGap(rev, pending); gap != nil {
+			catchupRevGaps.Inc()
+			span.SetAttributes(attribute.Bool("rev_gap", true))
+			log.Warnw("gap in buffered events, resyncing repo", "did", ai.Did, "pds", pds.Host, "i", gap.index, "expectedSince", gap.expected, "since", gap.since, "seq", gap.seq)
+		} else if ix.replayCatchup(ctx, &pds, ai, pending) {
+			return nil
 		}
+		// fall back to a repo sync
 	}
 
 	if rev == "" {
 		span.SetAttributes(attribute.Bool("full", true))
 	}
 
+	ctx = withRepoFetch(ctx)
+
 	c := models.ClientForPds(&pds)
 	ix.ApplyPDSClientSettings(c)
 
@@ -477,7 +809,24 @@ func (ix *Indexer) FetchAndIndexRepo(ctx context.Context, job *crawlWork) error
 		return err
 	}
 
-	if err := ix.repomgr.ImportNewRepo(ctx, ai.Uid, ai.Did, bytes.NewReader(repo), &rev); err != nil {
+	// the account may have been deleted while we were waiting on the fetch,
+	// in which case importing would only recreate data that is being purged
+	tombstoned, err := ix.UserTombstoned(ctx, ai.Uid)
+	if err != nil {
+		return fmt.Errorf("checking tombstone status: %w", err)
+	}
+	if tombstoned {
+		crawlsCancelled.Inc()
+		log.Infow("user was tombstoned during crawl, dropping fetched repo", "did", ai.Did)
+		return nil
+	}
+
+	since := &rev
+	if job.forceFull {
+		since = nil
+	}
+
+	if err := ix.repomgr.ImportNewRepo(ctx, ai.Uid, ai.Did, bytes.NewReader(repo), since); err != nil {
 		span.RecordError(err)
 
 		if ipld.IsNotFound(err) {
@@ -506,8 +855,10 @@ func (ix *Indexer) GetPost(ctx context.Context, uri string) (*models.FeedPost, e
 		return nil, err
 	}
 
+	db := ix.reader(ctx)
+
 	var post models.FeedPost
-	if err := ix.db.First(&post, "rkey = ? AND author = (?)", puri.Rkey, ix.db.Model(models.ActorInfo{}).Where("did = ?", puri.Did).Select("id")).Error; err != nil {
+	if err := db.First(&post, "rkey = ? AND author = (?)", puri.Rkey, db.Model(models.ActorInfo{}).Where("did = ?", puri.Did).Select("id")).Error; err != nil {
 		return nil, err
 	}
 
@@ -515,7 +866,9 @@ func (ix *Indexer) GetPost(ctx context.Context, uri string) (*models.FeedPost, e
 }
 
 func (ix *Indexer) handleRecordDelete(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, local bool) error {
-	log.Infow("record delete event", "collection", op.Collection)
+	if ix.sampleRecordLog(evt, op) {
+		log.Infow("record delete event", "collection", op.Collection, "uid", evt.User, "rkey", op.Rkey)
+	}
 
 	switch op.Collection {
 	case "app.bsky.feed.post":
@@ -524,7 +877,7 @@ func (ix *Indexer) handleRecordDelete(ctx context.Context, evt *repomgr.RepoEven
 			return err
 		}
 
-		uri := "at://" + u.Did + "/app.bsky.feed.post/" + op.Rkey
+		uri := util.BuildAtUri(u.Did, "app.bsky.feed.post", op.Rkey)
 
 		// NB: currently not using the 'or missing' variant here. If we delete
 		// something that we've never seen before, maybe just dont bother?
@@ -537,11 +890,29 @@ func (ix *Indexer) handleRecordDelete(ctx context.Context, evt *repomgr.RepoEven
 			return err
 		}
 
-		if err := ix.db.Model(models.FeedPost{}).Where("id = ?", fp.ID).UpdateColumn("deleted", true).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", fp.ID).UpdateColumn("deleted", true).Error; err != nil {
+			return err
+		}
+
+		if err := ix.db.WithContext(ctx).Where("post = ?", fp.ID).Delete(&models.PostTag{}).Error; err != nil {
 			return err
 		}
+
+		if fp.QuoteOf != 0 && !fp.Deleted {
+			// quotes that a postgate kept out of the count were never added
+			allowed, err := ix.embedAllowed(ctx, fp.QuoteOf, fp.ID)
+			if err != nil {
+				return err
+			}
+
+			if allowed {
+				if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", fp.QuoteOf).Update("quote_count", gorm.Expr("quote_count - 1")).Error; err != nil {
+					return err
+				}
+			}
+		}
 	case "app.bsky.feed.repost":
-		if err := ix.db.Where("reposter = ? AND rkey = ?", evt.User, op.Rkey).Delete(&models.RepostRecord{}).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Where("reposter = ? AND rkey = ?", evt.User, op.Rkey).Delete(&models.RepostRecord{}).Error; err != nil {
 			return err
 		}
 
@@ -556,9 +927,20 @@ func (ix *Indexer) handleRecordDelete(ctx context.Context, evt *repomgr.RepoEven
 		return ix.handleRecordDeleteFeedLike(ctx, evt, op)
 	case "app.bsky.graph.follow":
 		return ix.handleRecordDeleteGraphFollow(ctx, evt, op)
+	case "app.bsky.graph.block":
+		return ix.handleRecordDeleteGraphBlock(ctx, evt, op)
 	case "app.bsky.graph.confirmation":
 		return nil
+	case "app.bsky.actor.profile":
+		return ix.handleRecordDeleteActorProfile(ctx, evt, op)
+	case "app.bsky.actor.status":
+		return ix.handleRecordDeleteActorStatus(ctx, evt, op)
+	case "app.bsky.feed.postgate":
+		return ix.handleRecordDeleteFeedPostgate(ctx, evt, op)
 	default:
+		if h := ix.collectionHandler(op.Collection); h != nil {
+			return h(ctx, evt, op)
+		}
 		return fmt.Errorf("unrecognized record type (delete): %q", op.Collection)
 	}
 
@@ -567,14 +949,19 @@ func (ix *Indexer) handleRecordDelete(ctx context.Context, evt *repomgr.RepoEven
 
 func (ix *Indexer) handleRecordDeleteFeedLike(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
 	var vr models.VoteRecord
-	if err := ix.db.Find(&vr, "voter = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+	if err := ix.db.WithContext(ctx).Find(&vr, "voter = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
 		return err
 	}
 
-	if err := ix.db.Transaction(func(tx *gorm.DB) error {
+	if err := ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		tx.Statement.RaiseErrorOnNotFound = true
-		if err := tx.Model(models.VoteRecord{}).Where("id = ?", vr.ID).Delete(&vr).Error; err != nil {
-			return err
+		res := tx.Model(models.VoteRecord{}).Where("id = ?", vr.ID).Delete(&vr)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// already gone, e.g. pruned
+			return nil
 		}
 
 		if err := tx.Model(models.FeedPost{}).Where("id = ?", vr.Post).Update("up_count", gorm.Expr("up_count - 1")).Error; err != nil {
@@ -591,21 +978,65 @@ func (ix *Indexer) handleRecordDeleteFeedLike(ctx context.Context, evt *repomgr.
 }
 
 func (ix *Indexer) handleRecordDeleteGraphFollow(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
-	q := ix.db.Where("follower = ? AND rkey = ?", evt.User, op.Rkey).Delete(&models.FollowRecord{})
-	if err := q.Error; err != nil {
+	var fr models.FollowRecord
+	if err := ix.db.WithContext(ctx).Limit(1).Find(&fr, "follower = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
 		return err
 	}
 
-	if q.RowsAffected == 0 {
+	if fr.ID == 0 {
 		log.Warnw("attempted to delete follow we didnt have a record for", "user", evt.User, "rkey", op.Rkey)
 		return nil
 	}
 
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// hard delete, so the (follower, rkey) key is free again
+		if err := tx.Unscoped().Delete(&fr).Error; err != nil {
+			return err
+		}
+
+		return updateFollowCounts(tx, &fr, -1)
+	})
+}
+
+// updateFollowCounts adjusts the denormalized follow counts of both sides of
+// the given follow by delta. Self-follows, whether the one every actor is
+// initialized with or a user's own follow record, are not counted.
+func updateFollowCounts(tx *gorm.DB, fr *models.FollowRecord, delta int) error {
+	if fr.Follower == fr.Target {
+		return nil
+	}
+
+	if err := tx.Model(models.ActorInfo{}).Where("uid = ?", fr.Follower).Update("following", gorm.Expr("following + ?", delta)).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(models.ActorInfo{}).Where("uid = ?", fr.Target).Update("followers", gorm.Expr("followers + ?", delta)).Error; err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (ix *Indexer) handleRecordCreate(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, local bool) ([]uint, error) {
-	log.Infow("record create event", "collection", op.Collection)
+	if ix.sampleRecordLog(evt, op) {
+		log.Infow("record create event", "collection", op.Collection, "uid", evt.User, "rkey", op.Rkey)
+	}
+
+	if ix.verifyRecordCids {
+		if err := verifyRecordCid(op); err != nil {
+			recordCidMismatches.WithLabelValues(op.Collection).Inc()
+			log.Warnw("skipping aggregation of record not matching its cid", "collection", op.Collection, "rkey", op.Rkey, "uid", evt.User, "err", err)
+			return nil, nil
+		}
+	}
+
+	if ix.validateRecords {
+		if err := validateRecord(op.Record); err != nil {
+			recordValidationFailures.WithLabelValues(op.Collection).Inc()
+			log.Warnw("skipping aggregation of invalid record", "collection", op.Collection, "rkey", op.Rkey, "uid", evt.User, "err", err)
+			return nil, nil
+		}
+	}
 
 	var out []uint
 	switch rec := op.Record.(type) {
@@ -614,10 +1045,13 @@ func (ix *Indexer) handleRecordCreate(ctx context.Context, evt *repomgr.RepoEven
 			return nil, err
 		}
 	case *bsky.FeedRepost:
-		fp, err := ix.GetPostOrMissing(ctx, rec.Subject.Uri)
+		fp, err := ix.repostSubjectPost(ctx, rec.Subject.Uri)
 		if err != nil {
 			return nil, err
 		}
+		if fp == nil {
+			return nil, nil
+		}
 
 		author, err := ix.LookupUser(ctx, fp.Author)
 		if err != nil {
@@ -634,11 +1068,11 @@ func (ix *Indexer) handleRecordCreate(ctx context.Context, evt *repomgr.RepoEven
 			RecCid:     op.RecCid.String(),
 			Rkey:       op.Rkey,
 		}
-		if err := ix.db.Create(&rr).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Create(&rr).Error; err != nil {
 			return nil, err
 		}
 
-		if err := ix.notifman.AddRepost(ctx, fp.Author, rr.ID, evt.User); err != nil {
+		if err := ix.addNewRepostNotification(ctx, fp.Author, &rr); err != nil {
 			return nil, err
 		}
 
@@ -646,9 +1080,18 @@ func (ix *Indexer) handleRecordCreate(ctx context.Context, evt *repomgr.RepoEven
 		return nil, ix.handleRecordCreateFeedLike(ctx, rec, evt, op)
 	case *bsky.GraphFollow:
 		return out, ix.handleRecordCreateGraphFollow(ctx, rec, evt, op)
+	case *bsky.GraphBlock:
+		return out, ix.handleRecordCreateGraphBlock(ctx, rec, evt, op)
 	case *bsky.ActorProfile:
-		log.Infof("TODO: got actor profile record creation, need to do something with this")
+		return out, ix.handleRecordCreateActorProfile(ctx, rec, evt, op)
+	case *bsky.ActorStatus:
+		return out, ix.handleRecordCreateActorStatus(ctx, rec, evt, op)
+	case *bsky.FeedPostgate:
+		return out, ix.handleRecordCreateFeedPostgate(ctx, rec, evt, op)
 	default:
+		if h := ix.collectionHandler(op.Collection); h != nil {
+			return nil, h(ctx, evt, op)
+		}
 		return nil, fmt.Errorf("unrecognized record type: %T", rec)
 	}
 
@@ -673,11 +1116,11 @@ func (ix *Indexer) handleRecordCreateFeedLike(ctx context.Context, rec *bsky.Fee
 		Rkey:    op.Rkey,
 		Cid:     op.RecCid.String(),
 	}
-	if err := ix.db.Create(&vr).Error; err != nil {
+	if err := ix.db.WithContext(ctx).Create(&vr).Error; err != nil {
 		return err
 	}
 
-	if err := ix.db.Model(models.FeedPost{}).Where("id = ?", post.ID).Update("up_count", gorm.Expr("up_count + 1")).Error; err != nil {
+	if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", post.ID).Update("up_count", gorm.Expr("up_count + 1")).Error; err != nil {
 		return err
 	}
 	if err := ix.addNewVoteNotification(ctx, act.Uid, &vr); err != nil {
@@ -694,6 +1137,17 @@ func (ix *Indexer) handleRecordCreateGraphFollow(ctx context.Context, rec *bsky.
 			return fmt.Errorf("failed to lookup user: %w", err)
 		}
 
+		// past the crawl's fan-out limit, the follow is indexed once the
+		// batcher has created the user
+		if b := fanoutBudgetFrom(ctx); b != nil && !b.take() {
+			crawlFanoutDeferred.Inc()
+			d := &deferredOp{evt: &repomgr.RepoEvent{User: evt.User}, op: *op}
+			if !ix.fanoutBatcher.addWaiting(rec.Subject, d) {
+				log.Warnw("dropping follow of a new user past the crawl's fan-out limit", "uid", evt.User, "rkey", op.Rkey, "subject", rec.Subject)
+			}
+			return nil
+		}
+
 		nu, err := ix.createMissingUserRecord(ctx, rec.Subject)
 		if err != nil {
 			return fmt.Errorf("create external user: %w", err)
@@ -702,6 +1156,14 @@ func (ix *Indexer) handleRecordCreateGraphFollow(ctx context.Context, rec *bsky.
 		subj = nu
 	}
 
+	if subj.Uid == evt.User {
+		selfFollowRecords.Inc()
+		if ix.selfFollowPolicy == SelfFollowReject {
+			log.Debugw("skipping self follow record", "uid", evt.User, "rkey", op.Rkey)
+			return nil
+		}
+	}
+
 	// 'follower' followed 'target'
 	fr := models.FollowRecord{
 		Follower: evt.User,
@@ -709,19 +1171,143 @@ func (ix *Indexer) handleRecordCreateGraphFollow(ctx context.Context, rec *bsky.
 		Rkey:     op.Rkey,
 		Cid:      op.RecCid.String(),
 	}
-	if err := ix.db.Create(&fr).Error; err != nil {
+
+	// follows are unique on (follower, rkey), so that replaying an event we
+	// already indexed leaves the existing record (and counts) alone
+	var created bool
+	if err := ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fr)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			var existing models.FollowRecord
+			if err := tx.First(&existing, "follower = ? AND rkey = ?", fr.Follower, fr.Rkey).Error; err != nil {
+				return err
+			}
+
+			if existing.Target == fr.Target {
+				return tx.Model(&existing).Update("cid", fr.Cid).Error
+			}
+
+			// the rkey was reused for a different subject
+			if err := tx.Unscoped().Delete(&existing).Error; err != nil {
+				return err
+			}
+			if err := updateFollowCounts(tx, &existing, -1); err != nil {
+				return err
+			}
+			if err := tx.Create(&fr).Error; err != nil {
+				return err
+			}
+		}
+		created = true
+
+		return updateFollowCounts(tx, &fr, 1)
+	}); err != nil {
 		return err
 	}
 
-	if err := ix.notifman.AddFollow(ctx, fr.Follower, fr.Target, fr.ID); err != nil {
+	if !created {
+		return nil
+	}
+
+	if err := ix.addNewFollowNotification(ctx, &fr); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (ix *Indexer) handleRecordCreateGraphBlock(ctx context.Context, rec *bsky.GraphBlock, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	subj, err := ix.LookupUserByDid(ctx, rec.Subject)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to lookup user: %w", err)
+		}
+
+		nu, err := ix.createMissingUserRecord(ctx, rec.Subject)
+		if err != nil {
+			return fmt.Errorf("create external user: %w", err)
+		}
+
+		subj = nu
+	}
+
+	// 'blocker' blocked 'target'
+	br := models.BlockRecord{
+		Blocker: evt.User,
+		Target:  subj.Uid,
+		Rkey:    op.Rkey,
+		Cid:     op.RecCid.String(),
+	}
+
+	// blocks are unique on (blocker, rkey) like follows, so a replayed
+	// block doesn't add a second record
+	res := ix.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&br)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		var existing models.BlockRecord
+		if err := ix.db.WithContext(ctx).First(&existing, "blocker = ? AND rkey = ?", br.Blocker, br.Rkey).Error; err != nil {
+			return err
+		}
+
+		if err := ix.db.WithContext(ctx).Model(&existing).Updates(map[string]any{
+			"target": br.Target,
+			"cid":    br.Cid,
+		}).Error; err != nil {
+			return err
+		}
+
+		// the rkey may have been reused for a different subject
+		ix.invalidateBlocks(existing.Blocker, existing.Target)
+	}
+
+	ix.invalidateBlocks(evt.User, subj.Uid)
+	return nil
+}
+
+func (ix *Indexer) handleRecordDeleteGraphBlock(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	var brs []models.BlockRecord
+	if err := ix.db.WithContext(ctx).Find(&brs, "blocker = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+		return err
+	}
+
+	// hard delete, so the (blocker, rkey) key is free again
+	if err := ix.db.WithContext(ctx).Unscoped().Where("blocker = ? AND rkey = ?", evt.User, op.Rkey).Delete(&models.BlockRecord{}).Error; err != nil {
+		return err
+	}
+
+	for _, br := range brs {
+		ix.invalidateBlocks(br.Blocker, br.Target)
+	}
+	return nil
+}
+
 func (ix *Indexer) handleRecordUpdate(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, local bool) error {
-	log.Infow("record update event", "collection", op.Collection)
+	if ix.sampleRecordLog(evt, op) {
+		log.Infow("record update event", "collection", op.Collection, "uid", evt.User, "rkey", op.Rkey)
+	}
+
+	if ix.verifyRecordCids {
+		if err := verifyRecordCid(op); err != nil {
+			recordCidMismatches.WithLabelValues(op.Collection).Inc()
+			log.Warnw("skipping aggregation of record not matching its cid", "collection", op.Collection, "rkey", op.Rkey, "uid", evt.User, "err", err)
+			return nil
+		}
+	}
+
+	if ix.validateRecords {
+		if err := validateRecord(op.Record); err != nil {
+			recordValidationFailures.WithLabelValues(op.Collection).Inc()
+			log.Warnw("skipping aggregation of invalid record", "collection", op.Collection, "rkey", op.Rkey, "uid", evt.User, "err", err)
+			return nil
+		}
+	}
 
 	switch rec := op.Record.(type) {
 	case *bsky.FeedPost:
@@ -730,7 +1316,7 @@ func (ix *Indexer) handleRecordUpdate(ctx context.Context, evt *repomgr.RepoEven
 			return err
 		}
 
-		uri := "at://" + u.Did + "/app.bsky.feed.post/" + op.Rkey
+		uri := util.BuildAtUri(u.Did, "app.bsky.feed.post", op.Rkey)
 		fp, err := ix.GetPostOrMissing(ctx, uri)
 		if err != nil {
 			return err
@@ -757,14 +1343,18 @@ func (ix *Indexer) handleRecordUpdate(ctx context.Context, evt *repomgr.RepoEven
 			}
 		}
 
-		if err := ix.db.Model(models.FeedPost{}).Where("id = ?", fp.ID).UpdateColumn("cid", op.RecCid.String()).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", fp.ID).UpdateColumn("cid", op.RecCid.String()).Error; err != nil {
 			return err
 		}
 
-		return nil
+		if err := ix.setPostLangs(ctx, fp.ID, rec.Langs); err != nil {
+			return err
+		}
+
+		return ix.setPostTags(ctx, fp.ID, postTags(rec))
 	case *bsky.FeedRepost:
 		var rr models.RepostRecord
-		if err := ix.db.First(&rr, "reposter = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+		if err := ix.db.WithContext(ctx).First(&rr, "reposter = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
 			return err
 		}
 
@@ -773,13 +1363,13 @@ func (ix *Indexer) handleRecordUpdate(ctx context.Context, evt *repomgr.RepoEven
 		rr.RecCreated = rec.CreatedAt
 		rr.RecCid = op.RecCid.String()
 
-		if err := ix.db.Save(&rr).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Save(&rr).Error; err != nil {
 			return err
 		}
 
 	case *bsky.FeedLike:
 		var vr models.VoteRecord
-		if err := ix.db.Find(&vr, "voted = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Find(&vr, "voted = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
 			return err
 		}
 
@@ -804,9 +1394,22 @@ func (ix *Indexer) handleRecordUpdate(ctx context.Context, evt *repomgr.RepoEven
 		}
 
 		return ix.handleRecordCreateGraphFollow(ctx, rec, evt, op)
+	case *bsky.GraphBlock:
+		if err := ix.handleRecordDeleteGraphBlock(ctx, evt, op); err != nil {
+			return err
+		}
+
+		return ix.handleRecordCreateGraphBlock(ctx, rec, evt, op)
 	case *bsky.ActorProfile:
-		log.Infof("TODO: got actor profile record update, need to do something with this")
+		return ix.handleRecordCreateActorProfile(ctx, rec, evt, op)
+	case *bsky.ActorStatus:
+		return ix.handleRecordCreateActorStatus(ctx, rec, evt, op)
+	case *bsky.FeedPostgate:
+		return ix.handleRecordCreateFeedPostgate(ctx, rec, evt, op)
 	default:
+		if h := ix.collectionHandler(op.Collection); h != nil {
+			return h(ctx, evt, op)
+		}
 		return fmt.Errorf("unrecognized record type: %T", rec)
 	}
 
@@ -820,7 +1423,7 @@ func (ix *Indexer) GetPostOrMissing(ctx context.Context, uri string) (*models.Fe
 	}
 
 	var post models.FeedPost
-	if err := ix.db.Find(&post, "rkey = ? AND author = (?)", puri.Rkey, ix.db.Model(models.ActorInfo{}).Where("did = ?", puri.Did).Select("id")).Error; err != nil {
+	if err := ix.db.WithContext(ctx).Find(&post, "rkey = ? AND author = (?)", puri.Rkey, ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("did = ?", puri.Did).Select("id")).Error; err != nil {
 		return nil, err
 	}
 
@@ -851,20 +1454,28 @@ func (ix *Indexer) handleRecordCreateFeedPost(ctx context.Context, user models.U
 		_ = rootref
 	}
 
-	var mentions []*models.ActorInfo
-	for _, e := range rec.Entities {
-		if e.Type == "mention" {
-			ai, err := ix.GetUserOrMissing(ctx, e.Value)
-			if err != nil {
-				return err
-			}
+	var quoteid uint
+	if quri := quotedPostUri(rec); quri != "" {
+		quoted, err := ix.GetPostOrMissing(ctx, quri)
+		if err != nil {
+			return err
+		}
+
+		quoteid = quoted.ID
+	}
 
-			mentions = append(mentions, ai)
+	var mentions []*models.ActorInfo
+	for _, did := range postMentionDids(rec) {
+		ai, err := ix.GetUserOrMissing(ctx, did)
+		if err != nil {
+			return err
 		}
+
+		mentions = append(mentions, ai)
 	}
 
 	var maybe models.FeedPost
-	if err := ix.db.Find(&maybe, "rkey = ? AND author = ?", rkey, user).Error; err != nil {
+	if err := ix.db.WithContext(ctx).Find(&maybe, "rkey = ? AND author = ?", rkey, user).Error; err != nil {
 		return err
 	}
 
@@ -873,24 +1484,60 @@ func (ix *Indexer) handleRecordCreateFeedPost(ctx context.Context, user models.U
 		Cid:     rcid.String(),
 		Author:  user,
 		ReplyTo: replyid,
+		QuoteOf: quoteid,
 	}
 
+	// only count the quote the first time we see this post
+	countQuote := quoteid != 0 && (maybe.ID == 0 || maybe.Missing)
+
 	if maybe.ID != 0 {
 		// we're likely filling in a missing reference
-		if !maybe.Missing {
+		if maybe.Missing {
+			ix.notePlaceholders(-1)
+		} else {
 			// TODO: we've already processed this record creation
 			log.Warnw("potentially erroneous event, duplicate create", "rkey", rkey, "user", user)
 		}
 
-		if err := ix.db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{clause.Column{Name: "rkey"}, clause.Column{Name: "author"}},
-			UpdateAll: true,
+		if err := ix.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns: []clause.Column{clause.Column{Name: "rkey"}, clause.Column{Name: "author"}},
+			// only the record's own columns, the counts were collected
+			// while this was a placeholder and have to be kept
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "cid", "reply_to", "quote_of", "missing", "deleted"}),
 		}).Create(&fp).Error; err != nil {
 			return err
 		}
 
 	} else {
-		if err := ix.db.Create(&fp).Error; err != nil {
+		if err := ix.db.WithContext(ctx).Create(&fp).Error; err != nil {
+			return err
+		}
+	}
+
+	postID := fp.ID
+	if maybe.ID != 0 {
+		postID = maybe.ID
+	}
+
+	if err := ix.setPostLangs(ctx, postID, rec.Langs); err != nil {
+		return err
+	}
+
+	if err := ix.setPostTags(ctx, postID, postTags(rec)); err != nil {
+		return err
+	}
+
+	if countQuote {
+		allowed, err := ix.embedAllowed(ctx, quoteid, postID)
+		if err != nil {
+			return err
+		}
+
+		countQuote = allowed
+	}
+
+	if countQuote {
+		if err := ix.db.WithContext(ctx).Model(models.FeedPost{}).Where("id = ?", quoteid).Update("quote_count", gorm.Expr("quote_count + 1")).Error; err != nil {
 			return err
 		}
 	}
@@ -899,24 +1546,64 @@ func (ix *Indexer) handleRecordCreateFeedPost(ctx context.Context, user models.U
 		return err
 	}
 
+	ix.replayDeferredOps(ctx, user, rkey)
+
 	return nil
 }
 
+// quotedPostUri returns the URI of the post quoted by a record embed (with or
+// without media), or an empty string if the post doesn't quote another post
+func quotedPostUri(rec *bsky.FeedPost) string {
+	if rec.Embed == nil {
+		return ""
+	}
+
+	var ref *comatproto.RepoStrongRef
+	switch {
+	case rec.Embed.EmbedRecord != nil:
+		ref = rec.Embed.EmbedRecord.Record
+	case rec.Embed.EmbedRecordWithMedia != nil && rec.Embed.EmbedRecordWithMedia.Record != nil:
+		ref = rec.Embed.EmbedRecordWithMedia.Record.Record
+	}
+
+	if ref == nil {
+		return ""
+	}
+
+	// record embeds can point at things other than posts (eg, feed generators)
+	puri, err := util.ParseAtUri(ref.Uri)
+	if err != nil || puri.Collection != "app.bsky.feed.post" {
+		return ""
+	}
+
+	return ref.Uri
+}
+
 func (ix *Indexer) createMissingPostRecord(ctx context.Context, puri *util.ParsedUri) (*models.FeedPost, error) {
+	if ix.deferringMissingPosts() {
+		return nil, ix.deferMissingPost(ctx, puri)
+	}
+
 	log.Warn("creating missing post record")
+	if err := ix.allowPlaceholder(ctx, puri); err != nil {
+		return nil, err
+	}
+
 	ai, err := ix.GetUserOrMissing(ctx, puri.Did)
 	if err != nil {
 		return nil, err
 	}
 
 	var fp models.FeedPost
-	if err := ix.db.FirstOrCreate(&fp, models.FeedPost{
+	res := ix.db.WithContext(ctx).FirstOrCreate(&fp, models.FeedPost{
 		Author:  ai.Uid,
 		Rkey:    puri.Rkey,
 		Missing: true,
-	}).Error; err != nil {
-		return nil, err
+	})
+	if res.Error != nil {
+		return nil, res.Error
 	}
+	ix.notePlaceholders(res.RowsAffected)
 
 	return &fp, nil
 }
@@ -929,13 +1616,24 @@ func (ix *Indexer) addNewPostNotification(ctx context.Context, post *bsky.FeedPo
 			return err
 		}
 
-		if err := ix.notifman.AddReplyTo(ctx, fp.Author, fp.ID, replyto); err != nil {
-			return err
+		if !isSelfNotification(fp.Author, replyto.Author) {
+			if err := ix.sendNotification(ctx, notifSource{&models.FeedPost{}, fp.ID}, func(ctx context.Context) error {
+				return ix.notifman.AddReplyTo(ctx, fp.Author, fp.ID, replyto)
+			}); err != nil {
+				return err
+			}
 		}
 	}
 
 	for _, mentioned := range mentions {
-		if err := ix.notifman.AddMention(ctx, fp.Author, fp.ID, mentioned.Uid); err != nil {
+		if isSelfNotification(fp.Author, mentioned.Uid) {
+			continue
+		}
+
+		mentioned := mentioned.Uid
+		if err := ix.sendNotification(ctx, notifSource{&models.FeedPost{}, fp.ID}, func(ctx context.Context) error {
+			return ix.notifman.AddMention(ctx, fp.Author, fp.ID, mentioned)
+		}); err != nil {
 			return err
 		}
 	}
@@ -944,5 +1642,37 @@ func (ix *Indexer) addNewPostNotification(ctx context.Context, post *bsky.FeedPo
 }
 
 func (ix *Indexer) addNewVoteNotification(ctx context.Context, postauthor models.Uid, vr *models.VoteRecord) error {
-	return ix.notifman.AddUpVote(ctx, vr.Voter, vr.Post, vr.ID, postauthor)
+	if isSelfNotification(vr.Voter, postauthor) {
+		return nil
+	}
+
+	return ix.sendNotification(ctx, notifSource{&models.VoteRecord{}, vr.ID}, func(ctx context.Context) error {
+		return ix.notifman.AddUpVote(ctx, vr.Voter, vr.Post, vr.ID, postauthor)
+	})
+}
+
+func (ix *Indexer) addNewRepostNotification(ctx context.Context, postauthor models.Uid, rr *models.RepostRecord) error {
+	if isSelfNotification(rr.Reposter, postauthor) {
+		return nil
+	}
+
+	return ix.sendNotification(ctx, notifSource{&models.RepostRecord{}, rr.ID}, func(ctx context.Context) error {
+		return ix.notifman.AddRepost(ctx, postauthor, rr.ID, rr.Reposter)
+	})
+}
+
+func (ix *Indexer) addNewFollowNotification(ctx context.Context, fr *models.FollowRecord) error {
+	if isSelfNotification(fr.Follower, fr.Target) {
+		return nil
+	}
+
+	return ix.sendNotification(ctx, notifSource{&models.FollowRecord{}, fr.ID}, func(ctx context.Context) error {
+		return ix.notifman.AddFollow(ctx, fr.Follower, fr.Target, fr.ID)
+	})
+}
+
+// isSelfNotification reports whether a notification for recipient would be
+// about an action they took themselves, which we never notify about.
+func isSelfNotification(actor, recipient models.Uid) bool {
+	return actor == recipient
 }
@@ -0,0 +1,117 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// failedOpUsers is how many users the last op that failed to aggregate is
+// kept for.
+const failedOpUsers = 10000
+
+// FailedOp describes a repo op handed to AggregationFailed.
+type FailedOp struct {
+	Collection string    `json:"collection"`
+	Rkey       string    `json:"rkey"`
+	Kind       string    `json:"kind"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failedAt"`
+}
+
+type failedOps struct {
+	count int
+	last  FailedOp
+}
+
+// IndexingStatus sums up what the indexer knows about a repo, for answering
+// whether and how recently it has been indexed.
+type IndexingStatus struct {
+	Did   string `json:"did"`
+	Known bool   `json:"known"`
+
+	Uid       models.Uid `json:"uid,omitempty"`
+	PDS       uint       `json:"pds,omitempty"`
+	TakenDown bool       `json:"takenDown,omitempty"`
+	Rev       string     `json:"rev,omitempty"`
+
+	// Crawl is "queued" or "inProgress" if the repo is up for a crawl
+	Crawl     string        `json:"crawl,omitempty"`
+	LastCrawl *CrawlOutcome `json:"lastCrawl,omitempty"`
+
+	FailedOps    int       `json:"failedOps,omitempty"`
+	LastFailedOp *FailedOp `json:"lastFailedOp,omitempty"`
+}
+
+// aggregationFailed notes the failed op for GetIndexingStatus and hands it
+// to AggregationFailed.
+func (ix *Indexer) aggregationFailed(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp, err error) {
+	ix.failedOpsLk.Lock()
+	fo, ok := ix.failedOps.Get(evt.User)
+	if !ok {
+		fo = &failedOps{}
+		ix.failedOps.Add(evt.User, fo)
+	}
+	fo.count++
+	fo.last = FailedOp{
+		Collection: op.Collection,
+		Rkey:       op.Rkey,
+		Kind:       string(op.Kind),
+		Error:      err.Error(),
+		FailedAt:   ix.Now(),
+	}
+	ix.failedOpsLk.Unlock()
+
+	ix.AggregationFailed(ctx, evt, op, err)
+}
+
+// GetIndexingStatus reports the indexing state of the given repo: whether we
+// know of it, the rev we have, how its crawls are going, and any of its ops
+// that failed to aggregate since startup.
+func (ix *Indexer) GetIndexingStatus(ctx context.Context, did string) (*IndexingStatus, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetIndexingStatus")
+	defer span.End()
+
+	st := &IndexingStatus{Did: did}
+
+	ai, err := ix.LookupUserByDid(ctx, did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return st, nil
+		}
+		return nil, err
+	}
+
+	st.Known = true
+	st.Uid = ai.Uid
+	st.PDS = ai.PDS
+	st.TakenDown = ai.TakenDown
+
+	rev, err := ix.repomgr.GetRepoRev(ctx, ai.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("getting repo rev: %w", err)
+	}
+	st.Rev = rev
+
+	if ix.Crawler != nil {
+		st.Crawl = ix.Crawler.CrawlState(ai.Uid)
+		st.LastCrawl = ix.Crawler.LastCrawl(ai.Uid)
+	}
+
+	ix.failedOpsLk.Lock()
+	if fo, ok := ix.failedOps.Get(ai.Uid); ok {
+		last := fo.last
+		st.FailedOps = fo.count
+		st.LastFailedOp = &last
+	}
+	ix.failedOpsLk.Unlock()
+
+	return st, nil
+}
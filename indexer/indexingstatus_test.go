@@ -0,0 +1,69 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestGetIndexingStatus(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	st, err := ix.GetIndexingStatus(ctx, "did:plc:nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Known {
+		t.Fatal("expected an unknown did not to be known")
+	}
+
+	ai := &models.ActorInfo{Uid: 1, Did: "did:plc:alice", PDS: 1}
+	if err := ix.db.Create(ai).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrawlDispatcher(func(context.Context, *crawlWork) error { return nil }, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix.Crawler = c
+	c.todo[ai.Uid] = &crawlWork{act: ai}
+	c.lastCrawls.Add(ai.Uid, &CrawlOutcome{FinishedAt: time.Now(), Error: "pds unreachable"})
+
+	var handed int
+	ix.AggregationFailed = func(context.Context, *repomgr.RepoEvent, *repomgr.RepoOp, error) {
+		handed++
+	}
+	evt := &repomgr.RepoEvent{User: ai.Uid}
+	for _, rkey := range []string{"a", "b"} {
+		ix.aggregationFailed(ctx, evt, &repomgr.RepoOp{Kind: repomgr.EvtKindCreateRecord, Collection: "app.bsky.feed.post", Rkey: rkey}, fmt.Errorf("boom"))
+	}
+	if handed != 2 {
+		t.Fatalf("expected failed ops to still go to AggregationFailed, got %d", handed)
+	}
+
+	st, err = ix.GetIndexingStatus(ctx, ai.Did)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Known || st.Uid != ai.Uid || st.PDS != 1 || st.Rev != "" {
+		t.Fatalf("unexpected user info: %+v", st)
+	}
+	if st.Crawl != "queued" {
+		t.Fatalf("expected crawl to be queued, got %q", st.Crawl)
+	}
+	if st.LastCrawl == nil || st.LastCrawl.Error != "pds unreachable" {
+		t.Fatalf("expected the last crawl's error, got %+v", st.LastCrawl)
+	}
+	if st.FailedOps != 2 || st.LastFailedOp == nil || st.LastFailedOp.Rkey != "b" || st.LastFailedOp.Error != "boom" {
+		t.Fatalf("expected the failed ops to be reported, got %d %+v", st.FailedOps, st.LastFailedOp)
+	}
+}
@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lagCheckInterval is how often the aggregation lag is compared against the
+// alert threshold.
+const lagCheckInterval = time.Second
+
+type lagMonitor struct {
+	lk        sync.Mutex
+	threshold int64
+	sustain   time.Duration
+	cancel    func()
+
+	behindSince time.Time
+	alerted     bool
+}
+
+// SetAggregationLagAlert warns when the number of repo events received but
+// not yet aggregated stays above threshold for at least sustain, meaning
+// aggregation can't keep up with the firehose. The lag is logged, counted
+// and handed to AggregationLagging, and logged again once it recovers.
+// Zero threshold turns the alert off, which is the default. The lag itself
+// is always exported as a metric.
+func (ix *Indexer) SetAggregationLagAlert(ctx context.Context, threshold int64, sustain time.Duration) {
+	m := &ix.lagMonitor
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.threshold = threshold
+	m.sustain = sustain
+	m.behindSince = time.Time{}
+	m.alerted = false
+
+	if threshold <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+
+	go func() {
+		t := time.NewTicker(lagCheckInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case now := <-t.C:
+				ix.checkAggregationLag(ctx, now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// AggregationLag returns how many repo events have been received but not
+// yet aggregated.
+func (ix *Indexer) AggregationLag() int64 {
+	return ix.eventsReceived.Load() - ix.eventsAggregated.Load()
+}
+
+func (ix *Indexer) noteEventReceived() {
+	aggregationLag.Set(float64(ix.eventsReceived.Add(1) - ix.eventsAggregated.Load()))
+}
+
+func (ix *Indexer) noteEventAggregated() {
+	aggregated := ix.eventsAggregated.Add(1)
+	aggregationLag.Set(float64(ix.eventsReceived.Load() - aggregated))
+}
+
+func (ix *Indexer) checkAggregationLag(ctx context.Context, now time.Time) {
+	m := &ix.lagMonitor
+	lag := ix.AggregationLag()
+
+	m.lk.Lock()
+	if lag <= m.threshold {
+		recovered := m.alerted
+		behindFor := now.Sub(m.behindSince)
+		m.behindSince = time.Time{}
+		m.alerted = false
+		m.lk.Unlock()
+
+		if recovered {
+			log.Infow("aggregation caught up with the firehose", "lag", lag, "behindFor", behindFor)
+		}
+		return
+	}
+
+	if m.behindSince.IsZero() {
+		m.behindSince = now
+	}
+	behindFor := now.Sub(m.behindSince)
+	threshold := m.threshold
+	alert := !m.alerted && behindFor >= m.sustain
+	if alert {
+		m.alerted = true
+	}
+	m.lk.Unlock()
+
+	if alert {
+		aggregationLagAlerts.Inc()
+		log.Warnw("aggregation is falling behind the firehose", "lag", lag, "threshold", threshold, "behindFor", behindFor)
+		ix.AggregationLagging(ctx, lag, behindFor)
+	}
+}
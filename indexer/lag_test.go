@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAggregationLagAlert(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.lagMonitor.threshold = 2
+	ix.lagMonitor.sustain = time.Minute
+
+	var alerts []int64
+	ix.AggregationLagging = func(ctx context.Context, lag int64, behindFor time.Duration) {
+		if behindFor < time.Minute {
+			t.Errorf("alerted after only %s", behindFor)
+		}
+		alerts = append(alerts, lag)
+	}
+
+	for i := 0; i < 5; i++ {
+		ix.noteEventReceived()
+	}
+	ix.noteEventAggregated()
+	if lag := ix.AggregationLag(); lag != 4 {
+		t.Fatalf("expected a lag of 4, got %d", lag)
+	}
+
+	t0 := time.Now()
+	for _, d := range []time.Duration{0, 30 * time.Second, 61 * time.Second, 90 * time.Second} {
+		ix.checkAggregationLag(ctx, t0.Add(d))
+	}
+	if len(alerts) != 1 || alerts[0] != 4 {
+		t.Fatalf("expected a single alert once the lag was sustained, got %v", alerts)
+	}
+
+	// catching up resets the alert
+	for i := 0; i < 3; i++ {
+		ix.noteEventAggregated()
+	}
+	ix.checkAggregationLag(ctx, t0.Add(2*time.Minute))
+
+	for i := 0; i < 3; i++ {
+		ix.noteEventReceived()
+	}
+	ix.checkAggregationLag(ctx, t0.Add(3*time.Minute))
+	if len(alerts) != 1 {
+		t.Fatalf("expected no alert before the new lag was sustained, got %v", alerts)
+	}
+	ix.checkAggregationLag(ctx, t0.Add(5*time.Minute))
+	if len(alerts) != 2 || alerts[1] != 4 {
+		t.Fatalf("expected a second alert, got %v", alerts)
+	}
+}
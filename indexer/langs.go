@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// PostLangUnknown is the language posts that don't declare any (valid)
+// languages are indexed under. It is the BCP-47 tag for "undetermined".
+const PostLangUnknown = "und"
+
+// normalizePostLangs canonicalizes the BCP-47 tags a post declares, dropping
+// malformed tags and duplicates.
+func normalizePostLangs(langs []string) []string {
+	seen := make(map[string]bool, len(langs))
+	out := make([]string, 0, len(langs))
+	for _, l := range langs {
+		tag, err := language.Parse(l)
+		if err != nil {
+			continue
+		}
+
+		s := tag.String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+
+	if len(out) == 0 {
+		return []string{PostLangUnknown}
+	}
+
+	return out
+}
+
+// setPostLangs replaces the indexed languages of the given post.
+func (ix *Indexer) setPostLangs(ctx context.Context, postID uint, langs []string) error {
+	norm := normalizePostLangs(langs)
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post = ?", postID).Delete(&models.PostLang{}).Error; err != nil {
+			return err
+		}
+
+		rows := make([]models.PostLang, 0, len(norm))
+		for _, l := range norm {
+			rows = append(rows, models.PostLang{Post: postID, Lang: l})
+		}
+
+		return tx.Create(&rows).Error
+	})
+}
+
+// GetRecentPosts returns up to limit posts, newest first. If langs is given,
+// only posts in at least one of those languages are returned, where a tag
+// also matches its more specific forms (eg, "en" matches "en-GB"). Pass
+// PostLangUnknown to include posts that declare no language. The returned
+// cursor can be passed back in to fetch the next page, and is empty once
+// there are no more posts.
+func (ix *Indexer) GetRecentPosts(ctx context.Context, langs []string, cursor string, limit int) ([]*models.FeedPost, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetRecentPosts")
+	defer span.End()
+
+	db := ix.reader(ctx)
+
+	q := db.WithContext(ctx).Where("NOT deleted AND NOT missing")
+	if cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where("id < ?", before)
+	}
+
+	if len(langs) > 0 {
+		match := db.Model(&models.PostLang{}).Select("post")
+		var cond *gorm.DB
+		for _, l := range langs {
+			if l != PostLangUnknown {
+				tag, err := language.Parse(l)
+				if err != nil {
+					continue
+				}
+				l = tag.String()
+			}
+
+			c := db.Where("lang = ? OR lang LIKE ?", l, l+"-%")
+			if cond == nil {
+				cond = c
+			} else {
+				cond = cond.Or(c)
+			}
+		}
+		if cond == nil {
+			return nil, "", fmt.Errorf("no valid languages to filter by")
+		}
+
+		q = q.Where("id IN (?)", match.Where(cond))
+	}
+
+	var out []*models.FeedPost
+	if err := q.Order("id desc").Limit(limit).Find(&out).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(out) == limit && limit > 0 {
+		next = strconv.FormatUint(uint64(out[len(out)-1].ID), 10)
+	}
+
+	return out, next, nil
+}
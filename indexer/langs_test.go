@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestNormalizePostLangs(t *testing.T) {
+	cases := []struct {
+		in  []string
+		out []string
+	}{
+		{in: []string{"en"}, out: []string{"en"}},
+		{in: []string{"en-us", "EN-US", "pt-BR"}, out: []string{"en-US", "pt-BR"}},
+		{in: []string{"not a lang!", "ja"}, out: []string{"ja"}},
+		{in: []string{"!!"}, out: []string{PostLangUnknown}},
+		{in: nil, out: []string{PostLangUnknown}},
+	}
+
+	for _, c := range cases {
+		if got := normalizePostLangs(c.in); !reflect.DeepEqual(got, c.out) {
+			t.Errorf("normalizePostLangs(%v) = %v, expected %v", c.in, got, c.out)
+		}
+	}
+}
+
+func TestGetRecentPostsByLang(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for i, langs := range [][]string{{"en"}, {"ja"}, nil, {"en-GB", "ja"}} {
+		fp := models.FeedPost{Author: 1, Rkey: fmt.Sprintf("post%d", i)}
+		if err := ix.db.Create(&fp).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.setPostLangs(ctx, fp.ID, langs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rkeys := func(langs []string) []string {
+		posts, _, err := ix.GetRecentPosts(ctx, langs, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out []string
+		for _, p := range posts {
+			out = append(out, p.Rkey)
+		}
+		return out
+	}
+
+	if got := rkeys([]string{"ja"}); !reflect.DeepEqual(got, []string{"post3", "post1"}) {
+		t.Fatalf("unexpected ja posts: %v", got)
+	}
+	if got := rkeys([]string{"en", PostLangUnknown}); !reflect.DeepEqual(got, []string{"post3", "post2", "post0"}) {
+		t.Fatalf("unexpected en and unknown posts: %v", got)
+	}
+	if got := rkeys([]string{"en-GB"}); !reflect.DeepEqual(got, []string{"post3"}) {
+		t.Fatalf("unexpected en-GB posts: %v", got)
+	}
+	if got := rkeys(nil); len(got) != 4 {
+		t.Fatalf("expected all posts without a filter, got %v", got)
+	}
+
+	page, cursor, err := ix.GetRecentPosts(ctx, nil, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 3 || cursor == "" {
+		t.Fatalf("expected a full first page with a cursor, got %d posts", len(page))
+	}
+
+	page, _, err = ix.GetRecentPosts(ctx, nil, cursor, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Rkey != "post0" {
+		t.Fatalf("expected the oldest post on the second page, got %v", page)
+	}
+}
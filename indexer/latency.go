@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/util"
+)
+
+type crawlKey struct{}
+
+// withCrawl marks ctx as belonging to a crawl job, so events indexed under it
+// are counted as catch-up rather than live.
+func withCrawl(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crawlKey{}, true)
+}
+
+func eventSource(ctx context.Context) string {
+	if v, _ := ctx.Value(crawlKey{}).(bool); v {
+		return "catchup"
+	}
+	return "live"
+}
+
+// observeIndexLatency records how long indexing the ops of evt took since
+// start and, for events from the firehose, how far behind their upstream
+// timestamp we finished.
+func observeIndexLatency(ctx context.Context, evt *repomgr.RepoEvent, start time.Time) {
+	source := eventSource(ctx)
+	repoEventIndexDuration.WithLabelValues(source).Observe(time.Since(start).Seconds())
+
+	if evt.Time == "" {
+		return
+	}
+
+	t, err := util.ParseTimestamp(evt.Time)
+	if err != nil {
+		log.Debugw("failed to parse event time", "uid", evt.User, "time", evt.Time, "err", err)
+		return
+	}
+	firehoseIndexLag.WithLabelValues(source).Observe(time.Since(t).Seconds())
+}
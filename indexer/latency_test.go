@@ -0,0 +1,17 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventSource(t *testing.T) {
+	ctx := context.Background()
+	if s := eventSource(ctx); s != "live" {
+		t.Fatalf("expected live, got %q", s)
+	}
+
+	if s := eventSource(withCrawl(ctx)); s != "catchup" {
+		t.Fatalf("expected catchup, got %q", s)
+	}
+}
@@ -0,0 +1,31 @@
+package indexer
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+// SetRecordLogSampleRate makes the per-record create, update and delete logs
+// only fire for 1 in n records. Records are picked by hashing their path, so
+// all events about a sampled record get logged. Errors are always logged.
+// Values below 2 log every record, which is the default.
+func (ix *Indexer) SetRecordLogSampleRate(n int) {
+	ix.recordLogSampleRate = n
+}
+
+// sampleRecordLog reports whether the record op should be logged under the
+// configured sample rate.
+func (ix *Indexer) sampleRecordLog(evt *repomgr.RepoEvent, op *repomgr.RepoOp) bool {
+	if ix.recordLogSampleRate < 2 {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatUint(uint64(evt.User), 10)))
+	h.Write([]byte(op.Collection))
+	h.Write([]byte(op.Rkey))
+
+	return h.Sum32()%uint32(ix.recordLogSampleRate) == 0
+}
@@ -0,0 +1,37 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestSampleRecordLog(t *testing.T) {
+	ix := &Indexer{}
+	evt := &repomgr.RepoEvent{User: 1}
+
+	op := &repomgr.RepoOp{Collection: "app.bsky.feed.post", Rkey: "aaaa"}
+	if !ix.sampleRecordLog(evt, op) {
+		t.Fatal("expected every record to be logged by default")
+	}
+
+	ix.SetRecordLogSampleRate(10)
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		op := &repomgr.RepoOp{Collection: "app.bsky.feed.post", Rkey: fmt.Sprintf("rkey%d", i)}
+		if ix.sampleRecordLog(evt, op) {
+			sampled++
+
+			// the same record is always picked
+			if !ix.sampleRecordLog(evt, op) {
+				t.Fatalf("sampling of %s is not deterministic", op.Rkey)
+			}
+		}
+	}
+
+	if sampled < 50 || sampled > 150 {
+		t.Fatalf("expected about 100 of 1000 records sampled, got %d", sampled)
+	}
+}
@@ -15,6 +15,11 @@ var externalUserCreationAttempts = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Number of external user creation attempts",
 })
 
+var missingUserCreationsDeduped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_missing_user_creations_deduped",
+	Help: "Number of attempts to create an unknown user that waited on a creation of the same user already in flight",
+})
+
 var userCrawlsEnqueued = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "indexer_user_crawls_enqueued",
 	Help: "Number of user crawls enqueued",
@@ -25,6 +30,51 @@ var reposFetched = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Number of repos fetched",
 }, []string{"status"})
 
+var placeholderPostsCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_placeholder_posts_created",
+	Help: "Number of placeholder posts created for references to posts we haven't seen",
+})
+
+var placeholderPostsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_placeholder_posts_rejected",
+	Help: "Number of placeholder posts not created because of the placeholder limits",
+}, []string{"reason"})
+
+var placeholderPostsCollected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_placeholder_posts_collected",
+	Help: "Number of placeholder posts deleted for not being filled in in time",
+})
+
+var outOfOrderEvents = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_out_of_order_events",
+	Help: "Number of repo events not emitted because a later rev of the same repo already was",
+})
+
+var unknownOpKinds = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_unknown_op_kinds",
+	Help: "Number of repo ops of an unrecognized kind, by kind",
+}, []string{"kind"})
+
+var catchupStaleEventsSkipped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_catchup_stale_events_skipped",
+	Help: "Number of buffered events skipped because their rev was not newer than the repo's",
+})
+
+var catchupRevGaps = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_catchup_rev_gaps",
+	Help: "Number of crawls whose buffered events did not chain on from the repo rev, forcing a resync",
+})
+
+var catchupBufferOverflows = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_catchup_buffer_overflows",
+	Help: "Number of times a repo's buffered catch-up events were dropped in favour of a full resync",
+})
+
+var crawlsCancelled = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_crawls_cancelled",
+	Help: "Number of queued or running user crawls dropped because the user was tombstoned",
+})
+
 var catchupEventsEnqueued = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "indexer_catchup_events_enqueued",
 	Help: "Number of catchup events enqueued",
@@ -34,3 +84,216 @@ var catchupEventsProcessed = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "indexer_catchup_events_processed",
 	Help: "Number of catchup events processed",
 })
+
+var countMismatchesFound = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_count_mismatches_found",
+	Help: "Number of posts found with cached counts not matching their record tables",
+})
+
+var referencesDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_references_deduplicated",
+	Help: "Number of reference crawls skipped because the reference was already pending",
+})
+
+var referencesDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_references_dropped",
+	Help: "Number of reference crawls dropped because the pending batch was full",
+})
+
+var malformedReferenceUris = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_malformed_reference_uris",
+	Help: "Number of malformed AT-URIs referenced by records that were skipped while crawling references",
+}, []string{"kind"})
+
+var referencesSkippedBanned = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_references_skipped_banned",
+	Help: "Number of reference crawls skipped because the referenced user is hosted on a banned domain",
+})
+
+var referencesSkippedOutage = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_references_skipped_resolver_outage",
+	Help: "Number of reference crawls skipped because the DID resolver appeared to be down",
+})
+
+var newUserCrawlsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_new_user_crawls_coalesced",
+	Help: "Number of references to a newly discovered user folded into its already pending crawl",
+})
+
+var recordCidMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_record_cid_mismatches",
+	Help: "Number of records skipped for aggregation because they did not hash to the cid of their op",
+}, []string{"collection"})
+
+var recordValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_record_validation_failures",
+	Help: "Number of records skipped for aggregation because they did not match their lexicon",
+}, []string{"collection"})
+
+var eventDidLookupFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_event_did_lookup_failures",
+	Help: "Number of repo events that could not be emitted because the user's DID lookup failed",
+})
+
+var crawlFanoutDeferred = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_crawl_fanout_deferred",
+	Help: "Number of new users referenced during a crawl deferred to the background because the job hit its fan-out limit",
+})
+
+var crawlSnapshotBuffersEvicted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_crawl_snapshot_buffers_evicted",
+	Help: "Number of crawl jobs whose buffered events were left out of a saved crawl queue to stay under its size cap",
+})
+
+var queryTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_query_timeouts",
+	Help: "Number of indexer database queries that failed because they ran past the query timeout",
+})
+
+var repoEventIndexDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "indexer_repo_event_index_duration_seconds",
+	Help:    "Time taken to index all ops of a repo event",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+}, []string{"source"})
+
+var firehoseIndexLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "indexer_firehose_index_lag_seconds",
+	Help:    "Time between an upstream firehose event being emitted and its ops being indexed",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 18),
+}, []string{"source"})
+
+var catchupExpiredFullFetches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_catchup_expired_full_fetches",
+	Help: "Number of crawls that fetched the repo instead of replaying buffered events because they were older than the max age",
+})
+
+var deferredOpsBuffered = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indexer_deferred_ops_buffered",
+	Help: "Number of records held back until the post they reference is indexed",
+})
+
+var deferredOpsReplayed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_deferred_ops_replayed",
+	Help: "Number of held back records aggregated once the post they reference was indexed",
+})
+
+var deferredOpsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_deferred_ops_dropped",
+	Help: "Number of records referencing unknown posts dropped because too many were already held back",
+})
+
+var deferredOpsExpired = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_deferred_ops_expired",
+	Help: "Number of held back records dropped because the post they reference wasn't indexed in time",
+})
+
+var selfFollowRecords = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_self_follow_records",
+	Help: "Number of follow records seen whose subject is their author",
+})
+
+var bulkDeletedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_bulk_deleted_records",
+	Help: "Number of records deleted in batches from commits with many deletes",
+}, []string{"collection"})
+
+var blockCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_block_cache_hits",
+	Help: "Number of viewer block lookups served from the cache",
+})
+
+var blockCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_block_cache_misses",
+	Help: "Number of viewer block lookups that went to the database",
+})
+
+var aggregationQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indexer_aggregation_queue_depth",
+	Help: "Number of emitted repo events waiting to be aggregated",
+})
+
+var aggregationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_aggregation_failures",
+	Help: "Number of repo ops that failed to aggregate after their event was emitted",
+}, []string{"collection"})
+
+var aggregationRecrawls = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_aggregation_recrawls",
+	Help: "Number of repos queued for a full re-crawl because ops of theirs failed to aggregate after their event was emitted",
+})
+
+var aggregationTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_aggregation_timeouts",
+	Help: "Number of repo ops abandoned for running past their aggregation timeout",
+}, []string{"collection"})
+
+var aggregationLag = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indexer_aggregation_lag_events",
+	Help: "Number of repo events received but not yet aggregated",
+})
+
+var aggregationLagAlerts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_aggregation_lag_alerts",
+	Help: "Number of times aggregation stayed too far behind the firehose for too long",
+})
+
+var brokenRepostChains = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_broken_repost_chains",
+	Help: "Number of reposts of reposts skipped because the inner repost was unknown",
+})
+
+var resolverOutage = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indexer_did_resolver_outage",
+	Help: "1 while the DID resolver appears to be down and user creation is paused",
+})
+
+var resolverOutages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_did_resolver_outages",
+	Help: "Number of times the DID resolver was detected to be down",
+})
+
+var resolverOutageSkippedUsers = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_did_resolver_outage_skipped_users",
+	Help: "Number of user creations skipped because the DID resolver appeared to be down",
+})
+
+var retentionPrunedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_retention_pruned_records",
+	Help: "Number of records deleted for being older than their collection's retention",
+}, []string{"collection"})
+
+var retentionSweepDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "indexer_retention_sweep_duration_seconds",
+	Help:    "Time taken to prune the aged records of a collection",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 16),
+}, []string{"collection"})
+
+var missingPostsBackfilled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_missing_posts_backfilled",
+	Help: "Number of placeholder posts filled in or removed by a backfill of missing posts",
+}, []string{"outcome"})
+
+var notificationQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indexer_notification_queue_depth",
+	Help: "Number of notifications waiting to be written by the notification queue worker",
+})
+
+var notificationQueueBlocked = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_notification_queue_blocked",
+	Help: "Number of times indexing had to wait for room in the full notification queue",
+})
+
+var notificationWriteFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_notification_write_failures",
+	Help: "Number of queued notifications that could not be written, even after retrying",
+})
+
+var queuedNotificationsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_queued_notifications_dropped",
+	Help: "Number of queued notifications dropped because their record was deleted before they were written",
+})
+
+var notificationsSuppressed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indexer_notifications_suppressed",
+	Help: "Number of notifications dropped because they came from a user's initial scrape",
+})
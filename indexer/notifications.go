@@ -0,0 +1,250 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/notifs"
+	"github.com/bluesky-social/indigo/util"
+
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	NotifReasonReply   = "reply"
+	NotifReasonMention = "mention"
+	NotifReasonLike    = "like"
+	NotifReasonRepost  = "repost"
+	NotifReasonFollow  = "follow"
+)
+
+type Notification struct {
+	ID     uint
+	Reason string
+
+	// Actor is the user whose action triggered the notification
+	Actor *models.ActorInfo
+
+	// Uri and Cid identify the record that triggered the notification
+	Uri string
+	Cid string
+
+	// ReasonSubject is the post that was replied to, liked or reposted.
+	// It is empty for mentions and follows.
+	ReasonSubject string
+
+	IsRead    bool
+	IndexedAt time.Time
+}
+
+// GetNotifications returns up to limit notifications for the given user,
+// newest first, and the cursor to fetch the following page with, which is
+// empty once there are no more. Notifications whose underlying records have
+// since been deleted are skipped, so a page may come back short or even
+// empty before the end.
+func (ix *Indexer) GetNotifications(ctx context.Context, uid models.Uid, cursor string, limit int) ([]*Notification, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetNotifications")
+	defer span.End()
+
+	var before uint
+	if cursor != "" {
+		v, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		before = uint(v)
+	}
+
+	lastSeen, err := ix.notifman.GetLastSeen(ctx, uid)
+	if err != nil {
+		return nil, "", fmt.Errorf("getting last seen: %w", err)
+	}
+
+	nrecs, err := ix.notifman.ListNotifRecords(ctx, uid, before, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing notifications: %w", err)
+	}
+
+	out := make([]*Notification, 0, len(nrecs))
+	for _, nrec := range nrecs {
+		n, err := ix.hydrateNotification(ctx, nrec)
+		if err != nil {
+			return nil, "", err
+		}
+		if n == nil {
+			continue
+		}
+
+		n.ID = nrec.ID
+		n.IsRead = !nrec.CreatedAt.After(lastSeen)
+		n.IndexedAt = nrec.CreatedAt
+
+		out = append(out, n)
+	}
+
+	// continue after the last record scanned rather than the last one
+	// returned, so skipped records aren't scanned again
+	var next string
+	if limit > 0 && len(nrecs) >= limit {
+		next = strconv.FormatUint(uint64(nrecs[len(nrecs)-1].ID), 10)
+	}
+
+	return out, next, nil
+}
+
+// GetUnreadNotificationCount returns the number of notifications the user has
+// not yet seen, excluding those triggered by their own actions.
+func (ix *Indexer) GetUnreadNotificationCount(ctx context.Context, uid models.Uid) (int64, error) {
+	return ix.notifman.GetCount(ctx, uid)
+}
+
+// UpdateSeen marks all of the given user's notifications created at or
+// before seen as read.
+func (ix *Indexer) UpdateSeen(ctx context.Context, uid models.Uid, seen time.Time) error {
+	return ix.notifman.UpdateSeen(ctx, uid, seen)
+}
+
+// hydrateNotification resolves the records a notification points at. It
+// returns nil if any of them no longer exist.
+func (ix *Indexer) hydrateNotification(ctx context.Context, nrec *notifs.NotifRecord) (*Notification, error) {
+	actor, err := ix.lookupNotifActor(ctx, nrec.Who)
+	if err != nil || actor == nil {
+		return nil, err
+	}
+
+	switch nrec.Kind {
+	case notifs.NotifKindReply:
+		reply, err := ix.lookupNotifPost(ctx, nrec.Record)
+		if err != nil || reply == nil {
+			return nil, err
+		}
+
+		subj, err := ix.notifPostUri(ctx, nrec.ReplyTo)
+		if err != nil || subj == "" {
+			return nil, err
+		}
+
+		return &Notification{
+			Reason:        NotifReasonReply,
+			Actor:         actor,
+			Uri:           util.BuildAtUri(actor.Did, "app.bsky.feed.post", reply.Rkey),
+			Cid:           reply.Cid,
+			ReasonSubject: subj,
+		}, nil
+	case notifs.NotifKindMention:
+		post, err := ix.lookupNotifPost(ctx, nrec.Record)
+		if err != nil || post == nil {
+			return nil, err
+		}
+
+		return &Notification{
+			Reason: NotifReasonMention,
+			Actor:  actor,
+			Uri:    util.BuildAtUri(actor.Did, "app.bsky.feed.post", post.Rkey),
+			Cid:    post.Cid,
+		}, nil
+	case notifs.NotifKindUpVote:
+		var vote models.VoteRecord
+		if err := ix.reader(ctx).WithContext(ctx).Limit(1).Find(&vote, "id = ?", nrec.Record).Error; err != nil {
+			return nil, err
+		}
+		if vote.ID == 0 {
+			return nil, nil
+		}
+
+		subj, err := ix.notifPostUri(ctx, vote.Post)
+		if err != nil || subj == "" {
+			return nil, err
+		}
+
+		return &Notification{
+			Reason:        NotifReasonLike,
+			Actor:         actor,
+			Uri:           util.BuildAtUri(actor.Did, "app.bsky.feed.like", vote.Rkey),
+			Cid:           vote.Cid,
+			ReasonSubject: subj,
+		}, nil
+	case notifs.NotifKindRepost:
+		var repost models.RepostRecord
+		if err := ix.reader(ctx).WithContext(ctx).Limit(1).Find(&repost, "id = ?", nrec.Record).Error; err != nil {
+			return nil, err
+		}
+		if repost.ID == 0 {
+			return nil, nil
+		}
+
+		subj, err := ix.notifPostUri(ctx, repost.Post)
+		if err != nil || subj == "" {
+			return nil, err
+		}
+
+		return &Notification{
+			Reason:        NotifReasonRepost,
+			Actor:         actor,
+			Uri:           util.BuildAtUri(actor.Did, "app.bsky.feed.repost", repost.Rkey),
+			Cid:           repost.RecCid,
+			ReasonSubject: subj,
+		}, nil
+	case notifs.NotifKindFollow:
+		var frec models.FollowRecord
+		if err := ix.reader(ctx).WithContext(ctx).Limit(1).Find(&frec, "id = ?", nrec.Record).Error; err != nil {
+			return nil, err
+		}
+		if frec.ID == 0 {
+			return nil, nil
+		}
+
+		return &Notification{
+			Reason: NotifReasonFollow,
+			Actor:  actor,
+			Uri:    util.BuildAtUri(actor.Did, "app.bsky.graph.follow", frec.Rkey),
+			Cid:    frec.Cid,
+		}, nil
+	default:
+		log.Warnw("skipping notification of unknown kind", "kind", nrec.Kind, "id", nrec.ID)
+		return nil, nil
+	}
+}
+
+func (ix *Indexer) lookupNotifActor(ctx context.Context, uid models.Uid) (*models.ActorInfo, error) {
+	var ai models.ActorInfo
+	if err := ix.reader(ctx).WithContext(ctx).Limit(1).Find(&ai, "uid = ?", uid).Error; err != nil {
+		return nil, err
+	}
+	if ai.ID == 0 {
+		return nil, nil
+	}
+
+	return &ai, nil
+}
+
+func (ix *Indexer) lookupNotifPost(ctx context.Context, id uint) (*models.FeedPost, error) {
+	var fp models.FeedPost
+	if err := ix.reader(ctx).WithContext(ctx).Limit(1).Find(&fp, "id = ? AND NOT deleted", id).Error; err != nil {
+		return nil, err
+	}
+	if fp.ID == 0 {
+		return nil, nil
+	}
+
+	return &fp, nil
+}
+
+// notifPostUri returns the at:// uri of the given post, or an empty string if
+// it is not known (or was deleted).
+func (ix *Indexer) notifPostUri(ctx context.Context, id uint) (string, error) {
+	fp, err := ix.lookupNotifPost(ctx, id)
+	if err != nil || fp == nil {
+		return "", err
+	}
+
+	author, err := ix.lookupNotifActor(ctx, fp.Author)
+	if err != nil || author == nil {
+		return "", err
+	}
+
+	return util.BuildAtUri(author.Did, "app.bsky.feed.post", fp.Rkey), nil
+}
@@ -0,0 +1,407 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/notifs"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+func TestGetNotifications(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"},
+		{Model: gorm.Model{ID: 2}, Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opUri := "at://did:plc:alice/app.bsky.feed.post/aaaa"
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := &bsky.FeedPost{
+		Text: "nice post",
+		Reply: &bsky.FeedPost_ReplyRef{
+			Parent: &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()},
+			Root:   &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "bbbb", cc, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := ix.GetPost(ctx, opUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vote := &models.VoteRecord{Voter: 2, Post: op.ID, Rkey: "cccc", Cid: cc.String()}
+	if err := ix.db.Create(vote).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.addNewVoteNotification(ctx, 1, vote); err != nil {
+		t.Fatal(err)
+	}
+
+	follow := &models.FollowRecord{Follower: 2, Target: 1, Rkey: "dddd", Cid: cc.String()}
+	if err := ix.db.Create(follow).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.notifman.AddFollow(ctx, 2, 1, follow.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	page, cursor, err := ix.GetNotifications(ctx, 1, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(page))
+	}
+
+	if page[0].Reason != NotifReasonFollow || page[0].Uri != "at://did:plc:bob/app.bsky.graph.follow/dddd" {
+		t.Fatalf("unexpected first notification: %+v", page[0])
+	}
+	if page[1].Reason != NotifReasonLike || page[1].ReasonSubject != opUri {
+		t.Fatalf("unexpected second notification: %+v", page[1])
+	}
+	if page[0].IsRead || page[1].IsRead {
+		t.Fatal("expected notifications to be unread")
+	}
+
+	rest, cursor, err := ix.GetNotifications(ctx, 1, cursor, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 {
+		t.Fatalf("expected 1 notification on second page, got %d", len(rest))
+	}
+	if cursor != "" {
+		t.Fatalf("expected no cursor after the last page, got %q", cursor)
+	}
+	if rest[0].Reason != NotifReasonReply || rest[0].Actor.Did != "did:plc:bob" || rest[0].ReasonSubject != opUri {
+		t.Fatalf("unexpected reply notification: %+v", rest[0])
+	}
+
+	if err := ix.UpdateSeen(ctx, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	all, _, err := ix.GetNotifications(ctx, 1, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range all {
+		if !n.IsRead {
+			t.Fatalf("expected notification %d to be read", n.ID)
+		}
+	}
+
+	// a page of only deleted records still moves the cursor along
+	if err := ix.db.Delete(follow).Error; err != nil {
+		t.Fatal(err)
+	}
+	page, cursor, err = ix.GetNotifications(ctx, 1, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 0 || cursor == "" {
+		t.Fatalf("expected an empty page with a cursor, got %d notifications and cursor %q", len(page), cursor)
+	}
+	page, _, err = ix.GetNotifications(ctx, 1, cursor, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Reason != NotifReasonLike {
+		t.Fatalf("expected the like after the deleted follow, got %+v", page)
+	}
+}
+
+func TestUnreadNotificationCount(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	count := func() int64 {
+		t.Helper()
+		c, err := ix.GetUnreadNotificationCount(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if c := count(); c != 0 {
+		t.Fatalf("expected no unread notifications, got %d", c)
+	}
+
+	if err := ix.notifman.AddFollow(ctx, 2, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	// notifications caused by the user themselves are never counted
+	if err := ix.notifman.AddUpVote(ctx, 1, 1, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := count(); c != 1 {
+		t.Fatalf("expected 1 unread notification, got %d", c)
+	}
+
+	if err := ix.UpdateSeen(ctx, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if c := count(); c != 0 {
+		t.Fatalf("expected no unread notifications after update seen, got %d", c)
+	}
+
+	if err := ix.notifman.AddFollow(ctx, 3, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if c := count(); c != 1 {
+		t.Fatalf("expected 1 unread notification, got %d", c)
+	}
+}
+
+func TestNoSelfNotifications(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opUri := "at://did:plc:alice/app.bsky.feed.post/aaaa"
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// self-reply
+	reply := &bsky.FeedPost{
+		Text: "replying to myself",
+		Reply: &bsky.FeedPost_ReplyRef{
+			Parent: &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()},
+			Root:   &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "bbbb", cc, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1}
+
+	// self-like
+	like := &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()}}
+	if err := ix.handleRecordCreateFeedLike(ctx, like, evt, &repomgr.RepoOp{Rkey: "cccc", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	// self-follow
+	follow := &bsky.GraphFollow{Subject: "did:plc:alice"}
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, &repomgr.RepoOp{Rkey: "dddd", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := ix.db.Model(&notifs.NotifRecord{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no notifications for self actions, got %d", count)
+	}
+}
+
+func TestReplayedFollowIsIdempotent(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := &bsky.GraphFollow{Subject: "did:plc:bob"}
+	evt := &repomgr.RepoEvent{User: 1}
+	for i := 0; i < 2; i++ {
+		if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var follows int64
+	if err := ix.db.Model(&models.FollowRecord{}).Where("follower = ? AND rkey = ?", 1, "ffff").Count(&follows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if follows != 1 {
+		t.Fatalf("expected a single follow record, got %d", follows)
+	}
+
+	var notifCount int64
+	if err := ix.db.Model(&notifs.NotifRecord{}).Count(&notifCount).Error; err != nil {
+		t.Fatal(err)
+	}
+	if notifCount != 1 {
+		t.Fatalf("expected one follow notification, got %d", notifCount)
+	}
+
+	bob, err := ix.LookupUser(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Followers != 1 {
+		t.Fatalf("expected follower count of 1, got %d", bob.Followers)
+	}
+
+	// a deleted follow frees its rkey up again
+	if err := ix.handleRecordDeleteGraphFollow(ctx, evt, &repomgr.RepoOp{Rkey: "ffff"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err = ix.LookupUser(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Followers != 1 {
+		t.Fatalf("expected follower count of 1 after refollowing, got %d", bob.Followers)
+	}
+}
+
+func TestNotificationQueue(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+		{Uid: 3, Did: "did:plc:carol"},
+		{Uid: 4, Did: "did:plc:dave"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := &bsky.GraphFollow{Subject: "did:plc:alice"}
+
+	ix.SetNotificationQueueSize(ctx, 1)
+	for _, follower := range []models.Uid{2, 3} {
+		if err := ix.handleRecordCreateGraphFollow(ctx, follow, &repomgr.RepoEvent{User: follower}, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// notifications from an initial scrape are dropped when suppressed
+	ix.SetInitialScrapeNotifications(InitialScrapeSuppress)
+	if err := ix.handleRecordCreateGraphFollow(withInitScrape(ctx), follow, &repomgr.RepoEvent{User: 4}, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	// switching the queue off flushes it
+	ix.SetNotificationQueueSize(ctx, 0)
+
+	var count int64
+	if err := ix.db.Model(&notifs.NotifRecord{}).Where("\"for\" = ?", 1).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 follow notifications, got %d", count)
+	}
+}
+
+func TestQueuedNotificationDroppedOnDelete(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hold the notification in the queue until the follow is deleted
+	ix.notifQueue = newNotifQueue(10)
+
+	follow := &bsky.GraphFollow{Subject: "did:plc:alice"}
+	evt := &repomgr.RepoEvent{User: 2}
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordDeleteGraphFollow(ctx, evt, &repomgr.RepoOp{Rkey: "ffff"}); err != nil {
+		t.Fatal(err)
+	}
+
+	go ix.notifQueue.run(ctx)
+	ix.SetNotificationQueueSize(ctx, 0)
+
+	var count int64
+	if err := ix.db.Model(&notifs.NotifRecord{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no notification for the deleted follow, got %d", count)
+	}
+}
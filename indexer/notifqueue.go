@@ -0,0 +1,195 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+type InitialScrapeNotifications int
+
+const (
+	// InitialScrapeNotify creates notifications for records found while
+	// indexing a user's repo for the first time, same as for any other
+	// record. This is the default.
+	InitialScrapeNotify InitialScrapeNotifications = iota
+
+	// InitialScrapeSuppress drops notifications for records found during a
+	// user's initial scrape, which are mostly old and would otherwise flood
+	// the notification queue during big backfills.
+	InitialScrapeSuppress
+)
+
+// SetInitialScrapeNotifications configures whether indexing a newly crawled
+// repo creates notifications.
+func (ix *Indexer) SetInitialScrapeNotifications(p InitialScrapeNotifications) {
+	ix.initScrapeNotifs = p
+}
+
+// SetNotificationQueueSize routes new notifications through a queue of up to
+// size entries that a background worker writes to the notification manager.
+// Once the queue is full, indexing blocks until the worker catches up, so a
+// backlog slows the indexer down rather than growing without bound. Zero
+// writes notifications inline, which is the default.
+func (ix *Indexer) SetNotificationQueueSize(ctx context.Context, size int) {
+	if ix.notifQueue != nil {
+		ix.notifQueue.stop()
+		ix.notifQueue = nil
+	}
+
+	if size > 0 {
+		ix.notifQueue = newNotifQueue(size)
+		go ix.notifQueue.run(ctx)
+	}
+}
+
+type initScrapeKey struct{}
+
+func withInitScrape(ctx context.Context) context.Context {
+	return context.WithValue(ctx, initScrapeKey{}, true)
+}
+
+func isInitScrape(ctx context.Context) bool {
+	v, _ := ctx.Value(initScrapeKey{}).(bool)
+	return v
+}
+
+// notifSource is the record a notification is about, e.g. the follow or the
+// reply.
+type notifSource struct {
+	model any
+	id    uint
+}
+
+// sendNotification hands a notification write to the queue if there is one
+// and performs it inline otherwise.
+func (ix *Indexer) sendNotification(ctx context.Context, src notifSource, add func(context.Context) error) error {
+	if ix.initScrapeNotifs == InitialScrapeSuppress && isInitScrape(ctx) {
+		notificationsSuppressed.Inc()
+		return nil
+	}
+
+	if ix.notifQueue == nil {
+		return add(ctx)
+	}
+
+	// the record may be deleted while the notification waits in the queue,
+	// in which case it must not be written after the fact
+	return ix.notifQueue.push(ctx, func(ctx context.Context) error {
+		live, err := ix.notifSourceLive(ctx, src)
+		if err != nil {
+			return err
+		}
+		if !live {
+			queuedNotificationsDropped.Inc()
+			return nil
+		}
+
+		return add(ctx)
+	})
+}
+
+func (ix *Indexer) notifSourceLive(ctx context.Context, src notifSource) (bool, error) {
+	q := ix.db.WithContext(ctx).Model(src.model).Where("id = ?", src.id)
+	if _, ok := src.model.(*models.FeedPost); ok {
+		// posts are only marked deleted
+		q = q.Where("NOT deleted")
+	}
+
+	var n int64
+	if err := q.Count(&n).Error; err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+type notifQueue struct {
+	ch   chan func(context.Context) error
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newNotifQueue(size int) *notifQueue {
+	q := &notifQueue{
+		ch:   make(chan func(context.Context) error, size),
+		quit: make(chan struct{}),
+	}
+	q.wg.Add(1)
+	return q
+}
+
+func (q *notifQueue) push(ctx context.Context, add func(context.Context) error) error {
+	select {
+	case q.ch <- add:
+		notificationQueueDepth.Set(float64(len(q.ch)))
+		return nil
+	default:
+	}
+
+	notificationQueueBlocked.Inc()
+
+	select {
+	case q.ch <- add:
+		notificationQueueDepth.Set(float64(len(q.ch)))
+		return nil
+	case <-q.quit:
+		// the queue is going away, so write it ourselves
+		return add(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *notifQueue) run(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case add := <-q.ch:
+			q.write(ctx, add)
+		case <-q.quit:
+			// flush whatever was already queued before exiting
+			for {
+				select {
+				case add := <-q.ch:
+					q.write(ctx, add)
+				default:
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+const (
+	notifWriteAttempts = 4
+	notifWriteBackoff  = 50 * time.Millisecond
+)
+
+// write performs a queued notification write, retrying it since it runs
+// alongside the indexer's own writes and may fail to get the database (e.g.
+// a locked sqlite file) where an inline write would not have.
+func (q *notifQueue) write(ctx context.Context, add func(context.Context) error) {
+	notificationQueueDepth.Set(float64(len(q.ch)))
+
+	err := add(ctx)
+	for i := 1; err != nil && i < notifWriteAttempts && ctx.Err() == nil; i++ {
+		time.Sleep(notifWriteBackoff << (i - 1))
+		err = add(ctx)
+	}
+
+	if err != nil {
+		notificationWriteFailures.Inc()
+		log.Errorw("failed to write queued notification", "err", err)
+	}
+}
+
+// stop waits for the queued notifications to be written.
+func (q *notifQueue) stop() {
+	close(q.quit)
+	q.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"sync"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+// repoGate serializes the handling of events for a single repo, so that
+// they are emitted strictly in rev order even if they reach
+// HandleRepoEvent concurrently, e.g. a live event overlapping catch-up.
+type repoGate struct {
+	lk sync.Mutex
+
+	// guarded by lk
+	lastRev string
+
+	// number of HandleRepoEvent calls holding or waiting on the gate,
+	// guarded by Indexer.repoGatesLk
+	refs int
+}
+
+// SetOrderedRepoEvents enables serializing event handling per repo. Events
+// for different repos are still handled in parallel.
+func (ix *Indexer) SetOrderedRepoEvents(v bool) {
+	ix.repoGatesLk.Lock()
+	defer ix.repoGatesLk.Unlock()
+
+	ix.orderedRepoEvents = v
+	if v && ix.repoGates == nil {
+		ix.repoGates = make(map[models.Uid]*repoGate)
+	}
+}
+
+// acquireRepoGate blocks until no other event for the user is being
+// handled. It returns nil if ordering is disabled.
+func (ix *Indexer) acquireRepoGate(uid models.Uid) *repoGate {
+	ix.repoGatesLk.Lock()
+	if !ix.orderedRepoEvents {
+		ix.repoGatesLk.Unlock()
+		return nil
+	}
+
+	g, ok := ix.repoGates[uid]
+	if !ok {
+		g = &repoGate{}
+		ix.repoGates[uid] = g
+	}
+	g.refs++
+	ix.repoGatesLk.Unlock()
+
+	g.lk.Lock()
+	return g
+}
+
+func (ix *Indexer) releaseRepoGate(uid models.Uid, g *repoGate) {
+	if g == nil {
+		return
+	}
+
+	g.lk.Unlock()
+
+	ix.repoGatesLk.Lock()
+	defer ix.repoGatesLk.Unlock()
+
+	g.refs--
+	if g.refs == 0 {
+		delete(ix.repoGates, uid)
+	}
+}
+
+// stale reports whether an event at rev would go out after a later one for
+// the same repo. Only events that overlapped while holding the gate are
+// compared, as the gate is forgotten once nobody holds it.
+func (g *repoGate) stale(rev string) bool {
+	if g == nil || rev == "" {
+		return false
+	}
+
+	return g.lastRev != "" && rev <= g.lastRev
+}
+
+func (g *repoGate) emitted(rev string) {
+	if g == nil || rev == "" {
+		return
+	}
+
+	g.lastRev = rev
+}
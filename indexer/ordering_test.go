@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestOrderedRepoEventsSkipsStale(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetOrderedRepoEvents(true)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend a later rev is being emitted while an older one arrives
+	gate := ix.acquireRepoGate(1)
+
+	done := make(chan error)
+	go func() {
+		done <- ix.HandleRepoEvent(ctx, &repomgr.RepoEvent{User: 1, NewRoot: root, Rev: "3kaaaaaaaaaa2", Ops: []repomgr.RepoOp{{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.feed.post",
+			Rkey:       "aaaa",
+			RecCid:     &root,
+			Record:     &bsky.FeedPost{Text: "stale"},
+		}}})
+	}()
+
+	for {
+		ix.repoGatesLk.Lock()
+		refs := gate.refs
+		ix.repoGatesLk.Unlock()
+		if refs == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	gate.emitted("3kaaaaaaaaaa3")
+	ix.releaseRepoGate(1, gate)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var posts int64
+	if err := ix.db.Model(&models.FeedPost{}).Count(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if posts != 0 {
+		t.Fatalf("expected the stale event's records not to be aggregated, got %d posts", posts)
+	}
+	if lag := ix.AggregationLag(); lag != 0 {
+		t.Fatalf("expected the stale event not to count as lagging, got %d", lag)
+	}
+
+	if err := ix.HandleRepoEvent(ctx, &repomgr.RepoEvent{User: 1, NewRoot: root, Rev: "3kaaaaaaaaaa4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	since := int64(0)
+	evts, cancel, err := ix.events.Subscribe(ctx, "test", nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	select {
+	case evt := <-evts:
+		if evt.RepoCommit == nil || evt.RepoCommit.Rev != "3kaaaaaaaaaa4" {
+			t.Fatalf("expected only the newer commit to be emitted, got %+v", evt)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for event")
+	}
+
+	select {
+	case evt := <-evts:
+		t.Fatalf("unexpected extra event: %+v", evt)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ix.repoGatesLk.Lock()
+	defer ix.repoGatesLk.Unlock()
+	if len(ix.repoGates) != 0 {
+		t.Fatalf("expected gates to be released, have %d", len(ix.repoGates))
+	}
+}
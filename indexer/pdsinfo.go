@@ -0,0 +1,169 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+// pdsInfoTimeout bounds each request made while refreshing a PDS's info.
+const pdsInfoTimeout = 10 * time.Second
+
+// SetPDSInfoMaxAge makes crawls refresh the software and version recorded
+// for their PDS once it is older than maxAge. The refresh happens in the
+// background and never holds up the crawl. Zero leaves the recorded info
+// alone, which is the default.
+func (ix *Indexer) SetPDSInfoMaxAge(maxAge time.Duration) {
+	ix.pdsInfoLk.Lock()
+	defer ix.pdsInfoLk.Unlock()
+
+	ix.pdsInfoMaxAge = maxAge
+}
+
+// maybeRefreshPDSInfo starts a background refresh of the PDS's info if it is
+// stale and one isn't already running.
+func (ix *Indexer) maybeRefreshPDSInfo(pds *models.PDS) {
+	ix.pdsInfoLk.Lock()
+	defer ix.pdsInfoLk.Unlock()
+
+	if ix.pdsInfoMaxAge <= 0 || ix.Now().Sub(pds.InfoUpdatedAt) < ix.pdsInfoMaxAge {
+		return
+	}
+
+	if ix.pdsInfoRefreshing == nil {
+		ix.pdsInfoRefreshing = make(map[uint]bool)
+	}
+	if ix.pdsInfoRefreshing[pds.ID] {
+		return
+	}
+	ix.pdsInfoRefreshing[pds.ID] = true
+
+	host := *pds
+	go func() {
+		defer func() {
+			ix.pdsInfoLk.Lock()
+			delete(ix.pdsInfoRefreshing, host.ID)
+			ix.pdsInfoLk.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*pdsInfoTimeout)
+		defer cancel()
+
+		if err := ix.RefreshPDSInfo(ctx, &host); err != nil {
+			log.Warnw("failed to refresh pds info", "pds", host.Host, "err", err)
+		}
+	}()
+}
+
+// RefreshPDSInfo asks the PDS what software and version it runs and records
+// the answer on its row. The software comes from the Server header of its
+// describeServer response, given as "name/version" or just a name. The
+// version comes from a "version" field in the describeServer body if the
+// header doesn't carry one, and failing that from the _health endpoint,
+// which is where the reference PDS reports it. Either may end up empty.
+//
+// A failed refresh still records when it was tried, so that a PDS that's down
+// isn't asked again on every crawl until its info is stale once more.
+func (ix *Indexer) RefreshPDSInfo(ctx context.Context, pds *models.PDS) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "RefreshPDSInfo")
+	defer span.End()
+
+	base := models.ClientForPds(pds).Host
+	client := &http.Client{Timeout: pdsInfoTimeout}
+
+	var software, version string
+
+	header, body, err := getPDSInfo(ctx, client, base+"/xrpc/com.atproto.server.describeServer")
+	if err != nil {
+		now := ix.Now()
+		if uerr := ix.db.WithContext(ctx).Model(&models.PDS{}).Where("id = ?", pds.ID).Update("info_updated_at", now).Error; uerr != nil {
+			log.Warnw("failed to record pds info refresh attempt", "pds", pds.Host, "err", uerr)
+		} else {
+			pds.InfoUpdatedAt = now
+		}
+
+		return fmt.Errorf("describing server: %w", err)
+	}
+
+	if server := header.Get("Server"); server != "" {
+		software, version, _ = strings.Cut(server, "/")
+		// anything past the product token is a comment
+		version, _, _ = strings.Cut(version, " ")
+	}
+	if version == "" {
+		version = body.Version
+	}
+	if version == "" {
+		if _, health, err := getPDSInfo(ctx, client, base+"/xrpc/_health"); err == nil {
+			version = health.Version
+		}
+	}
+
+	now := ix.Now()
+	if err := ix.db.WithContext(ctx).Model(&models.PDS{}).Where("id = ?", pds.ID).Updates(map[string]any{
+		"software":        software,
+		"version":         version,
+		"info_updated_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	pds.Software = software
+	pds.Version = version
+	pds.InfoUpdatedAt = now
+
+	return nil
+}
+
+type pdsInfoBody struct {
+	Version string `json:"version"`
+}
+
+func getPDSInfo(ctx context.Context, client *http.Client, url string) (http.Header, *pdsInfoBody, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body pdsInfoBody
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return resp.Header, &body, nil
+}
+
+// ListPDSesBySoftware returns the PDSes known to run the given software,
+// ignoring case, optionally narrowed to versions starting with
+// versionPrefix. An empty software matches hosts we have no info for.
+func (ix *Indexer) ListPDSesBySoftware(ctx context.Context, software, versionPrefix string) ([]*models.PDS, error) {
+	q := ix.db.WithContext(ctx).Model(&models.PDS{}).Where("LOWER(COALESCE(software, '')) = ?", strings.ToLower(software))
+	if versionPrefix != "" {
+		q = q.Where(`version LIKE ? ESCAPE '\'`, likeEscaper.Replace(versionPrefix)+"%")
+	}
+
+	var out []*models.PDS
+	if err := q.Order("id").Find(&out).Error; err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
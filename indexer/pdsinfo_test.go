@@ -0,0 +1,128 @@
+package indexer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestRefreshPDSInfo(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// reports its version in the Server header
+	headered := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "goat-pds/0.3.1 (linux)")
+		w.Write([]byte(`{"did":"did:web:example.com","availableUserDomains":[]}`))
+	}))
+	defer headered.Close()
+
+	// only reports its version from _health
+	healthed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "goat-pds")
+		if r.URL.Path == "/xrpc/_health" {
+			w.Write([]byte(`{"version":"0.2.9"}`))
+			return
+		}
+		w.Write([]byte(`{"did":"did:web:example.com","availableUserDomains":[]}`))
+	}))
+	defer healthed.Close()
+
+	for _, srv := range []*httptest.Server{headered, healthed} {
+		pds := &models.PDS{Host: strings.TrimPrefix(srv.URL, "http://")}
+		if err := ix.db.Create(pds).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.RefreshPDSInfo(ctx, pds); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ix.db.Create(&models.PDS{Host: "unknown.example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := ix.ListPDSesBySoftware(ctx, "GOAT-PDS", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Version != "0.3.1" || all[1].Version != "0.2.9" {
+		t.Fatalf("unexpected pds info: %+v", all)
+	}
+
+	old, err := ix.ListPDSesBySoftware(ctx, "goat-pds", "0.2.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old) != 1 || old[0].Host != strings.TrimPrefix(healthed.URL, "http://") {
+		t.Fatalf("expected only the older pds, got %+v", old)
+	}
+
+	unknown, err := ix.ListPDSesBySoftware(ctx, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknown) != 1 || unknown[0].Host != "unknown.example.com" {
+		t.Fatalf("expected only the pds without info, got %+v", unknown)
+	}
+}
+
+func TestRefreshPDSInfoFailureBacksOff(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ix.Now = func() time.Time { return now }
+	ix.SetPDSInfoMaxAge(time.Hour)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	pds := &models.PDS{Host: strings.TrimPrefix(down.URL, "http://"), Software: "goat-pds", Version: "0.3.1"}
+	if err := ix.db.Create(pds).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.RefreshPDSInfo(ctx, pds); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+
+	var got models.PDS
+	if err := ix.db.First(&got, pds.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !got.InfoUpdatedAt.Equal(now) {
+		t.Fatalf("expected the failed attempt to be recorded, got %s", got.InfoUpdatedAt)
+	}
+	if got.Software != "goat-pds" || got.Version != "0.3.1" {
+		t.Fatalf("expected the last known info to be kept, got %q %q", got.Software, got.Version)
+	}
+
+	// not stale yet, so the next crawl leaves it be
+	ix.maybeRefreshPDSInfo(&got)
+	ix.pdsInfoLk.Lock()
+	refreshing := ix.pdsInfoRefreshing[pds.ID]
+	ix.pdsInfoLk.Unlock()
+	if refreshing {
+		t.Fatal("expected no refresh right after a failed one")
+	}
+}
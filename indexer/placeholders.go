@@ -0,0 +1,197 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/time/rate"
+)
+
+// ErrPlaceholderLimit is returned when a record references an unknown post
+// and creating a placeholder for it would exceed the configured limits.
+var ErrPlaceholderLimit = errors.New("placeholder post limit reached")
+
+// placeholderGCInterval is how often SetPlaceholderGC looks for expired
+// placeholders.
+const placeholderGCInterval = 10 * time.Minute
+
+// placeholderChunk caps how many placeholders a single delete touches.
+const placeholderChunk = 500
+
+type placeholderSourceKey struct{}
+
+// withPlaceholderSource records which repo's event is being handled, so
+// placeholders it causes are charged to that repo.
+func withPlaceholderSource(ctx context.Context, uid models.Uid) context.Context {
+	return context.WithValue(ctx, placeholderSourceKey{}, uid)
+}
+
+func placeholderSourceFrom(ctx context.Context) (models.Uid, bool) {
+	uid, ok := ctx.Value(placeholderSourceKey{}).(models.Uid)
+	return uid, ok
+}
+
+// SetPlaceholderLimits bounds the placeholder posts created for references
+// to posts we haven't seen. perRepo caps how fast a single repo's records
+// may create them (zero for no limit), and maxOutstanding caps how many may
+// be waiting to be filled in at once (zero for no cap).
+func (ix *Indexer) SetPlaceholderLimits(perRepo rate.Limit, maxOutstanding int64) error {
+	ix.placeholderLk.Lock()
+	defer ix.placeholderLk.Unlock()
+
+	ix.placeholderRate = perRepo
+	ix.placeholderLimiters = nil
+	if perRepo > 0 {
+		lims, err := lru.New[models.Uid, *rate.Limiter](10_000)
+		if err != nil {
+			return err
+		}
+		ix.placeholderLimiters = lims
+	}
+
+	ix.placeholderMax = maxOutstanding
+	if maxOutstanding > 0 {
+		var n int64
+		if err := ix.db.Model(&models.FeedPost{}).Where("missing").Count(&n).Error; err != nil {
+			return fmt.Errorf("counting placeholder posts: %w", err)
+		}
+		ix.placeholderCount = n
+	}
+
+	return nil
+}
+
+// SetPlaceholderGC periodically deletes placeholder posts that haven't been
+// filled in within maxAge of being created, until ctx is cancelled.
+// Placeholders that likes, reposts, replies or quotes point at are kept.
+func (ix *Indexer) SetPlaceholderGC(ctx context.Context, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+
+	go func() {
+		t := time.NewTicker(placeholderGCInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				if _, err := ix.gcPlaceholders(ctx, maxAge); err != nil {
+					log.Errorw("failed to delete expired placeholder posts", "err", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (ix *Indexer) gcPlaceholders(ctx context.Context, maxAge time.Duration) (int64, error) {
+	cutoff := ix.Now().Add(-maxAge)
+
+	var total int64
+	var last uint
+	for {
+		var ids []uint
+		if err := ix.db.WithContext(ctx).Model(&models.FeedPost{}).
+			Where("missing AND created_at < ? AND id > ?", cutoff, last).
+			Order("id").Limit(placeholderChunk).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		last = ids[len(ids)-1]
+
+		n, err := ix.deletePlaceholders(ctx, ids)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		placeholderPostsCollected.Add(float64(n))
+	}
+
+	return total, nil
+}
+
+// deletePlaceholders deletes those of the given placeholder posts that no
+// like, repost or other post points at, and returns how many it deleted.
+// Referenced placeholders are kept, deleting them would leave the records
+// pointing at them dangling.
+func (ix *Indexer) deletePlaceholders(ctx context.Context, ids []uint) (int64, error) {
+	var total int64
+	for len(ids) > 0 {
+		chunk := ids[:min(len(ids), placeholderChunk)]
+		ids = ids[len(chunk):]
+
+		res := ix.db.WithContext(ctx).Unscoped().
+			Where("id IN ? AND missing", chunk).
+			Where("NOT EXISTS (SELECT 1 FROM vote_records WHERE vote_records.post = feed_posts.id)").
+			Where("NOT EXISTS (SELECT 1 FROM repost_records WHERE repost_records.post = feed_posts.id)").
+			Where("NOT EXISTS (SELECT 1 FROM feed_posts AS ref WHERE ref.reply_to = feed_posts.id OR ref.quote_of = feed_posts.id)").
+			Delete(&models.FeedPost{})
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+
+	ix.placeholderLk.Lock()
+	ix.placeholderCount -= total
+	if ix.placeholderCount < 0 {
+		ix.placeholderCount = 0
+	}
+	ix.placeholderLk.Unlock()
+
+	return total, nil
+}
+
+// allowPlaceholder checks the placeholder limits before one is created.
+func (ix *Indexer) allowPlaceholder(ctx context.Context, puri *util.ParsedUri) error {
+	ix.placeholderLk.Lock()
+	defer ix.placeholderLk.Unlock()
+
+	if ix.placeholderMax > 0 && ix.placeholderCount >= ix.placeholderMax {
+		placeholderPostsRejected.WithLabelValues("cap").Inc()
+		return fmt.Errorf("%w: %d outstanding (referencing %s)", ErrPlaceholderLimit, ix.placeholderCount, puri.Did)
+	}
+
+	if ix.placeholderLimiters != nil {
+		if src, ok := placeholderSourceFrom(ctx); ok {
+			lim, ok := ix.placeholderLimiters.Get(src)
+			if !ok {
+				lim = rate.NewLimiter(ix.placeholderRate, int(ix.placeholderRate)+1)
+				ix.placeholderLimiters.Add(src, lim)
+			}
+
+			if !lim.Allow() {
+				placeholderPostsRejected.WithLabelValues("rate").Inc()
+				return fmt.Errorf("%w: repo %d is creating them too quickly", ErrPlaceholderLimit, src)
+			}
+		}
+	}
+
+	return nil
+}
+
+// notePlaceholders adjusts the outstanding placeholder count as they are
+// created (n > 0) or filled in (n < 0).
+func (ix *Indexer) notePlaceholders(n int64) {
+	if n > 0 {
+		placeholderPostsCreated.Add(float64(n))
+	}
+
+	ix.placeholderLk.Lock()
+	defer ix.placeholderLk.Unlock()
+
+	ix.placeholderCount += n
+	if ix.placeholderCount < 0 {
+		ix.placeholderCount = 0
+	}
+}
@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/gorm"
+)
+
+func TestPlaceholderLimits(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	if err := ix.db.Create(&models.ActorInfo{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.SetPlaceholderLimits(0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, rkey := range []string{"3kaaaaaaaaaa1", "3kaaaaaaaaaa2"} {
+		if _, err := ix.GetPostOrMissing(ctx, "at://did:plc:alice/app.bsky.feed.post/"+rkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// looking up an existing placeholder doesn't count against the cap
+	if _, err := ix.GetPostOrMissing(ctx, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ix.GetPostOrMissing(ctx, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa3")
+	if !errors.Is(err, ErrPlaceholderLimit) {
+		t.Fatalf("expected placeholder cap to be hit, got %v", err)
+	}
+
+	// expire everything and the cap frees up again
+	ix.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	n, err := ix.gcPlaceholders(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 placeholders collected, got %d", n)
+	}
+
+	if _, err := ix.GetPostOrMissing(ctx, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa3"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlaceholderRateLimitPerRepo(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	if err := ix.db.Create(&models.ActorInfo{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.SetPlaceholderLimits(0.001, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	spammer := withPlaceholderSource(context.Background(), 5)
+	if _, err := ix.GetPostOrMissing(spammer, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.GetPostOrMissing(spammer, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa2"); !errors.Is(err, ErrPlaceholderLimit) {
+		t.Fatalf("expected per repo limit to be hit, got %v", err)
+	}
+
+	// other repos have their own budget
+	other := withPlaceholderSource(context.Background(), 6)
+	if _, err := ix.GetPostOrMissing(other, "at://did:plc:alice/app.bsky.feed.post/3kaaaaaaaaaa2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlaceholderGCKeepsReferenced(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	if err := ix.db.Create(&models.ActorInfo{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint
+	for _, rkey := range []string{"3kaaaaaaaaaa1", "3kaaaaaaaaaa2", "3kaaaaaaaaaa3", "3kaaaaaaaaaa4"} {
+		fp, err := ix.GetPostOrMissing(ctx, "at://did:plc:alice/app.bsky.feed.post/"+rkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, fp.ID)
+	}
+
+	// a like, a repost and a reply point at three of them
+	if err := ix.db.Create(&models.VoteRecord{Voter: 1, Post: ids[0], Rkey: "l1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.RepostRecord{Reposter: 1, Post: ids[1], Rkey: "r1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.FeedPost{Author: 1, Rkey: "3kaaaaaaaaaa5", ReplyTo: ids[2]}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ix.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	n, err := ix.gcPlaceholders(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected only the unreferenced placeholder to be collected, got %d", n)
+	}
+
+	var left int64
+	if err := ix.db.Model(&models.FeedPost{}).Where("id IN ?", ids[:3]).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 3 {
+		t.Fatalf("expected referenced placeholders to be kept, %d left", left)
+	}
+}
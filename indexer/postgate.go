@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"context"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// handleRecordCreateFeedPostgate stores (or replaces) the embedding rules for
+// a post. Postgates only apply to posts in the same repo.
+func (ix *Indexer) handleRecordCreateFeedPostgate(ctx context.Context, rec *bsky.FeedPostgate, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	post, err := ix.GetPostOrMissing(ctx, rec.Post)
+	if err != nil {
+		return err
+	}
+
+	if post.Author != evt.User {
+		log.Warnw("ignoring postgate for another user's post", "uid", evt.User, "rkey", op.Rkey, "post", rec.Post)
+		return nil
+	}
+
+	var detached []uint
+	for _, uri := range rec.DetachedEmbeddingUris {
+		fp, err := ix.GetPostOrMissing(ctx, uri)
+		if err != nil {
+			return err
+		}
+
+		detached = append(detached, fp.ID)
+	}
+
+	var disable bool
+	for _, r := range rec.EmbeddingRules {
+		if r.FeedPostgate_DisableRule != nil {
+			disable = true
+		}
+	}
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		gate := models.PostGate{
+			Author:           evt.User,
+			Rkey:             op.Rkey,
+			Post:             post.ID,
+			DisableEmbedding: disable,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "author"}, {Name: "rkey"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "post", "disable_embedding"}),
+		}).Create(&gate).Error; err != nil {
+			return err
+		}
+
+		// the upsert doesn't reliably give us back the id of an existing row
+		var stored models.PostGate
+		if err := tx.Find(&stored, "author = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+			return err
+		}
+		gate = stored
+
+		if err := tx.Where("gate = ?", gate.ID).Delete(&models.PostGateDetached{}).Error; err != nil {
+			return err
+		}
+
+		for _, id := range detached {
+			if err := tx.Create(&models.PostGateDetached{Gate: gate.ID, Post: id}).Error; err != nil {
+				return err
+			}
+		}
+
+		return recomputeQuoteCount(tx, post.ID)
+	})
+}
+
+func (ix *Indexer) handleRecordDeleteFeedPostgate(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	var gate models.PostGate
+	if err := ix.db.WithContext(ctx).Find(&gate, "author = ? AND rkey = ?", evt.User, op.Rkey).Error; err != nil {
+		return err
+	}
+	if gate.ID == 0 {
+		return nil
+	}
+
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("gate = ?", gate.ID).Delete(&models.PostGateDetached{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&gate).Error; err != nil {
+			return err
+		}
+
+		return recomputeQuoteCount(tx, gate.Post)
+	})
+}
+
+// embedAllowed reports whether the quoting post may embed the quoted one
+// under the quoted post's postgate, if it has one.
+func (ix *Indexer) embedAllowed(ctx context.Context, quoted uint, quoting uint) (bool, error) {
+	var gate models.PostGate
+	if err := ix.db.WithContext(ctx).Find(&gate, "post = ?", quoted).Error; err != nil {
+		return false, err
+	}
+	if gate.ID == 0 {
+		return true, nil
+	}
+	if gate.DisableEmbedding {
+		return false, nil
+	}
+
+	var count int64
+	if err := ix.db.WithContext(ctx).Model(models.PostGateDetached{}).Where("gate = ? AND post = ?", gate.ID, quoting).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
+// recomputeQuoteCount resets the quote count of a post to the number of live
+// quotes its postgate allows.
+func recomputeQuoteCount(tx *gorm.DB, post uint) error {
+	var gate models.PostGate
+	if err := tx.Find(&gate, "post = ?", post).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if !gate.DisableEmbedding {
+		q := tx.Model(models.FeedPost{}).Where("quote_of = ? AND NOT deleted AND NOT missing", post)
+		if gate.ID != 0 {
+			q = q.Where("id NOT IN (?)", tx.Model(models.PostGateDetached{}).Where("gate = ?", gate.ID).Select("post"))
+		}
+
+		if err := q.Count(&count).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(models.FeedPost{}).Where("id = ?", post).UpdateColumn("quote_count", count).Error
+}
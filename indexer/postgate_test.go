@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+func TestPostgateQuoteCounts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"},
+		{Model: gorm.Model{ID: 2}, Uid: 2, Did: "did:plc:bob"},
+		{Model: gorm.Model{ID: 3}, Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const origUri = "at://did:plc:alice/app.bsky.feed.post/aaaa"
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := &bsky.FeedPost{
+		Text: "look at this",
+		Embed: &bsky.FeedPost_Embed{
+			EmbedRecord: &bsky.EmbedRecord{
+				Record: &comatproto.RepoStrongRef{Uri: origUri, Cid: cc.String()},
+			},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "bbbb", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 3, "cccc", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+
+	expectQuotes := func(exp int64) {
+		t.Helper()
+		orig, err := ix.GetPost(ctx, origUri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if orig.QuoteCount != exp {
+			t.Fatalf("expected quote count of %d, got %d", exp, orig.QuoteCount)
+		}
+	}
+
+	expectQuotes(2)
+
+	gateEvt := &repomgr.RepoEvent{User: 1}
+	gateOp := &repomgr.RepoOp{Collection: "app.bsky.feed.postgate", Rkey: "aaaa"}
+
+	// detach bob's quote
+	if err := ix.handleRecordCreateFeedPostgate(ctx, &bsky.FeedPostgate{
+		Post:                  origUri,
+		DetachedEmbeddingUris: []string{"at://did:plc:bob/app.bsky.feed.post/bbbb"},
+	}, gateEvt, gateOp); err != nil {
+		t.Fatal(err)
+	}
+	expectQuotes(1)
+
+	// disable embedding altogether
+	if err := ix.handleRecordCreateFeedPostgate(ctx, &bsky.FeedPostgate{
+		Post: origUri,
+		EmbeddingRules: []*bsky.FeedPostgate_EmbeddingRules_Elem{
+			{FeedPostgate_DisableRule: &bsky.FeedPostgate_DisableRule{}},
+		},
+	}, gateEvt, gateOp); err != nil {
+		t.Fatal(err)
+	}
+	expectQuotes(0)
+
+	// new quotes of a gated post aren't counted
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "dddd", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+	expectQuotes(0)
+
+	if err := ix.handleRecordDeleteFeedPostgate(ctx, gateEvt, gateOp); err != nil {
+		t.Fatal(err)
+	}
+	expectQuotes(3)
+
+	// gates on someone else's post are ignored
+	if err := ix.handleRecordCreateFeedPostgate(ctx, &bsky.FeedPostgate{
+		Post: origUri,
+		EmbeddingRules: []*bsky.FeedPostgate_EmbeddingRules_Elem{
+			{FeedPostgate_DisableRule: &bsky.FeedPostgate_DisableRule{}},
+		},
+	}, &repomgr.RepoEvent{User: 2}, gateOp); err != nil {
+		t.Fatal(err)
+	}
+	expectQuotes(3)
+}
@@ -2,18 +2,22 @@ package indexer
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	bsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
 	"github.com/bluesky-social/indigo/notifs"
 	"github.com/bluesky-social/indigo/plc"
 	"github.com/bluesky-social/indigo/repomgr"
 	"github.com/bluesky-social/indigo/util"
+	"github.com/ipfs/go-cid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -127,3 +131,269 @@ func TestBasicIndexing(t *testing.T) {
 	// - references to missing posts work
 	// - mentions?
 }
+
+func TestQuoteCounts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"},
+		{Model: gorm.Model{ID: 2}, Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := &bsky.FeedPost{Text: "original"}
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, op); err != nil {
+		t.Fatal(err)
+	}
+
+	quote := &bsky.FeedPost{
+		Text: "look at this",
+		Embed: &bsky.FeedPost_Embed{
+			EmbedRecord: &bsky.EmbedRecord{
+				Record: &comatproto.RepoStrongRef{
+					Uri: "at://did:plc:alice/app.bsky.feed.post/aaaa",
+					Cid: cc.String(),
+				},
+			},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "bbbb", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+
+	orig, err := ix.GetPost(ctx, "at://did:plc:alice/app.bsky.feed.post/aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig.QuoteCount != 1 {
+		t.Fatalf("expected quote count of 1, got %d", orig.QuoteCount)
+	}
+
+	if err := ix.handleRecordDelete(ctx, &repomgr.RepoEvent{User: 2}, &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindDeleteRecord,
+		Collection: "app.bsky.feed.post",
+		Rkey:       "bbbb",
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	orig, err = ix.GetPost(ctx, "at://did:plc:alice/app.bsky.feed.post/aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig.QuoteCount != 0 {
+		t.Fatalf("expected quote count of 0 after delete, got %d", orig.QuoteCount)
+	}
+}
+
+func TestFillingPlaceholderKeepsCounts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"},
+		{Model: gorm.Model{ID: 2}, Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the quote arrives before the post it quotes
+	quote := &bsky.FeedPost{
+		Text: "look at this",
+		Embed: &bsky.FeedPost_Embed{
+			EmbedRecord: &bsky.EmbedRecord{
+				Record: &comatproto.RepoStrongRef{
+					Uri: "at://did:plc:alice/app.bsky.feed.post/aaaa",
+					Cid: cc.String(),
+				},
+			},
+		},
+	}
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "bbbb", cc, quote); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Model(models.FeedPost{}).Where("rkey = ? AND author = ?", "aaaa", 1).Update("up_count", 3).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	orig, err := ix.GetPost(ctx, "at://did:plc:alice/app.bsky.feed.post/aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orig.Missing {
+		t.Fatal("expected the placeholder to be filled in")
+	}
+	if orig.Cid != cc.String() {
+		t.Fatalf("expected cid %s, got %q", cc, orig.Cid)
+	}
+	if orig.QuoteCount != 1 || orig.UpCount != 3 {
+		t.Fatalf("expected the placeholder's counts to be kept, got %d quotes and %d likes", orig.QuoteCount, orig.UpCount)
+	}
+}
+
+func TestAuditCounts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	// one post with accurate counts, one with drifted counts
+	good := &models.FeedPost{Author: 1, Rkey: "good", UpCount: 1}
+	bad := &models.FeedPost{Author: 1, Rkey: "bad", UpCount: 5, RepostCount: 0}
+	for _, fp := range []*models.FeedPost{good, bad} {
+		if err := ix.db.Create(fp).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted := &models.VoteRecord{Voter: 3, Post: bad.ID}
+	for _, rec := range []any{
+		&models.VoteRecord{Voter: 2, Post: good.ID},
+		&models.VoteRecord{Voter: 2, Post: bad.ID},
+		deleted,
+		&models.RepostRecord{Reposter: 2, Post: bad.ID},
+	} {
+		if err := ix.db.Create(rec).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// soft-deleted votes shouldn't count
+	if err := ix.db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := ix.AuditCounts(ctx, 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected one discrepancy, got %d", len(diffs))
+	}
+	d := diffs[0]
+	if d.Post != bad.ID || d.CachedUpCount != 5 || d.ActualUpCount != 1 || d.ActualRepostCount != 1 {
+		t.Fatalf("unexpected discrepancy: %+v", d)
+	}
+
+	// the fix should have been applied
+	diffs, err = ix.AuditCounts(ctx, 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected no discrepancies after fix, got %d", len(diffs))
+	}
+}
+
+func TestEventTimeUsesClock(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	fixed := time.Date(2023, 7, 4, 12, 30, 0, 0, time.UTC)
+	ix.Now = func() time.Time { return fixed }
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.HandleRepoEvent(ctx, &repomgr.RepoEvent{User: 1, NewRoot: cc, Rev: "rev1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	since := int64(0)
+	evts, cancel, err := ix.events.Subscribe(ctx, "test", nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	select {
+	case evt := <-evts:
+		if evt.RepoCommit == nil {
+			t.Fatal("expected a commit event")
+		}
+		if evt.RepoCommit.Time != fixed.Format(util.ISO8601) {
+			t.Fatalf("expected event time %s, got %s", fixed.Format(util.ISO8601), evt.RepoCommit.Time)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestListReposByPDS(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for i, pds := range []uint{1, 2, 1, 1, 2} {
+		ai := &models.ActorInfo{Uid: models.Uid(i + 1), Did: fmt.Sprintf("did:plc:user%d", i+1), PDS: pds}
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var dids []string
+	var cursor string
+	for {
+		page, next, err := ix.ListReposByPDS(ctx, 1, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ai := range page {
+			dids = append(dids, ai.Did)
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	exp := []string{"did:plc:user1", "did:plc:user3", "did:plc:user4"}
+	if len(dids) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, dids)
+	}
+	for i := range exp {
+		if dids[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, dids)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+
+	"go.opentelemetry.io/otel"
+)
+
+type Profile struct {
+	*models.ActorInfo
+
+	FollowersCount int64
+	FollowsCount   int64
+	PostsCount     int64
+}
+
+// GetProfile returns the given user's actor info along with their follower,
+// follows and post counts.
+func (ix *Indexer) GetProfile(ctx context.Context, uid models.Uid) (*Profile, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetProfile")
+	defer span.End()
+
+	ai, err := ix.LookupUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Profile{
+		ActorInfo:      ai,
+		FollowersCount: ai.Followers,
+		FollowsCount:   ai.Following,
+	}
+
+	if err := ix.reader(ctx).WithContext(ctx).Model(&models.FeedPost{}).Where("author = ? AND NOT deleted AND NOT missing", uid).Count(&out.PostsCount).Error; err != nil {
+		return nil, fmt.Errorf("counting posts: %w", err)
+	}
+
+	return out, nil
+}
+
+// RecomputeFollowCounts recounts the given user's followers and follows from
+// the follow record table and overwrites the cached counts with the result,
+// repairing any drift in the incrementally maintained values.
+func (ix *Indexer) RecomputeFollowCounts(ctx context.Context, uid models.Uid) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "RecomputeFollowCounts")
+	defer span.End()
+
+	// every actor has a follow record pointing at themselves, which is not a
+	// real follow and must not be counted
+	var followers, following int64
+	if err := ix.db.WithContext(ctx).Model(&models.FollowRecord{}).Where("target = ? AND follower <> target", uid).Count(&followers).Error; err != nil {
+		return fmt.Errorf("counting followers: %w", err)
+	}
+
+	if err := ix.db.WithContext(ctx).Model(&models.FollowRecord{}).Where("follower = ? AND follower <> target", uid).Count(&following).Error; err != nil {
+		return fmt.Errorf("counting follows: %w", err)
+	}
+
+	return ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", uid).UpdateColumns(map[string]any{
+		"followers": followers,
+		"following": following,
+	}).Error
+}
+
+// the only profile record rkey clients are expected to read
+const profileRkey = "self"
+
+// profileBlobSyncTimeout bounds the background fetch of a profile's avatar
+// and banner blobs.
+const profileBlobSyncTimeout = time.Minute
+
+func (ix *Indexer) handleRecordCreateActorProfile(ctx context.Context, rec *bsky.ActorProfile, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	if op.Rkey != profileRkey {
+		log.Infow("ignoring profile record with unexpected rkey", "uid", evt.User, "rkey", op.Rkey)
+		return nil
+	}
+
+	upd := map[string]any{
+		"avatar_cid": "",
+		"banner_cid": "",
+	}
+
+	var blobs []string
+	if rec.Avatar != nil {
+		c := rec.Avatar.Ref.String()
+		upd["avatar_cid"] = c
+		blobs = append(blobs, c)
+	}
+	if rec.Banner != nil {
+		c := rec.Banner.Ref.String()
+		upd["banner_cid"] = c
+		blobs = append(blobs, c)
+	}
+	if rec.DisplayName != nil {
+		upd["display_name"] = *rec.DisplayName
+	}
+
+	if err := ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", evt.User).UpdateColumns(upd).Error; err != nil {
+		return fmt.Errorf("updating actor profile: %w", err)
+	}
+
+	if len(blobs) > 0 {
+		// fetching from the PDS can be slow, keep it off the event path
+		user := evt.User
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), profileBlobSyncTimeout)
+			defer cancel()
+
+			if err := ix.SyncProfileBlobs(ctx, user, blobs); err != nil {
+				log.Warnw("failed to sync profile blobs", "uid", user, "blobs", blobs, "err", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (ix *Indexer) handleRecordDeleteActorProfile(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	if op.Rkey != profileRkey {
+		return nil
+	}
+
+	return ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", evt.User).UpdateColumns(map[string]any{
+		"avatar_cid": "",
+		"banner_cid": "",
+	}).Error
+}
+
+// GetAvatarCid returns the blob cid of the given user's avatar, or an empty
+// string if they haven't set one.
+func (ix *Indexer) GetAvatarCid(ctx context.Context, uid models.Uid) (string, error) {
+	ai, err := ix.LookupUser(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+
+	return ai.AvatarCid, nil
+}
@@ -0,0 +1,224 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+	"gorm.io/gorm"
+)
+
+func TestGetProfile(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Model: gorm.Model{ID: 1}, Uid: 1, Did: "did:plc:alice"},
+		{Model: gorm.Model{ID: 2}, Uid: 2, Did: "did:plc:bob"},
+		{Model: gorm.Model{ID: 3}, Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// self-follow sentinel as created for new actors
+	if err := ix.db.Create(&models.FollowRecord{Follower: 1, Target: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []struct {
+		follower models.Uid
+		subject  string
+		rkey     string
+	}{
+		{2, "did:plc:alice", "f1"},
+		{3, "did:plc:alice", "f2"},
+		{1, "did:plc:bob", "f3"},
+		{1, "did:plc:carol", "f4"},
+	} {
+		if err := ix.handleRecordCreateGraphFollow(ctx, &bsky.GraphFollow{Subject: f.subject}, &repomgr.RepoEvent{User: f.follower}, &repomgr.RepoOp{Rkey: f.rkey, RecCid: &cc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// unfollow carol again
+	if err := ix.handleRecordDeleteGraphFollow(ctx, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{Rkey: "f4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rkey := range []string{"aaaa", "bbbb"} {
+		if err := ix.handleRecordCreateFeedPost(ctx, 1, rkey, cc, &bsky.FeedPost{Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ix.handleRecordDelete(ctx, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindDeleteRecord,
+		Collection: "app.bsky.feed.post",
+		Rkey:       "bbbb",
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	prof, err := ix.GetProfile(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prof.Did != "did:plc:alice" {
+		t.Fatalf("unexpected profile did: %s", prof.Did)
+	}
+	if prof.FollowersCount != 2 {
+		t.Fatalf("expected 2 followers, got %d", prof.FollowersCount)
+	}
+	if prof.FollowsCount != 1 {
+		t.Fatalf("expected 1 follow, got %d", prof.FollowsCount)
+	}
+	if prof.PostsCount != 1 {
+		t.Fatalf("expected 1 post, got %d", prof.PostsCount)
+	}
+
+	carol, err := ix.GetProfile(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carol.FollowersCount != 0 || carol.FollowsCount != 1 {
+		t.Fatalf("unexpected counts for carol: %d followers, %d follows", carol.FollowersCount, carol.FollowsCount)
+	}
+}
+
+func TestRecomputeFollowCounts(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice", Followers: 100, Following: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fr := range []*models.FollowRecord{
+		{Follower: 1, Target: 1},
+		{Follower: 2, Target: 1, Rkey: "f1"},
+		{Follower: 1, Target: 2, Rkey: "f2"},
+	} {
+		if err := ix.db.Create(fr).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ix.RecomputeFollowCounts(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ai, err := ix.LookupUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.Followers != 1 || ai.Following != 1 {
+		t.Fatalf("expected repaired counts of 1/1, got %d/%d", ai.Followers, ai.Following)
+	}
+}
+
+func TestProfileBlobs(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// the sync blocks until released, which must not hold up indexing
+	release := make(chan struct{})
+	synced := make(chan []string, 1)
+	ix.SyncProfileBlobs = func(ctx context.Context, uid models.Uid, blobs []string) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the blob sync to be bounded by a timeout")
+		}
+		<-release
+		synced <- blobs
+		return nil
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "alice"
+	prof := &bsky.ActorProfile{
+		DisplayName: &name,
+		Avatar:      &lexutil.LexBlob{Ref: lexutil.LexLink(cc), MimeType: "image/jpeg"},
+	}
+	if _, err := ix.handleRecordCreate(ctx, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindCreateRecord,
+		Collection: "app.bsky.actor.profile",
+		Rkey:       "self",
+		RecCid:     &cc,
+		Record:     prof,
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	avatar, err := ix.GetAvatarCid(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avatar != cc.String() {
+		t.Fatalf("expected avatar cid %s, got %q", cc, avatar)
+	}
+
+	close(release)
+	select {
+	case blobs := <-synced:
+		if len(blobs) != 1 || blobs[0] != cc.String() {
+			t.Fatalf("expected avatar blob to be synced, got %v", blobs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the avatar blob to be synced")
+	}
+
+	ai, err := ix.LookupUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ai.DisplayName != "alice" || ai.BannerCid != "" {
+		t.Fatalf("unexpected actor info after profile update: %+v", ai)
+	}
+
+	if err := ix.handleRecordDelete(ctx, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindDeleteRecord,
+		Collection: "app.bsky.actor.profile",
+		Rkey:       "self",
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	avatar, err = ix.GetAvatarCid(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avatar != "" {
+		t.Fatalf("expected avatar to be cleared, got %q", avatar)
+	}
+}
@@ -0,0 +1,37 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+// SetRecordCidVerification toggles checking that the CID an op claims for
+// its record is the hash of the record's raw bytes as read from the repo,
+// before aggregating it. Records that don't match are left out of the
+// index. This is on by default, since the records come from PDSes we have
+// no reason to trust.
+func (ix *Indexer) SetRecordCidVerification(enabled bool) {
+	ix.verifyRecordCids = enabled
+}
+
+// verifyRecordCid checks the op's raw record bytes against its CID. Ops
+// without a CID or raw bytes (local writes) are let through; the decoded
+// record isn't re-encoded, as fields its type doesn't know about would be
+// lost and the hash would never match.
+func verifyRecordCid(op *repomgr.RepoOp) error {
+	if op.RecCid == nil || op.RecordBytes == nil {
+		return nil
+	}
+
+	actual, err := op.RecCid.Prefix().Sum(op.RecordBytes)
+	if err != nil {
+		return fmt.Errorf("hashing record: %w", err)
+	}
+
+	if !actual.Equals(*op.RecCid) {
+		return fmt.Errorf("record hashes to %s, not %s", actual, op.RecCid)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-multihash"
+)
+
+func TestVerifyRecordCid(t *testing.T) {
+	rec := &bsky.GraphFollow{LexiconTypeID: "app.bsky.graph.follow", Subject: "did:plc:bob", CreatedAt: "2024-01-01T00:00:00Z"}
+
+	buf := new(bytes.Buffer)
+	if err := rec.MarshalCBOR(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	good, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyRecordCid(&repomgr.RepoOp{RecCid: &good, RecordBytes: buf.Bytes()}); err != nil {
+		t.Fatalf("expected raw record to match its cid: %s", err)
+	}
+	if err := verifyRecordCid(&repomgr.RepoOp{RecCid: &bad, RecordBytes: buf.Bytes()}); err == nil {
+		t.Fatal("expected mismatched cid to be caught")
+	}
+	if err := verifyRecordCid(&repomgr.RepoOp{RecCid: &bad, Record: rec}); err != nil {
+		t.Fatalf("expected ops of local writes to be let through: %s", err)
+	}
+
+	// a record with a field the lexicon type doesn't know about yet
+	newer, err := cbor.DumpObject(map[string]any{
+		"$type":        "app.bsky.graph.follow",
+		"subject":      "did:plc:carol",
+		"createdAt":    "2024-01-01T00:00:00Z",
+		"someNewField": "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newerCid, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newerRec, err := lexutil.CborDecodeValue(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+		{Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evt := &repomgr.RepoEvent{User: 1}
+	for _, op := range []*repomgr.RepoOp{
+		{Rkey: "good", RecCid: &good, Record: rec, RecordBytes: buf.Bytes()},
+		{Rkey: "bad", RecCid: &bad, Record: rec, RecordBytes: buf.Bytes()},
+		{Rkey: "newer", RecCid: &newerCid, Record: newerRec, RecordBytes: newer},
+	} {
+		op.Kind = repomgr.EvtKindCreateRecord
+		op.Collection = "app.bsky.graph.follow"
+		if _, err := ix.handleRecordCreate(ctx, evt, op, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rkeys []string
+	if err := ix.db.Model(&models.FollowRecord{}).Where("follower = 1").Order("rkey").Pluck("rkey", &rkeys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rkeys) != 2 || rkeys[0] != "good" || rkeys[1] != "newer" {
+		t.Fatalf("expected only the follows matching their cids to be indexed, got %v", rkeys)
+	}
+}
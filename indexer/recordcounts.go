@@ -0,0 +1,54 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+// CountUserRecords returns the number of records the user has in each
+// collection we aggregate, counted from the indexer's tables rather than by
+// walking the repo. Collections we don't aggregate are left out; use
+// CountRepoRecords for an authoritative count of everything in the repo.
+func (ix *Indexer) CountUserRecords(ctx context.Context, uid models.Uid) (map[string]int64, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "CountUserRecords")
+	defer span.End()
+
+	db := ix.db.WithContext(ctx)
+
+	counts := []struct {
+		collection string
+		model      any
+		where      string
+	}{
+		{"app.bsky.feed.post", &models.FeedPost{}, "author = ? AND NOT missing AND NOT deleted"},
+		{"app.bsky.feed.like", &models.VoteRecord{}, "voter = ?"},
+		{"app.bsky.feed.repost", &models.RepostRecord{}, "reposter = ?"},
+		// the self-follow every actor is initialized with has no record
+		{"app.bsky.graph.follow", &models.FollowRecord{}, "follower = ? AND rkey != ''"},
+		{"app.bsky.graph.block", &models.BlockRecord{}, "blocker = ?"},
+	}
+
+	out := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		var n int64
+		if err := db.Model(c.model).Where(c.where, uid).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		out[c.collection] = n
+	}
+
+	return out, nil
+}
+
+// CountRepoRecords counts the records in each collection of the user's repo
+// by walking its MST. This reads the whole tree, so it is much more expensive
+// than CountUserRecords, and is meant for verifying those counts.
+func (ix *Indexer) CountRepoRecords(ctx context.Context, uid models.Uid) (map[string]int64, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "CountRepoRecords")
+	defer span.End()
+
+	return ix.repomgr.CountRecords(ctx, uid)
+}
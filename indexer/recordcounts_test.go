@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestCountUserRecords(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rkey := range []string{"aaaa", "bbbb"} {
+		if err := ix.handleRecordCreateFeedPost(ctx, 1, rkey, cc, &bsky.FeedPost{Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// self-follow, as every actor gets when initialized
+	if err := ix.db.Create(&models.FollowRecord{Follower: 1, Target: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	follow := &bsky.GraphFollow{Subject: "did:plc:bob"}
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := ix.CountUserRecords(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{
+		"app.bsky.feed.post":    2,
+		"app.bsky.feed.like":    0,
+		"app.bsky.feed.repost":  0,
+		"app.bsky.graph.follow": 1,
+		"app.bsky.graph.block":  0,
+	}
+	for coll, n := range expected {
+		if counts[coll] != n {
+			t.Fatalf("expected %d records in %s, got %d", n, coll, counts[coll])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/util"
+
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"go.opentelemetry.io/otel"
+)
+
+// ErrRecordNotFound is returned by GetRecord when either the user or the
+// record doesn't exist.
+var ErrRecordNotFound = errors.New("record not found")
+
+// Record is a record read straight from a user's repo.
+type Record struct {
+	Uri string
+	Cid string
+
+	// Value is the decoded record: its lexicon type if that is registered,
+	// and otherwise a generic map of its fields.
+	Value any
+}
+
+// GetRecord reads any record from the repo store, including those of types
+// we don't aggregate into the indexer's tables.
+func (ix *Indexer) GetRecord(ctx context.Context, did string, collection string, rkey string) (*Record, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetRecord")
+	defer span.End()
+
+	ai, err := ix.LookupUserByDid(ctx, did)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	rcid, b, err := ix.repomgr.GetRecordBytes(ctx, ai.Uid, collection, rkey)
+	if err != nil {
+		if errors.Is(err, repomgr.ErrRecordNotFound) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("reading record: %w", err)
+	}
+
+	rec := &Record{
+		Uri: util.BuildAtUri(did, collection, rkey),
+		Cid: rcid.String(),
+	}
+
+	val, err := lexutil.CborDecodeValue(b)
+	switch {
+	case err == nil:
+		rec.Value = val
+	case errors.Is(err, lexutil.ErrUnrecognizedType):
+		var m map[string]any
+		if err := cbornode.DecodeInto(b, &m); err != nil {
+			return nil, fmt.Errorf("decoding record: %w", err)
+		}
+		rec.Value = m
+	default:
+		return nil, fmt.Errorf("decoding record: %w", err)
+	}
+
+	return rec, nil
+}
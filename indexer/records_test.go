@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+)
+
+func TestGetRecord(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	did := "did:plc:asdasda"
+
+	if err := tt.rm.InitNewActor(ctx, 1, "bob", did, "bob", "FAKE", "userboy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tt.ix.db.FirstOrCreate(&models.ActorInfo{}, &models.ActorInfo{Uid: 1, Did: did}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rpath, cc, err := tt.rm.CreateRecord(ctx, 1, "app.bsky.feed.post", &bsky.FeedPost{
+		CreatedAt: time.Now().Format(util.ISO8601),
+		Text:      "read me back",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rkey := strings.TrimPrefix(rpath, "app.bsky.feed.post/")
+
+	rec, err := tt.ix.GetRecord(ctx, did, "app.bsky.feed.post", rkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Uri != "at://"+did+"/"+rpath || rec.Cid != cc.String() {
+		t.Fatalf("unexpected record identity: %s %s", rec.Uri, rec.Cid)
+	}
+
+	post, ok := rec.Value.(*bsky.FeedPost)
+	if !ok || post.Text != "read me back" {
+		t.Fatalf("unexpected record value: %#v", rec.Value)
+	}
+
+	if _, err := tt.ix.GetRecord(ctx, did, "app.bsky.feed.post", "3kmissing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("expected not found for missing rkey, got %v", err)
+	}
+	if _, err := tt.ix.GetRecord(ctx, "did:plc:nobody", "app.bsky.feed.post", rkey); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("expected not found for unknown user, got %v", err)
+	}
+}
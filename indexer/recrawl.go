@@ -0,0 +1,134 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/time/rate"
+)
+
+// recrawlPageSize is how many of the PDS's users RecrawlPDS loads at a time.
+const recrawlPageSize = 500
+
+// RecrawlProgress reports how far along a RecrawlPDS run is.
+type RecrawlProgress struct {
+	PDS       uint      `json:"pds"`
+	Enqueued  int       `json:"enqueued"`
+	Skipped   int       `json:"skipped"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RecrawlPDS enqueues a crawl of every (non-tombstoned) user on the given
+// PDS, for bringing them up to date after the PDS has been down. Crawls are
+// enqueued at the PDS's crawl rate limit, the pace at which they can be
+// fetched anyway, so a just-recovered PDS isn't hit with a burst and the
+// crawl queue doesn't balloon. It blocks until all users are enqueued.
+func (ix *Indexer) RecrawlPDS(ctx context.Context, pdsID uint) error {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "RecrawlPDS")
+	defer span.End()
+
+	if ix.Crawler == nil {
+		return fmt.Errorf("crawling is disabled")
+	}
+
+	var pds models.PDS
+	if err := ix.db.First(&pds, "id = ?", pdsID).Error; err != nil {
+		return fmt.Errorf("looking up pds: %w", err)
+	}
+
+	ix.recrawlsLk.Lock()
+	if _, ok := ix.recrawls[pdsID]; ok {
+		ix.recrawlsLk.Unlock()
+		return fmt.Errorf("recrawl of %s already in progress", pds.Host)
+	}
+	now := ix.Now()
+	prog := &RecrawlProgress{PDS: pdsID, StartedAt: now, UpdatedAt: now}
+	ix.recrawls[pdsID] = prog
+	ix.recrawlsLk.Unlock()
+
+	defer func() {
+		ix.recrawlsLk.Lock()
+		delete(ix.recrawls, pdsID)
+		ix.recrawlsLk.Unlock()
+	}()
+
+	limit := rate.Limit(pds.CrawlRateLimit)
+	if limit <= 0 {
+		limit = rate.Inf
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	log.Infow("starting pds recrawl", "pds", pds.Host)
+
+	var last uint
+	for {
+		var users []*models.ActorInfo
+		if err := ix.db.Where("pds = ? AND id > ?", pdsID, last).Order("id").Limit(recrawlPageSize).Find(&users).Error; err != nil {
+			return fmt.Errorf("listing users: %w", err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		last = users[len(users)-1].ID
+
+		for _, ai := range users {
+			tombstoned, err := ix.UserTombstoned(ctx, ai.Uid)
+			if err != nil {
+				return fmt.Errorf("checking tombstone status of %s: %w", ai.Did, err)
+			}
+			if tombstoned {
+				ix.noteRecrawl(prog, false)
+				continue
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+
+			if err := ix.Crawler.Crawl(ctx, ai); err != nil {
+				return fmt.Errorf("enqueueing crawl of %s: %w", ai.Did, err)
+			}
+			ix.noteRecrawl(prog, true)
+		}
+
+		p := ix.GetRecrawlProgress(pdsID)
+		log.Infow("pds recrawl progress", "pds", pds.Host, "enqueued", p.Enqueued, "skipped", p.Skipped)
+	}
+
+	p := ix.GetRecrawlProgress(pdsID)
+	log.Infow("finished pds recrawl", "pds", pds.Host, "enqueued", p.Enqueued, "skipped", p.Skipped, "took", ix.Now().Sub(p.StartedAt))
+
+	return nil
+}
+
+func (ix *Indexer) noteRecrawl(prog *RecrawlProgress, enqueued bool) {
+	ix.recrawlsLk.Lock()
+	defer ix.recrawlsLk.Unlock()
+
+	if enqueued {
+		prog.Enqueued++
+	} else {
+		prog.Skipped++
+	}
+	prog.UpdatedAt = ix.Now()
+}
+
+// GetRecrawlProgress returns the progress of the RecrawlPDS run on the given
+// PDS, or nil if there is none.
+func (ix *Indexer) GetRecrawlProgress(pdsID uint) *RecrawlProgress {
+	ix.recrawlsLk.Lock()
+	defer ix.recrawlsLk.Unlock()
+
+	prog, ok := ix.recrawls[pdsID]
+	if !ok {
+		return nil
+	}
+
+	cp := *prog
+	return &cp
+}
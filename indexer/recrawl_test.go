@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/gorm"
+)
+
+func TestRecrawlPDS(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	var lk sync.Mutex
+	crawled := make(map[models.Uid]bool)
+	c, err := NewCrawlDispatcher(func(ctx context.Context, job *crawlWork) error {
+		lk.Lock()
+		defer lk.Unlock()
+		crawled[job.act.Uid] = true
+		return nil
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run()
+	ix.Crawler = c
+
+	// normally migrated by the bgs
+	if err := ix.db.AutoMigrate(&models.PDS{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pds := range []*models.PDS{
+		{Model: gorm.Model{ID: 1}, Host: "pds.one", CrawlRateLimit: 100},
+		{Model: gorm.Model{ID: 2}, Host: "pds.two", CrawlRateLimit: 100},
+	} {
+		if err := ix.db.Create(pds).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:one", PDS: 1},
+		{Uid: 2, Did: "did:plc:two", PDS: 1},
+		{Uid: 3, Did: "did:plc:gone", PDS: 1},
+		{Uid: 4, Did: "did:plc:elsewhere", PDS: 2},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ix.UserTombstoned = func(ctx context.Context, uid models.Uid) (bool, error) {
+		return uid == 3, nil
+	}
+
+	if err := ix.RecrawlPDS(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if ix.GetRecrawlProgress(1) != nil {
+		t.Fatal("expected progress to be cleared once the recrawl finished")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		lk.Lock()
+		n := len(crawled)
+		lk.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+	if len(crawled) != 2 || !crawled[1] || !crawled[2] {
+		t.Fatalf("expected only the live users of pds 1 to be crawled, got %v", crawled)
+	}
+}
@@ -0,0 +1,304 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/util"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrBannedDomain is returned by CreateExternalUser for users hosted on a
+// banned domain. References to such users are skipped rather than failing
+// the op that referenced them.
+var ErrBannedDomain = errors.New("user is hosted on a banned domain")
+
+// ErrMalformedAtUri is returned for records referencing malformed AT-URIs
+// when strict reference URIs are on.
+var ErrMalformedAtUri = errors.New("malformed at-uri reference")
+
+type ReferenceCrawlMode int
+
+const (
+	// RefCrawlSync looks up (and enqueues crawls for) referenced users inline
+	// while handling each op. This is the default.
+	RefCrawlSync ReferenceCrawlMode = iota
+
+	// RefCrawlBatched collects referenced DIDs and looks them up
+	// periodically, de-duplicating references seen within the same window.
+	RefCrawlBatched
+
+	// RefCrawlDisabled skips reference crawling during live indexing entirely.
+	RefCrawlDisabled
+)
+
+const defaultRefCrawlMaxPending = 50_000
+
+// SetReferenceCrawlMode configures how users referenced by incoming records
+// are crawled. For RefCrawlBatched, window controls how often pending
+// references are flushed.
+func (ix *Indexer) SetReferenceCrawlMode(ctx context.Context, mode ReferenceCrawlMode, window time.Duration) {
+	if ix.refBatcher != nil {
+		ix.refBatcher.stop()
+		ix.refBatcher = nil
+	}
+
+	ix.refCrawlMode = mode
+
+	if mode == RefCrawlBatched {
+		ix.refBatcher = newRefCrawlBatcher(ix, window, defaultRefCrawlMaxPending)
+		go ix.refBatcher.run(ctx)
+	}
+}
+
+// SetStrictReferenceUris makes records referencing malformed AT-URIs fail
+// with ErrMalformedAtUri when their references are crawled. By default the
+// malformed references are counted and skipped, and the record's other
+// references are crawled as usual.
+func (ix *Indexer) SetStrictReferenceUris(strict bool) {
+	ix.strictRefUris = strict
+}
+
+// parseRefUri parses the AT-URI a record references. Malformed URIs are
+// skipped, returning nil, unless strict reference URIs are on.
+func (ix *Indexer) parseRefUri(kind, uri string) (*util.ParsedUri, error) {
+	puri, err := util.ParseAtUri(uri)
+	if err == nil {
+		return puri, nil
+	}
+
+	if ix.strictRefUris {
+		return nil, fmt.Errorf("%w: %s %q: %w", ErrMalformedAtUri, kind, uri, err)
+	}
+
+	malformedReferenceUris.WithLabelValues(kind).Inc()
+	log.Infow("skipping malformed reference", "kind", kind, "uri", uri, "err", err)
+	return nil, nil
+}
+
+// crawlAtUriRef crawls the author of the referenced record.
+func (ix *Indexer) crawlAtUriRef(ctx context.Context, kind, uri string) error {
+	puri, err := ix.parseRefUri(kind, uri)
+	if err != nil || puri == nil {
+		return err
+	}
+
+	return ix.crawlDidRef(ctx, puri.Did)
+}
+
+// crawlDidRef makes sure the referenced user is known to the indexer, either
+// immediately or by deferring it to the batcher.
+func (ix *Indexer) crawlDidRef(ctx context.Context, did string) error {
+	if ix.refBatcher != nil {
+		ix.refBatcher.add(did)
+		return nil
+	}
+
+	referencesCrawled.Inc()
+
+	if b := fanoutBudgetFrom(ctx); b != nil {
+		return skipBannedRef(did, ix.crawlDidRefBudgeted(ctx, b, did))
+	}
+
+	_, err := ix.GetUserOrMissing(ctx, did)
+	return skipBannedRef(did, err)
+}
+
+func skipBannedRef(did string, err error) error {
+	if errors.Is(err, ErrBannedDomain) {
+		referencesSkippedBanned.Inc()
+		log.Debugw("skipping reference to user on banned domain", "did", did)
+		return nil
+	}
+
+	if errors.Is(err, ErrResolverOutage) {
+		referencesSkippedOutage.Inc()
+		return nil
+	}
+
+	return err
+}
+
+type refCrawlBatcher struct {
+	ix         *Indexer
+	window     time.Duration
+	maxPending int
+
+	// pending users, with the records that can only be indexed once the
+	// user is created (follows deferred by the fan-out limit)
+	lk      sync.Mutex
+	pending map[string][]*deferredOp
+
+	done chan struct{}
+}
+
+func newRefCrawlBatcher(ix *Indexer, window time.Duration, maxPending int) *refCrawlBatcher {
+	if window <= 0 {
+		window = time.Second
+	}
+
+	return &refCrawlBatcher{
+		ix:         ix,
+		window:     window,
+		maxPending: maxPending,
+		pending:    make(map[string][]*deferredOp),
+		done:       make(chan struct{}),
+	}
+}
+
+func (b *refCrawlBatcher) add(did string) {
+	b.addWaiting(did, nil)
+}
+
+// addWaiting queues the user, along with an op to aggregate once the user
+// has been created. It returns false if the user was dropped.
+func (b *refCrawlBatcher) addWaiting(did string, d *deferredOp) bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	waiting, ok := b.pending[did]
+	if ok {
+		referencesDeduplicated.Inc()
+	} else if len(b.pending) >= b.maxPending {
+		referencesDropped.Inc()
+		return false
+	}
+
+	if d != nil {
+		waiting = append(waiting, d)
+	}
+	b.pending[did] = waiting
+	return true
+}
+
+func (b *refCrawlBatcher) take() map[string][]*deferredOp {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	out := b.pending
+	b.pending = make(map[string][]*deferredOp)
+	return out
+}
+
+func (b *refCrawlBatcher) run(ctx context.Context) {
+	t := time.NewTicker(b.window)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			b.flush(ctx)
+		case <-b.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *refCrawlBatcher) stop() {
+	close(b.done)
+}
+
+func (b *refCrawlBatcher) flush(ctx context.Context) {
+	for did, waiting := range b.take() {
+		referencesCrawled.Inc()
+
+		_, err := b.ix.GetUserOrMissing(ctx, did)
+		if err != nil {
+			if err := skipBannedRef(did, err); err != nil {
+				log.Infow("failed to crawl referenced user", "did", did, "err", err)
+			}
+			if len(waiting) > 0 {
+				log.Warnw("dropping records waiting on a referenced user that couldn't be created", "did", did, "records", len(waiting))
+			}
+			continue
+		}
+
+		for _, d := range waiting {
+			b.ix.dispatchDeferredOp(ctx, d)
+		}
+	}
+}
+
+// refCrawlConcurrency bounds how many of a single post's references are
+// resolved at once.
+const refCrawlConcurrency = 4
+
+// crawlPostReferences resolves the users a post mentions, links to or
+// replies to, several at a time. Failures are logged and otherwise ignored,
+// except for malformed URIs when strict reference URIs are on.
+func (ix *Indexer) crawlPostReferences(ctx context.Context, op *repomgr.RepoOp, rec *bsky.FeedPost) error {
+	type postRef struct {
+		kind string
+		ref  string
+		did  string
+	}
+
+	var refs []postRef
+	var malformed error
+	addUri := func(kind, uri string) {
+		puri, err := ix.parseRefUri(kind, uri)
+		if err != nil {
+			if malformed == nil {
+				malformed = err
+			}
+			return
+		}
+		if puri != nil {
+			refs = append(refs, postRef{kind: kind, ref: uri, did: puri.Did})
+		}
+	}
+
+	for _, did := range postMentionDids(rec) {
+		refs = append(refs, postRef{kind: "user mention", ref: did, did: did})
+	}
+
+	// links to other atproto records
+	for _, uri := range postLinkUris(rec) {
+		if isAtUri(uri) {
+			addUri("linked uri", uri)
+		}
+	}
+
+	if rec.Reply != nil {
+		if rec.Reply.Parent != nil {
+			addUri("reply parent", rec.Reply.Parent.Uri)
+		}
+		if rec.Reply.Root != nil {
+			addUri("reply root", rec.Reply.Root.Uri)
+		}
+	}
+	if malformed != nil {
+		return malformed
+	}
+
+	// replies usually share a root and parent author, and there is no point
+	// resolving the same user twice
+	seen := make(map[string]bool, len(refs))
+	var eg errgroup.Group
+	eg.SetLimit(refCrawlConcurrency)
+	for _, r := range refs {
+		if seen[r.did] {
+			continue
+		}
+		seen[r.did] = true
+
+		r := r
+		eg.Go(func() error {
+			if err := ix.crawlDidRef(ctx, r.did); err != nil {
+				log.Infow("failed to crawl "+r.kind, "cid", op.RecCid, "ref", r.ref, "err", err)
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+
+	return nil
+}
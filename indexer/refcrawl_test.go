@@ -0,0 +1,164 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestRefCrawlBatcherDedup(t *testing.T) {
+	b := newRefCrawlBatcher(nil, time.Second, 2)
+
+	b.add("did:plc:alice")
+	b.add("did:plc:alice")
+	b.add("did:plc:bob")
+	b.add("did:plc:carol")
+
+	batch := b.take()
+	if len(batch) != 2 {
+		t.Fatalf("expected 2 pending references, got %d", len(batch))
+	}
+
+	for _, did := range []string{"did:plc:alice", "did:plc:bob"} {
+		if _, ok := batch[did]; !ok {
+			t.Fatalf("expected %s to be pending", did)
+		}
+	}
+
+	if len(b.take()) != 0 {
+		t.Fatal("expected pending references to be cleared after take")
+	}
+}
+
+func TestRefCrawlSkipsBannedDomain(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		return nil, fmt.Errorf("cannot create user on pds with banned domain (pds.example.com): %w", ErrBannedDomain)
+	}
+
+	if err := ix.crawlDidRef(context.Background(), "did:plc:banned"); err != nil {
+		t.Fatalf("expected banned reference to be skipped, got: %s", err)
+	}
+
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		return nil, fmt.Errorf("could not locate DID document")
+	}
+
+	if err := ix.crawlDidRef(context.Background(), "did:plc:broken"); err == nil {
+		t.Fatal("expected other creation failures to still be returned")
+	}
+}
+
+func TestCrawlPostReferencesConcurrently(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+
+	var lk sync.Mutex
+	calls := make(map[string]int)
+	var inflight, maxInflight atomic.Int32
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			m := maxInflight.Load()
+			if n <= m || maxInflight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		lk.Lock()
+		calls[did]++
+		lk.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		return nil, fmt.Errorf("could not locate DID document")
+	}
+
+	rec := &bsky.FeedPost{
+		Reply: &bsky.FeedPost_ReplyRef{
+			Root:   &comatproto.RepoStrongRef{Uri: "at://did:plc:op/app.bsky.feed.post/a"},
+			Parent: &comatproto.RepoStrongRef{Uri: "at://did:plc:op/app.bsky.feed.post/b"},
+		},
+	}
+	for i := 0; i < 8; i++ {
+		rec.Facets = append(rec.Facets, &bsky.RichtextFacet{
+			Features: []*bsky.RichtextFacet_Features_Elem{{
+				RichtextFacet_Mention: &bsky.RichtextFacet_Mention{Did: fmt.Sprintf("did:plc:user%d", i)},
+			}},
+		})
+	}
+
+	if err := ix.crawlPostReferences(context.Background(), &repomgr.RepoOp{}, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 9 {
+		t.Fatalf("expected 9 distinct users resolved, got %d", len(calls))
+	}
+	for did, n := range calls {
+		if n != 1 {
+			t.Fatalf("expected %s to be resolved once, got %d", did, n)
+		}
+	}
+	if m := maxInflight.Load(); m < 2 || m > refCrawlConcurrency {
+		t.Fatalf("expected between 2 and %d concurrent resolutions, got %d", refCrawlConcurrency, m)
+	}
+}
+
+func TestMalformedReferenceUris(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+
+	var resolved []string
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		resolved = append(resolved, did)
+		return nil, fmt.Errorf("could not locate DID document")
+	}
+
+	op := &repomgr.RepoOp{
+		Record: &bsky.FeedPost{
+			Reply: &bsky.FeedPost_ReplyRef{
+				Root:   &comatproto.RepoStrongRef{Uri: "at://did:plc:op/app.bsky.feed.post/a"},
+				Parent: &comatproto.RepoStrongRef{Uri: "https://example.com/not/a/post"},
+			},
+		},
+	}
+
+	if err := ix.crawlRecordReferences(context.Background(), op); err != nil {
+		t.Fatalf("expected the malformed parent to be skipped, got: %s", err)
+	}
+	if len(resolved) != 1 || resolved[0] != "did:plc:op" {
+		t.Fatalf("expected the root author to still be resolved, got %v", resolved)
+	}
+
+	ix.SetStrictReferenceUris(true)
+	resolved = nil
+
+	if err := ix.crawlRecordReferences(context.Background(), op); !errors.Is(err, ErrMalformedAtUri) {
+		t.Fatalf("expected a malformed reference error, got %v", err)
+	}
+
+	like := &repomgr.RepoOp{Record: &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: "at://did:plc:op"}}}
+	if err := ix.crawlRecordReferences(context.Background(), like); !errors.Is(err, ErrMalformedAtUri) {
+		t.Fatalf("expected a malformed reference error, got %v", err)
+	}
+	if len(resolved) != 0 {
+		t.Fatalf("expected nothing to be resolved, got %v", resolved)
+	}
+}
@@ -0,0 +1,55 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type primaryReadsKey struct{}
+
+// SetReadReplica routes the indexer's read-only lookups and queries
+// (LookupUser*, DidForUser, GetPost, GetRecentPosts, GetPostsByTag,
+// GetBlockedDids, HydrateActors, HydrateViewerState, GetTimeline, GetProfile,
+// GetNotifications, GetPostLikers, GetPostReposters and ListReposByPDS) to the
+// given database, typically a replica of the primary, so reads don't compete
+// with aggregation writes. GetRecord reads the repo store, and only its user
+// lookup goes to the replica; the notification records themselves are read by
+// the notification manager from its own database. Lookups may see data that
+// lags the primary; write paths mark their context with WithPrimaryReads so
+// they see their own writes. nil sends everything to the primary, the
+// default. A timeout set with SetQueryTimeout applies to the replica too.
+func (ix *Indexer) SetReadReplica(db *gorm.DB) error {
+	if db != nil {
+		if v, ok := ix.db.Get(queryTimeoutKey); ok {
+			d, _ := v.(time.Duration)
+			replica, err := withQueryTimeout(db, d)
+			if err != nil {
+				return err
+			}
+			db = replica
+		}
+	}
+
+	ix.readReplica = db
+	return nil
+}
+
+// WithPrimaryReads makes lookups made under ctx read from the primary database
+// even if a read replica is configured, for paths that write based on what
+// they read.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// reader returns the database read-only lookups made under ctx should use.
+func (ix *Indexer) reader(ctx context.Context) *gorm.DB {
+	if ix.readReplica == nil {
+		return ix.db
+	}
+	if primary, _ := ctx.Value(primaryReadsKey{}).(bool); primary {
+		return ix.db
+	}
+	return ix.readReplica
+}
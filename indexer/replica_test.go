@@ -0,0 +1,54 @@
+package indexer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReadReplica(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	replica, err := gorm.Open(sqlite.Open(filepath.Join(tt.dir, "replica.sqlite")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.AutoMigrate(&models.ActorInfo{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the replica hasn't caught up with alice yet
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ix.LookupUserByDid(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("expected lookups to go to the primary without a replica: %s", err)
+	}
+
+	if err := ix.SetReadReplica(replica); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ix.LookupUserByDid(ctx, "did:plc:alice"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected the lookup to go to the replica, got %v", err)
+	}
+	if _, err := ix.LookupUserByDid(WithPrimaryReads(ctx), "did:plc:alice"); err != nil {
+		t.Fatalf("expected write paths to read from the primary: %s", err)
+	}
+
+	if err := replica.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.LookupUserByDid(ctx, "did:plc:alice"); err != nil {
+		t.Fatalf("expected the lookup to succeed once the replica caught up: %s", err)
+	}
+}
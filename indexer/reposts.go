@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+
+	"gorm.io/gorm"
+)
+
+// repostSubjectPost returns the post a repost is ultimately of. A repost of
+// a repost is attributed to the original post, which the inner repost was
+// resolved to when it was indexed, so chains of any length end up there.
+// It returns nil if the inner repost isn't known, leaving nothing to
+// attribute the repost to.
+func (ix *Indexer) repostSubjectPost(ctx context.Context, uri string) (*models.FeedPost, error) {
+	puri, err := util.ParseAtUri(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if puri.Collection != "app.bsky.feed.repost" {
+		return ix.GetPostOrMissing(ctx, uri)
+	}
+
+	ai, err := ix.LookupUserByDid(ctx, puri.Did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			brokenRepostChains.Inc()
+			log.Warnw("skipping repost of a repost by an unknown user", "subject", uri)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var rr models.RepostRecord
+	if err := ix.db.WithContext(ctx).Find(&rr, "reposter = ? AND rkey = ?", ai.Uid, puri.Rkey).Error; err != nil {
+		return nil, err
+	}
+	if rr.ID == 0 {
+		brokenRepostChains.Inc()
+		log.Warnw("skipping repost of a repost we don't have", "subject", uri)
+		return nil, nil
+	}
+
+	var fp models.FeedPost
+	if err := ix.db.WithContext(ctx).Find(&fp, "id = ?", rr.Post).Error; err != nil {
+		return nil, err
+	}
+	if fp.ID == 0 {
+		brokenRepostChains.Inc()
+		log.Warnw("skipping repost of a repost whose post is gone", "subject", uri, "post", rr.Post)
+		return nil, nil
+	}
+
+	return &fp, nil
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestRepostOfRepost(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+		{Uid: 3, Did: "did:plc:carol"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.handleRecordCreateFeedPost(ctx, 2, "post", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	repost := func(user models.Uid, rkey, subject string) {
+		t.Helper()
+		op := &repomgr.RepoOp{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.feed.repost",
+			Rkey:       rkey,
+			RecCid:     &cc,
+			Record:     &bsky.FeedRepost{Subject: &comatproto.RepoStrongRef{Uri: subject, Cid: cc.String()}},
+		}
+		if _, err := ix.handleRecordCreate(ctx, &repomgr.RepoEvent{User: user}, op, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repost(1, "r1", "at://did:plc:bob/app.bsky.feed.post/post")
+	repost(3, "r2", "at://did:plc:alice/app.bsky.feed.repost/r1")
+	repost(2, "r3", "at://did:plc:carol/app.bsky.feed.repost/r2")
+	// broken chains
+	repost(3, "r4", "at://did:plc:alice/app.bsky.feed.repost/nope")
+	repost(3, "r5", "at://did:plc:nobody/app.bsky.feed.repost/r1")
+
+	op, err := ix.GetPost(ctx, "at://did:plc:bob/app.bsky.feed.post/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rrs []models.RepostRecord
+	if err := ix.db.Order("id asc").Find(&rrs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 3 {
+		t.Fatalf("expected the broken chains to be skipped, got %d reposts", len(rrs))
+	}
+	for _, rr := range rrs {
+		if rr.Post != op.ID || rr.Author != 2 {
+			t.Fatalf("expected repost %s to be attributed to the original post, got post %d by %d", rr.Rkey, rr.Post, rr.Author)
+		}
+	}
+
+	var posts int64
+	if err := ix.db.Model(&models.FeedPost{}).Count(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if posts != 1 {
+		t.Fatalf("expected no placeholder posts for reposts, got %d posts", posts)
+	}
+}
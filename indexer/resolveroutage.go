@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/api"
+)
+
+// ErrDidResolution should be wrapped by CreateExternalUser errors caused by
+// the DID resolver failing, as told by IsResolverFailure. Runs of them are
+// what resolver outages are detected from.
+var ErrDidResolution = errors.New("failed to resolve did")
+
+// IsResolverFailure reports whether err, from resolving did, means the PLC
+// directory couldn't be reached or failed to answer: a transport error or a
+// 5xx. did:web failures, 4xx answers and unknown methods are problems with
+// the DID itself and say nothing about the resolver.
+func IsResolverFailure(did string, err error) bool {
+	if err == nil || !strings.HasPrefix(did, "did:plc:") {
+		return false
+	}
+
+	var serr *api.PLCStatusError
+	if errors.As(err, &serr) {
+		return serr.StatusCode >= 500
+	}
+
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return uerr.Op != "parse"
+	}
+
+	var nerr net.Error
+	return errors.As(err, &nerr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ErrResolverOutage is returned instead of creating users while the DID
+// resolver appears to be down.
+var ErrResolverOutage = errors.New("did resolver appears to be down, not creating users")
+
+type resolverHealth struct {
+	lk            sync.Mutex
+	threshold     int
+	probeInterval time.Duration
+
+	failures  int
+	down      bool
+	downSince time.Time
+	lastProbe time.Time
+	probing   bool
+}
+
+// SetResolverOutageDetection makes the indexer treat the DID resolver as
+// down after failures user creations in a row failed to resolve the user's
+// DID (see ErrDidResolution). While it is down, creating users fails right
+// away with ErrResolverOutage, so records of users we already know keep
+// being aggregated and crawls don't back up behind resolver timeouts. Every
+// probeInterval one creation is let through to check whether the resolver
+// is back. Zero failures turns detection off, which is the default.
+func (ix *Indexer) SetResolverOutageDetection(failures int, probeInterval time.Duration) {
+	h := &ix.resolverHealth
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	h.threshold = failures
+	h.probeInterval = probeInterval
+	h.failures = 0
+	h.probing = false
+	if h.down {
+		h.down = false
+		resolverOutage.Set(0)
+	}
+}
+
+// resolverAvailable reports whether a user creation may go ahead, letting
+// one through as a probe every probeInterval during an outage.
+func (ix *Indexer) resolverAvailable() bool {
+	h := &ix.resolverHealth
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if !h.down {
+		return true
+	}
+
+	now := ix.Now()
+	if h.probing || now.Sub(h.lastProbe) < h.probeInterval {
+		return false
+	}
+
+	h.probing = true
+	h.lastProbe = now
+	return true
+}
+
+// noteResolution records the outcome of a user creation. Any outcome other
+// than a DID resolution failure means the resolver answered.
+func (ix *Indexer) noteResolution(err error) {
+	h := &ix.resolverHealth
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+
+	if h.threshold <= 0 {
+		return
+	}
+	h.probing = false
+	now := ix.Now()
+
+	if errors.Is(err, ErrDidResolution) {
+		h.failures++
+		if !h.down && h.failures >= h.threshold {
+			h.down = true
+			h.downSince = now
+			h.lastProbe = now
+			resolverOutage.Set(1)
+			resolverOutages.Inc()
+			log.Errorw("did resolver appears to be down, pausing user creation", "failures", h.failures, "err", err)
+		}
+		return
+	}
+
+	h.failures = 0
+	if h.down {
+		h.down = false
+		resolverOutage.Set(0)
+		log.Infow("did resolver is back, resuming user creation", "downFor", now.Sub(h.downSince))
+	}
+}
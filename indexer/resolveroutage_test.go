@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api"
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestResolverOutage(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetResolverOutageDetection(3, time.Minute)
+
+	now := time.Now()
+	ix.Now = func() time.Time { return now }
+
+	var calls int
+	up := false
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		calls++
+		if !up {
+			return nil, fmt.Errorf("could not locate DID document: %w: plc timed out", ErrDidResolution)
+		}
+		return &models.ActorInfo{Did: did}, nil
+	}
+
+	n := 0
+	create := func() error {
+		n++
+		_, err := ix.GetUserOrMissing(ctx, fmt.Sprintf("did:plc:user%d", n))
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := create(); !errors.Is(err, ErrDidResolution) {
+			t.Fatalf("expected a resolution failure, got %v", err)
+		}
+	}
+	if err := create(); !errors.Is(err, ErrResolverOutage) {
+		t.Fatalf("expected user creation to be paused, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected no creation attempts during the outage, got %d", calls)
+	}
+	if err := ix.crawlDidRef(ctx, "did:plc:referenced"); err != nil {
+		t.Fatalf("expected references to be skipped during the outage, got %v", err)
+	}
+
+	// the probe fails, so the outage goes on
+	now = now.Add(61 * time.Second)
+	if err := create(); !errors.Is(err, ErrDidResolution) {
+		t.Fatalf("expected the probe to go through, got %v", err)
+	}
+	if err := create(); !errors.Is(err, ErrResolverOutage) {
+		t.Fatalf("expected user creation to stay paused, got %v", err)
+	}
+
+	up = true
+	now = now.Add(61 * time.Second)
+	if err := create(); err != nil {
+		t.Fatalf("expected the probe to succeed: %s", err)
+	}
+	if err := create(); err != nil {
+		t.Fatalf("expected user creation to resume: %s", err)
+	}
+	if calls != 6 {
+		t.Fatalf("expected 6 creation attempts, got %d", calls)
+	}
+}
+
+func TestIsResolverFailure(t *testing.T) {
+	transport := &url.Error{Op: "Get", URL: "https://plc.directory/did:plc:aaaa", Err: context.DeadlineExceeded}
+
+	cases := []struct {
+		did  string
+		err  error
+		want bool
+	}{
+		{"did:plc:aaaa", transport, true},
+		{"did:plc:aaaa", fmt.Errorf("wrapped: %w", transport), true},
+		{"did:plc:aaaa", &api.PLCStatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}, true},
+		{"did:plc:aaaa", &api.PLCStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}, false},
+		{"did:plc:aaaa", &url.Error{Op: "parse", URL: "::", Err: errors.New("missing protocol scheme")}, false},
+		{"did:web:example.com", transport, false},
+		{"did:foo:aaaa", fmt.Errorf("unknown did method: %q", "foo"), false},
+		{"did:plc:aaaa", nil, false},
+	}
+
+	for _, c := range cases {
+		if got := IsResolverFailure(c.did, c.err); got != c.want {
+			t.Errorf("IsResolverFailure(%q, %v) = %v, want %v", c.did, c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	// retentionSweepInterval is how often SetRetention looks for aged
+	// records.
+	retentionSweepInterval = 10 * time.Minute
+
+	// retentionChunk caps how many records a single prune statement touches.
+	retentionChunk = 1000
+)
+
+// retentionCollections are the collections that can be pruned. Posts and
+// follows are kept forever, other records depend on them.
+var retentionCollections = map[string]any{
+	"app.bsky.feed.like":   &models.VoteRecord{},
+	"app.bsky.feed.repost": &models.RepostRecord{},
+}
+
+// errPruneRaced means some of the rows about to be pruned were deleted by
+// other means in the meantime, and the chunk should be looked at again.
+var errPruneRaced = errors.New("records deleted while pruning")
+
+// SetRetention periodically deletes the records of each collection in
+// maxAge that were indexed longer than that ago, until ctx is cancelled.
+// Pruned likes are taken off the like counts of their posts. Only likes
+// and reposts can be pruned.
+func (ix *Indexer) SetRetention(ctx context.Context, maxAge map[string]time.Duration) error {
+	policies := make(map[string]time.Duration)
+	for collection, d := range maxAge {
+		if _, ok := retentionCollections[collection]; !ok {
+			return fmt.Errorf("records of %q can't be pruned", collection)
+		}
+		if d > 0 {
+			policies[collection] = d
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	go func() {
+		t := time.NewTicker(retentionSweepInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				for collection, d := range policies {
+					if _, err := ix.pruneCollection(ctx, collection, ix.Now().Add(-d)); err != nil {
+						log.Errorw("failed to prune aged records", "collection", collection, "err", err)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// pruneCollection deletes the records of the collection indexed before
+// cutoff, a chunk at a time, and returns how many were deleted.
+func (ix *Indexer) pruneCollection(ctx context.Context, collection string, cutoff time.Time) (int64, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "pruneCollection")
+	defer span.End()
+	span.SetAttributes(attribute.String("collection", collection))
+
+	start := time.Now()
+	defer func() {
+		retentionSweepDuration.WithLabelValues(collection).Observe(time.Since(start).Seconds())
+	}()
+
+	var total int64
+	for {
+		var n int64
+		var err error
+		switch collection {
+		case "app.bsky.feed.like":
+			n, err = ix.pruneLikes(ctx, cutoff)
+		case "app.bsky.feed.repost":
+			n, err = ix.pruneReposts(ctx, cutoff)
+		default:
+			return total, fmt.Errorf("records of %q can't be pruned", collection)
+		}
+		if errors.Is(err, errPruneRaced) {
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		retentionPrunedRecords.WithLabelValues(collection).Add(float64(n))
+
+		if n < retentionChunk {
+			break
+		}
+	}
+
+	span.SetAttributes(attribute.Int64("pruned", total))
+	if total > 0 {
+		log.Infow("pruned aged records", "collection", collection, "count", total, "cutoff", cutoff)
+	}
+
+	return total, nil
+}
+
+func (ix *Indexer) pruneLikes(ctx context.Context, cutoff time.Time) (int64, error) {
+	// likes that were already deleted aren't in the counts anymore
+	var votes []models.VoteRecord
+	if err := ix.db.WithContext(ctx).Unscoped().Select("id", "post", "deleted_at").Where("created_at < ?", cutoff).Order("id").Limit(retentionChunk).Find(&votes).Error; err != nil {
+		return 0, err
+	}
+	if len(votes) == 0 {
+		return 0, nil
+	}
+
+	var live, dead []uint
+	posts := make(map[uint]int)
+	for _, vr := range votes {
+		if vr.DeletedAt.Valid {
+			dead = append(dead, vr.ID)
+			continue
+		}
+		live = append(live, vr.ID)
+		posts[vr.Post]++
+	}
+
+	if err := ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(live) > 0 {
+			res := tx.Unscoped().Where("id IN ? AND deleted_at IS NULL", live).Delete(&models.VoteRecord{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected != int64(len(live)) {
+				// somebody else took some of them off the counts already
+				return errPruneRaced
+			}
+
+			for n, ids := range byCount(posts) {
+				if err := tx.Model(models.FeedPost{}).Where("id IN ?", ids).Update("up_count", gorm.Expr("up_count - ?", n)).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(dead) > 0 {
+			if err := tx.Unscoped().Where("id IN ?", dead).Delete(&models.VoteRecord{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return int64(len(votes)), nil
+}
+
+func (ix *Indexer) pruneReposts(ctx context.Context, cutoff time.Time) (int64, error) {
+	ids := ix.db.Model(&models.RepostRecord{}).Select("id").Where("created_at < ?", cutoff).Order("id").Limit(retentionChunk)
+
+	res := ix.db.WithContext(ctx).Where("id IN (?)", ids).Delete(&models.RepostRecord{})
+	return res.RowsAffected, res.Error
+}
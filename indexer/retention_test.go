@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestPruneLikes(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	// the ops below carry a made up cid
+	ix.SetRecordCidVerification(false)
+
+	if err := ix.SetRetention(ctx, map[string]time.Duration{"app.bsky.feed.post": time.Hour}); err == nil {
+		t.Fatal("expected posts not to be prunable")
+	}
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:alice"},
+		{Uid: 2, Did: "did:plc:bob"},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opUri := "at://did:plc:alice/app.bsky.feed.post/aaaa"
+	if err := ix.handleRecordCreateFeedPost(ctx, 1, "aaaa", cc, &bsky.FeedPost{Text: "original"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rkey := range []string{"l111", "l222", "l333", "l444"} {
+		like := &repomgr.RepoOp{
+			Kind:       repomgr.EvtKindCreateRecord,
+			Collection: "app.bsky.feed.like",
+			Rkey:       rkey,
+			RecCid:     &cc,
+			Record:     &bsky.FeedLike{Subject: &comatproto.RepoStrongRef{Uri: opUri, Cid: cc.String()}},
+		}
+		if err := ix.handleRepoOp(ctx, &repomgr.RepoEvent{User: 2}, like); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// three of the likes are old, and one of those was already deleted
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	if err := ix.db.Model(&models.VoteRecord{}).Where("rkey IN ?", []string{"l111", "l222", "l333"}).Update("created_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.handleRecordDeleteFeedLike(ctx, &repomgr.RepoEvent{User: 2}, &repomgr.RepoOp{Rkey: "l333"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := ix.pruneCollection(ctx, "app.bsky.feed.like", time.Now().Add(-90*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 likes to be pruned, got %d", n)
+	}
+
+	var left int64
+	if err := ix.db.Unscoped().Model(&models.VoteRecord{}).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 1 {
+		t.Fatalf("expected one like to be kept, got %d", left)
+	}
+
+	op, err := ix.GetPost(ctx, opUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.UpCount != 1 {
+		t.Fatalf("expected the like count to drop to 1, got %d", op.UpCount)
+	}
+
+	// deleting a pruned like doesn't count it off again
+	if err := ix.handleRecordDeleteFeedLike(ctx, &repomgr.RepoEvent{User: 2}, &repomgr.RepoOp{Rkey: "l111"}); err != nil {
+		t.Fatal(err)
+	}
+
+	op, err = ix.GetPost(ctx, opUri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.UpCount != 1 {
+		t.Fatalf("expected the like count to stay at 1, got %d", op.UpCount)
+	}
+}
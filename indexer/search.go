@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// ActorSearcher finds actors matching a typeahead query. The returned cursor
+// is opaque to callers and is empty once there are no more results.
+type ActorSearcher interface {
+	SearchActors(ctx context.Context, query, cursor string, limit int) ([]*models.ActorInfo, string, error)
+}
+
+// SetActorSearcher replaces the backend used by SearchActors. By default
+// actors are searched in the database with DBActorSearcher.
+func (ix *Indexer) SetActorSearcher(s ActorSearcher) {
+	ix.actorSearcher = s
+}
+
+// SearchActors returns up to limit actors whose handle or display name starts
+// with the query, ignoring case, most followed first.
+func (ix *Indexer) SearchActors(ctx context.Context, query, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "SearchActors")
+	defer span.End()
+
+	if ix.actorSearcher == nil {
+		return NewDBActorSearcher(ix.db).SearchActors(ctx, query, cursor, limit)
+	}
+
+	return ix.actorSearcher.SearchActors(ctx, query, cursor, limit)
+}
+
+// DBActorSearcher is an ActorSearcher doing prefix matches with LIKE against
+// the actor table. Taken down and tombstoned actors are left out.
+type DBActorSearcher struct {
+	db *gorm.DB
+}
+
+func NewDBActorSearcher(db *gorm.DB) *DBActorSearcher {
+	return &DBActorSearcher{db: db}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *DBActorSearcher) SearchActors(ctx context.Context, query, cursor string, limit int) ([]*models.ActorInfo, string, error) {
+	query = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+	if query == "" {
+		return nil, "", nil
+	}
+	pattern := likeEscaper.Replace(query) + "%"
+
+	q := s.db.WithContext(ctx).Model(&models.ActorInfo{}).
+		Where("NOT taken_down AND NOT tombstoned").
+		Where(`(LOWER(handle) LIKE ? ESCAPE '\' OR LOWER(display_name) LIKE ? ESCAPE '\')`, pattern, pattern)
+
+	// results are ordered by (followers desc, uid asc), and the cursor holds
+	// the position of the last one returned
+	if cursor != "" {
+		fstr, ustr, ok := strings.Cut(cursor, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid cursor: %q", cursor)
+		}
+		followers, err := strconv.ParseInt(fstr, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		uid, err := strconv.ParseUint(ustr, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where("followers < ? OR (followers = ? AND uid > ?)", followers, followers, uid)
+	}
+
+	var out []*models.ActorInfo
+	if err := q.Order("followers DESC, uid ASC").Limit(limit).Find(&out).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(out) == limit && limit > 0 {
+		last := out[len(out)-1]
+		next = fmt.Sprintf("%d:%d", last.Followers, last.Uid)
+	}
+
+	return out, next, nil
+}
@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestSearchActors(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	for _, ai := range []*models.ActorInfo{
+		{Uid: 1, Did: "did:plc:1", Handle: sql.NullString{String: "alice.test", Valid: true}, Followers: 5},
+		{Uid: 2, Did: "did:plc:2", Handle: sql.NullString{String: "bob.test", Valid: true}, DisplayName: "Alison", Followers: 10},
+		{Uid: 3, Did: "did:plc:3", Handle: sql.NullString{String: "ALIEN.test", Valid: true}, Followers: 5},
+		{Uid: 4, Did: "did:plc:4", Handle: sql.NullString{String: "alibaba.test", Valid: true}, Followers: 50, TakenDown: true},
+		{Uid: 5, Did: "did:plc:5", DisplayName: "Alice (tombstoned)", Followers: 50, Tombstoned: true},
+		{Uid: 6, Did: "did:plc:6", Handle: sql.NullString{String: "mallory.test", Valid: true}, DisplayName: "not ali", Followers: 100},
+		{Uid: 7, Did: "did:plc:7", Handle: sql.NullString{String: "al_x.test", Valid: true}},
+		{Uid: 8, Did: "did:plc:8", DisplayName: "Alibi (no handle yet)", Followers: 1},
+	} {
+		if err := ix.db.Create(ai).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []models.Uid
+	cursor := ""
+	for i := 0; ; i++ {
+		page, next, err := ix.SearchActors(ctx, "@Ali", cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ai := range page {
+			got = append(got, ai.Uid)
+		}
+		if next == "" {
+			break
+		}
+		if i > 5 {
+			t.Fatal("search did not run out of results")
+		}
+		cursor = next
+	}
+
+	exp := []models.Uid{2, 1, 3, 8}
+	if len(got) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+	}
+
+	// LIKE wildcards in the query are matched literally
+	page, _, err := ix.SearchActors(ctx, "al_", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Uid != 7 {
+		t.Fatalf("expected only al_x.test, got %v", page)
+	}
+}
@@ -0,0 +1,21 @@
+package indexer
+
+type SelfFollowPolicy int
+
+const (
+	// SelfFollowStore keeps a follow record whose subject is its author like
+	// any other follow. It is told apart from the self-follow every actor is
+	// initialized with by having an rkey, and like that one it doesn't count
+	// towards the actor's follow counts. This is the default.
+	SelfFollowStore SelfFollowPolicy = iota
+
+	// SelfFollowReject skips follow records whose subject is their author,
+	// only counting them.
+	SelfFollowReject
+)
+
+// SetSelfFollowPolicy configures how follow records of their own author are
+// handled.
+func (ix *Indexer) SetSelfFollowPolicy(p SelfFollowPolicy) {
+	ix.selfFollowPolicy = p
+}
@@ -0,0 +1,78 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestSelfFollowRecord(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// the self-follow alice was initialized with
+	if err := ix.db.Create(&models.FollowRecord{Follower: 1, Target: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := &bsky.GraphFollow{Subject: "did:plc:alice"}
+	evt := &repomgr.RepoEvent{User: 1}
+	op := &repomgr.RepoOp{Rkey: "ffff", RecCid: &cc}
+
+	selfFollows := func() []models.FollowRecord {
+		t.Helper()
+		var out []models.FollowRecord
+		if err := ix.db.Order("id").Find(&out, "follower = 1 AND target = 1").Error; err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, op); err != nil {
+		t.Fatal(err)
+	}
+
+	frs := selfFollows()
+	if len(frs) != 2 || frs[0].Rkey != "" || frs[1].Rkey != "ffff" {
+		t.Fatalf("expected the self follow record to be stored next to the initial one, got %+v", frs)
+	}
+
+	alice, err := ix.LookupUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Followers != 0 || alice.Following != 0 {
+		t.Fatalf("self follows should not be counted, got %d followers and %d following", alice.Followers, alice.Following)
+	}
+
+	// deleting the record leaves the initial self-follow alone
+	if err := ix.handleRecordDeleteGraphFollow(ctx, evt, op); err != nil {
+		t.Fatal(err)
+	}
+	if frs := selfFollows(); len(frs) != 1 || frs[0].Rkey != "" {
+		t.Fatalf("expected only the initial self follow to remain, got %+v", frs)
+	}
+
+	ix.SetSelfFollowPolicy(SelfFollowReject)
+	if err := ix.handleRecordCreateGraphFollow(ctx, follow, evt, op); err != nil {
+		t.Fatal(err)
+	}
+	if frs := selfFollows(); len(frs) != 1 {
+		t.Fatalf("expected self follow record to be rejected, got %+v", frs)
+	}
+}
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CrawlLimiter paces repo fetches from a single PDS. *rate.Limiter is the
+// in-process implementation.
+type CrawlLimiter interface {
+	Wait(ctx context.Context) error
+	SetLimit(newLimit rate.Limit)
+	Tokens() float64
+}
+
+// SharedLimitStore holds crawl rate limits shared between indexer
+// instances, so that a sharded deployment as a whole stays within each
+// PDS's CrawlRateLimit.
+type SharedLimitStore interface {
+	// Reserve takes the next slot in the bucket with the given key, which
+	// allows limit events per second, and returns how long the caller has to
+	// wait before using it.
+	Reserve(ctx context.Context, key string, limit rate.Limit) (time.Duration, error)
+}
+
+// SetSharedLimitStore makes crawl limiters created from now on enforce their
+// limits through the given store. Passing nil goes back to per-process
+// limiters. Existing limiters are dropped so they get recreated.
+func (ix *Indexer) SetSharedLimitStore(s SharedLimitStore) {
+	ix.LimitMux.Lock()
+	defer ix.LimitMux.Unlock()
+
+	ix.sharedLimits = s
+	ix.Limiters = make(map[uint]CrawlLimiter)
+}
+
+// sharedLimiter adapts a SharedLimitStore bucket to CrawlLimiter. If the
+// store can't be reached it falls back to limiting in-process.
+type sharedLimiter struct {
+	store SharedLimitStore
+	key   string
+	local *rate.Limiter
+
+	lk     sync.Mutex
+	tokens float64
+}
+
+func newSharedLimiter(store SharedLimitStore, pdsID uint, limit rate.Limit) *sharedLimiter {
+	return &sharedLimiter{
+		store:  store,
+		key:    fmt.Sprintf("crawl:%d", pdsID),
+		local:  rate.NewLimiter(limit, 1),
+		tokens: 1,
+	}
+}
+
+func (l *sharedLimiter) Wait(ctx context.Context) error {
+	limit := l.local.Limit()
+	if limit == rate.Inf || limit <= 0 {
+		return l.local.Wait(ctx)
+	}
+
+	d, err := l.store.Reserve(ctx, l.key, limit)
+	if err != nil {
+		log.Warnw("shared crawl limit unavailable, limiting locally", "key", l.key, "err", err)
+		return l.local.Wait(ctx)
+	}
+
+	l.lk.Lock()
+	l.tokens = math.Max(0, 1-d.Seconds()*float64(limit))
+	l.lk.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *sharedLimiter) SetLimit(newLimit rate.Limit) {
+	l.local.SetLimit(newLimit)
+}
+
+// Tokens is an estimate as of the last Wait, as the real count lives in the
+// store and changes with every instance's fetches.
+func (l *sharedLimiter) Tokens() float64 {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	return l.tokens
+}
+
+// DBLimitStore is a SharedLimitStore kept in a database all the indexer
+// instances can reach.
+type DBLimitStore struct {
+	db *gorm.DB
+}
+
+func NewDBLimitStore(db *gorm.DB) (*DBLimitStore, error) {
+	if err := db.AutoMigrate(&models.CrawlLimitBucket{}); err != nil {
+		return nil, err
+	}
+
+	return &DBLimitStore{db: db}, nil
+}
+
+// maxReserveAttempts bounds how often Reserve retries when other instances
+// keep taking slots from under it.
+const maxReserveAttempts = 10
+
+func (s *DBLimitStore) Reserve(ctx context.Context, key string, limit rate.Limit) (time.Duration, error) {
+	interval := int64(float64(time.Second) / float64(limit))
+
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.CrawlLimitBucket{Key: key}).Error; err != nil {
+		return 0, fmt.Errorf("creating limit bucket: %w", err)
+	}
+
+	for i := 0; i < maxReserveAttempts; i++ {
+		var b models.CrawlLimitBucket
+		if err := s.db.WithContext(ctx).Find(&b, "key = ?", key).Error; err != nil {
+			return 0, err
+		}
+
+		now := time.Now().UnixNano()
+		start := b.Next
+		if start < now {
+			start = now
+		}
+
+		// only succeeds if nobody else reserved since we read the bucket
+		res := s.db.WithContext(ctx).Model(&models.CrawlLimitBucket{}).
+			Where("key = ? AND next = ?", key, b.Next).
+			Update("next", start+interval)
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		if res.RowsAffected == 1 {
+			return time.Duration(start - now), nil
+		}
+	}
+
+	return 0, fmt.Errorf("too much contention on limit bucket %s", key)
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestDBLimitStoreReserve(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ls, err := NewDBLimitStore(tt.ix.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// 10/s leaves 100ms between slots, whoever takes them
+	var last time.Duration
+	for i := 0; i < 3; i++ {
+		d, err := ls.Reserve(ctx, "crawl:1", rate.Limit(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && d <= last {
+			t.Fatalf("reservation %d: wait %s not after previous %s", i, d, last)
+		}
+		last = d
+	}
+	if last < 150*time.Millisecond {
+		t.Fatalf("expected third slot about 200ms out, got %s", last)
+	}
+
+	// other buckets are independent
+	d, err := ls.Reserve(ctx, "crawl:2", rate.Limit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 0 {
+		t.Fatalf("expected no wait on a fresh bucket, got %s", d)
+	}
+}
+
+func TestSharedLimiterAcrossIndexers(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ls, err := NewDBLimitStore(tt.ix.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two limiters for the same pds standing in for two indexer instances
+	a := newSharedLimiter(ls, 1, rate.Limit(20))
+	b := newSharedLimiter(ls, 1, rate.Limit(20))
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := a.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// four fetches at 20/s take at least 150ms between them
+	if el := time.Since(start); el < 140*time.Millisecond {
+		t.Fatalf("limit was not shared, four waits took %s", el)
+	}
+}
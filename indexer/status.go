@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/bluesky-social/indigo/util"
+)
+
+// ActorStatusLive is the one status value the lexicon defines so far.
+const ActorStatusLive = "app.bsky.actor.status#live"
+
+type ActorStatus struct {
+	Status string
+
+	// ExpiresAt is nil for statuses that hold until replaced
+	ExpiresAt *time.Time
+}
+
+// GetActorStatus returns the given user's self-declared status, or nil if
+// they have none or it has expired.
+func (ix *Indexer) GetActorStatus(ctx context.Context, uid models.Uid) (*ActorStatus, error) {
+	ai, err := ix.LookupUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if ai.Status == "" {
+		return nil, nil
+	}
+	if ai.StatusExpiresAt != nil && !ix.Now().Before(*ai.StatusExpiresAt) {
+		return nil, nil
+	}
+
+	return &ActorStatus{
+		Status:    ai.Status,
+		ExpiresAt: ai.StatusExpiresAt,
+	}, nil
+}
+
+func (ix *Indexer) handleRecordCreateActorStatus(ctx context.Context, rec *bsky.ActorStatus, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	if op.Rkey != profileRkey {
+		log.Infow("ignoring status record with unexpected rkey", "uid", evt.User, "rkey", op.Rkey)
+		return nil
+	}
+
+	// a status with a duration lapses that long after it was created
+	var expires *time.Time
+	if rec.DurationMinutes != nil {
+		t, err := util.ParseTimestamp(rec.CreatedAt)
+		if err != nil {
+			log.Infow("ignoring status record with invalid creation time", "uid", evt.User, "createdAt", rec.CreatedAt, "err", err)
+			return nil
+		}
+		t = t.Add(time.Duration(*rec.DurationMinutes) * time.Minute)
+		expires = &t
+	}
+
+	if err := ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", evt.User).UpdateColumns(map[string]any{
+		"status":            rec.Status,
+		"status_expires_at": expires,
+	}).Error; err != nil {
+		return fmt.Errorf("updating actor status: %w", err)
+	}
+
+	return nil
+}
+
+func (ix *Indexer) handleRecordDeleteActorStatus(ctx context.Context, evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	if op.Rkey != profileRkey {
+		return nil
+	}
+
+	return ix.db.WithContext(ctx).Model(models.ActorInfo{}).Where("uid = ?", evt.User).UpdateColumns(map[string]any{
+		"status":            "",
+		"status_expires_at": nil,
+	}).Error
+}
@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestActorStatus(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ix.Now = func() time.Time { return now }
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	evt := &repomgr.RepoEvent{User: 1}
+	self := &repomgr.RepoOp{Rkey: "self"}
+
+	st, err := ix.GetActorStatus(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil {
+		t.Fatalf("expected no status, got %+v", st)
+	}
+
+	duration := int64(60)
+	live := &bsky.ActorStatus{Status: ActorStatusLive, CreatedAt: "2024-05-01T12:00:00.000Z", DurationMinutes: &duration}
+	if err := ix.handleRecordCreateActorStatus(ctx, live, evt, self); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err = ix.GetActorStatus(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || st.Status != ActorStatusLive || st.ExpiresAt == nil || !st.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	// the status lapses on its own once it expires
+	now = now.Add(time.Hour)
+	st, err = ix.GetActorStatus(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil {
+		t.Fatalf("expected expired status to be cleared, got %+v", st)
+	}
+
+	// records not at the self rkey are ignored
+	if err := ix.handleRecordCreateActorStatus(ctx, &bsky.ActorStatus{Status: ActorStatusLive}, evt, &repomgr.RepoOp{Rkey: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := ix.GetActorStatus(ctx, 1); err != nil || st != nil {
+		t.Fatalf("expected no status, got %+v (err %v)", st, err)
+	}
+
+	if err := ix.handleRecordCreateActorStatus(ctx, &bsky.ActorStatus{Status: ActorStatusLive}, evt, self); err != nil {
+		t.Fatal(err)
+	}
+	st, err = ix.GetActorStatus(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || st.Status != ActorStatusLive || st.ExpiresAt != nil {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if err := ix.handleRecordDeleteActorStatus(ctx, evt, self); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := ix.GetActorStatus(ctx, 1); err != nil || st != nil {
+		t.Fatalf("expected status to be cleared by delete, got %+v (err %v)", st, err)
+	}
+}
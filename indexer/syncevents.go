@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/ipfs/go-cid"
+)
+
+// SetTooBigSyncEvents makes commits that exceed the event slice limits go out
+// as #sync events carrying the signed commit, rather than as commits flagged
+// tooBig. Consumers can then verify the new repo root from the firehose alone.
+func (ix *Indexer) SetTooBigSyncEvents(enabled bool) {
+	ix.tooBigSyncEvents = enabled
+}
+
+// commitOnlySlice builds a CAR containing just the commit block of the given
+// repo slice, as carried by #sync events.
+func commitOnlySlice(slice []byte, commit cid.Cid) ([]byte, error) {
+	ds, err := carstore.DecodeSlice(slice)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blk := range ds.Blocks {
+		if blk.Cid() != commit {
+			continue
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := carstore.WriteCarHeader(buf, commit); err != nil {
+			return nil, err
+		}
+		if _, err := carstore.LdWrite(buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("commit block %s not found in repo slice", commit)
+}
@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	blocks "github.com/ipfs/go-block-format"
+)
+
+func TestTooBigCommitSendsSync(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	ix.SetTooBigSyncEvents(true)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	commit := blocks.NewBlock([]byte("signed commit"))
+	filler := blocks.NewBlock(bytes.Repeat([]byte{'a'}, MaxEventSliceLength))
+
+	buf := new(bytes.Buffer)
+	if _, err := carstore.WriteCarHeader(buf, commit.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	for _, blk := range []blocks.Block{commit, filler} {
+		if _, err := carstore.LdWrite(buf, blk.Cid().Bytes(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ix.HandleRepoEvent(ctx, &repomgr.RepoEvent{
+		User:      1,
+		NewRoot:   commit.Cid(),
+		Rev:       "rev1",
+		RepoSlice: buf.Bytes(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	since := int64(0)
+	evts, cancel, err := ix.events.Subscribe(ctx, "test", nil, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	select {
+	case evt := <-evts:
+		if evt.RepoSync == nil {
+			t.Fatal("expected a sync event")
+		}
+		if evt.RepoSync.Did != "did:plc:alice" || evt.RepoSync.Rev != "rev1" {
+			t.Fatalf("unexpected sync event: %+v", evt.RepoSync)
+		}
+
+		ds, err := carstore.DecodeSlice(evt.RepoSync.Blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ds.Root != commit.Cid() || len(ds.Blocks) != 1 || ds.Blocks[0].Cid() != commit.Cid() {
+			t.Fatalf("expected sync blocks to hold only the commit, got root %s and %d blocks", ds.Root, len(ds.Blocks))
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for event")
+	}
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+)
+
+// setPostTags replaces the indexed tags of the given post.
+func (ix *Indexer) setPostTags(ctx context.Context, postID uint, tags []string) error {
+	return ix.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post = ?", postID).Delete(&models.PostTag{}).Error; err != nil {
+			return err
+		}
+
+		if len(tags) == 0 {
+			return nil
+		}
+
+		rows := make([]models.PostTag, 0, len(tags))
+		for _, t := range tags {
+			rows = append(rows, models.PostTag{Post: postID, Tag: t})
+		}
+
+		return tx.Create(&rows).Error
+	})
+}
+
+// GetPostsByTag returns up to limit posts carrying the given tag, newest
+// first. Tags match case insensitively, with or without a leading '#'. The
+// returned cursor can be passed back in to fetch the next page, and is empty
+// once there are no more posts.
+func (ix *Indexer) GetPostsByTag(ctx context.Context, tag string, cursor string, limit int) ([]*models.FeedPost, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetPostsByTag")
+	defer span.End()
+
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if tag == "" {
+		return nil, "", fmt.Errorf("must pass a tag")
+	}
+
+	db := ix.reader(ctx)
+
+	q := db.WithContext(ctx).Where("NOT deleted AND NOT missing")
+	if cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where("id < ?", before)
+	}
+
+	q = q.Where("id IN (?)", db.Model(&models.PostTag{}).Select("post").Where("tag = ?", tag))
+
+	var out []*models.FeedPost
+	if err := q.Order("id desc").Limit(limit).Find(&out).Error; err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(out) == limit && limit > 0 {
+		next = strconv.FormatUint(uint64(out[len(out)-1].ID), 10)
+	}
+
+	return out, next, nil
+}
@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestGetPostsByTag(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tags := range [][]string{{"Go"}, {"rust"}, {"go", "GO"}, {"#go", "rust"}} {
+		rec := &bsky.FeedPost{Text: "tagged"}
+		for _, tag := range tags {
+			rec.Facets = append(rec.Facets, &bsky.RichtextFacet{
+				Features: []*bsky.RichtextFacet_Features_Elem{{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: tag}}},
+			})
+		}
+		if err := ix.handleRecordCreateFeedPost(ctx, 1, fmt.Sprintf("post%d", i), cc, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rkeys := func(tag string) []string {
+		posts, _, err := ix.GetPostsByTag(ctx, tag, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out []string
+		for _, p := range posts {
+			out = append(out, p.Rkey)
+		}
+		return out
+	}
+
+	if got := rkeys("#Go"); !reflect.DeepEqual(got, []string{"post3", "post2", "post0"}) {
+		t.Fatalf("unexpected go posts: %v", got)
+	}
+
+	var dupes int64
+	if err := ix.db.Model(&models.PostTag{}).Where("tag = ?", "go").Count(&dupes).Error; err != nil {
+		t.Fatal(err)
+	}
+	if dupes != 3 {
+		t.Fatalf("expected tags to be deduplicated per post, got %d rows", dupes)
+	}
+
+	page, cursor, err := ix.GetPostsByTag(ctx, "go", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || cursor == "" {
+		t.Fatalf("expected a full first page and a cursor, got %d posts and %q", len(page), cursor)
+	}
+	page, cursor, err = ix.GetPostsByTag(ctx, "go", cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Rkey != "post0" || cursor != "" {
+		t.Fatalf("unexpected second page: %d posts, cursor %q", len(page), cursor)
+	}
+
+	del := &repomgr.RepoOp{Kind: repomgr.EvtKindDeleteRecord, Collection: "app.bsky.feed.post", Rkey: "post3"}
+	if err := ix.handleRecordDelete(ctx, &repomgr.RepoEvent{User: 1}, del, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var left int64
+	if err := ix.db.Model(&models.PostTag{}).Joins("JOIN feed_posts ON feed_posts.id = post_tags.post").Where("feed_posts.rkey = ?", "post3").Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Fatalf("expected the deleted post's tags to be removed, %d left", left)
+	}
+	if got := rkeys("rust"); !reflect.DeepEqual(got, []string{"post1"}) {
+		t.Fatalf("unexpected rust posts after delete: %v", got)
+	}
+}
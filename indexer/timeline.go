@@ -0,0 +1,163 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+
+	"go.opentelemetry.io/otel"
+)
+
+type TimelineItem struct {
+	Post   *models.FeedPost
+	Author *ActorWithInfo
+	Uri    string
+
+	// Viewer is nil if the viewer neither liked nor reposted the post
+	Viewer *ViewerState
+}
+
+// GetTimeline returns up to limit posts by the accounts the viewer follows,
+// newest first. Posts we only have placeholders for, deleted posts, posts by
+// taken down accounts and posts by accounts blocking or blocked by the
+// viewer are left out. The returned cursor can be passed back in to fetch
+// the next page, and is empty once there are no more posts.
+func (ix *Indexer) GetTimeline(ctx context.Context, viewer models.Uid, cursor string, limit int) ([]*TimelineItem, string, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "GetTimeline")
+	defer span.End()
+
+	db := ix.reader(ctx).WithContext(ctx)
+
+	q := db.Model(&models.FeedPost{}).
+		Where("author IN (?)", db.Model(&models.FollowRecord{}).Where("follower = ?", viewer).Select("target")).
+		Where("author NOT IN (?)", db.Model(&models.ActorInfo{}).Where("taken_down").Select("uid")).
+		Where("NOT missing AND NOT deleted")
+
+	if ix.blockCacheEnabled() {
+		for _, blockedBy := range []bool{false, true} {
+			cb, err := ix.getBlocks(ctx, blockCacheKey{viewer: viewer, blockedBy: blockedBy})
+			if err != nil {
+				return nil, "", err
+			}
+			if len(cb.uids) > 0 {
+				q = q.Where("author NOT IN ?", cb.uids)
+			}
+		}
+	} else {
+		q = q.Where("author NOT IN (?)", db.Model(&models.BlockRecord{}).Where("blocker = ?", viewer).Select("target")).
+			Where("author NOT IN (?)", db.Model(&models.BlockRecord{}).Where("target = ?", viewer).Select("blocker"))
+	}
+
+	if cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor: %w", err)
+		}
+		q = q.Where("id < ?", before)
+	}
+
+	var posts []*models.FeedPost
+	if err := q.Order("id DESC").Limit(limit).Find(&posts).Error; err != nil {
+		return nil, "", err
+	}
+
+	if len(posts) == 0 {
+		return nil, "", nil
+	}
+
+	var next string
+	if len(posts) == limit && limit > 0 {
+		next = strconv.FormatUint(uint64(posts[len(posts)-1].ID), 10)
+	}
+
+	postIDs := make([]uint, 0, len(posts))
+	authorUids := make([]models.Uid, 0, len(posts))
+	for _, p := range posts {
+		postIDs = append(postIDs, p.ID)
+		authorUids = append(authorUids, p.Author)
+	}
+
+	byUid, err := ix.HydrateActors(ctx, viewer, authorUids)
+	if err != nil {
+		return nil, "", err
+	}
+
+	viewerState, err := ix.HydrateViewerState(ctx, viewer, postIDs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	out := make([]*TimelineItem, 0, len(posts))
+	for _, p := range posts {
+		author, ok := byUid[p.Author]
+		if !ok {
+			continue
+		}
+
+		out = append(out, &TimelineItem{
+			Post:   p,
+			Author: author,
+			Uri:    util.BuildAtUri(author.Did, "app.bsky.feed.post", p.Rkey),
+			Viewer: viewerState[p.ID],
+		})
+	}
+
+	return out, next, nil
+}
+
+// ViewerState holds the at:// uris of a viewer's like and repost of a post.
+// Either is empty if the viewer has not liked or reposted it.
+type ViewerState struct {
+	Like   string
+	Repost string
+}
+
+// HydrateViewerState looks up the viewer's likes and reposts of the given
+// posts, with one query for each. Posts the viewer has done neither to are
+// absent from the returned map.
+func (ix *Indexer) HydrateViewerState(ctx context.Context, viewer models.Uid, postIDs []uint) (map[uint]*ViewerState, error) {
+	ctx, span := otel.Tracer("indexer").Start(ctx, "HydrateViewerState")
+	defer span.End()
+
+	out := make(map[uint]*ViewerState)
+	if len(postIDs) == 0 {
+		return out, nil
+	}
+
+	viewerActor, err := ix.LookupUser(ctx, viewer)
+	if err != nil {
+		return nil, fmt.Errorf("looking up viewer: %w", err)
+	}
+
+	get := func(post uint) *ViewerState {
+		vs, ok := out[post]
+		if !ok {
+			vs = &ViewerState{}
+			out[post] = vs
+		}
+		return vs
+	}
+
+	db := ix.reader(ctx).WithContext(ctx)
+
+	var likes []models.VoteRecord
+	if err := db.Find(&likes, "voter = ? AND dir = ? AND post IN ?", viewer, models.VoteDirUp, postIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, vr := range likes {
+		get(vr.Post).Like = util.BuildAtUri(viewerActor.Did, "app.bsky.feed.like", vr.Rkey)
+	}
+
+	var reposts []models.RepostRecord
+	if err := db.Find(&reposts, "reposter = ? AND post IN ?", viewer, postIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, rr := range reposts {
+		get(rr.Post).Repost = util.BuildAtUri(viewerActor.Did, "app.bsky.feed.repost", rr.Rkey)
+	}
+
+	return out, nil
+}
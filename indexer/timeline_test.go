@@ -0,0 +1,167 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestGetTimeline(t *testing.T) {
+	t.Run("uncached", func(t *testing.T) { testGetTimeline(t, false) })
+	t.Run("block cache", func(t *testing.T) { testGetTimeline(t, true) })
+}
+
+func testGetTimeline(t *testing.T, blockCache bool) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+	if blockCache {
+		if err := ix.SetBlockCache(10, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 1 is the viewer, who follows everyone but 6. The viewer blocks 3, 4
+	// blocks the viewer and 5 is taken down.
+	for i := 1; i <= 6; i++ {
+		if err := ix.db.Create(&models.ActorInfo{Uid: models.Uid(i), Did: fmt.Sprintf("did:plc:user%d", i)}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if i < 6 {
+			if err := ix.db.Create(&models.FollowRecord{Follower: 1, Target: models.Uid(i), Rkey: fmt.Sprintf("f%d", i)}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := ix.SetActorTakenDown(ctx, 5, true); err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []struct {
+		blocker models.Uid
+		subject string
+	}{
+		{1, "did:plc:user3"},
+		{4, "did:plc:user1"},
+	} {
+		if err := ix.handleRecordCreateGraphBlock(ctx, &bsky.GraphBlock{Subject: b.subject}, &repomgr.RepoEvent{User: b.blocker}, &repomgr.RepoOp{Rkey: "block", RecCid: &cc}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	posts := []*models.FeedPost{
+		{Author: 2, Rkey: "p1", UpCount: 1},
+		{Author: 1, Rkey: "p2"},
+		{Author: 3, Rkey: "p3"},
+		{Author: 4, Rkey: "p4"},
+		{Author: 5, Rkey: "p5"},
+		{Author: 6, Rkey: "p6"},
+		{Author: 2, Rkey: "p7", Deleted: true},
+		{Author: 2, Rkey: "p8", Missing: true},
+		{Author: 2, Rkey: "p9"},
+	}
+	for _, p := range posts {
+		if err := ix.db.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ix.db.Create(&models.VoteRecord{Dir: models.VoteDirUp, Voter: 1, Post: posts[0].ID, Rkey: "like"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.db.Create(&models.RepostRecord{Reposter: 1, Post: posts[8].ID, Rkey: "repost"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	page, cursor, err := ix.GetTimeline(ctx, 1, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Post.Rkey != "p9" || page[1].Post.Rkey != "p2" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if page[0].Uri != "at://did:plc:user2/app.bsky.feed.post/p9" {
+		t.Fatalf("unexpected uri: %s", page[0].Uri)
+	}
+	if vs := page[0].Viewer; vs == nil || vs.Repost != "at://did:plc:user1/app.bsky.feed.repost/repost" || vs.Like != "" {
+		t.Fatalf("unexpected viewer state: %+v", vs)
+	}
+	if cursor == "" {
+		t.Fatal("expected a cursor for the next page")
+	}
+
+	page, cursor, err = ix.GetTimeline(ctx, 1, cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Post.Rkey != "p1" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	if vs := page[0].Viewer; vs == nil || vs.Like != "at://did:plc:user1/app.bsky.feed.like/like" || page[0].Post.UpCount != 1 {
+		t.Fatalf("unexpected viewer state: %+v", vs)
+	}
+	if cursor != "" {
+		t.Fatalf("expected no cursor after the last page, got %q", cursor)
+	}
+
+	// once unblocked, the blocked account's posts show up again
+	if err := ix.handleRecordDeleteGraphBlock(ctx, &repomgr.RepoEvent{User: 1}, &repomgr.RepoOp{Rkey: "block"}); err != nil {
+		t.Fatal(err)
+	}
+	page, _, err = ix.GetTimeline(ctx, 1, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 4 || page[1].Post.Rkey != "p3" {
+		t.Fatalf("expected unblocked account's post in timeline, got %+v", page)
+	}
+}
+
+func TestHydrateViewerState(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:viewer"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []any{
+		&models.VoteRecord{Dir: models.VoteDirUp, Voter: 1, Post: 10, Rkey: "l10"},
+		&models.VoteRecord{Dir: models.VoteDirUp, Voter: 2, Post: 11, Rkey: "other"},
+		&models.RepostRecord{Reposter: 1, Post: 10, Rkey: "r10"},
+		&models.RepostRecord{Reposter: 1, Post: 12, Rkey: "r12"},
+	} {
+		if err := ix.db.Create(rec).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	states, err := ix.HydrateViewerState(ctx, 1, []uint{10, 11, 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("expected state for two posts, got %d", len(states))
+	}
+	if vs := states[10]; vs.Like != "at://did:plc:viewer/app.bsky.feed.like/l10" || vs.Repost != "at://did:plc:viewer/app.bsky.feed.repost/r10" {
+		t.Fatalf("unexpected state for post 10: %+v", vs)
+	}
+	if vs := states[12]; vs.Like != "" || vs.Repost != "at://did:plc:viewer/app.bsky.feed.repost/r12" {
+		t.Fatalf("unexpected state for post 12: %+v", vs)
+	}
+}
@@ -0,0 +1,36 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+type UnknownOpPolicy int
+
+const (
+	// UnknownOpError fails ops of a kind the indexer doesn't know about.
+	// This is the default.
+	UnknownOpError UnknownOpPolicy = iota
+
+	// UnknownOpIgnore skips ops of unknown kinds, only counting them, so new
+	// op kinds on the firehose don't show up as indexing failures.
+	UnknownOpIgnore
+)
+
+// SetUnknownOpPolicy configures how repo ops of an unrecognized kind are
+// handled.
+func (ix *Indexer) SetUnknownOpPolicy(p UnknownOpPolicy) {
+	ix.unknownOpPolicy = p
+}
+
+func (ix *Indexer) handleUnknownOp(evt *repomgr.RepoEvent, op *repomgr.RepoOp) error {
+	unknownOpKinds.WithLabelValues(string(op.Kind)).Inc()
+
+	if ix.unknownOpPolicy == UnknownOpIgnore {
+		log.Debugw("ignoring repo op of unknown kind", "kind", op.Kind, "uid", evt.User, "collection", op.Collection, "rkey", op.Rkey)
+		return nil
+	}
+
+	return fmt.Errorf("unrecognized repo op kind %q for %s/%s (set the unknown op policy to ignore to skip these)", op.Kind, op.Collection, op.Rkey)
+}
@@ -0,0 +1,28 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/repomgr"
+)
+
+func TestUnknownOpPolicy(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ctx := context.Background()
+	ix := tt.ix
+
+	evt := &repomgr.RepoEvent{User: 1}
+	op := &repomgr.RepoOp{Kind: repomgr.EventKind("frobnicate"), Collection: "app.bsky.feed.post", Rkey: "aaaa"}
+
+	if err := ix.handleRepoOp(ctx, evt, op); err == nil {
+		t.Fatal("expected unknown op kind to fail by default")
+	}
+
+	ix.SetUnknownOpPolicy(UnknownOpIgnore)
+	if err := ix.handleRepoOp(ctx, evt, op); err != nil {
+		t.Fatalf("expected unknown op kind to be ignored, got: %s", err)
+	}
+}
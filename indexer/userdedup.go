@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"context"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+// SetDedupMissingUsers controls whether concurrent attempts to create the
+// same previously unknown user are folded into one. With it on, which is the
+// default, callers arriving while a DID is already being created wait for
+// that creation and share its result instead of calling CreateExternalUser
+// and enqueueing a crawl of their own.
+func (ix *Indexer) SetDedupMissingUsers(v bool) {
+	ix.creatingUsersLk.Lock()
+	defer ix.creatingUsersLk.Unlock()
+
+	ix.dedupMissingUsers = v
+}
+
+// dedupUserCreation runs create for did unless a creation for it is already
+// in flight, in which case it waits for that one to finish. The entry is
+// dropped once create returns, whether or not it succeeded.
+func (ix *Indexer) dedupUserCreation(ctx context.Context, did string, create func() (*models.ActorInfo, error)) (*models.ActorInfo, error) {
+	ix.creatingUsersLk.Lock()
+	dedup := ix.dedupMissingUsers
+	ix.creatingUsersLk.Unlock()
+
+	if !dedup {
+		return create()
+	}
+
+	// only the caller that started the creation gets to run its create
+	ran := false
+	ch := ix.creatingUsers.DoChan(did, func() (any, error) {
+		ran = true
+		return create()
+	})
+
+	select {
+	case res := <-ch:
+		if !ran {
+			missingUserCreationsDeduped.Inc()
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*models.ActorInfo), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+)
+
+func TestMissingUserCreationDedup(t *testing.T) {
+	ix := &Indexer{
+		pendingCrawls:     make(map[string]*models.ActorInfo),
+		dedupMissingUsers: true,
+	}
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	ix.CreateExternalUser = func(ctx context.Context, did string) (*models.ActorInfo, error) {
+		calls.Add(1)
+		<-release
+		return &models.ActorInfo{Uid: 1, Did: did}, nil
+	}
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]*models.ActorInfo, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ai, err := ix.createMissingUserRecord(ctx, "did:plc:alice")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = ai
+		}(i)
+	}
+
+	// let the callers pile up behind the first creation
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected a single call to CreateExternalUser, got %d", n)
+	}
+	for _, ai := range results {
+		if ai == nil || ai.Uid != 1 {
+			t.Fatalf("expected every caller to get the created user, got %+v", ai)
+		}
+	}
+
+	// the entry is cleared once creation is done
+	if _, err := ix.createMissingUserRecord(ctx, "did:plc:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected a new creation after the first finished, got %d calls", n)
+	}
+}
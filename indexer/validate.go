@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/ipfs/go-cid"
+)
+
+// limits taken from the app.bsky lexicon schemas
+const (
+	maxPostTextLength        = 3000
+	maxPostLangs             = 3
+	maxPostTags              = 8
+	maxProfileDisplayNameLen = 640
+	maxProfileDescriptionLen = 2560
+)
+
+// SetRecordValidation toggles checking incoming records against the
+// constraints of their lexicon schemas before aggregating them. Records that
+// fail are still stored in the repo, but are left out of the index.
+func (ix *Indexer) SetRecordValidation(enabled bool) {
+	ix.validateRecords = enabled
+}
+
+// validateRecord checks the record types the indexer aggregates against the
+// required fields and limits declared in their lexicons. Other record types
+// are not checked.
+func validateRecord(rec any) error {
+	switch rec := rec.(type) {
+	case *bsky.FeedPost:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		if len(rec.Text) > maxPostTextLength {
+			return fmt.Errorf("text is longer than %d bytes", maxPostTextLength)
+		}
+		if len(rec.Langs) > maxPostLangs {
+			return fmt.Errorf("more than %d langs", maxPostLangs)
+		}
+		if len(rec.Tags) > maxPostTags {
+			return fmt.Errorf("more than %d tags", maxPostTags)
+		}
+		if rec.Reply != nil {
+			if err := validateStrongRef("reply.root", rec.Reply.Root); err != nil {
+				return err
+			}
+			if err := validateStrongRef("reply.parent", rec.Reply.Parent); err != nil {
+				return err
+			}
+		}
+	case *bsky.FeedLike:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		return validateStrongRef("subject", rec.Subject)
+	case *bsky.FeedRepost:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		return validateStrongRef("subject", rec.Subject)
+	case *bsky.GraphFollow:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		if _, err := syntax.ParseDID(rec.Subject); err != nil {
+			return fmt.Errorf("invalid subject: %w", err)
+		}
+	case *bsky.GraphBlock:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		if _, err := syntax.ParseDID(rec.Subject); err != nil {
+			return fmt.Errorf("invalid subject: %w", err)
+		}
+	case *bsky.ActorProfile:
+		if rec.DisplayName != nil && len(*rec.DisplayName) > maxProfileDisplayNameLen {
+			return fmt.Errorf("displayName is longer than %d bytes", maxProfileDisplayNameLen)
+		}
+		if rec.Description != nil && len(*rec.Description) > maxProfileDescriptionLen {
+			return fmt.Errorf("description is longer than %d bytes", maxProfileDescriptionLen)
+		}
+	case *bsky.ActorStatus:
+		if err := validateDatetime(rec.CreatedAt); err != nil {
+			return err
+		}
+		if rec.Status == "" {
+			return fmt.Errorf("missing status")
+		}
+		if rec.DurationMinutes != nil && *rec.DurationMinutes < 1 {
+			return fmt.Errorf("status duration must be at least a minute")
+		}
+	}
+
+	return nil
+}
+
+func validateDatetime(s string) error {
+	if _, err := util.ParseTimestamp(s); err != nil {
+		return fmt.Errorf("invalid createdAt: %w", err)
+	}
+
+	return nil
+}
+
+func validateStrongRef(field string, ref *comatproto.RepoStrongRef) error {
+	if ref == nil {
+		return fmt.Errorf("missing %s", field)
+	}
+
+	if _, err := syntax.ParseATURI(ref.Uri); err != nil {
+		return fmt.Errorf("invalid %s uri: %w", field, err)
+	}
+
+	if _, err := cid.Decode(ref.Cid); err != nil {
+		return fmt.Errorf("invalid %s cid: %w", field, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/ipfs/go-cid"
+)
+
+func TestValidateRecord(t *testing.T) {
+	createdAt := "2023-07-04T12:30:00.000Z"
+	goodRef := &comatproto.RepoStrongRef{
+		Uri: "at://did:plc:alice/app.bsky.feed.post/3jzfcijpj2z2a",
+		Cid: "bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454",
+	}
+
+	cases := []struct {
+		name  string
+		rec   any
+		valid bool
+	}{
+		{"post", &bsky.FeedPost{CreatedAt: createdAt, Text: "hello"}, true},
+		{"post bad date", &bsky.FeedPost{CreatedAt: "yesterday", Text: "hello"}, false},
+		{"post too long", &bsky.FeedPost{CreatedAt: createdAt, Text: strings.Repeat("a", maxPostTextLength+1)}, false},
+		{"post bad reply", &bsky.FeedPost{CreatedAt: createdAt, Reply: &bsky.FeedPost_ReplyRef{Root: goodRef}}, false},
+		{"like", &bsky.FeedLike{CreatedAt: createdAt, Subject: goodRef}, true},
+		{"like bad cid", &bsky.FeedLike{CreatedAt: createdAt, Subject: &comatproto.RepoStrongRef{Uri: goodRef.Uri, Cid: "nope"}}, false},
+		{"follow", &bsky.GraphFollow{CreatedAt: createdAt, Subject: "did:plc:bob"}, true},
+		{"follow bad subject", &bsky.GraphFollow{CreatedAt: createdAt, Subject: "bob.test"}, false},
+	}
+
+	for _, c := range cases {
+		err := validateRecord(c.rec)
+		if c.valid && err != nil {
+			t.Errorf("%s: expected valid record, got %s", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expected validation error", c.name)
+		}
+	}
+}
+
+func TestInvalidUpdateSkipped(t *testing.T) {
+	tt := testIndexer(t)
+	defer tt.Cleanup()
+
+	ix := tt.ix
+	ix.SetRecordCidVerification(false)
+	ix.SetRecordValidation(true)
+
+	if err := ix.db.Create(&models.ActorInfo{Uid: 1, Did: "did:plc:alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := &repomgr.RepoOp{
+		Kind:       repomgr.EvtKindUpdateRecord,
+		Collection: "app.bsky.feed.post",
+		Rkey:       "3jzfcijpj2z2a",
+		RecCid:     &cc,
+		Record:     &bsky.FeedPost{CreatedAt: "yesterday", Text: "hello"},
+	}
+	if err := ix.handleRecordUpdate(context.Background(), &repomgr.RepoEvent{User: 1}, op, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := ix.db.Model(&models.FeedPost{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected the invalid update not to be aggregated, got %d posts", count)
+	}
+}
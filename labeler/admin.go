@@ -84,7 +84,7 @@ func (s *Server) hydrateModerationActionViews(ctx context.Context, rows []models
 		case "com.atproto.repo.repoRef":
 			subj = &comatproto.AdminDefs_ActionView_Subject{
 				AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
-					LexiconTypeID: "com.atproto.repo.repoRef",
+					LexiconTypeID: "com.atproto.admin.defs#repoRef",
 					Did:           row.SubjectDid,
 				},
 			}
@@ -110,6 +110,8 @@ func (s *Server) hydrateModerationActionViews(ctx context.Context, rows []models
 			Reversal:          reversal,
 			Subject:           subj,
 			SubjectBlobCids:   subjectBlobCIDs,
+			CreateLabelVals:   splitLabelVals(row.CreateLabelVals),
+			NegateLabelVals:   splitLabelVals(row.NegateLabelVals),
 		}
 		out = append(out, view)
 	}
@@ -182,6 +184,8 @@ func (s *Server) hydrateModerationActionDetails(ctx context.Context, rows []mode
 			Reversal:        reversal,
 			Subject:         subj,
 			SubjectBlobs:    subjectBlobViews,
+			CreateLabelVals: splitLabelVals(row.CreateLabelVals),
+			NegateLabelVals: splitLabelVals(row.NegateLabelVals),
 		}
 		out = append(out, viewDetail)
 	}
@@ -207,7 +211,7 @@ func (s *Server) hydrateModerationReportViews(ctx context.Context, rows []models
 		case "com.atproto.repo.repoRef":
 			subj = &comatproto.AdminDefs_ReportView_Subject{
 				AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
-					LexiconTypeID: "com.atproto.repo.repoRef",
+					LexiconTypeID: "com.atproto.admin.defs#repoRef",
 					Did:           row.SubjectDid,
 				},
 			}
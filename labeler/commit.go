@@ -16,6 +16,14 @@ import (
 
 // Persist to database (and repo), and emit events.
 func (s *Server) CommitLabels(ctx context.Context, labels []*label.Label, negate bool) error {
+	return s.commitLabels(ctx, labels, negate, false)
+}
+
+// If 'overwrite' is set, existing label rows for the same subject and value
+// are updated in place (eg, to flip negation) instead of being left as-is.
+// This is what human moderation actions want; automated labelers should not
+// clobber those.
+func (s *Server) commitLabels(ctx context.Context, labels []*label.Label, negate, overwrite bool) error {
 
 	now := time.Now()
 	nowStr := now.Format(util.ISO8601)
@@ -51,9 +59,42 @@ func (s *Server) CommitLabels(ctx context.Context, labels []*label.Label, negate
 	// ... and database ...
 	if len(labelRows) > 0 {
 		// TODO(bnewbold): don't clobber action labels (aka, human interventions)
-		res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&labelRows)
-		if res.Error != nil {
-			return res.Error
+		if !overwrite {
+			res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&labelRows)
+			if res.Error != nil {
+				return res.Error
+			}
+		} else {
+			// rows with and without a cid are unique by different indexes,
+			// see models.Label
+			var withCid, withoutCid []models.Label
+			for _, lr := range labelRows {
+				if lr.Cid != nil {
+					withCid = append(withCid, lr)
+				} else {
+					withoutCid = append(withoutCid, lr)
+				}
+			}
+			updates := clause.AssignmentColumns([]string{"neg", "repo_r_key", "updated_at"})
+			if len(withCid) > 0 {
+				res := s.db.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "uri"}, {Name: "source_did"}, {Name: "val"}, {Name: "cid"}},
+					DoUpdates: updates,
+				}).Create(&withCid)
+				if res.Error != nil {
+					return res.Error
+				}
+			}
+			if len(withoutCid) > 0 {
+				res := s.db.Clauses(clause.OnConflict{
+					Columns:     []clause.Column{{Name: "uri"}, {Name: "source_did"}, {Name: "val"}},
+					TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "cid IS NULL"}}},
+					DoUpdates:   updates,
+				}).Create(&withoutCid)
+				if res.Error != nil {
+					return res.Error
+				}
+			}
 		}
 	}
 
@@ -34,8 +34,13 @@ func testGetReport(t *testing.T, e *echo.Echo, lm *Server, reportId int64) comat
 	assert.Equal(reportId, reportViewDetail.Id)
 
 	// read back (getModerationReports) and verify output
-	// TODO: include 'subject' param
-	req = httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationReports", nil)
+	params = make(url.Values)
+	if reportViewDetail.Subject.AdminDefs_RepoView != nil {
+		params.Set("subject", reportViewDetail.Subject.AdminDefs_RepoView.Did)
+	} else if reportViewDetail.Subject.AdminDefs_RecordView != nil {
+		params.Set("subject", reportViewDetail.Subject.AdminDefs_RecordView.Uri)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationReports?"+params.Encode(), nil)
 	recorder = httptest.NewRecorder()
 	c = e.NewContext(req, recorder)
 	assert.NoError(lm.HandleComAtprotoAdminGetModerationReports(c))
@@ -0,0 +1,134 @@
+package labeler
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	label "github.com/bluesky-social/indigo/api/label"
+	"github.com/bluesky-social/indigo/models"
+)
+
+// action values which take down the subject. the short form is accepted for
+// older clients.
+func isTakedownAction(action string) bool {
+	return action == "com.atproto.admin.defs#takedown" || action == "takedown"
+}
+
+// label published on subjects which are taken down, so that consumers of
+// our labels hide them
+const takedownLabel = "!takedown"
+
+// moderationState is the net effect of all the non-reversed moderation
+// actions on a single subject
+type moderationState struct {
+	TakenDown bool
+	Labels    map[string]bool
+}
+
+// label values are stored on the action row as a comma-separated list
+func joinLabelVals(vals []string) string {
+	return strings.Join(vals, ",")
+}
+
+func splitLabelVals(vals string) []string {
+	if vals == "" {
+		return nil
+	}
+	return strings.Split(vals, ",")
+}
+
+// Recomputes the effective moderation state of an action's subject by
+// replaying every non-reversed action on that subject, oldest first. Later
+// actions win: a label created by one action and negated by a later one is
+// not applied.
+func (s *Server) subjectModerationState(ctx context.Context, subj *models.ModerationAction) (*moderationState, error) {
+	q := s.db.Where("reversed_at IS NULL").Where("subject_type = ?", subj.SubjectType).Order("id asc")
+	if subj.SubjectUri != nil {
+		q = q.Where("subject_uri = ?", *subj.SubjectUri)
+	} else {
+		q = q.Where("subject_did = ?", subj.SubjectDid)
+	}
+
+	var rows []models.ModerationAction
+	if err := q.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	state := &moderationState{Labels: make(map[string]bool)}
+	for _, row := range rows {
+		if isTakedownAction(row.Action) {
+			state.TakenDown = true
+		}
+		for _, val := range splitLabelVals(row.CreateLabelVals) {
+			state.Labels[val] = true
+		}
+		for _, val := range splitLabelVals(row.NegateLabelVals) {
+			delete(state.Labels, val)
+		}
+	}
+	return state, nil
+}
+
+// the label values a state puts on its subject, including the takedown label
+func (st *moderationState) labelVals() map[string]bool {
+	vals := make(map[string]bool, len(st.Labels)+1)
+	for val := range st.Labels {
+		vals[val] = true
+	}
+	if st.TakenDown {
+		vals[takedownLabel] = true
+	}
+	return vals
+}
+
+// Publishes the label changes needed to go from one effective state of a
+// subject to another. Takedowns are enforced through takedownLabel.
+func (s *Server) applyModerationStateChange(ctx context.Context, subj *models.ModerationAction, before, after *moderationState) error {
+	beforeVals, afterVals := before.labelVals(), after.labelVals()
+
+	var added, removed []string
+	for val := range afterVals {
+		if !beforeVals[val] {
+			added = append(added, val)
+		}
+	}
+	for val := range beforeVals {
+		if !afterVals[val] {
+			removed = append(removed, val)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	if len(added) > 0 {
+		if err := s.commitLabels(ctx, s.subjectLabels(subj, added, false), false, true); err != nil {
+			return err
+		}
+	}
+	if len(removed) > 0 {
+		if err := s.commitLabels(ctx, s.subjectLabels(subj, removed, true), true, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) subjectLabels(subj *models.ModerationAction, vals []string, negate bool) []*label.Label {
+	var out []*label.Label
+	for _, val := range vals {
+		l := &label.Label{
+			Src: s.user.Did,
+			Val: val,
+			Neg: negate,
+		}
+		if subj.SubjectUri != nil {
+			l.Uri = *subj.SubjectUri
+			l.Cid = subj.SubjectCid
+		} else {
+			l.Uri = "at://" + subj.SubjectDid
+		}
+		out = append(out, l)
+	}
+	return out
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/bluesky-social/indigo/api"
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
@@ -50,6 +51,10 @@ type Server struct {
 	muNSFWImgLabeler    *MicroNSFWImgLabeler
 	hiveAILabeler       *HiveAILabeler
 	sqrlLabeler         *SQRLLabeler
+	reportWebhook       *ReportWebhook
+
+	// how long takeModerationAction idempotency keys are honored for
+	IdempotencyKeyTTL time.Duration
 }
 
 type RepoConfig struct {
@@ -70,6 +75,7 @@ func NewServer(db *gorm.DB, cs *carstore.CarStore, repoUser RepoConfig, plcURL,
 	db.AutoMigrate(models.ModerationActionSubjectBlobCid{})
 	db.AutoMigrate(models.ModerationReport{})
 	db.AutoMigrate(models.ModerationReportResolution{})
+	db.AutoMigrate(models.ModerationActionIdempotencyKey{})
 
 	didr := &api.PLCServer{Host: plcURL}
 	kmgr := indexer.NewKeyManager(didr, repoUser.SigningKey)
@@ -94,6 +100,7 @@ func NewServer(db *gorm.DB, cs *carstore.CarStore, repoUser RepoConfig, plcURL,
 		blobPdsURL:          blobPdsURL,
 		xrpcProxyURL:        proxyURL,
 		xrpcProxyAuthHeader: xrpcProxyAuthHeader,
+		IdempotencyKeyTTL:   24 * time.Hour,
 		// sluper configured below
 	}
 
@@ -144,6 +151,13 @@ func (s *Server) AddSQRLLabeler(url string) {
 	s.sqrlLabeler = &sl
 }
 
+// Configures an outbound webhook which is sent every newly created moderation report, signed with the given secret
+func (s *Server) AddReportWebhook(url, secret string) {
+	log.Infof("configuring report webhook url=%s", url)
+	s.reportWebhook = NewReportWebhook(url, secret, 1000)
+	go s.reportWebhook.Run(context.Background())
+}
+
 // call this *after* all the labelers are configured
 func (s *Server) SubscribeBGS(ctx context.Context, bgsURL string, useWss bool) {
 	// subscribe our RepoEvent slurper to the BGS, to receive incoming records for labeler
@@ -0,0 +1,124 @@
+package labeler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/util/version"
+)
+
+// ReportWebhookSignatureHeader carries the hex-encoded HMAC-SHA256 of the
+// request body, keyed with the webhook secret.
+const ReportWebhookSignatureHeader = "X-Labelmaker-Signature"
+
+// ReportWebhook POSTs newly created moderation reports to an external URL.
+// Deliveries are queued and sent from a background goroutine, so a slow or
+// failing endpoint never blocks report creation; when the queue is full,
+// new reports are dropped (and logged) rather than waiting.
+type ReportWebhook struct {
+	Client     http.Client
+	URL        string
+	Secret     []byte
+	MaxRetries int
+	Backoff    time.Duration
+
+	queue chan *comatproto.ModerationCreateReport_Output
+}
+
+func NewReportWebhook(url, secret string, queueSize int) *ReportWebhook {
+	return &ReportWebhook{
+		Client:     http.Client{Timeout: 10 * time.Second},
+		URL:        url,
+		Secret:     []byte(secret),
+		MaxRetries: 5,
+		Backoff:    time.Second,
+		queue:      make(chan *comatproto.ModerationCreateReport_Output, queueSize),
+	}
+}
+
+// Enqueue schedules delivery of a report, returning false if the queue is full
+func (wh *ReportWebhook) Enqueue(report *comatproto.ModerationCreateReport_Output) bool {
+	select {
+	case wh.queue <- report:
+		return true
+	default:
+		log.Warnw("report webhook queue full, dropping report", "reportId", report.Id)
+		return false
+	}
+}
+
+// Run delivers queued reports until the context is cancelled
+func (wh *ReportWebhook) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case report := <-wh.queue:
+			if err := wh.deliverWithRetry(ctx, report); err != nil {
+				log.Errorw("failed to deliver report webhook", "reportId", report.Id, "err", err)
+			}
+		}
+	}
+}
+
+func (wh *ReportWebhook) deliverWithRetry(ctx context.Context, report *comatproto.ModerationCreateReport_Output) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	backoff := wh.Backoff
+	for attempt := 0; ; attempt++ {
+		err = wh.deliver(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= wh.MaxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		log.Warnw("report webhook delivery failed, retrying", "reportId", report.Id, "attempt", attempt+1, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (wh *ReportWebhook) deliver(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "labelmaker/"+version.Version)
+	req.Header.Set(ReportWebhookSignatureHeader, wh.Sign(body))
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the body
+func (wh *ReportWebhook) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, wh.Secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
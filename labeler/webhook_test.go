@@ -0,0 +1,66 @@
+package labeler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportWebhookRetryAndSign(t *testing.T) {
+	assert := assert.New(t)
+
+	var attempts int32
+	received := make(chan comatproto.ModerationCreateReport_Output, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first attempt to exercise retry
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		wh := ReportWebhook{Secret: []byte("sekrit")}
+		if r.Header.Get(ReportWebhookSignatureHeader) != wh.Sign(body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var out comatproto.ModerationCreateReport_Output
+		if err := json.Unmarshal(body, &out); err != nil {
+			t.Error(err)
+		}
+		received <- out
+	}))
+	defer srv.Close()
+
+	wh := NewReportWebhook(srv.URL, "sekrit", 1)
+	wh.Backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.Run(ctx)
+
+	assert.True(wh.Enqueue(&comatproto.ModerationCreateReport_Output{Id: 123}))
+
+	select {
+	case out := <-received:
+		assert.Equal(int64(123), out.Id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestReportWebhookQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	// no worker running, so the single queue slot stays occupied
+	wh := NewReportWebhook("http://localhost:1", "sekrit", 1)
+	assert.True(wh.Enqueue(&comatproto.ModerationCreateReport_Output{Id: 1}))
+	assert.False(wh.Enqueue(&comatproto.ModerationCreateReport_Output{Id: 2}))
+}
@@ -114,7 +114,14 @@ func (s *Server) HandleComAtprotoAdminGetModerationAction(c echo.Context) error
 func (s *Server) HandleComAtprotoAdminGetModerationActions(c echo.Context) error {
 	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoAdminGetModerationActions")
 	defer span.End()
-	before := c.QueryParam("before")
+
+	// newer lexicons renamed 'before' to 'cursor'; accept both, preferring 'cursor'
+	cursor := c.QueryParam("cursor")
+	legacyBefore := false
+	if cursor == "" && c.QueryParam("before") != "" {
+		cursor = c.QueryParam("before")
+		legacyBefore = true
+	}
 
 	var limit int
 	if p := c.QueryParam("limit"); p != "" {
@@ -129,14 +136,28 @@ func (s *Server) HandleComAtprotoAdminGetModerationActions(c echo.Context) error
 	subject := c.QueryParam("subject")
 	var out *atproto.AdminGetModerationActions_Output
 	var handleErr error
-	// func (s *Server) handleComAtprotoAdminGetModerationActions(ctx context.Context,before string,limit int,subject string) (*atproto.AdminGetModerationActions_Output, error)
-	out, handleErr = s.handleComAtprotoAdminGetModerationActions(ctx, before, limit, subject)
+	// func (s *Server) handleComAtprotoAdminGetModerationActions(ctx context.Context,cursor string,limit int,subject string) (*atproto.AdminGetModerationActions_Output, error)
+	out, handleErr = s.handleComAtprotoAdminGetModerationActions(ctx, cursor, limit, subject)
 	if handleErr != nil {
 		return handleErr
 	}
+	if legacyBefore {
+		return c.JSON(200, &legacyModerationActionsOutput{
+			AdminGetModerationActions_Output: out,
+			Before:                           out.Cursor,
+		})
+	}
 	return c.JSON(200, out)
 }
 
+// legacyModerationActionsOutput echoes the next page token back in a 'before'
+// field for clients still paginating with the old parameter name. The 'cursor'
+// field is included as well.
+type legacyModerationActionsOutput struct {
+	*atproto.AdminGetModerationActions_Output
+	Before *string `json:"before,omitempty"`
+}
+
 func (s *Server) HandleComAtprotoAdminGetModerationReport(c echo.Context) error {
 	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoAdminGetModerationReport")
 	defer span.End()
@@ -180,16 +201,42 @@ func (s *Server) HandleComAtprotoAdminGetModerationReports(c echo.Context) error
 		resolved = &resolved_val
 	}
 	subject := c.QueryParam("subject")
+	reporters := c.QueryParams()["reporters"]
 	var out *atproto.AdminGetModerationReports_Output
 	var handleErr error
-	// func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context,before string,limit int,resolved *bool,subject string) (*atproto.AdminGetModerationReports_Output, error)
-	out, handleErr = s.handleComAtprotoAdminGetModerationReports(ctx, before, limit, resolved, subject)
+	// func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context,before string,limit int,reporters []string,resolved *bool,subject string) (*atproto.AdminGetModerationReports_Output, error)
+	out, handleErr = s.handleComAtprotoAdminGetModerationReports(ctx, before, limit, reporters, resolved, subject)
 	if handleErr != nil {
 		return handleErr
 	}
+
+	// the total is an extra COUNT(*) query, so only computed on request
+	if p := c.QueryParam("includeTotal"); p != "" {
+		includeTotal, err := strconv.ParseBool(p)
+		if err != nil {
+			return err
+		}
+		if includeTotal {
+			total, err := s.countModerationReports(ctx, reporters, resolved, subject)
+			if err != nil {
+				return err
+			}
+			return c.JSON(200, &moderationReportsWithTotalOutput{
+				AdminGetModerationReports_Output: out,
+				Total:                            &total,
+			})
+		}
+	}
 	return c.JSON(200, out)
 }
 
+// moderationReportsWithTotalOutput extends the getModerationReports output
+// with the number of reports matching the filters across all pages.
+type moderationReportsWithTotalOutput struct {
+	*atproto.AdminGetModerationReports_Output
+	Total *int64 `json:"total,omitempty"`
+}
+
 func (s *Server) HandleComAtprotoAdminResolveModerationReports(c echo.Context) error {
 	ctx, span := otel.Tracer("server").Start(c.Request().Context(), "HandleComAtprotoAdminResolveModerationReports")
 	defer span.End()
@@ -236,8 +283,10 @@ func (s *Server) HandleComAtprotoAdminTakeModerationAction(c echo.Context) error
 	}
 	var out *atproto.AdminDefs_ActionView
 	var handleErr error
-	// func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,body *atproto.AdminTakeModerationAction_Input) (*atproto.AdminDefs_ActionView, error)
-	out, handleErr = s.handleComAtprotoAdminTakeModerationAction(ctx, &body)
+	// func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,body *atproto.AdminTakeModerationAction_Input,idempotencyKey string) (*atproto.AdminDefs_ActionView, error)
+	// optional; lets clients safely retry without creating duplicate actions
+	idempotencyKey := c.Request().Header.Get("Idempotency-Key")
+	out, handleErr = s.handleComAtprotoAdminTakeModerationAction(ctx, &body, idempotencyKey)
 	if handleErr != nil {
 		return handleErr
 	}
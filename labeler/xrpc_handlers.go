@@ -14,11 +14,13 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func (s *Server) handleComAtprotoServerDescribeServer(ctx context.Context) (*atproto.ServerDescribeServer_Output, error) {
 	invcode := true
 	return &atproto.ServerDescribeServer_Output{
+		Did:                  s.user.Did,
 		InviteCodeRequired:   &invcode,
 		AvailableUserDomains: []string{},
 		Links:                &atproto.ServerDescribeServer_Links{},
@@ -118,7 +120,7 @@ func (s *Server) handleComAtprotoAdminGetModerationAction(ctx context.Context, i
 	return full[0], nil
 }
 
-func (s *Server) handleComAtprotoAdminGetModerationActions(ctx context.Context, before string, limit int, subject string) (*atproto.AdminGetModerationActions_Output, error) {
+func (s *Server) handleComAtprotoAdminGetModerationActions(ctx context.Context, cursor string, limit int, subject string) (*atproto.AdminGetModerationActions_Output, error) {
 
 	if limit <= 0 {
 		limit = 20
@@ -128,7 +130,6 @@ func (s *Server) handleComAtprotoAdminGetModerationActions(ctx context.Context,
 	}
 
 	q := s.db.Limit(limit).Order("id desc")
-	cursor := before
 	if cursor != "" {
 		cursorID, err := strconv.Atoi(cursor)
 		if err != nil {
@@ -180,7 +181,7 @@ func (s *Server) handleComAtprotoAdminGetModerationReport(ctx context.Context, i
 	return full[0], nil
 }
 
-func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context, before string, limit int, resolved *bool, subject string) (*atproto.AdminGetModerationReports_Output, error) {
+func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context, before string, limit int, reporters []string, resolved *bool, subject string) (*atproto.AdminGetModerationReports_Output, error) {
 
 	if limit <= 0 {
 		limit = 20
@@ -200,7 +201,11 @@ func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context,
 	}
 
 	if subject != "" {
-		q = q.Where("subject = ?", subject)
+		q = filterReportSubject(q, subject)
+	}
+
+	if len(reporters) > 0 {
+		q = q.Where("reported_by_did IN ?", reporters)
 	}
 
 	var reportRows []models.ModerationReport
@@ -243,6 +248,41 @@ func (s *Server) handleComAtprotoAdminGetModerationReports(ctx context.Context,
 	return &out, nil
 }
 
+// countModerationReports returns the number of reports matching the same
+// filters as getModerationReports, ignoring pagination. Unlike the listing
+// (which filters on resolution after hydration), the resolved filter is
+// applied in SQL here, counting only non-reversed resolving actions.
+func (s *Server) countModerationReports(ctx context.Context, reporters []string, resolved *bool, subject string) (int64, error) {
+
+	q := s.db.Model(&models.ModerationReport{})
+	if subject != "" {
+		q = filterReportSubject(q, subject)
+	}
+
+	if len(reporters) > 0 {
+		q = q.Where("reported_by_did IN ?", reporters)
+	}
+
+	if resolved != nil {
+		sub := s.db.Table("moderation_report_resolutions").
+			Select("1").
+			Joins("join moderation_actions on moderation_actions.id = moderation_report_resolutions.action_id").
+			Where("moderation_report_resolutions.report_id = moderation_reports.id").
+			Where("moderation_actions.reversed_at IS NULL")
+		if *resolved {
+			q = q.Where("EXISTS (?)", sub)
+		} else {
+			q = q.Where("NOT EXISTS (?)", sub)
+		}
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 func (s *Server) handleComAtprotoAdminResolveModerationReports(ctx context.Context, body *atproto.AdminResolveModerationReports_Input) (*atproto.AdminDefs_ActionView, error) {
 
 	if body.CreatedBy == "" {
@@ -306,6 +346,11 @@ func (s *Server) handleComAtprotoAdminReverseModerationAction(ctx context.Contex
 		return nil, echo.NewHTTPError(400, "action has already been reversed actionId=%d", body.Id)
 	}
 
+	before, err := s.subjectModerationState(ctx, &row)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	row.ReversedByDid = &body.CreatedBy
 	row.ReversedReason = &body.Reason
@@ -316,9 +361,29 @@ func (s *Server) handleComAtprotoAdminReverseModerationAction(ctx context.Contex
 		return nil, result.Error
 	}
 
+	// other actions on the same subject may still be in effect, so recompute
+	// from what remains instead of just undoing this action's labels
+	after, err := s.subjectModerationState(ctx, &row)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyModerationStateChange(ctx, &row, before, after); err != nil {
+		return nil, err
+	}
+
 	return s.fetchSingleModerationAction(ctx, body.Id)
 }
 
+// filterReportSubject narrows a report query to a subject given as either a
+// DID, matching reports on the account as a whole, or the at:// uri of a
+// reported record.
+func filterReportSubject(q *gorm.DB, subject string) *gorm.DB {
+	if strings.HasPrefix(subject, "at://") {
+		return q.Where("subject_type = ? AND subject_uri = ?", "com.atproto.repo.recordRef", subject)
+	}
+	return q.Where("subject_type = ? AND subject_did = ?", "com.atproto.repo.repoRef", subject)
+}
+
 func didFromURI(uri string) string {
 	parts := strings.SplitN(uri, "/", 4)
 	if len(parts) < 3 {
@@ -330,7 +395,7 @@ func didFromURI(uri string) string {
 	return ""
 }
 
-func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context, body *atproto.AdminTakeModerationAction_Input) (*atproto.AdminDefs_ActionView, error) {
+func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context, body *atproto.AdminTakeModerationAction_Input, idempotencyKey string) (*atproto.AdminDefs_ActionView, error) {
 
 	if body.Action == "" {
 		return nil, echo.NewHTTPError(400, "action param must be non-empty")
@@ -342,10 +407,23 @@ func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,
 		return nil, echo.NewHTTPError(400, "reason param was provided, but empty string")
 	}
 
+	// a retried request returns the action created by the original request
+	if idempotencyKey != "" {
+		actionId, err := s.lookupIdempotencyKey(ctx, idempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if actionId != 0 {
+			return s.fetchSingleModerationAction(ctx, int64(actionId))
+		}
+	}
+
 	row := models.ModerationAction{
-		Action:       body.Action,
-		Reason:       body.Reason,
-		CreatedByDid: body.CreatedBy,
+		Action:          body.Action,
+		Reason:          body.Reason,
+		CreatedByDid:    body.CreatedBy,
+		CreateLabelVals: joinLabelVals(body.CreateLabelVals),
+		NegateLabelVals: joinLabelVals(body.NegateLabelVals),
 	}
 
 	var outSubj atproto.AdminDefs_ActionView_Subject
@@ -353,7 +431,7 @@ func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,
 		row.SubjectType = "com.atproto.repo.repoRef"
 		row.SubjectDid = body.Subject.AdminDefs_RepoRef.Did
 		outSubj.AdminDefs_RepoRef = &atproto.AdminDefs_RepoRef{
-			LexiconTypeID: "com.atproto.repo.repoRef",
+			LexiconTypeID: "com.atproto.admin.defs#repoRef",
 			Did:           row.SubjectDid,
 		}
 	} else if body.Subject.RepoStrongRef != nil {
@@ -376,24 +454,68 @@ func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,
 		return nil, echo.NewHTTPError(400, "report subject must be a repoRef or a recordRef")
 	}
 
-	result := s.db.Create(&row)
-	if result.Error != nil {
-		return nil, result.Error
+	before, err := s.subjectModerationState(ctx, &row)
+	if err != nil {
+		return nil, err
 	}
 
-	var cidRows []models.ModerationActionSubjectBlobCid
-	for _, sbc := range body.SubjectBlobCids {
-		cidRows = append(cidRows, models.ModerationActionSubjectBlobCid{
-			ActionId: row.ID,
-			Cid:      sbc,
-		})
-	}
+	var replayId uint64
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if idempotencyKey != "" {
+			// claiming the key before creating anything makes a concurrent
+			// retry wait for this transaction, then find the key taken
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ModerationActionIdempotencyKey{
+				IdempotencyKey: idempotencyKey,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				var existing models.ModerationActionIdempotencyKey
+				if err := tx.First(&existing, "idempotency_key = ?", idempotencyKey).Error; err != nil {
+					return err
+				}
+				replayId = existing.ActionId
+				return nil
+			}
+		}
 
-	if len(cidRows) > 0 {
-		result = s.db.Create(&cidRows)
-		if result.Error != nil {
-			return nil, result.Error
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+
+		var cidRows []models.ModerationActionSubjectBlobCid
+		for _, sbc := range body.SubjectBlobCids {
+			cidRows = append(cidRows, models.ModerationActionSubjectBlobCid{
+				ActionId: row.ID,
+				Cid:      sbc,
+			})
+		}
+
+		if len(cidRows) > 0 {
+			if err := tx.Create(&cidRows).Error; err != nil {
+				return err
+			}
+		}
+
+		if idempotencyKey != "" {
+			return tx.Model(&models.ModerationActionIdempotencyKey{}).Where("idempotency_key = ?", idempotencyKey).Update("action_id", row.ID).Error
 		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if replayId != 0 {
+		return s.fetchSingleModerationAction(ctx, int64(replayId))
+	}
+
+	after, err := s.subjectModerationState(ctx, &row)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyModerationStateChange(ctx, &row, before, after); err != nil {
+		return nil, err
 	}
 
 	out := atproto.AdminDefs_ActionView{
@@ -404,10 +526,33 @@ func (s *Server) handleComAtprotoAdminTakeModerationAction(ctx context.Context,
 		CreatedAt:       row.CreatedAt.Format(time.RFC3339),
 		Subject:         &outSubj,
 		SubjectBlobCids: body.SubjectBlobCids,
+		CreateLabelVals: body.CreateLabelVals,
+		NegateLabelVals: body.NegateLabelVals,
 	}
 	return &out, nil
 }
 
+// returns the action ID previously recorded for the idempotency key, or zero
+// if the key is unknown or older than the configured TTL
+func (s *Server) lookupIdempotencyKey(ctx context.Context, key string) (uint64, error) {
+	cutoff := time.Now().Add(-s.IdempotencyKeyTTL)
+
+	// opportunistically prune expired keys
+	if err := s.db.Where("created_at < ?", cutoff).Delete(&models.ModerationActionIdempotencyKey{}).Error; err != nil {
+		return 0, err
+	}
+
+	var row models.ModerationActionIdempotencyKey
+	result := s.db.Where("idempotency_key = ? AND created_at >= ?", key, cutoff).Limit(1).Find(&row)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, nil
+	}
+	return row.ActionId, nil
+}
+
 func (s *Server) handleComAtprotoReportCreate(ctx context.Context, body *atproto.ModerationCreateReport_Input) (*atproto.ModerationCreateReport_Output, error) {
 
 	if body.ReasonType == nil || *body.ReasonType == "" {
@@ -431,7 +576,7 @@ func (s *Server) handleComAtprotoReportCreate(ctx context.Context, body *atproto
 		row.SubjectType = "com.atproto.repo.repoRef"
 		row.SubjectDid = body.Subject.AdminDefs_RepoRef.Did
 		outSubj.AdminDefs_RepoRef = &atproto.AdminDefs_RepoRef{
-			LexiconTypeID: "com.atproto.repo.repoRef",
+			LexiconTypeID: "com.atproto.admin.defs#repoRef",
 			Did:           row.SubjectDid,
 		}
 	} else if body.Subject.RepoStrongRef != nil {
@@ -470,5 +615,8 @@ func (s *Server) handleComAtprotoReportCreate(ctx context.Context, body *atproto
 		ReportedBy: row.ReportedByDid,
 		Subject:    &outSubj,
 	}
+	if s.reportWebhook != nil {
+		s.reportWebhook.Enqueue(&out)
+	}
 	return &out, nil
 }
@@ -12,9 +12,11 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	label "github.com/bluesky-social/indigo/api/label"
+	"github.com/bluesky-social/indigo/models"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestLabelMakerXRPCReportRepo(t *testing.T) {
@@ -286,6 +288,420 @@ func TestLabelMakerXRPCReportAction(t *testing.T) {
 	assert.Equal(reversalOut.Reversal, actionOutDetail.Reversal)
 }
 
+func TestLabelMakerXRPCGetActionsPagination(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+
+	for i := 0; i < 3; i++ {
+		testCreateAction(t, e, lm, &comatproto.AdminTakeModerationAction_Input{
+			Action:    "acknowledge",
+			CreatedBy: "did:plc:ADMIN",
+			Reason:    "paging",
+			Subject: &comatproto.AdminTakeModerationAction_Input_Subject{
+				AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+					Did: "did:plc:123",
+				},
+			},
+		})
+	}
+
+	getPage := func(params url.Values) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationActions?"+params.Encode(), nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		assert.NoError(lm.HandleComAtprotoAdminGetModerationActions(c))
+		assert.Equal(200, recorder.Code)
+		var out map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// current lexicon: 'cursor' in, 'cursor' out
+	params := make(url.Values)
+	params.Set("limit", "2")
+	page := getPage(params)
+	assert.Equal(2, len(page["actions"].([]any)))
+	assert.Equal("2", page["cursor"])
+	assert.Nil(page["before"])
+
+	params.Set("cursor", "2")
+	page = getPage(params)
+	assert.Equal(1, len(page["actions"].([]any)))
+
+	// legacy lexicon: 'before' in, token echoed back as 'before'
+	params = make(url.Values)
+	params.Set("limit", "1")
+	params.Set("before", "3")
+	page = getPage(params)
+	assert.Equal(1, len(page["actions"].([]any)))
+	assert.Equal("2", page["before"])
+	assert.Equal("2", page["cursor"])
+
+	// 'cursor' wins when both are passed
+	params.Set("cursor", "2")
+	page = getPage(params)
+	assert.Equal("1", page["cursor"])
+	assert.Nil(page["before"])
+}
+
+func TestLabelMakerXRPCGetReportsTotal(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+
+	rt := "spam"
+	var reportIds []int64
+	for i := 0; i < 3; i++ {
+		out := testCreateReport(t, e, lm, &comatproto.ModerationCreateReport_Input{
+			ReasonType: &rt,
+			Subject: &comatproto.ModerationCreateReport_Input_Subject{
+				AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+					Did: "did:plc:123",
+				},
+			},
+		})
+		reportIds = append(reportIds, out.Id)
+	}
+
+	// resolve one of the reports
+	actionOut := testCreateAction(t, e, lm, &comatproto.AdminTakeModerationAction_Input{
+		Action:    "acknowledge",
+		CreatedBy: "did:plc:ADMIN",
+		Reason:    "counted",
+		Subject: &comatproto.AdminTakeModerationAction_Input_Subject{
+			AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+				Did: "did:plc:123",
+			},
+		},
+	})
+	resolutionJSON, err := json.Marshal(comatproto.AdminResolveModerationReports_Input{
+		ActionId:  actionOut.Id,
+		CreatedBy: "did:plc:ADMIN",
+		ReportIds: []int64{reportIds[0]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/xrpc/com.atproto.report.resolveModerationReports", strings.NewReader(string(resolutionJSON)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c := e.NewContext(req, httptest.NewRecorder())
+	assert.NoError(lm.HandleComAtprotoAdminResolveModerationReports(c))
+
+	getTotal := func(params url.Values) any {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationReports?"+params.Encode(), nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		assert.NoError(lm.HandleComAtprotoAdminGetModerationReports(c))
+		assert.Equal(200, recorder.Code)
+		var out map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out["total"]
+	}
+
+	// not computed unless requested
+	params := make(url.Values)
+	params.Set("limit", "1")
+	assert.Nil(getTotal(params))
+
+	params.Set("includeTotal", "true")
+	assert.Equal(float64(3), getTotal(params))
+
+	params.Set("resolved", "true")
+	assert.Equal(float64(1), getTotal(params))
+
+	params.Set("resolved", "false")
+	assert.Equal(float64(2), getTotal(params))
+}
+
+func TestLabelMakerXRPCGetReportsByReporter(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+
+	rt := "spam"
+	for i := 0; i < 2; i++ {
+		testCreateReport(t, e, lm, &comatproto.ModerationCreateReport_Input{
+			ReasonType: &rt,
+			Subject: &comatproto.ModerationCreateReport_Input_Subject{
+				AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+					Did: "did:plc:123",
+				},
+			},
+		})
+	}
+
+	// a report filed by somebody else
+	assert.NoError(lm.db.Create(&models.ModerationReport{
+		SubjectType:   "com.atproto.repo.repoRef",
+		SubjectDid:    "did:plc:123",
+		ReasonType:    rt,
+		ReportedByDid: "did:plc:bomber",
+	}).Error)
+
+	getReports := func(params url.Values) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationReports?"+params.Encode(), nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		assert.NoError(lm.HandleComAtprotoAdminGetModerationReports(c))
+		assert.Equal(200, recorder.Code)
+		var out map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	params := make(url.Values)
+	params.Set("includeTotal", "true")
+	params.Add("reporters", "did:plc:bomber")
+	out := getReports(params)
+	reports := out["reports"].([]any)
+	assert.Equal(1, len(reports))
+	assert.Equal("did:plc:bomber", reports[0].(map[string]any)["reportedBy"])
+	assert.Equal(float64(1), out["total"])
+
+	// combines with the other filters, and takes several reporters
+	params.Add("reporters", lm.user.Did)
+	params.Set("resolved", "false")
+	out = getReports(params)
+	assert.Equal(3, len(out["reports"].([]any)))
+	assert.Equal(float64(3), out["total"])
+}
+
+func TestLabelMakerXRPCGetReportsBySubject(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+
+	rt := "spam"
+	uri := "at://did:plc:123/com.example.record/bcd234"
+	testCreateReport(t, e, lm, &comatproto.ModerationCreateReport_Input{
+		ReasonType: &rt,
+		Subject: &comatproto.ModerationCreateReport_Input_Subject{
+			AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+				Did: "did:plc:123",
+			},
+		},
+	})
+	testCreateReport(t, e, lm, &comatproto.ModerationCreateReport_Input{
+		ReasonType: &rt,
+		Subject: &comatproto.ModerationCreateReport_Input_Subject{
+			RepoStrongRef: &comatproto.RepoStrongRef{
+				Uri: uri,
+				Cid: "bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454",
+			},
+		},
+	})
+
+	getReports := func(params url.Values) comatproto.AdminGetModerationReports_Output {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/com.atproto.admin.getModerationReports?"+params.Encode(), nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		assert.NoError(lm.HandleComAtprotoAdminGetModerationReports(c))
+		assert.Equal(200, recorder.Code)
+		var out comatproto.AdminGetModerationReports_Output
+		if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// a DID only matches reports on the account itself
+	params := make(url.Values)
+	params.Set("subject", "did:plc:123")
+	out := getReports(params)
+	assert.Equal(1, len(out.Reports))
+	assert.NotNil(out.Reports[0].Subject.AdminDefs_RepoRef)
+	assert.Nil(out.Reports[0].Subject.RepoStrongRef)
+
+	params.Set("subject", uri)
+	out = getReports(params)
+	assert.Equal(1, len(out.Reports))
+	assert.Nil(out.Reports[0].Subject.AdminDefs_RepoRef)
+	assert.Equal(uri, out.Reports[0].Subject.RepoStrongRef.Uri)
+
+	params.Set("subject", "did:plc:other")
+	assert.Equal(0, len(getReports(params).Reports))
+}
+
+func TestLabelMakerXRPCTakeActionIdempotency(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+
+	actionJSON, err := json.Marshal(comatproto.AdminTakeModerationAction_Input{
+		Action:    "takedown",
+		CreatedBy: "did:plc:ADMIN",
+		Reason:    "retried",
+		Subject: &comatproto.AdminTakeModerationAction_Input_Subject{
+			AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+				Did: "did:plc:123",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	takeAction := func(key string) comatproto.AdminDefs_ActionView {
+		req := httptest.NewRequest(http.MethodPost, "/xrpc/com.atproto.admin.takeModerationAction", strings.NewReader(string(actionJSON)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		assert.NoError(lm.HandleComAtprotoAdminTakeModerationAction(c))
+		assert.Equal(200, recorder.Code)
+		var out comatproto.AdminDefs_ActionView
+		if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	first := takeAction("abc")
+	assert.Equal(first.Id, takeAction("abc").Id)
+	assert.NotEqual(first.Id, takeAction("def").Id)
+	assert.NotEqual(first.Id, takeAction("").Id)
+
+	// expired keys are no longer honored
+	lm.IdempotencyKeyTTL = 0
+	assert.NotEqual(first.Id, takeAction("abc").Id)
+}
+
+func TestLabelMakerXRPCTakeActionIdempotencyRace(t *testing.T) {
+	assert := assert.New(t)
+	lm := testLabelMaker(t)
+	ctx := context.TODO()
+
+	input := &comatproto.AdminTakeModerationAction_Input{
+		Action:    "takedown",
+		CreatedBy: "did:plc:ADMIN",
+		Reason:    "retried",
+		Subject: &comatproto.AdminTakeModerationAction_Input_Subject{
+			AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+				Did: "did:plc:123",
+			},
+		},
+	}
+
+	// a retry lands right after the original request found the key unused
+	var retried *comatproto.AdminDefs_ActionView
+	if err := lm.db.Callback().Query().After("gorm:query").Register("test:retry", func(db *gorm.DB) {
+		if retried != nil || db.Statement.Table != "moderation_action_idempotency_keys" {
+			return
+		}
+		retried = &comatproto.AdminDefs_ActionView{}
+		out, err := lm.handleComAtprotoAdminTakeModerationAction(ctx, input, "abc")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		*retried = *out
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := lm.handleComAtprotoAdminTakeModerationAction(ctx, input, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(retried.Id, first.Id)
+
+	var count int64
+	if err := lm.db.Model(&models.ModerationAction{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(int64(1), count)
+}
+
+func TestLabelMakerXRPCReverseOverlappingActions(t *testing.T) {
+	assert := assert.New(t)
+	e := echo.New()
+	lm := testLabelMaker(t)
+	ctx := context.TODO()
+
+	subject := &comatproto.AdminTakeModerationAction_Input_Subject{
+		AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{
+			Did: "did:plc:123",
+		},
+	}
+	first := testCreateAction(t, e, lm, &comatproto.AdminTakeModerationAction_Input{
+		Action:          "com.atproto.admin.defs#takedown",
+		CreatedBy:       "did:plc:ADMIN",
+		Reason:          "first",
+		Subject:         subject,
+		CreateLabelVals: []string{"spam", "rude"},
+	})
+	second := testCreateAction(t, e, lm, &comatproto.AdminTakeModerationAction_Input{
+		Action:          "com.atproto.admin.defs#takedown",
+		CreatedBy:       "did:plc:ADMIN",
+		Reason:          "second",
+		Subject:         subject,
+		CreateLabelVals: []string{"spam"},
+	})
+
+	reverse := func(id int64) {
+		reversalJSON, err := json.Marshal(comatproto.AdminReverseModerationAction_Input{
+			Id:        id,
+			CreatedBy: "did:plc:ADMIN",
+			Reason:    "oops",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/xrpc/com.atproto.admin.reverseModerationAction", strings.NewReader(string(reversalJSON)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		assert.NoError(lm.HandleComAtprotoAdminReverseModerationAction(c))
+	}
+	state := func() *moderationState {
+		row := models.ModerationAction{SubjectType: "com.atproto.repo.repoRef", SubjectDid: "did:plc:123"}
+		st, err := lm.subjectModerationState(ctx, &row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	negated := func(val string) bool {
+		var rows []models.Label
+		if err := lm.db.Where("uri = ? AND val = ?", "at://did:plc:123", val).Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("expected a single %q label row, got %d", val, len(rows))
+		}
+		return rows[0].Neg != nil && *rows[0].Neg
+	}
+
+	st := state()
+	assert.True(st.TakenDown)
+	assert.Equal(map[string]bool{"spam": true, "rude": true}, st.Labels)
+	assert.False(negated(takedownLabel))
+
+	// the second takedown (and its label) keeps the account down
+	reverse(first.Id)
+	st = state()
+	assert.True(st.TakenDown)
+	assert.Equal(map[string]bool{"spam": true}, st.Labels)
+	assert.False(negated("spam"))
+	assert.True(negated("rude"))
+	assert.False(negated(takedownLabel))
+
+	reverse(second.Id)
+	st = state()
+	assert.False(st.TakenDown)
+	assert.Empty(st.Labels)
+	assert.True(negated("spam"))
+	assert.True(negated(takedownLabel))
+}
+
 func TestLabelMakerXRPCLabelQuery(t *testing.T) {
 	assert := assert.New(t)
 	e := echo.New()
@@ -18,11 +18,28 @@ type FeedPost struct {
 	UpCount     int64
 	ReplyCount  int64
 	RepostCount int64
+	QuoteCount  int64
 	ReplyTo     uint
+	QuoteOf     uint
 	Missing     bool
 	Deleted     bool
 }
 
+// PostLang is one of the languages a post declares. Posts that declare none
+// get a single row for the "und" (undetermined) language.
+type PostLang struct {
+	ID   uint   `gorm:"primarykey"`
+	Post uint   `gorm:"uniqueIndex:idx_postlang_post_lang"`
+	Lang string `gorm:"uniqueIndex:idx_postlang_post_lang;index"`
+}
+
+// PostTag is one of the hashtags of a post, lowercased.
+type PostTag struct {
+	ID   uint   `gorm:"primarykey"`
+	Post uint   `gorm:"uniqueIndex:idx_posttag_post_tag"`
+	Tag  string `gorm:"uniqueIndex:idx_posttag_post_tag;index"`
+}
+
 type RepostRecord struct {
 	ID         uint `gorm:"primarykey"`
 	CreatedAt  time.Time
@@ -34,6 +51,49 @@ type RepostRecord struct {
 	Rkey       string
 }
 
+// CrawlQueueEntry is a crawl dispatcher job saved across a restart
+type CrawlQueueEntry struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	Uid        Uid `gorm:"uniqueindex"`
+	InitScrape bool
+	ForceFull  bool
+}
+
+// CrawlQueueEvent is a buffered catch-up event belonging to a saved crawl
+// job, stored as the CBOR of its commit
+type CrawlQueueEvent struct {
+	ID         uint `gorm:"primarykey"`
+	Uid        Uid  `gorm:"index"`
+	PDS        uint
+	Event      []byte
+	BufferedAt time.Time
+}
+
+// CrawlLimitBucket is the state of a crawl rate limit shared between indexer
+// instances. Next is the unix nano time at which the next fetch may start.
+type CrawlLimitBucket struct {
+	Key  string `gorm:"primarykey"`
+	Next int64
+}
+
+// PostGate holds the embedding rules an author has set on one of their posts
+type PostGate struct {
+	gorm.Model
+	Author           Uid    `gorm:"index:idx_postgate_rkey,unique"`
+	Rkey             string `gorm:"index:idx_postgate_rkey,unique"`
+	Post             uint   `gorm:"index"`
+	DisableEmbedding bool
+}
+
+// PostGateDetached records a post whose embed of a gated post was detached
+// by the gated post's author
+type PostGateDetached struct {
+	ID   uint `gorm:"primarykey"`
+	Gate uint `gorm:"index"`
+	Post uint `gorm:"index"`
+}
+
 type ActorInfo struct {
 	gorm.Model
 	Uid         Uid            `gorm:"uniqueindex"`
@@ -44,8 +104,17 @@ type ActorInfo struct {
 	Followers   int64
 	Posts       int64
 	Type        string
-	PDS         uint
+	PDS         uint `gorm:"index"`
 	ValidHandle bool `gorm:"default:true"`
+	AvatarCid   string
+	BannerCid   string
+	TakenDown   bool
+	Tombstoned  bool
+
+	// Status is the actor's self-declared app.bsky.actor.status, empty if
+	// they have none. It lapses at StatusExpiresAt, if set.
+	Status          string
+	StatusExpiresAt *time.Time
 }
 
 func (ai *ActorInfo) ActorRef() *bsky.ActorDefs_ProfileViewBasic {
@@ -87,7 +156,7 @@ type VoteRecord struct {
 	gorm.Model
 	Dir     VoteDir
 	Voter   Uid
-	Post    uint
+	Post    uint `gorm:"index"`
 	Created string
 	Rkey    string
 	Cid     string
@@ -95,12 +164,30 @@ type VoteRecord struct {
 
 type FollowRecord struct {
 	gorm.Model
-	Follower Uid
-	Target   Uid
-	Rkey     string
+	Follower Uid    `gorm:"index;uniqueIndex:idx_follow_follower_rkey"`
+	Target   Uid    `gorm:"index"`
+	Rkey     string `gorm:"uniqueIndex:idx_follow_follower_rkey"`
 	Cid      string
 }
 
+// BlockRecord is an app.bsky.graph.block record: 'blocker' blocked 'target'
+type BlockRecord struct {
+	gorm.Model
+	Blocker Uid    `gorm:"index;uniqueIndex:idx_block_blocker_rkey"`
+	Target  Uid    `gorm:"index"`
+	Rkey    string `gorm:"uniqueIndex:idx_block_blocker_rkey"`
+	Cid     string
+}
+
+// ActorMute records that 'muter' muted 'subject'. Mutes are private to the
+// muter and never appear in their repo.
+type ActorMute struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Muter     Uid `gorm:"uniqueIndex:idx_actormute_muter_subject"`
+	Subject   Uid `gorm:"uniqueIndex:idx_actormute_muter_subject"`
+}
+
 type PDS struct {
 	gorm.Model
 
@@ -112,6 +199,15 @@ type PDS struct {
 	Blocked        bool
 	RateLimit      float64
 	CrawlRateLimit float64
+
+	// Comma separated, as advertised by the PDS's describeServer
+	UserDomains string
+
+	// What the PDS reports running. InfoUpdatedAt is when we last asked,
+	// whether or not it answered
+	Software      string
+	Version       string
+	InfoUpdatedAt time.Time
 }
 
 func ClientForPds(pds *PDS) *xrpc.Client {
@@ -129,11 +225,13 @@ func ClientForPds(pds *PDS) *xrpc.Client {
 // The CreatedAt column corresponds to the 'cat' timestamp on label records. The UpdatedAt column is database-specific.
 //
 // NOTE: to get fast string-prefix queries on Uri via the idx_uri_src_val_cid index, it is important that the PostgreSQL LC_COLLATE="C"
+//
+// NULL cids never collide in idx_uri_src_val_cid, so labels on whole repos (which have no cid) are kept unique by the partial idx_uri_src_val_nocid index instead
 type Label struct {
 	ID        uint64  `gorm:"primaryKey"`
-	Uri       string  `gorm:"uniqueIndex:idx_uri_src_val_cid;not null"`
-	SourceDid string  `gorm:"uniqueIndex:idx_uri_src_val_cid;uniqueIndex:idx_src_rkey;not null"`
-	Val       string  `gorm:"uniqueIndex:idx_uri_src_val_cid;not null"`
+	Uri       string  `gorm:"uniqueIndex:idx_uri_src_val_cid;uniqueIndex:idx_uri_src_val_nocid,where:cid IS NULL;not null"`
+	SourceDid string  `gorm:"uniqueIndex:idx_uri_src_val_cid;uniqueIndex:idx_uri_src_val_nocid,where:cid IS NULL;uniqueIndex:idx_src_rkey;not null"`
+	Val       string  `gorm:"uniqueIndex:idx_uri_src_val_cid;uniqueIndex:idx_uri_src_val_nocid,where:cid IS NULL;not null"`
 	Cid       *string `gorm:"uniqueIndex:idx_uri_src_val_cid"`
 	Neg       *bool
 	RepoRKey  *string `gorm:"uniqueIndex:idx_src_rkey"`
@@ -145,3 +243,8 @@ type DomainBan struct {
 	gorm.Model
 	Domain string
 }
+
+type DomainAllow struct {
+	gorm.Model
+	Domain string
+}
@@ -17,6 +17,9 @@ type ModerationAction struct {
 	ReversedAt     *time.Time
 	ReversedByDid  *string
 	ReversedReason *string
+	// comma-separated label values
+	CreateLabelVals string
+	NegateLabelVals string
 }
 
 type ModerationActionSubjectBlobCid struct {
@@ -45,3 +48,11 @@ type ModerationReportResolution struct {
 	CreatedAt    time.Time `gorm:"not null"`
 	CreatedByDid string    `gorm:"not null"`
 }
+
+// Records a client-supplied idempotency key for a takeModerationAction
+// request, so that retries return the original action instead of a duplicate
+type ModerationActionIdempotencyKey struct {
+	IdempotencyKey string    `gorm:"primaryKey"`
+	ActionId       uint64    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"not null;index"`
+}
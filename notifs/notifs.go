@@ -16,6 +16,8 @@ import (
 
 type NotificationManager interface {
 	GetNotifications(ctx context.Context, user models.Uid) ([]*appbskytypes.NotificationListNotifications_Notification, error)
+	ListNotifRecords(ctx context.Context, user models.Uid, before uint, limit int) ([]*NotifRecord, error)
+	GetLastSeen(ctx context.Context, user models.Uid) (time.Time, error)
 	GetCount(ctx context.Context, user models.Uid) (int64, error)
 	UpdateSeen(ctx context.Context, usr models.Uid, seen time.Time) error
 	AddReplyTo(ctx context.Context, user models.Uid, replyid uint, replyto *models.FeedPost) error
@@ -54,8 +56,12 @@ const (
 )
 
 type NotifRecord struct {
-	gorm.Model
-	For     models.Uid
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index:idx_notif_for_created,priority:2"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	For     models.Uid `gorm:"index:idx_notif_for_created,priority:1"`
 	Kind    int64
 	Record  uint
 	Who     models.Uid
@@ -293,16 +299,44 @@ func (nm *DBNotifMan) hydrateNotificationFollow(ctx context.Context, nrec *Notif
 
 }
 
-func (nm *DBNotifMan) GetCount(ctx context.Context, user models.Uid) (int64, error) {
-	// TODO: sql count is inefficient
-	var lseen time.Time
-	if err := nm.db.Model(NotifSeen{}).Where("usr = ?", user).Select("last_seen").Scan(&lseen).Error; err != nil {
-		return 0, err
+// ListNotifRecords returns the raw notification records for the given user,
+// newest first. If before is non-zero, only records with a lower ID are
+// returned.
+func (nm *DBNotifMan) ListNotifRecords(ctx context.Context, user models.Uid, before uint, limit int) ([]*NotifRecord, error) {
+	q := nm.db.Where(&NotifRecord{For: user})
+	if before != 0 {
+		q = q.Where("id < ?", before)
 	}
 
+	var out []*NotifRecord
+	if err := q.Order("id desc").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (nm *DBNotifMan) GetLastSeen(ctx context.Context, user models.Uid) (time.Time, error) {
+	var lastSeen time.Time
+	if err := nm.db.Model(NotifSeen{}).Where("usr = ?", user).Select("last_seen").Scan(&lastSeen).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	return lastSeen, nil
+}
+
+// GetCount returns the number of notifications the user has received since
+// they last marked their notifications as seen, not counting any they caused
+// themselves.
+func (nm *DBNotifMan) GetCount(ctx context.Context, user models.Uid) (int64, error) {
+	lastSeen := nm.db.Model(&NotifSeen{}).Select("last_seen").Where("usr = ?", user)
+
 	var c int64
-	//seen := nm.db.Model(NotifSeen{}).Where("usr = ?", user).Select("last_seen")
-	if err := nm.db.Model(NotifRecord{}).Where("for = ? AND created_at > ?", user, lseen).Count(&c).Error; err != nil {
+	if err := nm.db.WithContext(ctx).Model(&NotifRecord{}).
+		Where(&NotifRecord{For: user}).
+		Where("who <> ?", user).
+		Where("created_at > COALESCE((?), ?)", lastSeen, time.Time{}).
+		Count(&c).Error; err != nil {
 		return 0, err
 	}
 
@@ -313,7 +347,7 @@ func (nm *DBNotifMan) UpdateSeen(ctx context.Context, usr models.Uid, seen time.
 	if err := nm.db.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "usr"}},
 		DoUpdates: clause.AssignmentColumns([]string{"last_seen"}),
-	}).Create(NotifSeen{
+	}).Create(&NotifSeen{
 		Usr:      usr,
 		LastSeen: seen,
 	}).Error; err != nil {
@@ -18,6 +18,14 @@ func (nn *NullNotifs) GetNotifications(ctx context.Context, user models.Uid) ([]
 	return nil, fmt.Errorf("no notifications engine loaded")
 }
 
+func (nn *NullNotifs) ListNotifRecords(ctx context.Context, user models.Uid, before uint, limit int) ([]*NotifRecord, error) {
+	return nil, fmt.Errorf("no notifications engine loaded")
+}
+
+func (nn *NullNotifs) GetLastSeen(ctx context.Context, user models.Uid) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("no notifications engine loaded")
+}
+
 func (nn *NullNotifs) GetCount(ctx context.Context, user models.Uid) (int64, error) {
 	return 0, fmt.Errorf("no notifications engine loaded")
 }
@@ -3,8 +3,6 @@ package pds
 import (
 	"context"
 	"fmt"
-	"sort"
-	"strings"
 	"time"
 
 	bsky "github.com/bluesky-social/indigo/api/bsky"
@@ -179,38 +177,37 @@ func (fg *FeedGenerator) getPostViewerState(ctx context.Context, item uint, view
 	return &out, nil
 }
 
-func (fg *FeedGenerator) GetTimeline(ctx context.Context, user *User, algo string, before string, limit int) ([]*bsky.FeedDefs_FeedViewPost, error) {
+func (fg *FeedGenerator) GetTimeline(ctx context.Context, user *User, algo string, before string, limit int) ([]*bsky.FeedDefs_FeedViewPost, string, error) {
 	ctx, span := otel.Tracer("feedgen").Start(context.Background(), "GetTimeline")
 	defer span.End()
 
-	// TODO: this query is just a temporary hack...
-	var feed []*models.FeedPost
-	if err := fg.db.Debug().Find(&feed, "author in (?)",
-		fg.db.Model(models.FollowRecord{}).Where("follower = ?", user.ID).Select("target"),
-	).Error; err != nil {
-		return nil, err
-	}
-
-	var rps []*models.RepostRecord
-	if err := fg.db.Debug().Find(&rps, "reposter in (?)",
-		fg.db.Model(models.FollowRecord{}).Where("follower = ?", user.ID).Select("target"),
-	).Error; err != nil {
-		return nil, err
-	}
-
-	fout, err := fg.hydrateFeed(ctx, feed, rps)
+	items, cursor, err := fg.ix.GetTimeline(ctx, user.ID, before, limit)
 	if err != nil {
-		return nil, fmt.Errorf("hydrating feed: %w", err)
+		return nil, "", err
 	}
 
-	sort.Slice(fout, func(i, j int) bool {
-		ti, _ := time.Parse(time.RFC3339, fout[i].Post.IndexedAt)
-		tj, _ := time.Parse(time.RFC3339, fout[j].Post.IndexedAt)
+	out := make([]*bsky.FeedDefs_FeedViewPost, 0, len(items))
+	for _, it := range items {
+		fvp, err := fg.hydrateItem(ctx, it.Post)
+		if err != nil {
+			return nil, "", fmt.Errorf("hydrating feed: %w", err)
+		}
+
+		vs := &bsky.FeedDefs_ViewerState{}
+		if it.Viewer != nil {
+			if it.Viewer.Like != "" {
+				vs.Like = &it.Viewer.Like
+			}
+			if it.Viewer.Repost != "" {
+				vs.Repost = &it.Viewer.Repost
+			}
+		}
+		fvp.Post.Viewer = vs
 
-		return tj.Before(ti)
-	})
+		out = append(out, fvp)
+	}
 
-	return fg.personalizeFeed(ctx, fout, user)
+	return out, cursor, nil
 }
 
 func (fg *FeedGenerator) personalizeFeed(ctx context.Context, feed []*bsky.FeedDefs_FeedViewPost, viewer *User) ([]*bsky.FeedDefs_FeedViewPost, error) {
@@ -272,19 +269,7 @@ func (fg *FeedGenerator) GetActorProfileByID(ctx context.Context, actor uint) (*
 	return &ai, nil
 }
 func (fg *FeedGenerator) GetActorProfile(ctx context.Context, actor string) (*models.ActorInfo, error) {
-	fmt.Println("get actor profile: ", actor)
-	var ai models.ActorInfo
-	if strings.HasPrefix(actor, "did:") {
-		if err := fg.db.First(&ai, "did = ?", actor).Error; err != nil {
-			return nil, err
-		}
-	} else {
-		if err := fg.db.First(&ai, "handle = ?", actor).Error; err != nil {
-			return nil, err
-		}
-	}
-
-	return &ai, nil
+	return fg.ix.LookupActor(ctx, actor, false)
 }
 
 type ThreadPost struct {
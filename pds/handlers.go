@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	comatprototypes "github.com/bluesky-social/indigo/api/atproto"
@@ -143,13 +144,16 @@ func (s *Server) handleAppBskyFeedGetTimeline(ctx context.Context, algorithm str
 		return nil, err
 	}
 
-	tl, err := s.feedgen.GetTimeline(ctx, u, algorithm, before, limit)
+	tl, cursor, err := s.feedgen.GetTimeline(ctx, u, algorithm, before, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	var out appbskytypes.FeedGetTimeline_Output
 	out.Feed = tl
+	if cursor != "" {
+		out.Cursor = &cursor
+	}
 
 	return &out, nil
 }
@@ -474,7 +478,10 @@ func (s *Server) handleComAtprotoRepoPutRecord(ctx context.Context, input *comat
 
 func (s *Server) handleComAtprotoServerDescribeServer(ctx context.Context) (*comatprototypes.ServerDescribeServer_Output, error) {
 	invcode := false
+	host := strings.TrimPrefix(strings.TrimPrefix(s.serviceUrl, "https://"), "http://")
+
 	return &comatprototypes.ServerDescribeServer_Output{
+		Did:                "did:web:" + strings.ReplaceAll(host, ":", "%3A"),
 		InviteCodeRequired: &invcode,
 		AvailableUserDomains: []string{
 			s.handleSuffix,
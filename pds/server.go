@@ -143,7 +143,7 @@ func (s *Server) handleFedEvent(ctx context.Context, host *Peering, env *events.
 			u.ID = subj.Uid
 		}
 
-		return s.repoman.HandleExternalUserEvent(ctx, host.ID, u.ID, u.Did, evt.Since, evt.Rev, evt.Blocks, evt.Ops)
+		return s.repoman.HandleExternalUserEvent(ctx, host.ID, u.ID, u.Did, evt.Since, evt.Rev, evt.Time, evt.Blocks, evt.Ops)
 	default:
 		return fmt.Errorf("invalid fed event")
 	}
@@ -152,6 +152,9 @@ func (s *Server) handleFedEvent(ctx context.Context, host *Peering, env *events.
 func (s *Server) createExternalUser(ctx context.Context, did string) (*models.ActorInfo, error) {
 	doc, err := s.plc.GetDocument(ctx, did)
 	if err != nil {
+		if indexer.IsResolverFailure(did, err) {
+			return nil, fmt.Errorf("could not locate DID document for followed user: %w: %s", indexer.ErrDidResolution, err)
+		}
 		return nil, fmt.Errorf("could not locate DID document for followed user: %s", err)
 	}
 
@@ -659,6 +662,12 @@ func (s *Server) EventsHandler(c echo.Context) error {
 		case evt.RepoCommit != nil:
 			header.MsgType = "#commit"
 			obj = evt.RepoCommit
+		case evt.RepoSync != nil:
+			header.MsgType = "#sync"
+			obj = evt.RepoSync
+		case evt.RepoAccount != nil:
+			header.MsgType = "#account"
+			obj = evt.RepoAccount
 		case evt.RepoHandle != nil:
 			header.MsgType = "#handle"
 			obj = evt.RepoHandle
@@ -3,6 +3,7 @@ package repo
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -322,7 +323,7 @@ func (r *Repo) ForEach(ctx context.Context, prefix string, cb func(k string, v c
 	t := mst.LoadMST(r.cst, r.sc.Data)
 
 	if err := t.WalkLeavesFrom(ctx, prefix, cb); err != nil {
-		if err != ErrDoneIterating {
+		if !errors.Is(err, ErrDoneIterating) {
 			return err
 		}
 	}
@@ -334,6 +335,22 @@ func (r *Repo) GetRecord(ctx context.Context, rpath string) (cid.Cid, cbg.CBORMa
 	ctx, span := otel.Tracer("repo").Start(ctx, "GetRecord")
 	defer span.End()
 
+	cc, b, err := r.GetRecordBytes(ctx, rpath)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	rec, err := lexutil.CborDecodeValue(b)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	return cc, rec, nil
+}
+
+// GetRecordBytes returns the raw CBOR of the record at the given path, for
+// records whose type may not be registered with lexutil.
+func (r *Repo) GetRecordBytes(ctx context.Context, rpath string) (cid.Cid, []byte, error) {
 	mst, err := r.getMst(ctx)
 	if err != nil {
 		return cid.Undef, nil, fmt.Errorf("getting repo mst: %w", err)
@@ -349,12 +366,7 @@ func (r *Repo) GetRecord(ctx context.Context, rpath string) (cid.Cid, cbg.CBORMa
 		return cid.Undef, nil, err
 	}
 
-	rec, err := lexutil.CborDecodeValue(blk.RawData())
-	if err != nil {
-		return cid.Undef, nil, err
-	}
-
-	return cc, rec, nil
+	return cc, blk.RawData(), nil
 }
 
 func (r *Repo) DiffSince(ctx context.Context, oldrepo cid.Cid) ([]*mst.DiffOp, error) {
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,6 +19,15 @@ func s32encode(i uint64) string {
 	return s
 }
 
+// s32encodeLen is s32encode, left padded to n characters.
+func s32encodeLen(i uint64, n int) string {
+	s := s32encode(i)
+	if len(s) < n {
+		s = strings.Repeat(alpha[:1], n-len(s)) + s
+	}
+	return s
+}
+
 func init() {
 	clockId = uint64(rand.Int() & 0x1f)
 }
@@ -26,6 +36,23 @@ var lastTime uint64
 var clockId uint64
 var ltLock sync.Mutex
 
+// ValidTID reports whether s is a well-formed TID (as used for revs and
+// record keys): 13 characters of the sortable base32 alphabet, the first of
+// which can't have the top bit set.
+func ValidTID(s string) bool {
+	if len(s) != 13 || !strings.ContainsRune(alpha[:16], rune(s[0])) {
+		return false
+	}
+
+	for _, c := range s {
+		if !strings.ContainsRune(alpha, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func NextTID() string {
 	t := uint64(time.Now().UnixMicro())
 
@@ -37,5 +64,5 @@ func NextTID() string {
 	lastTime = t
 	ltLock.Unlock()
 
-	return s32encode(uint64(t)) + s32encode(clockId)
+	return s32encodeLen(uint64(t), 11) + s32encodeLen(clockId, 2)
 }
@@ -0,0 +1,31 @@
+package repo
+
+import "testing"
+
+func TestValidTID(t *testing.T) {
+	cases := []struct {
+		tid   string
+		valid bool
+	}{
+		{"3jzfcijpj2z2a", true},
+		{"2222222222222", true},
+		{"3jzfcijpj2z2", false},
+		{"3jzfcijpj2z2aa", false},
+		{"kjzfcijpj2z2a", false},
+		{"3jzfcijpj2z21", false},
+		{"3JZFCIJPJ2Z2A", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if ValidTID(c.tid) != c.valid {
+			t.Errorf("%q: expected valid=%v", c.tid, c.valid)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if tid := NextTID(); !ValidTID(tid) {
+			t.Fatalf("expected NextTID to produce a valid TID, got %q", tid)
+		}
+	}
+}
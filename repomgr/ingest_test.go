@@ -3,6 +3,7 @@ package repomgr
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,6 +17,8 @@ import (
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -128,7 +131,7 @@ func TestIngestWithGap(t *testing.T) {
 			},
 		}
 
-		if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, since, nrev, slice, ops); err != nil {
+		if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, since, nrev, "", slice, ops); err != nil {
 			t.Fatal(err)
 		}
 
@@ -151,6 +154,70 @@ func TestIngestWithGap(t *testing.T) {
 	}
 }
 
+func TestRejectRevRegression(t *testing.T) {
+	dir, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := testCarstore(t, dir)
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	dir2, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs2 := testCarstore(t, dir2)
+
+	type commit struct {
+		slice []byte
+		rev   string
+		ops   []*atproto.SyncSubscribeRepos_RepoOp
+	}
+
+	did := "did:plc:beepboop"
+	ctx := context.TODO()
+
+	var since *string
+	var commits []commit
+	for i := 0; i < 3; i++ {
+		slice, _, nrev, tid := doPost(t, cs2, did, since, i)
+		ops := []*atproto.SyncSubscribeRepos_RepoOp{
+			{
+				Action: "create",
+				Path:   "app.bsky.feed.post/" + tid,
+			},
+		}
+
+		if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, since, nrev, "", slice, ops); err != nil {
+			t.Fatal(err)
+		}
+
+		commits = append(commits, commit{slice: slice, rev: nrev, ops: ops})
+		since = &nrev
+	}
+
+	for _, c := range []commit{commits[0], commits[2]} {
+		err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, nil, c.rev, "", c.slice, c.ops)
+		if !errors.Is(err, ErrRevNotAdvanced) {
+			t.Fatalf("expected replay of %s to be rejected, got %v", c.rev, err)
+		}
+	}
+
+	rev, err := cs.GetUserRepoRev(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != commits[2].rev {
+		t.Fatalf("expected repo to stay at %s, got %s", commits[2].rev, rev)
+	}
+
+	repoman.SetAllowRevRegressions(true)
+	if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, nil, commits[0].rev, "", commits[0].slice, commits[0].ops); err != nil {
+		t.Fatalf("expected re-import to be allowed: %s", err)
+	}
+}
+
 func doPost(t *testing.T, cs *carstore.CarStore, did string, prev *string, postid int) ([]byte, cid.Cid, string, string) {
 	ctx := context.TODO()
 	ds, err := cs.NewDeltaSession(ctx, 1, prev)
@@ -235,3 +302,219 @@ func TestDuplicateRecord(t *testing.T) {
 	_ = c
 	_ = rec
 }
+
+func TestGetRecordAtCommit(t *testing.T) {
+	dir, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := testCarstore(t, dir)
+
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	ctx := context.TODO()
+	if err := repoman.InitNewActor(ctx, 1, "hello.world", "did:plc:foobar", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _, err := repoman.CreateRecord(ctx, 1, "app.bsky.feed.post", &bsky.FeedPost{
+		Text: "first version",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rkey := strings.Split(p, "/")[1]
+
+	oldHead, err := cs.GetUserRepoHead(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repoman.DeleteRecord(ctx, 1, "app.bsky.feed.post", rkey); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rec, err := repoman.GetRecordAtCommit(ctx, 1, "app.bsky.feed.post", rkey, oldHead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt := rec.(*bsky.FeedPost).Text; txt != "first version" {
+		t.Fatalf("expected record from old commit, got %q", txt)
+	}
+
+	if _, _, err := repoman.GetRecord(ctx, 1, "app.bsky.feed.post", rkey, cid.Undef); err == nil {
+		t.Fatal("expected deleted record to be missing from current repo")
+	}
+
+	_, _, err = repoman.GetRecordAtCommit(ctx, 1, "app.bsky.feed.post", "nonexistent", oldHead)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("expected ErrRecordNotFound, got %v", err)
+	}
+
+	unknown, err := cid.Decode("bafyreie5cvv4h45feadgeuwhbcutmh6t2ceseocckahdoe6uat64zmz454")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = repoman.GetRecordAtCommit(ctx, 1, "app.bsky.feed.post", rkey, unknown)
+	if !errors.Is(err, ErrHistoricalReadUnsupported) {
+		t.Fatalf("expected ErrHistoricalReadUnsupported, got %v", err)
+	}
+}
+
+func TestGetRecordAtCommitEquivalentCids(t *testing.T) {
+	dir, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := testCarstore(t, dir)
+
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	ctx := context.TODO()
+	if err := repoman.InitNewActor(ctx, 1, "hello.world", "did:plc:foobar", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _, err := repoman.CreateRecord(ctx, 1, "app.bsky.feed.post", &bsky.FeedPost{
+		Text: "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rkey := strings.Split(p, "/")[1]
+
+	head, err := cs.GetUserRepoHead(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b58, err := head.StringOfBase(multibase.Base58BTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebased, err := cid.Decode(b58)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]cid.Cid{
+		"base58":    rebased,
+		"v0":        cid.NewCidV0(head.Hash()),
+		"raw codec": cid.NewCidV1(cid.Raw, head.Hash()),
+	} {
+		_, rec, err := repoman.GetRecordAtCommit(ctx, 1, "app.bsky.feed.post", rkey, c)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if txt := rec.(*bsky.FeedPost).Text; txt != "hello" {
+			t.Fatalf("%s: unexpected record %q", name, txt)
+		}
+	}
+
+	other, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_512}.Sum([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repoman.GetRecordAtCommit(ctx, 1, "app.bsky.feed.post", rkey, other); !errors.Is(err, ErrInvalidCommitCid) {
+		t.Fatalf("expected ErrInvalidCommitCid, got %v", err)
+	}
+}
+
+func TestCountRecords(t *testing.T) {
+	dir, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := testCarstore(t, dir)
+
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	ctx := context.TODO()
+	if err := repoman.InitNewActor(ctx, 1, "hello.world", "did:plc:foobar", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := repoman.CountRecords(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := repoman.CreateRecord(ctx, 1, "app.bsky.feed.post", &bsky.FeedPost{
+			Text: fmt.Sprintf("post %d", i),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := repoman.CountRecords(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := counts["app.bsky.feed.post"] - before["app.bsky.feed.post"]; n != 3 {
+		t.Fatalf("expected 3 new posts, got %d", n)
+	}
+}
+
+func TestListRecords(t *testing.T) {
+	dir, err := os.MkdirTemp("", "integtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := testCarstore(t, dir)
+
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	ctx := context.TODO()
+	if err := repoman.InitNewActor(ctx, 1, "hello.world", "did:plc:foobar", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var rkeys []string
+	for i := 0; i < 5; i++ {
+		p, _, err := repoman.CreateRecord(ctx, 1, "app.bsky.feed.post", &bsky.FeedPost{
+			Text: fmt.Sprintf("post %d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rkeys = append(rkeys, strings.Split(p, "/")[1])
+	}
+
+	// records in a neighbouring collection are not listed
+	if _, _, err := repoman.CreateRecord(ctx, 1, "app.bsky.feed.repost", &bsky.FeedRepost{
+		Subject: &atproto.RepoStrongRef{Uri: "at://did:plc:foobar/app.bsky.feed.post/" + rkeys[0]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []string
+	cursor := ""
+	for {
+		page, err := repoman.ListRecords(ctx, 1, "app.bsky.feed.post", cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, e := range page {
+			listed = append(listed, e.Rkey)
+		}
+		cursor = page[len(page)-1].Rkey
+	}
+
+	if len(listed) != len(rkeys) {
+		t.Fatalf("expected %d records, got %v", len(rkeys), listed)
+	}
+	for i := range rkeys {
+		if listed[i] != rkeys[i] {
+			t.Fatalf("expected records in rkey order %v, got %v", rkeys, listed)
+		}
+	}
+}
@@ -9,3 +9,8 @@ var repoOpsImported = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "repomgr_repo_ops_imported",
 	Help: "Number of repo ops imported",
 })
+
+var revRegressionsRejected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "repomgr_rev_regressions_rejected",
+	Help: "Number of external commits rejected for not advancing the repo rev",
+})
@@ -8,6 +8,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"time"
 
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	bsky "github.com/bluesky-social/indigo/api/bsky"
@@ -23,6 +24,7 @@ import (
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-car"
+	"github.com/multiformats/go-multihash"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	"go.opentelemetry.io/otel"
 	"gorm.io/gorm"
@@ -56,6 +58,8 @@ type RepoManager struct {
 	userLocks map[models.Uid]*userLock
 
 	events func(context.Context, *RepoEvent)
+
+	allowRevRegressions bool
 }
 
 type ActorInfo struct {
@@ -74,6 +78,10 @@ type RepoEvent struct {
 	RepoSlice []byte
 	PDS       uint
 	Ops       []RepoOp
+
+	// Time is the timestamp of the upstream firehose event this was applied
+	// from, empty for local writes and repo imports
+	Time string
 }
 
 type RepoOp struct {
@@ -83,6 +91,12 @@ type RepoOp struct {
 	RecCid     *cid.Cid
 	Record     any
 	ActorInfo  *ActorInfo
+
+	// RecordBytes holds the raw CBOR of the record as read from the repo,
+	// for checking it against RecCid. It is all there is of records whose
+	// type isn't registered with lexutil, in which case Record is nil. Ops
+	// of local writes don't carry it.
+	RecordBytes []byte
 }
 
 type EventKind string
@@ -395,6 +409,25 @@ func (rm *RepoManager) GetRepoRoot(ctx context.Context, user models.Uid) (cid.Ci
 	return rm.cs.GetUserRepoHead(ctx, user)
 }
 
+// GetRepoRoots fetches the roots of many repos at once. Unlike GetRepoRoot
+// this does not take the per-user locks, so a root may be slightly stale if
+// a write is in progress.
+func (rm *RepoManager) GetRepoRoots(ctx context.Context, users []models.Uid) (map[models.Uid]cid.Cid, error) {
+	return rm.cs.GetUserRepoHeads(ctx, users)
+}
+
+// GetLatestCommits fetches the root and rev of many repos at once, without
+// taking the per-user locks, same as GetRepoRoots.
+func (rm *RepoManager) GetLatestCommits(ctx context.Context, users []models.Uid) (map[models.Uid]carstore.RepoCommit, error) {
+	return rm.cs.GetUserRepoCommits(ctx, users)
+}
+
+// ReposUpdatedSince lists, in order, up to limit of the users after the given
+// one whose repos have had a commit stored since the given time.
+func (rm *RepoManager) ReposUpdatedSince(ctx context.Context, since time.Time, after models.Uid, limit int) ([]models.Uid, error) {
+	return rm.cs.ReposUpdatedSince(ctx, since, after, limit)
+}
+
 func (rm *RepoManager) GetRepoRev(ctx context.Context, user models.Uid) (string, error) {
 	unlock := rm.lockUser(ctx, user)
 	defer unlock()
@@ -406,6 +439,14 @@ func (rm *RepoManager) ReadRepo(ctx context.Context, user models.Uid, since stri
 	return rm.cs.ReadUserCar(ctx, user, since, true, w)
 }
 
+func (rm *RepoManager) HasHistorySince(ctx context.Context, user models.Uid, since string) (bool, error) {
+	return rm.cs.HasHistorySince(ctx, user, since)
+}
+
+func (rm *RepoManager) CountCommitsSince(ctx context.Context, user models.Uid, since string) (int64, error) {
+	return rm.cs.CountCommitsSince(ctx, user, since)
+}
+
 func (rm *RepoManager) GetRecord(ctx context.Context, user models.Uid, collection string, rkey string, maybeCid cid.Cid) (cid.Cid, cbg.CBORMarshaler, error) {
 	bs, err := rm.cs.ReadOnlySession(user)
 	if err != nil {
@@ -434,6 +475,211 @@ func (rm *RepoManager) GetRecord(ctx context.Context, user models.Uid, collectio
 	return ocid, val, nil
 }
 
+// ErrRecordNotFound is returned by GetRecordBytes and GetRecordAtCommit when
+// the user has no repo or no record at the given key.
+var ErrRecordNotFound = fmt.Errorf("record not found")
+
+// GetRecordBytes returns the current raw CBOR of a record, which unlike
+// GetRecord works for record types that aren't registered with lexutil.
+func (rm *RepoManager) GetRecordBytes(ctx context.Context, user models.Uid, collection string, rkey string) (cid.Cid, []byte, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "GetRecordBytes")
+	defer span.End()
+
+	head, err := rm.cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	if !head.Defined() {
+		return cid.Undef, nil, ErrRecordNotFound
+	}
+
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	r, err := repo.OpenRepo(ctx, bs, head, true)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	ocid, b, err := r.GetRecordBytes(ctx, collection+"/"+rkey)
+	if err != nil {
+		if errors.Is(err, mst.ErrNotFound) {
+			return cid.Undef, nil, ErrRecordNotFound
+		}
+		return cid.Undef, nil, err
+	}
+
+	return ocid, b, nil
+}
+
+// CountRecords walks the user's current repo and returns the number of
+// records in each collection.
+func (rm *RepoManager) CountRecords(ctx context.Context, user models.Uid) (map[string]int64, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "CountRecords")
+	defer span.End()
+
+	out := make(map[string]int64)
+
+	head, err := rm.cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !head.Defined() {
+		return out, nil
+	}
+
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := repo.OpenRepo(ctx, bs, head, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		collection, _, _ := strings.Cut(k, "/")
+		out[collection]++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// RecordEntry is a record's key within its collection and the CID of its
+// current version.
+type RecordEntry struct {
+	Rkey string
+	Cid  cid.Cid
+}
+
+// ListRecords returns up to limit records of a collection in the user's
+// current repo, in rkey order, starting after the given rkey. Only the MST is
+// walked; the records themselves aren't read.
+func (rm *RepoManager) ListRecords(ctx context.Context, user models.Uid, collection string, after string, limit int) ([]RecordEntry, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "ListRecords")
+	defer span.End()
+
+	head, err := rm.cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !head.Defined() {
+		return nil, nil
+	}
+
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := repo.OpenRepo(ctx, bs, head, true)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := collection + "/"
+	var out []RecordEntry
+	if err := r.ForEach(ctx, prefix+after, func(k string, v cid.Cid) error {
+		if !strings.HasPrefix(k, prefix) || len(out) >= limit {
+			return repo.ErrDoneIterating
+		}
+
+		rkey := k[len(prefix):]
+		if rkey == after {
+			return nil
+		}
+
+		out = append(out, RecordEntry{Rkey: rkey, Cid: v})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ErrHistoricalReadUnsupported is returned by GetRecordAtCommit when the
+// requested commit is no longer (or never was) retained by the repo store.
+var ErrHistoricalReadUnsupported = fmt.Errorf("historical reads not supported for this commit")
+
+// ErrInvalidCommitCid is returned by GetRecordAtCommit for CIDs that can't
+// name a repo commit in any encoding.
+var ErrInvalidCommitCid = fmt.Errorf("cid cannot refer to a repo commit")
+
+// canonicalCommitCid returns the CID commits are stored under, a dag-cbor
+// CIDv1, for a CID naming the same content. Clients sometimes send the hash
+// of a commit as a CIDv0 or tagged with another codec. Hashes other than
+// sha2-256 are never used for commits.
+func canonicalCommitCid(c cid.Cid) (cid.Cid, error) {
+	dmh, err := multihash.Decode(c.Hash())
+	if err != nil {
+		return cid.Undef, fmt.Errorf("%w: %s", ErrInvalidCommitCid, err)
+	}
+	if dmh.Code != multihash.SHA2_256 {
+		return cid.Undef, fmt.Errorf("%w: hashed with %s", ErrInvalidCommitCid, multihash.Codes[dmh.Code])
+	}
+
+	if c.Version() == 1 && c.Type() == cid.DagCBOR {
+		return c, nil
+	}
+	return cid.NewCidV1(cid.DagCBOR, c.Hash()), nil
+}
+
+// GetRecordAtCommit returns the record as it existed in the given commit of
+// the user's repo, rather than its current version. The commit may be given
+// in any CID version or encoding that carries its hash.
+func (rm *RepoManager) GetRecordAtCommit(ctx context.Context, user models.Uid, collection string, rkey string, commit cid.Cid) (cid.Cid, cbg.CBORMarshaler, error) {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "GetRecordAtCommit")
+	defer span.End()
+
+	commit, err := canonicalCommitCid(commit)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	ok, err := rm.cs.HasCommit(ctx, user, commit)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	if !ok {
+		return cid.Undef, nil, ErrHistoricalReadUnsupported
+	}
+
+	bs, err := rm.cs.ReadOnlySession(user)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+
+	r, err := repo.OpenRepo(ctx, bs, commit, true)
+	if err != nil {
+		if ipld.IsNotFound(err) {
+			return cid.Undef, nil, ErrHistoricalReadUnsupported
+		}
+		return cid.Undef, nil, err
+	}
+
+	ocid, val, err := r.GetRecord(ctx, collection+"/"+rkey)
+	if err != nil {
+		if errors.Is(err, mst.ErrNotFound) {
+			return cid.Undef, nil, ErrRecordNotFound
+		}
+		// the commit itself is retained, but parts of its tree may have been
+		// dropped by compaction
+		if ipld.IsNotFound(err) {
+			return cid.Undef, nil, ErrHistoricalReadUnsupported
+		}
+		return cid.Undef, nil, err
+	}
+
+	return ocid, val, nil
+}
+
 func (rm *RepoManager) GetProfile(ctx context.Context, uid models.Uid) (*bsky.ActorProfile, error) {
 	bs, err := rm.cs.ReadOnlySession(uid)
 	if err != nil {
@@ -486,7 +732,30 @@ func (rm *RepoManager) CheckRepoSig(ctx context.Context, r *repo.Repo, expdid st
 	return nil
 }
 
-func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint, uid models.Uid, did string, since *string, nrev string, carslice []byte, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
+// ErrRevNotAdvanced is returned for external commits whose rev is not newer
+// than the rev of the repo we hold.
+var ErrRevNotAdvanced = fmt.Errorf("commit rev does not advance the repo")
+
+// SetAllowRevRegressions lets external commits through whose rev doesn't
+// advance the rev we hold, for operators intentionally re-importing repos.
+// By default they are rejected with ErrRevNotAdvanced, so a misbehaving PDS
+// can't roll a repo back by replaying or backdating commits.
+func (rm *RepoManager) SetAllowRevRegressions(allow bool) {
+	rm.allowRevRegressions = allow
+}
+
+func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint, uid models.Uid, did string, since *string, nrev string, etime string, carslice []byte, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
+	slice, err := carstore.DecodeSlice(carslice)
+	if err != nil {
+		return fmt.Errorf("importing external carslice: %w", err)
+	}
+
+	return rm.HandleDecodedExternalUserEvent(ctx, pdsid, uid, did, since, nrev, etime, slice, ops)
+}
+
+// HandleDecodedExternalUserEvent is HandleExternalUserEvent for a car slice
+// that was already decoded with carstore.DecodeSlice.
+func (rm *RepoManager) HandleDecodedExternalUserEvent(ctx context.Context, pdsid uint, uid models.Uid, did string, since *string, nrev string, etime string, slice *carstore.DecodedSlice, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
 	ctx, span := otel.Tracer("repoman").Start(ctx, "HandleExternalUserEvent")
 	defer span.End()
 
@@ -495,7 +764,18 @@ func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint,
 	unlock := rm.lockUser(ctx, uid)
 	defer unlock()
 
-	root, ds, err := rm.cs.ImportSlice(ctx, uid, since, carslice)
+	if !rm.allowRevRegressions {
+		cur, err := rm.cs.GetUserRepoRev(ctx, uid)
+		if err != nil {
+			return fmt.Errorf("getting current repo rev: %w", err)
+		}
+		if cur != "" && nrev <= cur {
+			revRegressionsRejected.Inc()
+			return fmt.Errorf("%w: %q is not newer than %q", ErrRevNotAdvanced, nrev, cur)
+		}
+	}
+
+	root, ds, err := rm.cs.ImportDecodedSlice(ctx, uid, since, slice)
 	if err != nil {
 		return fmt.Errorf("importing external carslice: %w", err)
 	}
@@ -519,31 +799,25 @@ func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint,
 
 		switch EventKind(op.Action) {
 		case EvtKindCreateRecord:
-			recid, rec, err := r.GetRecord(ctx, op.Path)
+			rop, err := readChangedRecord(ctx, r, op.Path)
 			if err != nil {
-				return fmt.Errorf("reading changed record from car slice: %w", err)
+				return err
 			}
 
-			evtops = append(evtops, RepoOp{
-				Kind:       EvtKindCreateRecord,
-				Collection: parts[0],
-				Rkey:       parts[1],
-				Record:     rec,
-				RecCid:     &recid,
-			})
+			rop.Kind = EvtKindCreateRecord
+			rop.Collection = parts[0]
+			rop.Rkey = parts[1]
+			evtops = append(evtops, *rop)
 		case EvtKindUpdateRecord:
-			recid, rec, err := r.GetRecord(ctx, op.Path)
+			rop, err := readChangedRecord(ctx, r, op.Path)
 			if err != nil {
-				return fmt.Errorf("reading changed record from car slice: %w", err)
+				return err
 			}
 
-			evtops = append(evtops, RepoOp{
-				Kind:       EvtKindUpdateRecord,
-				Collection: parts[0],
-				Rkey:       parts[1],
-				Record:     rec,
-				RecCid:     &recid,
-			})
+			rop.Kind = EvtKindUpdateRecord
+			rop.Collection = parts[0]
+			rop.Rkey = parts[1]
+			evtops = append(evtops, *rop)
 		case EvtKindDeleteRecord:
 			evtops = append(evtops, RepoOp{
 				Kind:       EvtKindDeleteRecord,
@@ -570,6 +844,7 @@ func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint,
 			Ops:       evtops,
 			RepoSlice: rslice,
 			PDS:       pdsid,
+			Time:      etime,
 		})
 	}
 
@@ -697,6 +972,10 @@ func (rm *RepoManager) ImportNewRepo(ctx context.Context, user models.Uid, repoD
 	unlock := rm.lockUser(ctx, user)
 	defer unlock()
 
+	if err := rm.rollbackInterruptedImport(ctx, user); err != nil {
+		return err
+	}
+
 	currev, err := rm.cs.GetUserRepoRev(ctx, user)
 	if err != nil {
 		return err
@@ -712,6 +991,10 @@ func (rm *RepoManager) ImportNewRepo(ctx context.Context, user models.Uid, repoD
 		return fmt.Errorf("ImportNewRepo called with incorrect base")
 	}
 
+	if err := rm.cs.BeginImport(ctx, user); err != nil {
+		return fmt.Errorf("marking import start: %w", err)
+	}
+
 	err = rm.processNewRepo(ctx, user, r, rev, func(ctx context.Context, root cid.Cid, finish func(context.Context, string) ([]byte, error), bs blockstore.Blockstore) error {
 		r, err := repo.OpenRepo(ctx, bs, root, true)
 		if err != nil {
@@ -767,12 +1050,66 @@ func (rm *RepoManager) ImportNewRepo(ctx context.Context, user models.Uid, repoD
 		return nil
 	})
 	if err != nil {
+		// undo anything this attempt managed to write so a retry starts from
+		// the same base
+		if rerr := rm.rollbackInterruptedImport(ctx, user); rerr != nil {
+			log.Errorw("failed to roll back failed import", "uid", user, "err", rerr)
+		}
 		return fmt.Errorf("process new repo (current rev: %s): %w:", currev, err)
 	}
 
+	if err := rm.cs.FinishImport(ctx, user); err != nil {
+		return fmt.Errorf("marking import finished: %w", err)
+	}
+
 	return nil
 }
 
+// RecoverInterruptedImport cleans up after an ImportNewRepo for the given user
+// that was interrupted (e.g. by a crash) before it finished, so that the next
+// import starts from the repo state prior to the interrupted one.
+func (rm *RepoManager) RecoverInterruptedImport(ctx context.Context, user models.Uid) error {
+	unlock := rm.lockUser(ctx, user)
+	defer unlock()
+
+	return rm.rollbackInterruptedImport(ctx, user)
+}
+
+func (rm *RepoManager) rollbackInterruptedImport(ctx context.Context, user models.Uid) error {
+	rolledBack, err := rm.cs.RollbackInterruptedImport(ctx, user)
+	if err != nil {
+		return fmt.Errorf("rolling back interrupted import: %w", err)
+	}
+
+	if rolledBack {
+		log.Warnw("rolled back partially imported repo", "uid", user)
+	}
+
+	return nil
+}
+
+// readChangedRecord reads a created or updated record out of an event's repo
+// slice, keeping the raw CBOR of records we can't decode.
+func readChangedRecord(ctx context.Context, r *repo.Repo, rpath string) (*RepoOp, error) {
+	recid, b, err := r.GetRecordBytes(ctx, rpath)
+	if err != nil {
+		return nil, fmt.Errorf("reading changed record from car slice: %w", err)
+	}
+
+	rop := &RepoOp{RecCid: &recid, RecordBytes: b}
+
+	rec, err := lexutil.CborDecodeValue(b)
+	if err != nil {
+		if !errors.Is(err, lexutil.ErrUnrecognizedType) {
+			return nil, fmt.Errorf("decoding changed record: %w", err)
+		}
+	} else {
+		rop.Record = rec
+	}
+
+	return rop, nil
+}
+
 func processOp(ctx context.Context, bs blockstore.Blockstore, op *mst.DiffOp) (*RepoOp, error) {
 	parts := strings.SplitN(op.Rpath, "/", 2)
 	if len(parts) != 2 {
@@ -792,10 +1129,11 @@ func processOp(ctx context.Context, bs blockstore.Blockstore, op *mst.DiffOp) (*
 		}
 
 		outop := &RepoOp{
-			Kind:       kind,
-			Collection: parts[0],
-			Rkey:       parts[1],
-			RecCid:     &op.NewCid,
+			Kind:        kind,
+			Collection:  parts[0],
+			Rkey:        parts[1],
+			RecCid:      &op.NewCid,
+			RecordBytes: blk.RawData(),
 		}
 
 		rec, err := lexutil.CborDecodeValue(blk.RawData())
@@ -28,3 +28,9 @@ func ParseAtUri(uri string) (*ParsedUri, error) {
 		Rkey:       parts[2],
 	}, nil
 }
+
+// BuildAtUri is the inverse of ParseAtUri, building the at:// uri of a record
+// from its parts.
+func BuildAtUri(did, collection, rkey string) string {
+	return "at://" + did + "/" + collection + "/" + rkey
+}
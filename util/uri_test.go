@@ -0,0 +1,19 @@
+package util
+
+import "testing"
+
+func TestBuildAtUriRoundTrip(t *testing.T) {
+	uri := BuildAtUri("did:plc:alice", "app.bsky.feed.post", "3k2aexample")
+	if uri != "at://did:plc:alice/app.bsky.feed.post/3k2aexample" {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+
+	puri, err := ParseAtUri(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if puri.Did != "did:plc:alice" || puri.Collection != "app.bsky.feed.post" || puri.Rkey != "3k2aexample" {
+		t.Fatalf("parsed uri does not match its parts: %+v", puri)
+	}
+}